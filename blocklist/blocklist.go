@@ -0,0 +1,172 @@
+// Package blocklist lists the hosts, and the parts of websites, that must not be
+// downloaded from. The list is read from a file that can be edited while a crawl is
+// running, so that a misbehaving third party found during the crawl can be cut off
+// without restarting it.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+)
+
+// Interval is how often the file is checked for changes.
+const Interval = 2 * time.Second
+
+// entry blocks a host, or the URLs on it whose paths start with a prefix. A host
+// starting with "*." also blocks its subdomains.
+type entry struct {
+	host   string
+	prefix string
+}
+
+func (e entry) blocks(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if domain, ok := strings.CutPrefix(e.host, "*."); ok {
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	} else if host != e.host {
+		return false
+	}
+
+	return e.prefix == "" || strings.HasPrefix(u.EscapedPath(), e.prefix)
+}
+
+// parse reads the entries of a blocklist, one per line. Each is a host, such as
+// "ads.example.net", a domain and its subdomains, such as "*.example.net", or either of
+// these followed by a path prefix, such as "example.org/calendar/". A scheme, such as
+// "https://", is ignored. Blank lines and comment lines, which start with '#', are
+// ignored.
+func parse(r io.Reader) ([]entry, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if i := strings.Index(line, "://"); i >= 0 {
+			line = line[i+3:]
+		}
+
+		host, prefix, hasPath := strings.Cut(line, "/")
+		if name := strings.TrimPrefix(host, "*."); name == "" || strings.ContainsAny(name, " \t*?") {
+			return nil, fmt.Errorf("line %d: %q is not a host", n, line)
+		}
+		if hasPath {
+			prefix = "/" + prefix
+		}
+		entries = append(entries, entry{host: strings.ToLower(host), prefix: prefix})
+	}
+	return entries, scanner.Err()
+}
+
+// List is a blocklist read from a file. It is safe for concurrent use. A nil List
+// blocks nothing.
+type List struct {
+	file    string
+	entries atomic.Pointer[[]entry]
+
+	mu       sync.Mutex
+	modified time.Time
+	size     int64
+}
+
+// Read reads the blocklist in file.
+func Read(file string) (*List, error) {
+	l := &List{file: file}
+	if _, err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Blocks reports whether u must not be downloaded.
+func (l *List) Blocks(u *url.URL) bool {
+	if l == nil {
+		return false
+	}
+
+	for _, e := range *l.entries.Load() {
+		if e.blocks(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len gets the number of entries.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(*l.entries.Load())
+}
+
+// Reload reads the file again if it has changed since it was last read. It reports
+// whether it did so. When the file cannot be read or is invalid, the entries are
+// unchanged.
+func (l *List) Reload() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.file)
+	if err != nil {
+		return false, fmt.Errorf("blocklist: %w", err)
+	}
+	if info.ModTime().Equal(l.modified) && info.Size() == l.size && l.entries.Load() != nil {
+		return false, nil
+	}
+
+	f, err := os.Open(l.file)
+	if err != nil {
+		return false, fmt.Errorf("blocklist: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := parse(f)
+	l.modified, l.size = info.ModTime(), info.Size() // an invalid file is reported once
+	if err != nil {
+		return false, fmt.Errorf("blocklist %s: %w", l.file, err)
+	}
+
+	l.entries.Store(&entries)
+	return true, nil
+}
+
+// Watch reloads the file whenever it changes, until ctx is done. Errors are logged,
+// leaving the previous entries in force until the file has been corrected.
+func (l *List) Watch(ctx context.Context, interval time.Duration, log *logger.Logger) {
+	if l == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := l.Reload()
+			if err != nil {
+				log.Error("Reloading blocklist", slog.Any("error", err))
+			} else if reloaded {
+				log.Info("Reloaded blocklist", slog.String("file", l.file), slog.Int("entries", l.Len()))
+			}
+		}
+	}
+}
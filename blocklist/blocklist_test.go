@@ -0,0 +1,93 @@
+package blocklist
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := parse(strings.NewReader(`
+# trackers
+ads.example.net
+*.Tracker.example
+https://example.org/calendar/
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []entry{
+		{host: "ads.example.net"},
+		{host: "*.tracker.example"},
+		{host: "example.org", prefix: "/calendar/"},
+	}, entries)
+
+	_, err = parse(strings.NewReader("ads.example.net\ncdn*.example.net\n"))
+	assert.EqualError(t, err, `line 2: "cdn*.example.net" is not a host`)
+}
+
+func TestBlocks(t *testing.T) {
+	l := &List{}
+	l.entries.Store(&[]entry{
+		{host: "ads.example.net"},
+		{host: "*.tracker.example"},
+		{host: "example.org", prefix: "/calendar/"},
+	})
+
+	cases := map[string]bool{
+		"https://ads.example.net/x.js":           true,
+		"https://ADS.example.net:8443/":          true,
+		"https://example.net/":                   false,
+		"https://tracker.example/pixel":          true,
+		"https://eu.tracker.example/pixel":       true,
+		"https://nottracker.example/":            false,
+		"https://example.org/calendar/2024/01/":  true,
+		"https://example.org/calendar":           false,
+		"https://example.org/about":              false,
+		"https://www.example.org/calendar/2024/": false,
+	}
+	for s, expected := range cases {
+		u, err := url.Parse(s)
+		require.NoError(t, err)
+		assert.Equal(t, expected, l.Blocks(u), s)
+	}
+
+	var none *List
+	assert.False(t, none.Blocks(&url.URL{Host: "ads.example.net"}))
+	assert.Zero(t, none.Len())
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(file, []byte("ads.example.net\n"), 0o644))
+
+	l, err := Read(file)
+	require.NoError(t, err)
+	assert.Equal(t, 1, l.Len())
+
+	reloaded, err := l.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged")
+
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(file, []byte("ads.example.net\ncdn*\n"), 0o644))
+	require.NoError(t, os.Chtimes(file, later, later))
+	_, err = l.Reload()
+	require.Error(t, err)
+	assert.Equal(t, 1, l.Len(), "the previous entries are kept")
+
+	later = later.Add(time.Minute)
+	require.NoError(t, os.WriteFile(file, []byte("ads.example.net\n*.tracker.example\n"), 0o644))
+	require.NoError(t, os.Chtimes(file, later, later))
+	reloaded, err = l.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.True(t, l.Blocks(&url.URL{Host: "eu.tracker.example"}))
+
+	_, err = Read(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,190 @@
+// Package bookmarklet accepts URLs posted from a bookmarklet in a browser, so that
+// the page being viewed can be archived with one click. Each URL is added to the
+// scrape in progress if it belongs to that website; otherwise, the page is captured
+// on its own, along with its assets.
+package bookmarklet
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+)
+
+// queueSize is the number of submitted pages that may wait to be captured.
+const queueSize = 100
+
+// Submitter adds a URL to a scrape while it runs, returning false if it was not added.
+// *scraper.Scraper is a Submitter.
+type Submitter interface {
+	Submit(u *url.URL) bool
+}
+
+// CaptureFunc downloads a page and its assets.
+type CaptureFunc func(ctx context.Context, u *url.URL) error
+
+// Server serves the bookmarklet and accepts the URLs that it posts. The bookmarklet
+// includes a random token, which stops other websites from posting URLs; so it has to
+// be added to the browser again each time the server is started. A nil Server does
+// nothing.
+type Server struct {
+	capture CaptureFunc
+	token   string
+	log     *logger.Logger
+
+	mu      sync.Mutex
+	current Submitter
+	queue   chan *url.URL
+}
+
+// New creates a server that captures the pages that cannot be added to a scrape.
+func New(capture CaptureFunc, log *logger.Logger) *Server {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &Server{capture: capture, token: hex.EncodeToString(b), log: log, queue: make(chan *url.URL, queueSize)}
+}
+
+// Watch makes the scrape the current one, to which URLs are submitted.
+func (s *Server) Watch(sub Submitter) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = sub
+}
+
+// Run serves on the listener and captures the pages submitted, one at a time, until
+// the context is done. The capture in progress is then cancelled, and any pages still
+// waiting are abandoned.
+func (s *Server) Run(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	stop := context.AfterFunc(ctx, func() {
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.captureAll(ctx)
+	}()
+
+	s.log.Info("Bookmarklet", slog.String("address", "http://"+listener.Addr().String()+"/"))
+	err := server.Serve(listener)
+	<-done
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) captureAll(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for len(s.queue) > 0 {
+				s.log.Warn("Not captured", slog.String("url", (<-s.queue).String()))
+			}
+			return
+
+		case u := <-s.queue:
+			s.log.Info("Capturing page", slog.String("url", u.String()))
+			if err := s.capture(ctx, u); err != nil && ctx.Err() == nil {
+				s.log.Error("Capture failed", slog.String("url", u.String()), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// ServeHTTP serves the page with the bookmarklet at / and accepts URLs at /submit.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		s.serveIndex(w, r)
+	case "/submit":
+		s.serveSubmit(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>goscrape bookmarklet</title></head>
+<body>
+<p>Drag this link to the bookmarks bar, then click it on any page to archive that page:
+<a href="%s">Archive with goscrape</a></p>
+</body></html>
+`, html.EscapeString(s.script("http://"+r.Host+"/submit")))
+}
+
+// script gets the bookmarklet, which posts the URL of the current page in a new tab.
+func (s *Server) script(action string) string {
+	return `javascript:(function(){var f=document.createElement('form');f.method='post';` +
+		`f.action=` + strconv.Quote(action) + `;f.target='_blank';` +
+		`[['url',location.href],['token',` + strconv.Quote(s.token) + `]].forEach(function(p){` +
+		`var i=document.createElement('input');i.type='hidden';i.name=p[0];i.value=p[1];f.appendChild(i);});` +
+		`document.body.appendChild(f);f.submit();f.remove();})();`
+}
+
+func (s *Server) serveSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(s.token)) != 1 {
+		http.Error(w, "The bookmarklet is out of date: add it again", http.StatusForbidden)
+		return
+	}
+
+	u, err := url.Parse(r.PostFormValue("url"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Only http and https pages can be archived", http.StatusBadRequest)
+		return
+	}
+	u.Fragment = ""
+
+	message, status := s.submit(u)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>goscrape</title></head>\n<body><p>%s: %s</p></body></html>\n",
+		message, html.EscapeString(u.String()))
+}
+
+// submit adds the URL to the current scrape, or else queues it to be captured.
+func (s *Server) submit(u *url.URL) (string, int) {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+
+	if current != nil && current.Submit(u) {
+		return "Added to the scrape", http.StatusOK
+	}
+
+	select {
+	case s.queue <- u:
+		s.log.Info("Queued page", slog.String("url", u.String()))
+		return "Queued to be captured", http.StatusAccepted
+	default:
+		return "Too many pages are waiting to be captured", http.StatusServiceUnavailable
+	}
+}
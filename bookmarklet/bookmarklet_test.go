@@ -0,0 +1,106 @@
+package bookmarklet
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape accepts the URLs of one host.
+type scrape struct {
+	host      string
+	submitted []string
+}
+
+func (s *scrape) Submit(u *url.URL) bool {
+	if u.Host != s.host {
+		return false
+	}
+	s.submitted = append(s.submitted, u.String())
+	return true
+}
+
+func post(t *testing.T, s *Server, form url.Values) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestSubmit(t *testing.T) {
+	var mu sync.Mutex
+	var captured []string
+	captures := make(chan struct{}, 2)
+	s := New(func(ctx context.Context, u *url.URL) error {
+		mu.Lock()
+		defer mu.Unlock()
+		captured = append(captured, u.String())
+		captures <- struct{}{}
+		return nil
+	}, logger.Discard())
+
+	current := &scrape{host: "example.org"}
+	s.Watch(current)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx, listener) }()
+
+	code, _ := post(t, s, url.Values{"url": {"https://example.org/news#latest"}, "token": {s.token}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"https://example.org/news"}, current.submitted)
+
+	code, body := post(t, s, url.Values{"url": {"https://other.example/article"}, "token": {s.token}})
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Contains(t, body, "Queued to be captured: https://other.example/article")
+	<-captures
+
+	code, _ = post(t, s, url.Values{"url": {"https://other.example/forged"}, "token": {"guess"}})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = post(t, s, url.Values{"url": {"javascript:alert(1)"}, "token": {s.token}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"https://other.example/article"}, captured)
+}
+
+func TestIndex(t *testing.T) {
+	s := New(nil, logger.Discard())
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `href="javascript:`)
+	assert.Contains(t, string(body), "f.action=&#34;"+server.URL+"/submit&#34;")
+	assert.Contains(t, string(body), s.token)
+
+	resp, err = http.Get(server.URL + "/submit")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
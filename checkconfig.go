@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/scraper"
+	"github.com/spf13/afero"
+)
+
+// configReport is the result of -checkconfig, which is written as JSON.
+type configReport struct {
+	Valid    bool            `json:"valid"`
+	Problems []configProblem `json:"problems"`
+}
+
+// configProblem is something that would make a scrape fail or misbehave.
+type configProblem struct {
+	Check   string `json:"check"` // one of url, options, scraper, directory or auth
+	Message string `json:"message"`
+}
+
+// checkConfig validates the command line without scraping anything: the URLs must parse,
+// the options must be consistent, the patterns, rules and cookies they contain must be
+// well-formed and the output directory must be writable. This finds the mistakes that
+// would otherwise only show up well into a long scrape. It writes a report to w and
+// returns the exit code.
+func checkConfig(w io.Writer, args Arguments, urls []string, log *logger.Logger) int {
+	report := configReport{Problems: []configProblem{}}
+	add := func(check string, err error) {
+		for _, e := range unjoin(err) {
+			report.Problems = append(report.Problems, configProblem{Check: check, Message: e.Error()})
+		}
+	}
+
+	if len(urls) == 0 && !args.Serve && !args.Verify && !args.Stdin && args.Bookmarklet == "" && args.SeedFile == "" {
+		add("url", errors.New("must provide -serve or URLs to scrape"))
+	}
+
+	cfg, err := buildConfig(args)
+	add("options", err)
+
+	if cfg != nil {
+		if len(urls) == 0 && len(cfg.Seeds) > 0 {
+			urls = cfg.Seeds[:1] // the first seed becomes the start URL
+		}
+
+		for _, u := range urls {
+			parsed, err := parseAll([]string{u})
+			if err != nil {
+				add("url", err)
+				continue
+			}
+
+			_, err = scraper.New(*cfg, parsed[0], afero.NewMemMapFs(), log)
+			add("scraper", err)
+		}
+
+		add("directory", checkWritable(cfg.Directory))
+	}
+
+	add("auth", checkAuth(args))
+
+	report.Valid = len(report.Problems) == 0
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Error("Writing config report", slog.Any("error", err))
+	}
+
+	if !report.Valid {
+		return logger.ExitConfig
+	}
+	return logger.ExitOK
+}
+
+// checkWritable checks that files can be created in dir, or in the nearest directory
+// above it that exists, from which dir would be created.
+func checkWritable(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			return errors.New(dir + " is not a directory")
+		} else if err == nil {
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".goscrape-check-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkAuth checks that the options for logging in and sending credentials are
+// used together as they must be.
+func checkAuth(args Arguments) error {
+	var errs []error
+
+	if len(args.LoginValues) > 0 && args.Login == "" {
+		errs = append(errs, errors.New("-loginvalue requires -login"))
+	}
+
+	if (args.SessionContains != "" || args.SessionStatus != http.StatusOK) && args.SessionURL == "" {
+		errs = append(errs, errors.New("-sessioncontains and -sessionstatus require -sessionurl"))
+	}
+
+	if (len(args.CredentialHosts) > 0 || args.AnyHostCredentials) && args.User == "" && len(args.Headers) == 0 {
+		errs = append(errs, errors.New("-credentialhost and -anyhostcredentials require -user or -H"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// unjoin splits an error made by errors.Join into its parts.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, unjoin(e)...)
+		}
+		return errs
+	}
+
+	return []error{err}
+}
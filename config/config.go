@@ -1,8 +1,14 @@
 package config
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -14,24 +20,169 @@ type Config struct {
 	Includes []string
 	Excludes []string
 
-	Concurrency  int                 // number of concurrent downloads; default 1
-	MaxDepth     int                 // download depth, 0 for unlimited
-	ImageQuality images.ImageQuality // image quality from 0 to 100%, 0 to disable reencoding
-	Timeout      time.Duration       // time limit to process each http request
-	LoopDelay    time.Duration       // fixed value sleep time per request
-	LaxAge       time.Duration       // added to origin server's expires timestamp
-	Tries        int                 // download attempts, 0 for unlimited
+	IncludeTypes []string // media types, extensions or groups (e.g. images) of assets to download; HTML is always downloaded
+	ExcludeTypes []string // media types, extensions or groups (e.g. video) of assets not to download
 
-	Directory string
-	Username  string
-	Password  string
+	FetchIf  string // expression deciding which URLs are fetched, e.g. `depth < 3 && path.startsWith("/docs/")`; blank for all
+	FollowIf string // expression deciding which fetched pages have their links followed; blank for all
+	StoreIf  string // expression deciding which fetched files are stored; blank for all
 
-	Cookies   []Cookie
-	Header    http.Header
-	Proxy     string
-	UserAgent string
+	Refresh string // a URL prefix: only the pages under it are crawled, e.g. to update one section of a mirror; blank for all
+	Refetch bool   // the start URLs are downloaded again unconditionally, along with their assets, without following links to other pages
+
+	Plugins []string // Go plugin files that provide URL filters, page post-processors or middleware
+
+	Concurrency        int                 // number of concurrent downloads; default 1
+	HostConcurrency    int                 // number of concurrent downloads from any one host; 0 for no extra limit
+	ProcessConcurrency int                 // number of concurrent parse/rewrite workers; 0 to do this work in the download workers
+	Segments           int                 // number of parallel ranged requests used to download each large file; 0 or 1 for a single request
+	SegmentSize        int64               // files at least this large, in bytes, are downloaded in Segments; 0 for any size
+	ProcessQueue       int                 // capacity of the queue between the download and parse/rewrite workers; default twice ProcessConcurrency
+	MaxDepth           int                 // download depth, 0 for unlimited
+	MaxAssetDepth      int                 // download depth for assets, 0 for MaxDepth + 2
+	PageOnly           bool                // only the start page and its assets are downloaded, whatever the depth
+	MaxURLLength       int                 // longest URL that is downloaded, 0 for unlimited
+	MaxQueryParams     int                 // most query parameters in a URL that is downloaded, 0 for unlimited
+	ImageQuality       images.ImageQuality // image quality from 0 to 100%, 0 to disable reencoding
+	ImageWorkers       int                 // number of images re-encoded at once; default the number of CPUs
+	ImageMemory        int64               // limit in bytes on memory used by images being re-encoded; default images.DefaultMemory
+	Timeout            time.Duration       // time limit to process each http request
+	ProcessTimeout     time.Duration       // time limit to fetch, parse, rewrite and store each URL, 0 for unlimited
+	LoopDelay          time.Duration       // fixed value sleep time per request
+	MinDelay           time.Duration       // floor of the adaptive sleep time per request
+	MaxDelay           time.Duration       // ceiling of the adaptive sleep time per request; 0 disables adaptation
+	CrawlDelay         bool                // honour the Crawl-delay of the website's robots.txt as a floor for LoopDelay
+	LaxAge             time.Duration       // added to origin server's expires timestamp
+	Tries              int                 // download attempts, 0 for unlimited
+	MaxAttempts        int                 // maximum attempts for each item, which is requeued after 429 or 5xx responses; default 5
+	RetryAtEnd         bool                // requeue items only once the rest of the crawl has finished, in a final pass, rather than straight away
+	MaxErrors          int                 // abort the crawl once more items than this have failed, 0 for unlimited
+	MaxErrorRate       float64             // abort the crawl once more than this fraction of the last 100 items have failed, 0 for unlimited
+	Maintenance        time.Duration       // shortest Retry-After of a 503 response that leaves the host alone until then; default DefaultMaintenance, negative to disable
+	MaxMaintenance     time.Duration       // longest maintenance window that is waited out; a later Retry-After is cut short; default DefaultMaxMaintenance
+
+	RespectCacheControl bool // take the lifetime of cached copies from Cache-Control as well as Expires, so that fresh copies are not revalidated
+
+	MaxRedirects      int  // maximum redirects followed for each request; default DefaultMaxRedirects, negative (e.g. NoRedirects) to follow none
+	SameHostRedirects bool // don't follow redirects that lead to a different host
+	FixedStartURL     bool // don't adopt the redirect target of the start page as the new start URL
+	UpgradeHTTPS      bool // use https:// instead of an http:// start URL when the website supports it
+	SameScheme        bool // fetch both http:// and https:// links to the start host using the scheme of the start URL
+
+	Pagination []string   // URL patterns such as "/page/{1..200}", relative to the start URL; these are fetched at depth 0
+	Seeds      []string   // further URLs, absolute or relative to the start URL; these are also fetched at depth 0
+	FollowNext bool       // follow rel=next/prev links and Link headers at the same depth
+	Forms      bool       // follow the URLs generated by simple GET forms
+	FormValues url.Values // values for named form controls; each value gives a separate submission
+	Robots     bool       // honour noindex and nofollow in robots meta tags and X-Robots-Tag headers
+	SkipRels   bool       // don't follow anchors marked rel=nofollow, ugc or sponsored
+	Alternates string     // treatment of AMP and mobile alternates: AlternatesInclude (default), AlternatesSkip or AlternatesPrefer
+	Prune      []string   // CSS selectors of elements removed from stored pages, e.g. cookie banners and adverts
+	Inject     string     // HTML snippet inserted into stored pages; {url} and {date} are replaced
+	InjectAt   string     // where the snippet is inserted: InjectTop (default), InjectBottom or InjectHead
+
+	ExternalLinks string // treatment of links to other websites: ExternalLinksKeep (default), ExternalLinksAnnotate or ExternalLinksStub
+	ListURLs      bool   // crawl the pages to list the URLs found, without fetching assets or storing any files
+
+	MaxHTMLSize   int64 // pages larger than this, in bytes, are stored verbatim without being parsed; 0 for unlimited
+	ScanLargeHTML bool  // find the links in pages that are too large or too deeply nested to parse, using only the tokenizer
+
+	Directory     string
+	SaveHeaders   bool          // write the response headers of each file into a sidecar file
+	SaveDiffs     bool          // write the changes to the text of each page into a sidecar file
+	Fsync         string        // when files are flushed to disk: FsyncNone (default), FsyncFile or FsyncPeriodic
+	FsyncInterval time.Duration // interval for FsyncPeriodic; default DefaultFsyncInterval
+	WriteBehind   int           // capacity of the queue of files written in the background; 0 to write synchronously
+	Rsync         bool          // keep the output stable for replication by rsync: modification times come from Last-Modified and sidecars omit volatile headers
+	Username      string
+	Password      string
+
+	Cookies     []Cookie
+	Header      http.Header
+	HeaderRules []HeaderRule // headers and cookies sent only to matching URLs
+	AcceptRules []AcceptRule // Accept headers pinned for the URLs of particular types
+	Proxy       string
+	UserAgent   string
+	Wayback     string // timestamp (YYYYMMDDhhmmss or a prefix) of Wayback Machine captures to fetch instead of the live website
+	Origin      string // with a file:// start URL, the website that the local tree was exported from: links to it lead within the tree, and the assets missing from it are fetched from there
+	SmallWeb    bool   // also fetch gemini:// and gopher:// URLs, rendering gemtext pages and Gopher menus as HTML (experimental)
+
+	ConnectTo []ConnectRule                                                        // the connections for particular hosts go to other addresses or Unix sockets
+	Dial      func(ctx context.Context, network, address string) (net.Conn, error) // makes the connections instead of the default dialer, e.g. to reach an application in a container; nil for the default
+
+	CredentialHosts    []string         // hosts besides the start host, e.g. "*.example.org", that are sent the Authorization and custom headers
+	AnyHostCredentials bool             // send the Authorization and custom headers to every host, including third parties
+	HostCredentials    []HostCredential // usernames and passwords for particular hosts, e.g. private asset servers, used there instead of Username and Password
+
+	LoginURL        string        // URL to which LoginValues are posted before scraping, and whenever the session check fails
+	LoginValues     url.Values    // fields of the login form, e.g. the username and password
+	SessionURL      string        // URL fetched periodically to check that the login session is still valid
+	SessionStatus   int           // status of the session check when the session is valid; default 200
+	SessionContains string        // text in the response to the session check when the session is valid
+	SessionInterval time.Duration // interval between session checks; default DefaultSessionInterval
+
+	MaxIdleConnsPerHost int           // idle connections kept for reuse with each host; default Concurrency, but at least 2
+	IdleConnTimeout     time.Duration // how long idle connections are kept; default 90s
+	TLSSessionCache     int           // TLS sessions cached for resumption; default DefaultTLSSessionCache, negative to disable
+	CertPins            []CertPin     // the expected certificates of particular hosts; a connection to such a host presenting any other fails
 }
 
+const (
+	// DefaultMaxRedirects matches the default policy of http.Client.
+	DefaultMaxRedirects = 10
+
+	// NoRedirects is the MaxRedirects that follows no redirects.
+	NoRedirects = -1
+
+	// DefaultMaxAttempts limits requeueing of items that got 429 or 5xx responses.
+	DefaultMaxAttempts = 5
+
+	// DefaultMaintenance is the shortest Retry-After of a 503 response that is taken to
+	// announce a maintenance window rather than a transient error.
+	DefaultMaintenance = time.Minute
+
+	// DefaultMaxMaintenance is the longest maintenance window that is waited out.
+	DefaultMaxMaintenance = time.Hour
+)
+
+// Treatments of the AMP and mobile alternates of pages.
+const (
+	AlternatesInclude = "include" // followed like any other link
+	AlternatesSkip    = "skip"    // not followed
+	AlternatesPrefer  = "prefer"  // followed at the same depth as the page that declares them
+)
+
+// Positions in stored pages at which the Inject snippet is inserted.
+const (
+	InjectTop    = "top"    // at the start of the body
+	InjectBottom = "bottom" // at the end of the body
+	InjectHead   = "head"   // at the end of the head
+)
+
+// Treatments of the links in stored pages that lead to other websites.
+const (
+	ExternalLinksKeep     = "keep"     // left unchanged
+	ExternalLinksAnnotate = "annotate" // opened in a new window, with a title showing where they lead
+	ExternalLinksStub     = "stub"     // annotated, and routed through a page warning that they leave the archive
+)
+
+// Policies for flushing the files written to disk.
+const (
+	FsyncNone     = "none"     // left to the operating system
+	FsyncFile     = "file"     // each file is flushed before it replaces any previous version
+	FsyncPeriodic = "periodic" // the files written recently are flushed together at intervals
+)
+
+// DefaultFsyncInterval is the interval between flushes for FsyncPeriodic.
+const DefaultFsyncInterval = 5 * time.Second
+
+// DefaultSessionInterval is the interval between checks that the login session is still valid.
+const DefaultSessionInterval = time.Minute
+
+// DefaultTLSSessionCache is the number of TLS sessions cached so that connections
+// to the same servers can resume them, avoiding full handshakes.
+const DefaultTLSSessionCache = 64
+
 func (c *Config) GetLaxAge() time.Duration {
 	if c.LaxAge > 0 {
 		return c.LaxAge
@@ -48,14 +199,42 @@ func (c *Config) SensibleDefaults() {
 		c.Tries = 1
 	}
 
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if c.Maintenance == 0 {
+		c.Maintenance = DefaultMaintenance
+	}
+
+	if c.MaxMaintenance <= 0 {
+		c.MaxMaintenance = DefaultMaxMaintenance
+	}
+
+	if c.MaxRedirects == 0 {
+		c.MaxRedirects = DefaultMaxRedirects
+	}
+
 	if c.MaxDepth < 1 {
 		c.MaxDepth = math.MaxInt
 	}
 
+	if c.MaxAssetDepth < 1 {
+		// allows for the assets of the deepest pages, including any referenced by their CSS
+		c.MaxAssetDepth = c.MaxDepth
+		if c.MaxDepth < math.MaxInt-2 {
+			c.MaxAssetDepth = c.MaxDepth + 2
+		}
+	}
+
 	if c.Timeout < 0 {
 		c.Timeout = 0
 	}
 
+	if c.ProcessTimeout < 0 {
+		c.ProcessTimeout = 0
+	}
+
 	if c.LoopDelay < 0 {
 		c.LoopDelay = 0
 	}
@@ -80,3 +259,148 @@ func MakeHeaders(headers []string) http.Header {
 	}
 	return h
 }
+
+// HeaderRule adds headers to the requests for the URLs that match a glob pattern. A
+// pattern starting with '/', such as "/api/*", matches paths on the start host; otherwise
+// it starts with a host name, such as "api.example.org/v2/*" or "*.example.org/".
+type HeaderRule struct {
+	Pattern string
+	Header  http.Header
+}
+
+// MakeHeaderRules parses "pattern name:value" header rules and "pattern name=value"
+// cookie rules. The cookies are sent using the Cookie header.
+func MakeHeaderRules(headers, cookies []string) []HeaderRule {
+	var rules []HeaderRule
+	for _, rule := range headers {
+		pattern, hdr, _ := strings.Cut(strings.TrimSpace(rule), " ")
+		name, value, found := strings.Cut(hdr, ":")
+		if found {
+			h := http.Header{}
+			h.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+			rules = append(rules, HeaderRule{Pattern: pattern, Header: h})
+		}
+	}
+
+	for _, rule := range cookies {
+		pattern, cookie, _ := strings.Cut(strings.TrimSpace(rule), " ")
+		if strings.Contains(cookie, "=") {
+			h := http.Header{}
+			h.Set("Cookie", strings.TrimSpace(cookie))
+			rules = append(rules, HeaderRule{Pattern: pattern, Header: h})
+		}
+	}
+	return rules
+}
+
+// HostCredential is the username and password used to authenticate with the hosts that
+// match Host, which is a host name, e.g. "assets.example.net", or "*." and a domain, which
+// matches the domain and all its subdomains.
+type HostCredential struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// MakeHostCredentials parses "host user[:password]" rules.
+func MakeHostCredentials(rules []string) ([]HostCredential, error) {
+	var parsed []HostCredential
+	for _, rule := range rules {
+		host, user, _ := strings.Cut(strings.TrimSpace(rule), " ")
+		username, password, _ := strings.Cut(strings.TrimSpace(user), ":")
+		if host == "" || username == "" {
+			return nil, fmt.Errorf("%q: must be \"host user[:password]\"", rule)
+		}
+		parsed = append(parsed, HostCredential{Host: host, Username: username, Password: password})
+	}
+	return parsed, nil
+}
+
+// ConnectRule directs the connections for the URLs of a host to another address, e.g. for
+// an application that is not exposed on a routable port. Host is a host name, optionally
+// with a port, e.g. "app.example.org" or "app.example.org:8443". Address is a host and
+// port, e.g. "127.0.0.1:8080", or "unix:" and the path of a Unix domain socket, e.g.
+// "unix:/run/app.sock". The URLs are unchanged, so the Host header, cookies and TLS
+// server name are those of the host.
+type ConnectRule struct {
+	Host    string
+	Address string
+}
+
+// MakeConnectRules parses "host address" rules.
+func MakeConnectRules(rules []string) ([]ConnectRule, error) {
+	var parsed []ConnectRule
+	for _, rule := range rules {
+		host, address, _ := strings.Cut(strings.TrimSpace(rule), " ")
+		address = strings.TrimSpace(address)
+		if path, isUnix := strings.CutPrefix(address, "unix:"); isUnix {
+			if host != "" && path != "" {
+				parsed = append(parsed, ConnectRule{Host: host, Address: address})
+				continue
+			}
+		} else if _, _, err := net.SplitHostPort(address); host != "" && err == nil {
+			parsed = append(parsed, ConnectRule{Host: host, Address: address})
+			continue
+		}
+		return nil, fmt.Errorf("%q: must be \"host address\", where the address is host:port or unix:/path/to/socket", rule)
+	}
+	return parsed, nil
+}
+
+// CertPin is the SHA-256 fingerprint of a certificate that the hosts matching Host, which
+// is a host name or "*." and a domain, are expected to present. Fingerprint is in lower
+// case hex without separators.
+type CertPin struct {
+	Host        string
+	Fingerprint string
+}
+
+// MakeCertPins parses "host fingerprint" rules. The fingerprint is given in hex, as
+// printed by "openssl x509 -noout -fingerprint -sha256", with or without colons.
+func MakeCertPins(rules []string) ([]CertPin, error) {
+	var parsed []CertPin
+	for _, rule := range rules {
+		host, fingerprint, _ := strings.Cut(strings.TrimSpace(rule), " ")
+		fingerprint = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+		if b, err := hex.DecodeString(fingerprint); host == "" || err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%q: must be \"host fingerprint\", with the SHA-256 fingerprint in hex", rule)
+		}
+		if net.ParseIP(strings.Trim(host, "[]")) != nil {
+			return nil, fmt.Errorf("%q: an IP address cannot be pinned, as pins are matched by the host name sent to the server", rule)
+		}
+		parsed = append(parsed, CertPin{Host: host, Fingerprint: fingerprint})
+	}
+	return parsed, nil
+}
+
+// AcceptRule pins the Accept header of the requests for the URLs of some types. Types
+// is a comma-separated list of "pages", "*" or the items accepted by filter.NewTypes,
+// e.g. "images" or ".svg"; apart from pages, the type is given by the file extension.
+type AcceptRule struct {
+	Types  string
+	Accept string
+}
+
+// MakeAcceptRules parses "types: accept" rules, e.g. "images: image/png, image/webp;q=0".
+func MakeAcceptRules(rules []string) []AcceptRule {
+	var parsed []AcceptRule
+	for _, rule := range rules {
+		types, accept, found := strings.Cut(rule, ":")
+		if found && strings.TrimSpace(types) != "" {
+			parsed = append(parsed, AcceptRule{Types: strings.TrimSpace(types), Accept: strings.TrimSpace(accept)})
+		}
+	}
+	return parsed
+}
+
+// MakeFormValues parses "name=value" pairs; a name may be repeated.
+func MakeFormValues(pairs []string) url.Values {
+	v := url.Values{}
+	for _, pair := range pairs {
+		sl := strings.SplitN(pair, "=", 2)
+		if len(sl) == 2 {
+			v.Add(sl[0], sl[1])
+		}
+	}
+	return v
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,3 +13,65 @@ func TestHeaders(t *testing.T) {
 	assert.Equal(t, "b", headers.Get("a"))
 	assert.Equal(t, "d:e", headers.Get("c"))
 }
+
+func TestFormValues(t *testing.T) {
+	values := MakeFormValues([]string{"q=a", "q=b=c", "x"})
+	assert.Equal(t, []string{"a", "b=c"}, values["q"])
+	assert.NotContains(t, values, "x")
+}
+
+func TestHeaderRules(t *testing.T) {
+	rules := MakeHeaderRules([]string{"/api/* Authorization: Bearer x y", "bad"}, []string{"/a token=t", "/b"})
+	assert.Equal(t, []HeaderRule{
+		{Pattern: "/api/*", Header: http.Header{"Authorization": {"Bearer x y"}}},
+		{Pattern: "/a", Header: http.Header{"Cookie": {"token=t"}}},
+	}, rules)
+}
+
+func TestAcceptRules(t *testing.T) {
+	rules := MakeAcceptRules([]string{"images: image/png, image/webp;q=0", "pages:text/html", "bad", ": x"})
+	assert.Equal(t, []AcceptRule{
+		{Types: "images", Accept: "image/png, image/webp;q=0"},
+		{Types: "pages", Accept: "text/html"},
+	}, rules)
+}
+
+func TestHostCredentials(t *testing.T) {
+	credentials, err := MakeHostCredentials([]string{"assets.example.net alice:p:w", "*.example.org bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, []HostCredential{
+		{Host: "assets.example.net", Username: "alice", Password: "p:w"},
+		{Host: "*.example.org", Username: "bob"},
+	}, credentials)
+
+	for _, bad := range []string{"assets.example.net", " alice:pw", "assets.example.net :pw"} {
+		_, err = MakeHostCredentials([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCertPins(t *testing.T) {
+	fingerprint := "AB:" + strings.Repeat("01:", 30) + "CD"
+	pins, err := MakeCertPins([]string{"intranet.example.org " + fingerprint})
+	assert.NoError(t, err)
+	assert.Equal(t, []CertPin{{Host: "intranet.example.org", Fingerprint: "ab" + strings.Repeat("01", 30) + "cd"}}, pins)
+
+	for _, bad := range []string{"intranet.example.org", "intranet.example.org abcd", " " + fingerprint, "intranet.example.org " + fingerprint + "zz", "10.1.2.3 " + fingerprint} {
+		_, err = MakeCertPins([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestConnectRules(t *testing.T) {
+	rules, err := MakeConnectRules([]string{"app.example.org 127.0.0.1:8080", "app.example.org:8443  unix:/run/app.sock"})
+	assert.NoError(t, err)
+	assert.Equal(t, []ConnectRule{
+		{Host: "app.example.org", Address: "127.0.0.1:8080"},
+		{Host: "app.example.org:8443", Address: "unix:/run/app.sock"},
+	}, rules)
+
+	for _, bad := range []string{"app.example.org", "app.example.org 127.0.0.1", "app.example.org unix:", " 127.0.0.1:8080"} {
+		_, err = MakeConnectRules([]string{bad})
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,134 @@
+// Package corpus exports the plain text of every stored page, without its markup and
+// boilerplate, for building text corpora from a crawl. The text is written either into
+// a tree of text files that parallels the mirror or into a single file of JSON lines.
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+)
+
+// The formats of the exported text.
+const (
+	FormatTree  = "tree"  // a text file for each page, in TreeDir
+	FormatJSONL = "jsonl" // a JSON object for each page, in FileName
+)
+
+// TreeDir is the directory within the output directory that holds the text files.
+const TreeDir = "_text"
+
+// FileName is the name of the JSON lines file within the output directory.
+const FileName = "text.jsonl"
+
+// Page is the text of a page, as written in FileName.
+type Page struct {
+	URL      string `json:"url"`
+	File     string `json:"file"`
+	Title    string `json:"title,omitempty"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// Corpus receives the text of each page. It is safe for concurrent use; a nil Corpus
+// does nothing.
+type Corpus struct {
+	fs     afero.Fs
+	dir    string
+	format string
+
+	mu   sync.Mutex
+	file afero.File
+	enc  *json.Encoder
+}
+
+// New creates a corpus in the output directory dir. For FormatJSONL, the file is
+// created afresh. Any previous file is removed rather than truncated, because it may
+// be hard-linked to the published mirror or to a snapshot, which must not change. It
+// returns nil if the format is blank.
+func New(fs afero.Fs, dir, format string) (*Corpus, error) {
+	c := &Corpus{fs: fs, dir: dir, format: format}
+
+	switch format {
+	case "":
+		return nil, nil
+
+	case FormatTree:
+		return c, nil
+
+	case FormatJSONL:
+		if err := ioutil.CreateDirectory(fs, dir); err != nil {
+			return nil, err
+		}
+
+		name := filepath.Join(dir, FileName)
+		if err := fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("removing %s: %w", FileName, err)
+		}
+
+		f, err := fs.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s: %w", FileName, err)
+		}
+
+		c.file = f
+		c.enc = json.NewEncoder(f)
+		c.enc.SetEscapeHTML(false)
+		return c, nil
+
+	default:
+		return nil, fmt.Errorf("unknown text format %q", format)
+	}
+}
+
+// Add records the text of the page at u, which is stored in file within the directory
+// for its host.
+func (c *Corpus) Add(u *url.URL, file string, metadata *work.Metadata, lines []string) error {
+	if c == nil {
+		return nil
+	}
+
+	text := strings.Join(lines, "\n")
+
+	if c.format == FormatTree {
+		name := filepath.Join(c.dir, TreeDir, mapping.HostDir(u.Host), strings.TrimSuffix(file, filepath.Ext(file))+".txt")
+		if _, err := ioutil.WriteFileAtomically(c.fs, name, strings.NewReader(text+"\n")); err != nil {
+			return fmt.Errorf("writing text of %s: %w", u, err)
+		}
+		return nil
+	}
+
+	page := Page{URL: u.String(), File: filepath.ToSlash(filepath.Join(mapping.HostDir(u.Host), file)), Text: text}
+	if metadata != nil {
+		page.Title = metadata.Title
+		page.Language = metadata.Language
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(page); err != nil {
+		return fmt.Errorf("writing text of %s: %w", u, err)
+	}
+	return nil
+}
+
+// Close finishes writing the corpus.
+func (c *Corpus) Close() error {
+	if c == nil || c.file == nil {
+		return nil
+	}
+
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", FileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package corpus
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTree(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, err := New(fs, "out", FormatTree)
+	require.NoError(t, err)
+
+	u, _ := url.Parse("https://example.org/news/story")
+	require.NoError(t, c.Add(u, "news/story.html", nil, []string{"Headline", "Text."}))
+	require.NoError(t, c.Close())
+
+	data, err := afero.ReadFile(fs, "out/_text/example.org/news/story.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "Headline\nText.\n", string(data))
+}
+
+func TestJSONL(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	c, err := New(fs, "out", FormatJSONL)
+	require.NoError(t, err)
+
+	u, _ := url.Parse("https://example.org/")
+	require.NoError(t, c.Add(u, "index.html", &work.Metadata{Title: "Home", Language: "en"}, []string{"<Hello>", "World"}))
+	require.NoError(t, c.Close())
+
+	data, err := afero.ReadFile(fs, "out/"+FileName)
+	require.NoError(t, err)
+	assert.Equal(t, `{"url":"https://example.org/","file":"example.org/index.html","title":"Home","language":"en","text":"<Hello>\nWorld"}`+"\n", string(data))
+}
+
+func TestNone(t *testing.T) {
+	c, err := New(afero.NewMemMapFs(), "out", "")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	assert.NoError(t, c.Add(&url.URL{}, "", nil, nil))
+	assert.NoError(t, c.Close())
+
+	_, err = New(afero.NewMemMapFs(), "out", "xml")
+	assert.Error(t, err)
+}
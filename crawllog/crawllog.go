@@ -0,0 +1,100 @@
+// Package crawllog writes a record of every fetch as a stream of JSON lines, so that a
+// crawl can be analysed afterwards with tools such as jq or pandas. It is separate from
+// the human-readable log.
+package crawllog
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/work"
+)
+
+// Record describes one fetch.
+type Record struct {
+	Time        time.Time `json:"time"` // when the request was sent
+	URL         string    `json:"url"`
+	Parent      string    `json:"parent,omitempty"` // the page that referred to the URL
+	Depth       int       `json:"depth"`
+	Attempt     int       `json:"attempt,omitempty"` // the number of earlier attempts
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`                 // the bytes received
+	Stored      int64     `json:"stored,omitempty"`     // the bytes written to the file
+	DurationMS  float64   `json:"duration_ms"`          // the time taken to fetch and process the URL
+	QueuedMS    float64   `json:"queued_ms,omitempty"`  // the time spent waiting in the queue
+	Path        string    `json:"path,omitempty"`       // the file, relative to the output directory
+	Redirects   []string  `json:"redirects,omitempty"`  // every hop followed before the final URL
+	References  int       `json:"references,omitempty"` // the links found
+	Requeue     bool      `json:"requeue,omitempty"`    // the URL will be attempted again
+	TimedOut    bool      `json:"timed_out,omitempty"`  // the URL took longer than the processing timeout
+}
+
+// Log writes the records. It is safe for concurrent use; a nil Log does nothing.
+type Log struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+	log *logger.Logger
+}
+
+// New returns a log that writes to w. Failures are reported to log.
+func New(w io.Writer, log *logger.Logger) *Log {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Log{enc: enc, log: log}
+}
+
+// NewRecord describes the fetch that gave a result. The path of the stored file, if
+// any, is relative to the output directory.
+func NewRecord(result work.Result, path string) Record {
+	r := Record{
+		Time:        result.StartTime,
+		URL:         result.URL.String(),
+		Depth:       result.Depth,
+		Attempt:     result.Attempt,
+		Status:      result.StatusCode,
+		ContentType: result.ContentType,
+		Size:        result.ContentLength,
+		Stored:      result.FileSize,
+		DurationMS:  milliseconds(result.Duration),
+		Path:        path,
+		References:  len(result.References) + len(result.Pagination),
+		Requeue:     result.Requeue,
+		TimedOut:    result.TimedOut,
+	}
+
+	if result.Referrer != nil {
+		r.Parent = result.Referrer.String()
+	}
+
+	if !result.Queued.IsZero() && !result.StartTime.IsZero() {
+		r.QueuedMS = milliseconds(result.StartTime.Sub(result.Queued))
+	}
+
+	for _, hop := range result.Redirects {
+		r.Redirects = append(r.Redirects, hop.String())
+	}
+
+	return r
+}
+
+// Add writes a record.
+func (l *Log) Add(record Record) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(record); err != nil {
+		l.log.Error("Writing crawl log failed", slog.String("url", record.URL), slog.Any("error", err))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
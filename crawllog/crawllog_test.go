@@ -0,0 +1,45 @@
+package crawllog
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/work"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	u, _ := url.Parse("https://example.org/b")
+	parent, _ := url.Parse("https://example.org/")
+	hop, _ := url.Parse("https://example.org/a")
+	start := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	result := work.Result{
+		Item: work.Item{
+			URL:       u,
+			Referrer:  parent,
+			Depth:     1,
+			Queued:    start.Add(-250 * time.Millisecond),
+			StartTime: start,
+			FilePath:  "b.html",
+		},
+		StatusCode:    200,
+		ContentType:   "text/html",
+		ContentLength: 1234,
+		FileSize:      1300,
+		Duration:      1500 * time.Microsecond,
+		Redirects:     work.Refs{hop},
+		References:    work.Refs{parent},
+	}
+
+	buf := &bytes.Buffer{}
+	l := New(buf, nil)
+	l.Add(NewRecord(result, "example.org/b.html"))
+
+	assert.Equal(t, `{"time":"2024-05-06T07:08:09Z","url":"https://example.org/b","parent":"https://example.org/","depth":1,"status":200,"content_type":"text/html","size":1234,"stored":1300,"duration_ms":1.5,"queued_ms":250,"path":"example.org/b.html","redirects":["https://example.org/a"],"references":1}`+"\n", buf.String())
+
+	var none *Log
+	none.Add(NewRecord(result, ""))
+}
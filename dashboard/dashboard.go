@@ -0,0 +1,321 @@
+// Package dashboard shows the progress of a scrape on a full-screen terminal display,
+// for operators babysitting large crawls. Keys pause and resume the scrape, skip the
+// current host, change the speed and quit.
+package dashboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/scraper"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+const (
+	// Interval is how often the display is redrawn.
+	Interval = 500 * time.Millisecond
+
+	maxQueued = 8    // the number of queued URLs shown
+	maxLog    = 10   // the number of log lines shown
+	keptLog   = 1000 // the number of log lines written out when the dashboard stops
+
+	// slowestStep is the extra delay that the first slow-down imposes; subsequent ones double it.
+	slowestStep = 250 * time.Millisecond
+)
+
+// Terminal control sequences.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" // alternate screen, hidden cursor
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen = "\x1b[H\x1b[2J"
+)
+
+// HostStats are the results counted for one host.
+type HostStats struct {
+	Fetched int   // the files downloaded or found to be unchanged
+	Errors  int   // the error responses and timeouts
+	Bytes   int64 // the size of the files stored
+}
+
+// Dashboard draws the state of the current scraper. It is also an io.Writer that
+// receives the log, so that the most recent lines can be shown; once the dashboard
+// has stopped, the log is passed through to the terminal. A nil Dashboard does
+// nothing.
+type Dashboard struct {
+	out     io.Writer
+	started time.Time
+
+	mu      sync.Mutex
+	sc      *scraper.Scraper
+	hosts   map[string]*HostStats
+	log     []string
+	partial []byte // the start of a log line that has not yet been completed
+	running bool
+	cancel  context.CancelFunc
+}
+
+// New creates a dashboard that draws on out, which is normally the terminal.
+func New(out io.Writer) *Dashboard {
+	return &Dashboard{out: out, started: utc.Now(), hosts: make(map[string]*HostStats)}
+}
+
+// Watch makes the scraper the current one, whose progress is shown and which the keys
+// control. Its results are counted as they complete.
+func (d *Dashboard) Watch(sc *scraper.Scraper) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.sc = sc
+	d.mu.Unlock()
+
+	previous := sc.OnResult
+	sc.OnResult = func(result work.Result) {
+		d.Add(result)
+		if previous != nil {
+			previous(result)
+		}
+	}
+}
+
+// Add counts a result.
+func (d *Dashboard) Add(result work.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	host := result.Item.URL.Host
+	hs, ok := d.hosts[host]
+	if !ok {
+		hs = &HostStats{}
+		d.hosts[host] = hs
+	}
+
+	switch {
+	case result.TimedOut || result.StatusCode >= http.StatusBadRequest:
+		hs.Errors++
+	case result.StatusCode > 0:
+		hs.Fetched++
+	}
+	hs.Bytes += result.FileSize
+}
+
+// Write receives the log. Complete lines are kept for display while the dashboard is
+// running, and are written to the terminal otherwise.
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.running {
+		return d.out.Write(p)
+	}
+
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.log = append(d.log, string(d.partial[:i]))
+		d.partial = d.partial[i+1:]
+	}
+
+	if len(d.log) > 2*keptLog {
+		d.log = slices.Clone(d.log[len(d.log)-keptLog:])
+	}
+	return len(p), nil
+}
+
+// Start takes over the terminal and redraws the display until stop is called. Keys
+// are read from in, which is put into raw mode if it is a terminal. The returned
+// context is cancelled when the operator quits. Calling stop more than once is
+// harmless.
+func (d *Dashboard) Start(ctx context.Context, in *os.File) (_ context.Context, stop func()) {
+	if d == nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	restore := makeRaw(in)
+
+	d.mu.Lock()
+	d.running = true
+	d.cancel = cancel
+	fmt.Fprint(d.out, enterScreen)
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go d.readKeys(in, done)
+
+	ticker := time.NewTicker(Interval)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.draw()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			restore()
+
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.running = false
+			fmt.Fprint(d.out, leaveScreen)
+			for _, line := range d.log[max(0, len(d.log)-keptLog):] {
+				fmt.Fprintln(d.out, line) // the most recent log is not lost
+			}
+			d.log = nil
+		})
+	}
+}
+
+func (d *Dashboard) readKeys(in io.Reader, done <-chan struct{}) {
+	r := bufio.NewReader(in)
+	for {
+		key, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		default:
+			d.HandleKey(key)
+			d.draw()
+		}
+	}
+}
+
+// HandleKey acts on one key press.
+func (d *Dashboard) HandleKey(key byte) {
+	d.mu.Lock()
+	sc, cancel := d.sc, d.cancel
+	d.mu.Unlock()
+
+	switch key {
+	case 'q', 'Q', 3: // including ctrl-C, which raw mode no longer turns into a signal
+		if cancel != nil {
+			cancel()
+		}
+
+	case 'p', 'P', ' ':
+		if sc != nil && sc.Paused() {
+			sc.Resume()
+		} else if sc != nil {
+			sc.Pause()
+		}
+
+	case 's', 'S':
+		if sc != nil {
+			sc.Skip()
+		}
+
+	case '-', '_':
+		if sc != nil {
+			sc.SetExtraDelay(max(2*sc.ExtraDelay(), slowestStep))
+		}
+
+	case '+', '=':
+		if sc != nil {
+			delay := sc.ExtraDelay() / 2
+			if delay < slowestStep {
+				delay = 0
+			}
+			sc.SetExtraDelay(delay)
+		}
+	}
+}
+
+func (d *Dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		fmt.Fprint(d.out, clearScreen)
+		d.render(d.out)
+	}
+}
+
+// Render draws the display on w.
+func (d *Dashboard) Render(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.render(w)
+}
+
+func (d *Dashboard) render(w io.Writer) {
+	state, delay, url := "idle", time.Duration(0), ""
+	var queue []scraper.QueuedURL
+	var progress scraper.Progress
+	if d.sc != nil {
+		state, delay, url, queue = "running", d.sc.ExtraDelay(), d.sc.URL.String(), d.sc.Pending()
+		progress = d.sc.Progress()
+		if d.sc.Paused() {
+			state = "PAUSED"
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("goscrape  %s  %s  elapsed %s", url, state, utc.Now().Sub(d.started).Round(time.Second)),
+		fmt.Sprintf("Queue %d  Discovered %.1f/s  Completed %.1f/s  ETA %s  Extra delay %s",
+			len(queue), progress.DiscoveryRate, progress.CompletionRate, eta(progress), delay),
+	}
+	if progress.Growing() {
+		lines = append(lines, "Warning: the queue is growing faster than it is being completed")
+	}
+
+	lines = append(lines,
+		"",
+		fmt.Sprintf("%-40s %8s %8s %12s", "Host", "Fetched", "Errors", "Bytes"),
+	)
+
+	for _, host := range slices.Sorted(maps.Keys(d.hosts)) {
+		hs := d.hosts[host]
+		lines = append(lines, fmt.Sprintf("%-40s %8d %8d %12d", host, hs.Fetched, hs.Errors, hs.Bytes))
+	}
+
+	lines = append(lines, "", "Queue (oldest first)")
+	slices.SortStableFunc(queue, func(a, b scraper.QueuedURL) int { return a.Queued.Compare(b.Queued) })
+	for _, q := range queue[:min(maxQueued, len(queue))] {
+		lines = append(lines, fmt.Sprintf("  %s  depth %d", q.URL, q.Depth))
+	}
+	if len(queue) > maxQueued {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", len(queue)-maxQueued))
+	}
+
+	lines = append(lines, "", "Recent log")
+	for _, line := range d.log[max(0, len(d.log)-maxLog):] {
+		lines = append(lines, "  "+line)
+	}
+
+	lines = append(lines, "", "[p] pause/resume  [s] skip host  [-] slower  [+] faster  [q] quit")
+	fmt.Fprint(w, strings.Join(lines, "\r\n"), "\r\n") // raw mode needs carriage returns
+}
+
+func eta(progress scraper.Progress) string {
+	if progress.ETA == 0 {
+		return "unknown"
+	}
+	return progress.ETA.String()
+}
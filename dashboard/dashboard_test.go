@@ -0,0 +1,101 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/scraper"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestScraper(t *testing.T) *scraper.Scraper {
+	t.Helper()
+
+	u, err := url.Parse("https://example.org/")
+	require.NoError(t, err)
+	sc, err := scraper.New(config.Config{}, u, afero.NewMemMapFs(), logger.Discard())
+	require.NoError(t, err)
+	return sc
+}
+
+func TestRender(t *testing.T) {
+	d := New(io.Discard)
+	d.Watch(newTestScraper(t))
+
+	page, _ := url.Parse("https://example.org/a.html")
+	image, _ := url.Parse("https://cdn.example.org/b.png")
+	d.Add(work.Result{Item: work.Item{URL: page}, StatusCode: 200, FileSize: 100})
+	d.Add(work.Result{Item: work.Item{URL: page}, StatusCode: 304, FileSize: 50})
+	d.Add(work.Result{Item: work.Item{URL: image}, StatusCode: 404})
+	d.Add(work.Result{Item: work.Item{URL: image}, TimedOut: true})
+
+	var buf bytes.Buffer
+	d.Render(&buf)
+	out := buf.String()
+
+	assert.Contains(t, out, "https://example.org/  running")
+	assert.Regexp(t, `example\.org +2 +0 +150`, out)
+	assert.Regexp(t, `cdn\.example\.org +0 +2 +0`, out)
+}
+
+func TestWrite(t *testing.T) {
+	var out bytes.Buffer
+	d := New(&out)
+
+	_, err := d.Write([]byte("before\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "before\n", out.String(), "passed through when not running")
+
+	d.running = true
+	_, err = d.Write([]byte("first\nsec"))
+	require.NoError(t, err)
+	_, err = d.Write([]byte("ond\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, d.log)
+
+	var buf bytes.Buffer
+	d.Render(&buf)
+	assert.Contains(t, buf.String(), "  second\r\n")
+}
+
+func TestHandleKey(t *testing.T) {
+	sc := newTestScraper(t)
+	d := New(io.Discard)
+	d.Watch(sc)
+
+	d.HandleKey('p')
+	assert.True(t, sc.Paused())
+	d.HandleKey(' ')
+	assert.False(t, sc.Paused())
+
+	d.HandleKey('-')
+	assert.Equal(t, slowestStep, sc.ExtraDelay())
+	d.HandleKey('-')
+	assert.Equal(t, 2*slowestStep, sc.ExtraDelay())
+	d.HandleKey('+')
+	assert.Equal(t, slowestStep, sc.ExtraDelay())
+	d.HandleKey('+')
+	assert.Equal(t, time.Duration(0), sc.ExtraDelay())
+
+	cancelled := false
+	d.cancel = func() { cancelled = true }
+	d.HandleKey('q')
+	assert.True(t, cancelled)
+}
+
+func TestNilDashboard(t *testing.T) {
+	var d *Dashboard
+	d.Watch(newTestScraper(t))
+	ctx, stop := d.Start(context.Background(), nil)
+	stop()
+	assert.NoError(t, ctx.Err())
+}
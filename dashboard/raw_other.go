@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package dashboard
+
+import "os"
+
+// makeRaw does nothing on this platform, so each key must be followed by Enter.
+func makeRaw(*os.File) (restore func()) {
+	return func() {}
+}
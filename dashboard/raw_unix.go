@@ -0,0 +1,31 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package dashboard
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeRaw puts the terminal into raw mode, so that each key press is read at once and
+// not echoed. It returns a function that restores the previous mode. If f is not a
+// terminal, nothing is changed.
+func makeRaw(f *os.File) (restore func()) {
+	fd := int(f.Fd())
+	previous, err := unix.IoctlGetTermios(fd, getTermios)
+	if err != nil {
+		return func() {}
+	}
+
+	raw := *previous
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Iflag &^= unix.IXON | unix.ICRNL
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, setTermios, &raw); err != nil {
+		return func() {}
+	}
+
+	return func() { _ = unix.IoctlSetTermios(fd, setTermios, previous) }
+}
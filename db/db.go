@@ -7,63 +7,107 @@ import (
 	"github.com/spf13/afero"
 	"io"
 	"log/slog"
+	"net/http"
 	urlpkg "net/url"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// Item holds the metadata for one URL. It is independent of the file timestamps,
+// which can be altered by image recoding and file copying.
 type Item struct {
-	ETags   string
-	Expires time.Time
+	ETags        string
+	Expires      time.Time
+	LastModified time.Time // as given by the origin server
+	Fetched      time.Time // when the URL was last fetched or revalidated
+	Status       int       // the most recent HTTP status code
+	Hash         string    // the SHA-256 hash of the stored file, in hex
 }
 
-func (i Item) Empty() bool { return len(i.ETags) == 0 && i.Expires.IsZero() }
+func (i Item) Empty() bool {
+	return len(i.ETags) == 0 && i.Expires.IsZero() && !i.extended()
+}
+
+// extended is true if any of the fields beyond ETags and Expires are set.
+func (i Item) extended() bool {
+	return !i.LastModified.IsZero() || !i.Fetched.IsZero() || i.Status != 0 || len(i.Hash) > 0
+}
 
 func (i Item) String() string {
-	expires := i.Expires.Format(time.RFC3339)
-	if i.Expires.IsZero() {
-		expires = "-"
-	}
-	if len(i.ETags) == 0 {
+	expires := formatTime(i.Expires)
+	switch {
+	case i.extended():
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%s", expires, orDash(i.ETags),
+			formatTime(i.LastModified), formatTime(i.Fetched), i.Status, orDash(i.Hash))
+	case len(i.ETags) == 0:
 		return expires
-	} else {
+	default:
 		return fmt.Sprintf("%s\t%s", expires, i.ETags)
 	}
 }
 
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s) // "-" gives zero time
+	return t
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
 //-------------------------------------------------------------------------------------------------
 
-// DB provides a persistent store for HTTP ETags to reduce network traffic when repeating
-// a download session. If the store is unavailable for some reason, its methods are no-ops.
+// DB provides a persistent store for HTTP ETags and other metadata for each URL, to reduce
+// network traffic when repeating a download session. It drives the conditional request
+// decisions. If the store is unavailable for some reason, its methods are no-ops.
 type DB struct {
 	file    string
 	records map[string]Item
 	count   int
 	fs      afero.Fs
 	mu      sync.Mutex
+	log     *logger.Logger
 }
 
 func DeleteFile(fs afero.Fs) {
 	_ = fs.Remove(filepath.Join(localStateDir(), FileName))
 }
 
-func Open() *DB {
-	return OpenDB(localStateDir(), afero.NewOsFs())
+func Open(log *logger.Logger) *DB {
+	return OpenDB(localStateDir(), afero.NewOsFs(), log)
 }
 
 const FileName = "goscrape-etags.txt"
 
-func OpenDB(dir string, fs afero.Fs) *DB {
+func OpenDB(dir string, fs afero.Fs, log *logger.Logger) *DB {
 	if err := fs.MkdirAll(dir, 0755); err != nil {
 		return nil
 	}
 
 	file := filepath.Join(dir, FileName)
-	store := &DB{file: file, fs: fs}
+	store := &DB{file: file, fs: fs, log: log}
 
 	f, err := fs.Open(file)
 	if err == nil {
@@ -93,11 +137,18 @@ func readItem(records map[string]Item, line string) {
 			}
 
 		case 3:
-			if val1 != "-" {
-				expires, _ := time.Parse(time.RFC3339, val1)
-				value.Expires = expires
-			}
+			value.Expires = parseTime(val1)
 			value.ETags = parts[2]
+
+		default:
+			value.Expires = parseTime(val1)
+			value.ETags = dashToEmpty(parts[2])
+			value.LastModified = parseTime(parts[3])
+			if len(parts) >= 7 {
+				value.Fetched = parseTime(parts[4])
+				value.Status, _ = strconv.Atoi(parts[5])
+				value.Hash = dashToEmpty(parts[6])
+			}
 		}
 
 		records[key] = value
@@ -146,18 +197,21 @@ func (store *DB) Close() error {
 	return nil
 }
 
-// Lookup finds the ETags for a given URL.
+// Lookup finds the metadata for a given URL.
 func (store *DB) Lookup(u *urlpkg.URL) Item {
 	if store == nil {
 		return Item{} // no-op if absent
 	}
 
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
 	v := *u
 	v.Fragment = ""
 	return store.records[v.String()]
 }
 
-// Store stores the ETags for a given URL.
+// Store stores the metadata for a given URL.
 func (store *DB) Store(u *urlpkg.URL, item Item) {
 	if store == nil {
 		return // no-op if absent
@@ -178,10 +232,45 @@ func (store *DB) Store(u *urlpkg.URL, item Item) {
 	store.syncPeriodically()
 }
 
+// maintenanceKey is the prefix of the keys of the hosts' maintenance windows, which
+// cannot be mistaken for URLs.
+const maintenanceKey = "maintenance:"
+
+// Park records that a host is down for maintenance until the given time, so that a
+// later run also leaves it alone until then. A zero time removes the record.
+func (store *DB) Park(host string, until time.Time) {
+	if store == nil {
+		return // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if until.IsZero() {
+		delete(store.records, maintenanceKey+host)
+	} else {
+		store.records[maintenanceKey+host] = Item{Expires: until, Status: http.StatusServiceUnavailable}
+	}
+
+	store.syncPeriodically()
+}
+
+// ParkedUntil gets the time until which a host is down for maintenance, which is zero
+// if none has been recorded. The time may have passed.
+func (store *DB) ParkedUntil(host string) time.Time {
+	if store == nil {
+		return time.Time{} // no-op if absent
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.records[maintenanceKey+host].Expires
+}
+
 func (store *DB) flush() {
 	file, err := store.fs.Create(store.file)
 	if err != nil {
-		logger.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", store.file))
+		store.log.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", store.file))
 		return
 	}
 	defer file.Close()
@@ -195,7 +284,7 @@ func (store *DB) flush() {
 	buf := bufio.NewWriter(file)
 	for _, key := range keys {
 		if err := writeItem(buf, key, store.records[key]); err != nil {
-			logger.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", store.file))
+			store.log.Warn("Cannot create DB", slog.Any("err", err), slog.String("file", store.file))
 			return
 		}
 	}
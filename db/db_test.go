@@ -1,6 +1,7 @@
 package db
 
 import (
+	"github.com/cornelk/goscrape/logger"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"net/url"
@@ -16,16 +17,24 @@ func TestStringRepresentation(t *testing.T) {
 	writeItem(buf, "k1", Item{Expires: t1})
 	writeItem(buf, "k2", Item{Expires: t1.Add(time.Hour), ETags: `"abc123"`})
 	writeItem(buf, "k3", Item{ETags: `"def123"`})
+	writeItem(buf, "k4", Item{LastModified: t1, Fetched: t1.Add(time.Hour), Status: 200, Hash: "cafe"})
 	s := buf.String()
 	assert.Equal(t, `k1	2000-01-01T01:01:01Z
 k2	2000-01-01T02:01:01Z	"abc123"
 k3	-	"def123"
+k4	-	-	2000-01-01T01:01:01Z	2000-01-01T02:01:01Z	200	cafe
 `, s)
+
+	records, _ := readFile(strings.NewReader(s))
+	assert.Len(t, records, 4)
+	assert.Equal(t, Item{ETags: `"abc123"`, Expires: t1.Add(time.Hour)}, records["k2"])
+	assert.Equal(t, Item{ETags: `"def123"`}, records["k3"])
+	assert.Equal(t, Item{LastModified: t1, Fetched: t1.Add(time.Hour), Status: 200, Hash: "cafe"}, records["k4"])
 }
 
 func TestDB(t *testing.T) {
 	fs := afero.NewOsFs()
-	store1 := OpenDB(".", fs)
+	store1 := OpenDB(".", fs, logger.Discard())
 	defer os.Remove("./" + FileName)
 	defer store1.Close()
 
@@ -55,7 +64,7 @@ func TestDB(t *testing.T) {
 
 	//-------------------------------------------
 
-	store2 := OpenDB(".", fs)
+	store2 := OpenDB(".", fs, logger.Discard())
 	store2.Store(u3, Item{})
 
 	w1 := store2.Lookup(u1)
@@ -70,6 +79,24 @@ func TestDB(t *testing.T) {
 	assert.True(t, w3.Expires.IsZero())
 }
 
+func TestPark(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	until := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	store1 := OpenDB("state", fs, logger.Discard())
+	store1.Park("example.org", until)
+	assert.True(t, store1.Lookup(mustParse("http://example.org/")).Empty(), "not mistaken for a URL")
+	assert.NoError(t, store1.Close())
+
+	store2 := OpenDB("state", fs, logger.Discard())
+	assert.Equal(t, until, store2.ParkedUntil("example.org"))
+	assert.True(t, store2.ParkedUntil("other.example").IsZero())
+
+	store2.Park("example.org", time.Time{})
+	assert.True(t, store2.ParkedUntil("example.org").IsZero())
+	assert.True(t, (*DB)(nil).ParkedUntil("example.org").IsZero())
+}
+
 func mustParse(s string) *url.URL {
 	u, err := url.Parse(s)
 	if err != nil {
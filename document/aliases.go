@@ -0,0 +1,55 @@
+package document
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cornelk/goscrape/htmlindex"
+	"golang.org/x/net/html"
+)
+
+// Canonicalize replaces the references to URLs that have been permanently redirected
+// with the URLs they lead to. The lookup function gets the canonical URL, or nil if
+// there is none. This is done before the references are found, so that the redirected
+// URLs are not followed again. It returns the number of references replaced.
+func (d *HTMLDocument) Canonicalize(lookup func(*url.URL) *url.URL) int {
+	n := 0
+
+	walkElements(d.doc, func(node *html.Node) bool {
+		info, ok := htmlindex.Nodes[node.DataAtom]
+		if !ok {
+			return true
+		}
+
+		for i, attr := range node.Attr {
+			if _, isSrcSet := htmlindex.SrcSetAttributes[attr.Key]; isSrcSet || !slices.Contains(info.Attributes, attr.Key) {
+				continue
+			}
+
+			ref, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil || (ref.Host == "" && ref.Path == "" && ref.RawQuery == "") {
+				continue // a fragment on its own refers to this page
+			}
+
+			if canonical := lookup(d.u.ResolveReference(ref)); canonical != nil {
+				node.Attr[i].Val = canonical.String()
+				n++
+			}
+		}
+		return true
+	})
+
+	if n > 0 {
+		d.index = htmlindex.New()
+		d.index.Index(d.u, d.doc)
+		d.modified = true
+	}
+	return n
+}
+
+// RelativeLink gets the link from the page stored for one URL to the file stored for
+// another, which must be on the same website.
+func RelativeLink(from, to *url.URL) string {
+	return resolveURL(from, to.String(), from.Host, urlRelativeToRoot(from))
+}
@@ -0,0 +1,43 @@
+package document
+
+import (
+	"strings"
+
+	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// FindAlternates finds the links to alternative versions of the page that are
+// intended for mobile devices, i.e. link elements with rel="amphtml", or with
+// rel="alternate" and a media query. Translations and feeds are not included.
+func (d *HTMLDocument) FindAlternates() work.Refs {
+	base := d.u
+	if href := findBaseHref(d.doc); href != "" {
+		if u, err := d.u.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	var result work.Refs
+	walkElements(d.doc, func(node *html.Node) bool {
+		if node.DataAtom == atom.Link && isMobileAlternate(node) {
+			if href := strings.TrimSpace(getAttr(node, "href")); href != "" {
+				if u, err := base.Parse(href); err == nil {
+					u.Fragment = ""
+					result = append(result, u)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+func isMobileAlternate(node *html.Node) bool {
+	if hasRel(node, []string{"amphtml"}) {
+		return true
+	}
+	_, hasMedia := lookupAttr(node, "media")
+	return hasMedia && hasRel(node, []string{"alternate"})
+}
@@ -0,0 +1,30 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAlternates(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/news/story")
+
+	b := []byte(`<html><head>
+  <link rel="amphtml" href="/news/story/amp/">
+  <link rel="alternate" media="only screen and (max-width: 640px)" href="http://m.domain.com/news/story#top">
+  <link rel="alternate" hreflang="fr" href="/fr/news/story">
+  <link rel="alternate" type="application/rss+xml" href="/feed.xml">
+  <link rel="canonical" href="/news/story">
+</head>
+<body><a href="/news/story/amp/">AMP</a></body></html>
+`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+
+	refs := doc.FindAlternates()
+	assert.Equal(t, "domain.com/news/story/amp/ m.domain.com/news/story", refs.String())
+}
@@ -1,75 +1,292 @@
 package document
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/url"
 	"path"
-	"regexp"
 	"strings"
 
 	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/work"
-	"github.com/gorilla/css/scanner"
 )
 
-var cssURLRe = regexp.MustCompile(`^url\(['"]?(.*?)['"]?\)$`)
+// maxCSSToken is the longest url() token that is rewritten. Longer ones, such as big
+// embedded images, are copied unchanged. It is also the size of the read buffer.
+const maxCSSToken = 64 << 10
 
-func CheckCSSForUrls(cssURL *url.URL, startURLHost string, data []byte) ([]byte, work.Refs) {
-	var refs work.Refs
-	urls := make(map[string]string)
-	str := string(data)
-	css := scanner.New(str)
+// CheckCSSForUrls finds the url() references in a stylesheet held in memory and
+// rewrites them to point to relative file names. See RewriteCSS.
+func CheckCSSForUrls(cssURL *url.URL, startURLHost string, data []byte, log *logger.Logger) ([]byte, work.Refs) {
+	buf := &bytes.Buffer{}
+	buf.Grow(len(data))
+	refs, _ := RewriteCSS(cssURL, startURLHost, bytes.NewReader(data), buf, log) // in memory, this can't fail
+	return buf.Bytes(), refs
+}
+
+// RewriteCSS copies a stylesheet from r to w, rewriting its url() references to point
+// to relative file names, and returns the references. Comments, strings and embedded
+// data are copied unchanged. The stylesheet is processed in a single pass through a
+// small buffer, so the memory needed does not depend on its size.
+func RewriteCSS(cssURL *url.URL, startURLHost string, r io.Reader, w io.Writer, log *logger.Logger) (work.Refs, error) {
+	dir := *cssURL
+	dir.Path = path.Dir(dir.Path) + "/"
+
+	rw := &cssRewriter{
+		in:           bufio.NewReaderSize(r, maxCSSToken),
+		out:          bufio.NewWriter(w),
+		cssURL:       cssURL,
+		dir:          &dir,
+		startURLHost: startURLHost,
+		log:          log,
+	}
+
+	if err := rw.run(); err != nil {
+		return rw.refs, err
+	}
+	return rw.refs, rw.out.Flush()
+}
+
+type cssRewriter struct {
+	in           *bufio.Reader
+	out          *bufio.Writer
+	cssURL       *url.URL
+	dir          *url.URL // the directory of the stylesheet, relative to which references are rewritten
+	startURLHost string
+	refs         work.Refs
+	log          *logger.Logger
+}
 
+func (rw *cssRewriter) run() error {
 	for {
-		token := css.Next()
-		if token.Type == scanner.TokenEOF || token.Type == scanner.TokenError {
-			break
+		c, err := rw.in.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
 		}
 
-		if token.Type != scanner.TokenURI {
-			continue
+		switch {
+		case c == '/' && rw.next() == '*':
+			err = rw.copyComment()
+
+		case c == '"' || c == '\'':
+			err = rw.copyString(c)
+
+		case c == '\\': // an escape; the next character is literal
+			rw.out.WriteByte(c)
+			err = rw.copyByte()
+
+		case isCSSNameByte(c):
+			err = rw.name(c)
+
+		default:
+			err = rw.out.WriteByte(c)
 		}
 
-		match := cssURLRe.FindStringSubmatch(token.Value)
-		if match == nil {
-			continue
+		if err != nil {
+			return err
 		}
+	}
+}
 
-		src := match[1]
-		if strings.HasPrefix(strings.ToLower(src), "data:") {
-			continue // skip embedded data
+// next peeks at the next byte, or returns 0 at the end.
+func (rw *cssRewriter) next() byte {
+	if b, _ := rw.in.Peek(1); len(b) == 1 {
+		return b[0]
+	}
+	return 0
+}
+
+func (rw *cssRewriter) copyByte() error {
+	c, err := rw.in.ReadByte()
+	if err != nil {
+		return ignoreEOF(err)
+	}
+	return rw.out.WriteByte(c)
+}
+
+// copyComment copies a comment, starting from its slash.
+func (rw *cssRewriter) copyComment() error {
+	rw.out.WriteByte('/')
+	var prev byte
+	for {
+		c, err := rw.in.ReadByte()
+		if err != nil {
+			return ignoreEOF(err) // unterminated
+		}
+		rw.out.WriteByte(c)
+		if prev == '*' && c == '/' {
+			return nil
 		}
+		prev = c
+	}
+}
 
-		u, err := cssURL.Parse(src)
+// copyString copies a string, starting from its opening quote.
+func (rw *cssRewriter) copyString(quote byte) error {
+	rw.out.WriteByte(quote)
+	for {
+		c, err := rw.in.ReadByte()
 		if err != nil {
-			logger.Logger.Error("Parsing URL failed",
-				slog.String("url", src),
-				slog.Any("error", err))
-			continue
+			return ignoreEOF(err) // unterminated
+		}
+		rw.out.WriteByte(c)
+		switch c {
+		case '\\':
+			if err := rw.copyByte(); err != nil {
+				return err
+			}
+		case quote, '\n':
+			return nil
+		}
+	}
+}
+
+// name copies an identifier, number or unit, unless it starts a url() token, which is
+// rewritten instead.
+func (rw *cssRewriter) name(first byte) error {
+	var sb strings.Builder
+	sb.WriteByte(first)
+	for isCSSNameByte(rw.next()) {
+		c, _ := rw.in.ReadByte()
+		sb.WriteByte(c)
+	}
+
+	name := sb.String()
+	if strings.EqualFold(name, "url") && rw.next() == '(' {
+		if done, err := rw.url(); done || err != nil {
+			return err
 		}
+	}
 
-		u = cssURL.ResolveReference(u)
+	_, err := rw.out.WriteString(name)
+	return err
+}
 
-		refs = append(refs, u)
+// url rewrites the url() token that follows its name. It returns false if the token is
+// to be copied unchanged, in which case nothing has been consumed.
+func (rw *cssRewriter) url() (bool, error) {
+	data, err := rw.in.Peek(maxCSSToken)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
 
-		cssPath := *cssURL
-		cssPath.Path = path.Dir(cssPath.Path) + "/"
-		resolved := resolveURL(&cssPath, src, startURLHost, "")
-		urls[token.Value] = resolved
+	src, n := parseURLToken(data)
+	if n == 0 || src == "" || strings.HasPrefix(strings.ToLower(src), "data:") {
+		return false, nil // embedded data is not rewritten, nor is an invalid or overlong token
 	}
 
-	if len(urls) == 0 {
-		return data, refs
+	u, err := rw.cssURL.Parse(src)
+	if err != nil {
+		rw.log.Error("Parsing URL failed",
+			slog.String("url", src),
+			slog.Any("error", err))
+		return false, nil
 	}
 
-	for original, filePath := range urls {
-		fixed := fmt.Sprintf("url(%s)", filePath)
-		str = strings.ReplaceAll(str, original, fixed)
-		logger.Debug("CSS element relinked",
-			slog.String("url", original),
-			slog.String("fixed_url", fixed))
+	rw.refs = append(rw.refs, rw.cssURL.ResolveReference(u))
+
+	original := "url" + string(data[:n])
+	fixed := fmt.Sprintf("url(%s)", resolveURL(rw.dir, src, rw.startURLHost, ""))
+	rw.log.Debug("CSS element relinked",
+		slog.String("url", original),
+		slog.String("fixed_url", fixed))
+
+	_, _ = rw.in.Discard(n)
+	_, err = rw.out.WriteString(fixed)
+	return true, err
+}
+
+// parseURLToken parses the rest of a url() token, from its opening parenthesis. It
+// returns the URL and the length of the token, which is zero if data doesn't hold a
+// complete, valid token.
+func parseURLToken(data []byte) (string, int) {
+	i := 1
+	skipSpace := func() {
+		for i < len(data) && isCSSSpace(data[i]) {
+			i++
+		}
+	}
+
+	skipSpace()
+	if i >= len(data) {
+		return "", 0
+	}
+
+	var src string
+	if quote := data[i]; quote == '"' || quote == '\'' {
+		start := i + 1
+		for i = start; i < len(data) && data[i] != quote; i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '\n':
+				return "", 0
+			}
+		}
+		if i >= len(data) {
+			return "", 0
+		}
+		src = unescapeCSS(string(data[start:i]))
+		i++
+	} else {
+		start := i
+		for ; i < len(data) && data[i] != ')' && !isCSSSpace(data[i]); i++ {
+			if c := data[i]; c == '"' || c == '\'' || c == '(' || c == '\\' {
+				return "", 0
+			}
+		}
+		src = string(data[start:i])
 	}
 
-	return []byte(str), refs
+	skipSpace()
+	if i >= len(data) || data[i] != ')' {
+		return "", 0
+	}
+	return src, i + 1
+}
+
+// unescapeCSS removes the backslashes from the simple escapes in a CSS string, such as \'.
+// Hexadecimal escapes are left as they are.
+func unescapeCSS(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && !isHexDigit(s[i+1]) {
+			i++
+			if s[i] == '\n' {
+				continue // a line continuation
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isCSSNameByte(c byte) bool {
+	return c == '-' || c == '_' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
 }
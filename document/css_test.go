@@ -1,19 +1,17 @@
 package document
 
 import (
-	"io"
-	"log/slog"
 	"net/url"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/cornelk/goscrape/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCheckCSSForURLs(t *testing.T) {
-	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
-
 	cases := []struct{ input, resolved, ref string }{
 		{
 			input:    "url('http://localhost/uri/between/single/quote')",
@@ -58,7 +56,7 @@ func TestCheckCSSForURLs(t *testing.T) {
 	cssURL, _ := url.Parse("http://localhost/css/x/page.css")
 
 	for _, c := range cases {
-		revised, refs := CheckCSSForUrls(cssURL, "localhost", []byte(c.input))
+		revised, refs := CheckCSSForUrls(cssURL, "localhost", []byte(c.input), logger.Discard())
 
 		if c.ref == "" {
 			assert.Empty(t, refs)
@@ -71,3 +69,34 @@ func TestCheckCSSForURLs(t *testing.T) {
 		assert.True(t, strings.Contains(string(revised), c.resolved), string(revised))
 	}
 }
+
+func TestRewriteCSS(t *testing.T) {
+	cssURL, _ := url.Parse("http://localhost/css/page.css")
+
+	input := `/* url(/comment.png) */ a { content: "url(/string.png)"; background: URL( "/a.png" ) }
+b { mask: myurl(/b.png); background: url(data:image/gif;base64,R0lGODl) }
+c { background: url('/c\'d.png') } e { background: url("/f(1).png") } d { background: url(/e.png`
+
+	expected := `/* url(/comment.png) */ a { content: "url(/string.png)"; background: url(../a.png) }
+b { mask: myurl(/b.png); background: url(data:image/gif;base64,R0lGODl) }
+c { background: url(../c%27d.png) } e { background: url(../f%281%29.png) } d { background: url(/e.png`
+
+	out := &strings.Builder{}
+	refs, err := RewriteCSS(cssURL, "localhost", iotest.OneByteReader(strings.NewReader(input)), out, logger.Discard())
+	require.NoError(t, err)
+	assert.Equal(t, expected, out.String())
+	assert.Equal(t, "localhost/a.png localhost/c'd.png localhost/f(1).png", refs.String())
+}
+
+func TestRewriteCSS_Large(t *testing.T) {
+	cssURL, _ := url.Parse("http://localhost/page.css")
+
+	long := "url(/" + strings.Repeat("x", maxCSSToken) + ".png)"
+	input := strings.Repeat("a { background: url(/a.png) }\n", 10000) + long
+
+	out := &strings.Builder{}
+	refs, err := RewriteCSS(cssURL, "localhost", strings.NewReader(input), out, logger.Discard())
+	require.NoError(t, err)
+	assert.Len(t, refs, 10000)
+	assert.Equal(t, strings.Repeat("a { background: url(a.png) }\n", 10000)+long, out.String()) // the overlong token is unchanged
+}
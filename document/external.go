@@ -0,0 +1,80 @@
+package document
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ExternalStubPage is the page, in the root directory of a mirrored website, through
+// which external links can be routed to warn that they lead out of the archive.
+const ExternalStubPage = "_external.html"
+
+// AnnotateExternalLinks marks the hyperlinks that lead to other websites, which are
+// not downloaded. They open in a new window and their title shows where they lead.
+// If viaStub is true, FixURLReferences also routes them through ExternalStubPage,
+// with the original URL in the fragment. It returns the number of anchors changed.
+func (d *HTMLDocument) AnnotateExternalLinks(viaStub bool) int {
+	n := 0
+
+	for ref, nodes := range d.index.Nodes(atom.A) {
+		u, err := url.Parse(ref)
+		if err != nil || u.Host == d.startURL.Host || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		for _, node := range nodes {
+			setAttr(node, "target", "_blank")
+			addRels(node, "external", "noopener")
+			if getAttr(node, "title") == "" {
+				setAttr(node, "title", "External link: "+ref)
+			}
+			if viaStub {
+				d.stubbed = append(d.stubbed, stubbedLink{node: node, ref: ref})
+			}
+			n++
+		}
+	}
+
+	if n > 0 {
+		d.modified = true
+	}
+	return n
+}
+
+// stubbedLink is an anchor to be routed through ExternalStubPage.
+type stubbedLink struct {
+	node *html.Node
+	ref  string
+}
+
+// routeViaStub changes the stubbed links to lead to ExternalStubPage. This is done
+// after the other links have been rewritten, which would otherwise alter them.
+func (d *HTMLDocument) routeViaStub(relativeToRoot string) {
+	for _, link := range d.stubbed {
+		setAttr(link.node, "href", relativeToRoot+ExternalStubPage+"#"+url.PathEscape(link.ref))
+	}
+}
+
+func setAttr(node *html.Node, key, value string) {
+	for i, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func addRels(node *html.Node, rels ...string) {
+	existing := strings.Fields(getAttr(node, "rel"))
+	for _, rel := range rels {
+		if !slices.Contains(existing, rel) {
+			existing = append(existing, rel)
+		}
+	}
+	setAttr(node, "rel", strings.Join(existing, " "))
+}
@@ -0,0 +1,36 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotateExternalLinks(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/docs/page")
+	b := []byte(`<html><head></head><body>` +
+		`<a href="/about">About</a>` +
+		`<a href="https://other.org/x?y=1" rel="nofollow">Other</a>` +
+		`<a href="mailto:me@domain.com">Mail</a>` +
+		`</body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, doc.AnnotateExternalLinks(false))
+
+	fixed, _, err := doc.FixURLReferences()
+	require.NoError(t, err)
+	assert.Contains(t, string(fixed), `<a href="https://other.org/x?y=1" rel="nofollow external noopener" target="_blank" title="External link: https://other.org/x?y=1">Other</a>`)
+	assert.Contains(t, string(fixed), `<a href="mailto:me@domain.com">Mail</a>`)
+
+	doc, err = ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, doc.AnnotateExternalLinks(true))
+
+	fixed, _, err = doc.FixURLReferences()
+	require.NoError(t, err)
+	assert.Contains(t, string(fixed), `<a href="../_external.html#https:%2F%2Fother.org%2Fx%3Fy=1" rel="nofollow external noopener" target="_blank" title="External link: https://other.org/x?y=1">Other</a>`)
+}
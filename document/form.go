@@ -0,0 +1,277 @@
+package document
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MaxFormSubmissions limits the number of URLs generated from any one form, because
+// forms with several choices can produce a combinatorial explosion.
+const MaxFormSubmissions = 200
+
+// formField is a name/value pair that a form submits.
+type formField struct {
+	name, value string
+}
+
+// formChoice lists the alternatives for one control (or group of radio buttons);
+// each alternative contributes zero or more fields to the submission.
+type formChoice [][]formField
+
+// FindForms finds the URLs that would result from submitting each simple GET form
+// in the document, which is how some archives (e.g. A-Z indexes) are reached. Every
+// option of each select control, radio group and submit button gives a separate
+// submission. Values supplied for a control replace its own values; several values
+// for the same name give separate submissions. POST forms and forms leading to other
+// websites are ignored.
+func (d *HTMLDocument) FindForms(values url.Values) work.Refs {
+	base := d.u
+	if href := findBaseHref(d.doc); href != "" {
+		if u, err := d.u.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	var result work.Refs
+	walkElements(d.doc, func(node *html.Node) bool {
+		if node.DataAtom != atom.Form {
+			return true
+		}
+		result = append(result, d.formSubmissions(base, node, values)...)
+		return false // nested forms are not allowed
+	})
+	return result
+}
+
+func (d *HTMLDocument) formSubmissions(base *url.URL, form *html.Node, values url.Values) work.Refs {
+	method := strings.ToLower(strings.TrimSpace(getAttr(form, "method")))
+	if method != "" && method != "get" {
+		return nil
+	}
+
+	action, err := base.Parse(strings.TrimSpace(getAttr(form, "action")))
+	if err != nil || action.Host != d.startURL.Host {
+		return nil
+	}
+	action.Fragment = ""
+
+	choices := formChoices(form, values)
+
+	var result work.Refs
+	forEachCombination(choices, func(fields []formField) bool {
+		u := *action
+		u.RawQuery = encodeFormFields(fields)
+		result = append(result, &u)
+		return len(result) < MaxFormSubmissions
+	})
+
+	if len(result) == MaxFormSubmissions {
+		d.log.Warn("Form has too many choices; some were ignored",
+			slog.String("url", d.u.String()),
+			slog.String("action", action.String()),
+			slog.Int("limit", MaxFormSubmissions))
+	}
+
+	return result
+}
+
+// formChoices gets the choices for all the controls of a form, in document order.
+func formChoices(form *html.Node, values url.Values) []formChoice {
+	var choices []formChoice
+	radios := map[string]int{}    // index into choices for each radio group
+	supplied := map[string]bool{} // names for which the supplied values have been used
+	var submitters formChoice
+
+	walkElements(form, func(node *html.Node) bool {
+		name := getAttr(node, "name")
+		_, disabled := lookupAttr(node, "disabled")
+		if disabled {
+			return false
+		}
+
+		if vs := values[name]; name != "" && vs != nil && isFormControl(node) {
+			if !supplied[name] {
+				supplied[name] = true
+				var choice formChoice
+				for _, v := range vs {
+					choice = append(choice, []formField{{name, v}})
+				}
+				choices = append(choices, choice)
+			}
+			return false
+		}
+
+		switch node.DataAtom {
+		case atom.Input:
+			kind := strings.ToLower(getAttr(node, "type"))
+			switch kind {
+			case "submit", "image":
+				if name != "" {
+					submitters = append(submitters, []formField{{name, getAttr(node, "value")}})
+				}
+
+			case "radio":
+				if name == "" {
+					break
+				}
+				alternative := []formField{{name, valueOr(node, "on")}}
+				if i, exists := radios[name]; exists {
+					choices[i] = append(choices[i], alternative)
+				} else {
+					radios[name] = len(choices)
+					choices = append(choices, formChoice{alternative})
+				}
+
+			case "checkbox":
+				if _, checked := lookupAttr(node, "checked"); checked && name != "" {
+					choices = append(choices, formChoice{{{name, valueOr(node, "on")}}})
+				}
+
+			case "file", "password", "reset", "button":
+				// never submitted
+
+			default:
+				if name != "" {
+					choices = append(choices, formChoice{{{name, getAttr(node, "value")}}})
+				}
+			}
+
+		case atom.Button:
+			kind := strings.ToLower(getAttr(node, "type"))
+			if (kind == "" || kind == "submit") && name != "" {
+				submitters = append(submitters, []formField{{name, getAttr(node, "value")}})
+			}
+			return false
+
+		case atom.Select:
+			if name != "" {
+				var choice formChoice
+				walkElements(node, func(option *html.Node) bool {
+					if option.DataAtom == atom.Option {
+						if _, disabled := lookupAttr(option, "disabled"); !disabled {
+							choice = append(choice, []formField{{name, optionValue(option)}})
+						}
+						return false
+					}
+					return true
+				})
+				if len(choice) > 0 {
+					choices = append(choices, choice)
+				}
+			}
+			return false
+
+		case atom.Textarea:
+			if name != "" {
+				choices = append(choices, formChoice{{{name, textContent(node)}}})
+			}
+			return false
+		}
+
+		return true
+	})
+
+	if len(submitters) > 0 {
+		choices = append(choices, submitters)
+	}
+
+	return choices
+}
+
+// forEachCombination calls fn with every combination of the alternatives of each
+// choice, stopping when fn returns false.
+func forEachCombination(choices []formChoice, fn func([]formField) bool) {
+	var recurse func(i int, fields []formField) bool
+	recurse = func(i int, fields []formField) bool {
+		if i == len(choices) {
+			return fn(fields)
+		}
+		for _, alternative := range choices[i] {
+			next := append(fields[:len(fields):len(fields)], alternative...)
+			if !recurse(i+1, next) {
+				return false
+			}
+		}
+		return true
+	}
+	recurse(0, nil)
+}
+
+// encodeFormFields encodes the fields as a query string, retaining their order as
+// browsers do (unlike url.Values.Encode, which sorts them).
+func encodeFormFields(fields []formField) string {
+	var sb strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(f.name))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(f.value))
+	}
+	return sb.String()
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func findBaseHref(doc *html.Node) (href string) {
+	walkElements(doc, func(node *html.Node) bool {
+		if node.DataAtom == atom.Base && href == "" {
+			href = getAttr(node, "href")
+		}
+		return href == ""
+	})
+	return href
+}
+
+func isFormControl(node *html.Node) bool {
+	switch node.DataAtom {
+	case atom.Input, atom.Button, atom.Select, atom.Textarea:
+		return true
+	}
+	return false
+}
+
+func lookupAttr(node *html.Node, key string) (string, bool) {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func getAttr(node *html.Node, key string) string {
+	v, _ := lookupAttr(node, key)
+	return v
+}
+
+func valueOr(node *html.Node, def string) string {
+	if v, ok := lookupAttr(node, "value"); ok {
+		return v
+	}
+	return def
+}
+
+func optionValue(option *html.Node) string {
+	if v, ok := lookupAttr(option, "value"); ok {
+		return v
+	}
+	return strings.TrimSpace(textContent(option))
+}
+
+func textContent(node *html.Node) string {
+	var sb strings.Builder
+	walkNodes(node, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		return true
+	}, nil)
+	return sb.String()
+}
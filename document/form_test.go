@@ -0,0 +1,75 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindForms(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/archive/")
+
+	b := []byte(`<html><head></head>
+<body>
+  <form action="index.php">
+    <input type="hidden" name="section" value="news">
+    <select name="letter">
+      <option>A</option>
+      <option value="b">B</option>
+      <option disabled>C</option>
+    </select>
+    <input type="submit" value="Go">
+  </form>
+  <form action="/search" method="get">
+    <input name="q">
+    <input type="radio" name="sort" value="date">
+    <input type="radio" name="sort" value="title">
+    <input type="password" name="secret">
+  </form>
+  <form action="/login" method="post">
+    <input name="user">
+  </form>
+  <form action="http://elsewhere.com/search">
+    <input name="q">
+  </form>
+</body></html>
+`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+
+	refs := doc.FindForms(url.Values{"q": {"x y", "z"}})
+
+	var list []string
+	for _, ref := range refs {
+		list = append(list, ref.String())
+	}
+
+	assert.Equal(t, []string{
+		"http://domain.com/archive/index.php?section=news&letter=A",
+		"http://domain.com/archive/index.php?section=news&letter=b",
+		"http://domain.com/search?q=x+y&sort=date",
+		"http://domain.com/search?q=x+y&sort=title",
+		"http://domain.com/search?q=z&sort=date",
+		"http://domain.com/search?q=z&sort=title",
+	}, list)
+}
+
+func TestFindForms_limit(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/")
+
+	var options bytes.Buffer
+	for i := range 30 {
+		options.WriteString("<option>" + string(rune('a'+i)) + "</option>")
+	}
+
+	b := []byte(`<form><select name="x">` + options.String() + `</select><select name="y">` + options.String() + `</select></form>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+
+	assert.Len(t, doc.FindForms(nil), MaxFormSubmissions)
+}
@@ -28,9 +28,12 @@ type HTMLDocument struct {
 	startURL *url.URL
 	doc      *html.Node
 	index    *htmlindex.Index
+	modified bool // elements have been removed or inserted
+	stubbed  []stubbedLink
+	log      *logger.Logger
 }
 
-func ParseHTML(u, startURL *url.URL, rdr io.Reader) (*HTMLDocument, error) {
+func ParseHTML(u, startURL *url.URL, rdr io.Reader, log *logger.Logger) (*HTMLDocument, error) {
 	doc, err := html.Parse(rdr)
 	if err != nil {
 		return nil, fmt.Errorf("parsing: %w", err)
@@ -39,17 +42,18 @@ func ParseHTML(u, startURL *url.URL, rdr io.Reader) (*HTMLDocument, error) {
 	index := htmlindex.New()
 	index.Index(u, doc)
 
-	return &HTMLDocument{u: u, startURL: startURL, doc: doc, index: index}, nil
+	return &HTMLDocument{u: u, startURL: startURL, doc: doc, index: index, log: log}, nil
 }
 
 // FixURLReferences fixes URL references to point to relative file names.
-// It returns a bool that indicates that no reference needed to be fixed,
-// in this case the returned HTML string will be empty.
+// It returns a bool that indicates that no reference needed to be fixed
+// and nothing was pruned, in this case the returned HTML string will be empty.
 func (d *HTMLDocument) FixURLReferences() ([]byte, bool, error) {
 	relativeToRoot := urlRelativeToRoot(d.u)
-	if !fixHTMLNodeURLs(d.u, d.startURL.Host, relativeToRoot, d.index) {
+	if !fixHTMLNodeURLs(d.u, d.startURL.Host, relativeToRoot, d.index, d.log) && !d.modified {
 		return nil, false, nil
 	}
+	d.routeViaStub(relativeToRoot)
 
 	var rendered bytes.Buffer
 	if err := html.Render(&rendered, d.doc); err != nil {
@@ -58,16 +62,80 @@ func (d *HTMLDocument) FixURLReferences() ([]byte, bool, error) {
 	return rendered.Bytes(), true, nil
 }
 
+// Prune removes the elements that match the selector, along with their content. The
+// references within them are no longer found. It returns the number of elements removed.
+func (d *HTMLDocument) Prune(selector *Selector) int {
+	if selector == nil {
+		return 0
+	}
+
+	var matched []*html.Node
+	walkElements(d.doc, func(node *html.Node) bool {
+		if selector.Matches(node) {
+			matched = append(matched, node)
+			return false // the content goes too
+		}
+		return true
+	})
+
+	if len(matched) == 0 {
+		return 0
+	}
+
+	for _, node := range matched {
+		node.Parent.RemoveChild(node)
+	}
+
+	d.index = htmlindex.New()
+	d.index.Index(d.u, d.doc)
+	d.modified = true
+	return len(matched)
+}
+
+// Inject inserts an HTML snippet at the start or end of the content of the target
+// element, which is normally atom.Head or atom.Body. The snippet is not indexed, so
+// its references are neither found nor rewritten.
+func (d *HTMLDocument) Inject(snippet string, target atom.Atom, atStart bool) error {
+	var parent *html.Node
+	walkElements(d.doc, func(node *html.Node) bool {
+		if node.DataAtom == target && parent == nil {
+			parent = node
+		}
+		return parent == nil
+	})
+
+	if parent == nil {
+		return fmt.Errorf("%s has no %s element", d.u, target)
+	}
+
+	nodes, err := html.ParseFragment(strings.NewReader(snippet), parent)
+	if err != nil {
+		return fmt.Errorf("parsing snippet: %w", err)
+	}
+
+	first := parent.FirstChild
+	for _, node := range nodes {
+		if atStart {
+			parent.InsertBefore(node, first)
+		} else {
+			parent.AppendChild(node)
+		}
+	}
+
+	d.modified = true
+	return nil
+}
+
 // fixHTMLNodeURLs processes all HTML nodes that contain URLs that need to be fixed
 // to link to downloaded files. It returns whether any URLS have been fixed.
-func fixHTMLNodeURLs(baseURL *url.URL, startURLHost string, relativeToRoot string, index *htmlindex.Index) (changed bool) {
+func fixHTMLNodeURLs(baseURL *url.URL, startURLHost string, relativeToRoot string, index *htmlindex.Index, log *logger.Logger) (changed bool) {
 	for tag, nodeInfo := range htmlindex.Nodes {
 		isHyperlink := tag == atom.A
 
 		urls := index.Nodes(tag)
 		for _, nodes := range urls {
 			for _, node := range nodes {
-				if fixHTMLNodeURL(baseURL, nodeInfo.Attributes, node, startURLHost, isHyperlink, relativeToRoot) {
+				if fixHTMLNodeURL(baseURL, nodeInfo.Attributes, node, startURLHost, isHyperlink, relativeToRoot, log) {
 					changed = true
 				}
 			}
@@ -79,7 +147,7 @@ func fixHTMLNodeURLs(baseURL *url.URL, startURLHost string, relativeToRoot strin
 
 // fixHTMLNodeURL fixes the URL references of a HTML node to point to a relative file name.
 // It returns true if any attribute value bas been adjusted.
-func fixHTMLNodeURL(baseURL *url.URL, attributes []string, node *html.Node, startURLHost string, isHyperlink bool, relativeToRoot string) (changed bool) {
+func fixHTMLNodeURL(baseURL *url.URL, attributes []string, node *html.Node, startURLHost string, isHyperlink bool, relativeToRoot string, log *logger.Logger) (changed bool) {
 	for i, attr := range node.Attr {
 		if !slices.Contains(attributes, attr.Key) {
 			continue
@@ -109,7 +177,7 @@ func fixHTMLNodeURL(baseURL *url.URL, attributes []string, node *html.Node, star
 			attribute.Val = adjusted
 			changed = true
 
-			logger.Debug("HTML node relinked",
+			log.Debug("HTML node relinked",
 				slog.String("value", value),
 				slog.String("fixed_value", adjusted))
 		}
@@ -2,18 +2,16 @@ package document
 
 import (
 	"bytes"
-	"io"
-	"log/slog"
 	"net/url"
 	"testing"
 
 	"github.com/cornelk/goscrape/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html/atom"
 )
 
 func TestFixURLReferences(t *testing.T) {
-	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	u, _ := url.Parse("http://domain.com")
 
 	b := []byte(`<html lang="es"><head></head>
@@ -23,7 +21,7 @@ func TestFixURLReferences(t *testing.T) {
 </body></html>
 `)
 
-	doc, err := ParseHTML(u, u, bytes.NewReader(b))
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), logger.Discard())
 	require.NoError(t, err)
 
 	ref, fixed, err := doc.FixURLReferences()
@@ -38,3 +36,63 @@ func TestFixURLReferences(t *testing.T) {
 </body></html>`
 	assert.Equal(t, expected, string(ref))
 }
+
+func TestTextLines(t *testing.T) {
+	b := []byte(`<html><head><title>The  Title</title><style>p { color: red }</style></head>
+<body>
+  <h1>Heading</h1>
+  <p>Some <b>bold</b>
+     text.<br>Next line</p>
+  <script>var x = "<p>";</script>
+  <ul><li>one</li><li>two</li></ul>
+</body></html>
+`)
+
+	assert.Equal(t, []string{"The Title", "Heading", "Some bold text.", "Next line", "one", "two"}, TextLines(b))
+}
+
+func TestFindReferences_skipRels(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/forum/")
+	b := []byte(`<html><body>
+  <a href="/login" rel="nofollow">Log in</a>
+  <a href="https://spam.example/" rel="ugc nofollow">Spam</a>
+  <a href="/ad" rel="Sponsored">Ad</a>
+  <a href="/topic" rel="nofollow">Topic</a>
+  <a href="/topic#latest">Latest</a>
+  <a href="/about">About</a>
+  <img src="/logo.png">
+</body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), logger.Discard())
+	require.NoError(t, err)
+
+	all, err := doc.FindReferences()
+	require.NoError(t, err)
+	assert.Len(t, all, 7)
+
+	refs, err := doc.FindReferences(NoFollowRels...)
+	require.NoError(t, err)
+	var urls []string
+	for _, ref := range refs {
+		urls = append(urls, ref.String())
+	}
+	assert.ElementsMatch(t, []string{"http://domain.com/topic", "http://domain.com/about", "http://domain.com/logo.png"}, urls)
+}
+
+func TestInject(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/")
+	b := []byte(`<html><head><title>T</title></head><body><p>Text</p></body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), logger.Discard())
+	require.NoError(t, err)
+
+	require.NoError(t, doc.Inject(`<div class="banner">Archived</div>`, atom.Body, true))
+	require.NoError(t, doc.Inject(`<script src="/search.js"></script>`, atom.Body, false))
+	require.NoError(t, doc.Inject(`<style>.banner { color: red }</style>`, atom.Head, false))
+
+	fixed, changed, err := doc.FixURLReferences()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `<html><head><title>T</title><style>.banner { color: red }</style></head>`+
+		`<body><div class="banner">Archived</div><p>Text</p><script src="/search.js"></script></body></html>`, string(fixed))
+}
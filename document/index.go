@@ -2,23 +2,41 @@ package document
 
 import (
 	"github.com/cornelk/goscrape/htmlindex"
-	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 	"log/slog"
+	"strings"
 )
 
-func (d *HTMLDocument) FindReferences() (work.Refs, error) {
+// NoFollowRels are the link relations of anchors that mark links the author does not
+// vouch for, such as login links and user-generated or paid links.
+var NoFollowRels = []string{"nofollow", "ugc", "sponsored"}
+
+// FindReferences finds the URLs referenced by the document. Anchors with any of the
+// link relations skipRels are ignored, unless another anchor links to the same URL
+// without them.
+func (d *HTMLDocument) FindReferences(skipRels ...string) (work.Refs, error) {
 	var result work.Refs
 	for tag := range htmlindex.Nodes {
 		references, err := d.index.URLs(tag)
 		if err != nil {
-			logger.Error("Getting node URLs failed",
+			d.log.Error("Getting node URLs failed",
 				slog.String("url", d.u.String()),
 				slog.String("node", tag.String()),
 				slog.Any("error", err))
 		}
 
+		var nodes map[string][]*html.Node
+		if tag == atom.A && len(skipRels) > 0 {
+			nodes = d.index.Nodes(tag)
+		}
+
 		for _, ur := range references {
+			if nodes != nil && allHaveRel(nodes[ur.String()], skipRels) {
+				d.log.Debug("Skipping link by rel", slog.String("url", ur.String()))
+				continue
+			}
 			ur.Fragment = ""
 			result = append(result, ur)
 		}
@@ -26,3 +44,24 @@ func (d *HTMLDocument) FindReferences() (work.Refs, error) {
 
 	return result, nil
 }
+
+// allHaveRel returns true if every node has a rel attribute that includes any of rels.
+func allHaveRel(nodes []*html.Node, rels []string) bool {
+	for _, node := range nodes {
+		if !hasRel(node, rels) {
+			return false
+		}
+	}
+	return len(nodes) > 0
+}
+
+func hasRel(node *html.Node, rels []string) bool {
+	for _, r := range strings.Fields(getAttr(node, "rel")) {
+		for _, rel := range rels {
+			if strings.EqualFold(r, rel) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package document
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The names of the meta tags that give the dates of a page, in order of preference.
+var (
+	publishedNames = []string{"article:published_time", "datePublished", "dcterms.created", "dcterms.date", "dc.date", "date"}
+	modifiedNames  = []string{"article:modified_time", "og:updated_time", "dateModified", "dcterms.modified", "last-modified"}
+)
+
+// Metadata gets the title, description, language, canonical URL and dates of the page.
+// The Open Graph title and description are used if the page has no others, and the
+// dates may also come from time elements marked up with schema.org properties.
+func (d *HTMLDocument) Metadata() *work.Metadata {
+	m := &work.Metadata{}
+	metas := make(map[string]string)
+
+	walkElements(d.doc, func(node *html.Node) bool {
+		switch node.DataAtom {
+		case atom.Html:
+			m.Language = strings.TrimSpace(getAttr(node, "lang"))
+
+		case atom.Title:
+			if m.Title == "" {
+				m.Title = strings.Join(strings.Fields(textOf(node)), " ")
+			}
+
+		case atom.Link:
+			if m.Canonical == "" && hasRel(node, []string{"canonical"}) {
+				if ref, err := url.Parse(strings.TrimSpace(getAttr(node, "href"))); err == nil {
+					m.Canonical = d.u.ResolveReference(ref).String()
+				}
+			}
+
+		case atom.Meta:
+			content := strings.TrimSpace(getAttr(node, "content"))
+			for _, key := range []string{"name", "property", "itemprop", "http-equiv"} {
+				if name := strings.ToLower(strings.TrimSpace(getAttr(node, key))); name != "" && metas[name] == "" {
+					metas[name] = content
+				}
+			}
+
+		case atom.Time:
+			if datetime := strings.TrimSpace(getAttr(node, "datetime")); datetime != "" {
+				if prop := strings.ToLower(getAttr(node, "itemprop")); metas[prop] == "" {
+					metas[prop] = datetime
+				}
+			}
+		}
+		return true
+	})
+
+	if m.Title == "" {
+		m.Title = metas["og:title"]
+	}
+
+	m.Description = metas["description"]
+	if m.Description == "" {
+		m.Description = metas["og:description"]
+	}
+
+	if m.Language == "" {
+		m.Language = metas["content-language"]
+	}
+
+	m.Published = firstOf(metas, publishedNames)
+	m.Modified = firstOf(metas, modifiedNames)
+	return m
+}
+
+func firstOf(metas map[string]string, names []string) string {
+	for _, name := range names {
+		if v := metas[strings.ToLower(name)]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func textOf(node *html.Node) string {
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text.WriteString(child.Data)
+		}
+	}
+	return text.String()
+}
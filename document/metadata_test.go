@@ -0,0 +1,50 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/cornelk/goscrape/work"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+	u, _ := url.Parse("https://example.org/news/story")
+
+	cases := map[string]work.Metadata{
+		`<html lang="en-GB"><head><title>
+  A   story </title>
+<meta name="description" content="What happened">
+<meta property="og:title" content="Ignored">
+<link rel="canonical" href="/news/story?id=1">
+<meta property="article:published_time" content="2024-05-06T07:08:09Z">
+<meta property="article:modified_time" content="2024-05-07T00:00:00Z">
+</head><body></body></html>`: {
+			Title:       "A story",
+			Description: "What happened",
+			Language:    "en-GB",
+			Canonical:   "https://example.org/news/story?id=1",
+			Published:   "2024-05-06T07:08:09Z",
+			Modified:    "2024-05-07T00:00:00Z",
+		},
+
+		`<html><head><meta http-equiv="Content-Language" content="fr">
+<meta property="og:title" content="Histoire"><meta property="og:description" content="Ce qui s'est passé">
+</head><body><time itemprop="datePublished" datetime="2024-05-06">6 May</time></body></html>`: {
+			Title:       "Histoire",
+			Description: "Ce qui s'est passé",
+			Language:    "fr",
+			Published:   "2024-05-06",
+		},
+
+		`<html><head></head><body><p>Nothing</p></body></html>`: {},
+	}
+
+	for page, expected := range cases {
+		doc, err := ParseHTML(u, u, bytes.NewReader([]byte(page)), nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, *doc.Metadata(), page)
+	}
+}
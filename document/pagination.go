@@ -0,0 +1,48 @@
+package document
+
+import (
+	"strings"
+
+	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// FindPagination finds the links to the next and previous pages of a series, i.e.
+// link and anchor elements with rel="next" or rel="prev".
+func (d *HTMLDocument) FindPagination() work.Refs {
+	base := d.u
+	if href := findBaseHref(d.doc); href != "" {
+		if u, err := d.u.Parse(href); err == nil {
+			base = u
+		}
+	}
+
+	var result work.Refs
+	walkElements(d.doc, func(node *html.Node) bool {
+		switch node.DataAtom {
+		case atom.Link, atom.A:
+			href := strings.TrimSpace(getAttr(node, "href"))
+			if href != "" && IsPaginationRel(getAttr(node, "rel")) {
+				if u, err := base.Parse(href); err == nil {
+					u.Fragment = ""
+					result = append(result, u)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// IsPaginationRel returns true if a space-separated list of link relations includes
+// "next", "prev" or "previous".
+func IsPaginationRel(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		switch strings.ToLower(r) {
+		case "next", "prev", "previous":
+			return true
+		}
+	}
+	return false
+}
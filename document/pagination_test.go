@@ -0,0 +1,30 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindPagination(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/blog/page/2/")
+
+	b := []byte(`<html><head>
+  <link rel="prev" href="../1/">
+  <link rel="stylesheet" href="/style.css">
+</head>
+<body>
+  <a href="/about">About</a>
+  <a rel="Next nofollow" href="../3/#top">Older posts</a>
+</body></html>
+`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+
+	refs := doc.FindPagination()
+	assert.Equal(t, "domain.com/blog/page/1/ domain.com/blog/page/3/", refs.String())
+}
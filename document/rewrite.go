@@ -0,0 +1,75 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cornelk/goscrape/htmlindex"
+	"golang.org/x/net/html"
+)
+
+// RewriteLinks replaces each reference in the page, including each URL in a srcset,
+// with the result of the rewrite function. This gets the reference as written and
+// returns it unchanged when it should be kept. It returns the number of references
+// replaced.
+func (d *HTMLDocument) RewriteLinks(rewrite func(ref string) string) int {
+	n := 0
+
+	walkElements(d.doc, func(node *html.Node) bool {
+		info, ok := htmlindex.Nodes[node.DataAtom]
+		if !ok {
+			return true
+		}
+
+		for i, attr := range node.Attr {
+			if !slices.Contains(info.Attributes, attr.Key) {
+				continue
+			}
+
+			value := strings.TrimSpace(attr.Val)
+			var adjusted string
+			if _, isSrcSet := htmlindex.SrcSetAttributes[attr.Key]; isSrcSet {
+				adjusted = rewriteSrcSet(value, rewrite)
+			} else {
+				adjusted = rewrite(value)
+			}
+
+			if adjusted != value {
+				node.Attr[i].Val = adjusted
+				n++
+			}
+		}
+		return true
+	})
+
+	if n > 0 {
+		d.modified = true
+	}
+	return n
+}
+
+func rewriteSrcSet(value string, rewrite func(ref string) string) string {
+	candidates := strings.Split(value, ",")
+	for i, candidate := range candidates {
+		parts := strings.Split(strings.TrimSpace(candidate), " ")
+		parts[0] = rewrite(parts[0])
+		candidates[i] = strings.Join(parts, " ")
+	}
+
+	adjusted := strings.Join(candidates, ", ")
+	if strings.ReplaceAll(adjusted, " ", "") == strings.ReplaceAll(value, " ", "") {
+		return value // only the spacing differs
+	}
+	return adjusted
+}
+
+// Render gets the HTML of the page, including any changes made to it.
+func (d *HTMLDocument) Render() ([]byte, error) {
+	var rendered bytes.Buffer
+	if err := html.Render(&rendered, d.doc); err != nil {
+		return nil, fmt.Errorf("rendering html: %w", err)
+	}
+	return rendered.Bytes(), nil
+}
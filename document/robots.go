@@ -0,0 +1,73 @@
+package document
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// RobotsName is the name used to address goscrape specifically in robots meta tags
+// and X-Robots-Tag headers, as opposed to all robots.
+const RobotsName = "goscrape"
+
+// Robots holds the directives of robots meta tags and X-Robots-Tag headers that
+// are relevant for mirroring.
+type Robots struct {
+	NoIndex  bool // the page should not be stored
+	NoFollow bool // the page's links should not be followed
+}
+
+// Merge combines two sets of directives.
+func (r Robots) Merge(other Robots) Robots {
+	return Robots{NoIndex: r.NoIndex || other.NoIndex, NoFollow: r.NoFollow || other.NoFollow}
+}
+
+// ParseRobots parses a comma-separated list of directives, e.g. "noindex, nofollow".
+// Unknown directives are ignored.
+func ParseRobots(content string) Robots {
+	var r Robots
+	for _, directive := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			r.NoIndex = true
+		case "nofollow":
+			r.NoFollow = true
+		case "none":
+			r = Robots{NoIndex: true, NoFollow: true}
+		}
+	}
+	return r
+}
+
+// ParseRobotsHeader parses the values of X-Robots-Tag headers. Directives that are
+// addressed to other robots, e.g. "googlebot: noindex", are ignored.
+func ParseRobotsHeader(values []string) Robots {
+	var r Robots
+	for _, value := range values {
+		if name, rest, found := strings.Cut(value, ":"); found && !strings.ContainsAny(name, ",") {
+			if !strings.EqualFold(strings.TrimSpace(name), RobotsName) {
+				continue // addressed to another robot
+			}
+			value = rest
+		}
+		r = r.Merge(ParseRobots(value))
+	}
+	return r
+}
+
+// Robots gets the directives of the robots meta tags, i.e. those named "robots" or
+// "goscrape".
+func (d *HTMLDocument) Robots() Robots {
+	var r Robots
+	walkElements(d.doc, func(node *html.Node) bool {
+		if node.DataAtom == atom.Meta {
+			name := strings.TrimSpace(getAttr(node, "name"))
+			if strings.EqualFold(name, "robots") || strings.EqualFold(name, RobotsName) {
+				r = r.Merge(ParseRobots(getAttr(node, "content")))
+			}
+		}
+		return node.DataAtom != atom.Body // meta tags are in the head
+	})
+	return r
+}
@@ -0,0 +1,35 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRobots(t *testing.T) {
+	assert.Equal(t, Robots{}, ParseRobots("index, follow, noarchive"))
+	assert.Equal(t, Robots{NoIndex: true}, ParseRobots("NoIndex"))
+	assert.Equal(t, Robots{NoFollow: true}, ParseRobots("max-snippet:20, nofollow"))
+	assert.Equal(t, Robots{NoIndex: true, NoFollow: true}, ParseRobots("none"))
+}
+
+func TestParseRobotsHeader(t *testing.T) {
+	assert.Equal(t, Robots{NoFollow: true}, ParseRobotsHeader([]string{"googlebot: noindex", "nofollow"}))
+	assert.Equal(t, Robots{NoIndex: true}, ParseRobotsHeader([]string{"goscrape: noindex"}))
+	assert.Equal(t, Robots{}, ParseRobotsHeader(nil))
+}
+
+func TestHTMLRobots(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/")
+	b := []byte(`<html><head>
+<meta name="googlebot" content="noindex">
+<meta name="Robots" content="nofollow">
+</head><body><meta name="robots" content="noindex"></body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+	assert.Equal(t, Robots{NoFollow: true}, doc.Robots())
+}
@@ -0,0 +1,68 @@
+package document
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCrawlDelay gets the Crawl-delay of a robots.txt file that applies to goscrape,
+// i.e. that of the group of rules addressed to goscrape or, failing that, to all robots
+// ("*"). The delay is given in seconds, possibly fractional. It returns zero if there
+// is none.
+func ParseCrawlDelay(data []byte) time.Duration {
+	var agents []string
+	var specific, general time.Duration
+	var foundSpecific, foundGeneral bool
+	inRules := false // a group's user-agent lines are followed by its rules
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents, inRules = nil, false // the start of the next group
+			}
+			agents = append(agents, strings.ToLower(value))
+			continue
+		}
+		inRules = true
+
+		if key != "crawl-delay" {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			continue
+		}
+
+		delay := time.Duration(seconds * float64(time.Second))
+		for _, agent := range agents {
+			switch {
+			case agent == RobotsName || strings.HasPrefix(agent, RobotsName+"/"):
+				if !foundSpecific {
+					specific, foundSpecific = delay, true
+				}
+			case agent == "*":
+				if !foundGeneral {
+					general, foundGeneral = delay, true
+				}
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return general
+}
@@ -0,0 +1,31 @@
+package document
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCrawlDelay(t *testing.T) {
+	general := `# comment
+User-agent: googlebot
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2.5
+
+User-agent: bingbot
+Crawl-delay: 20
+`
+	assert.Equal(t, 2500*time.Millisecond, ParseCrawlDelay([]byte(general)))
+
+	specific := general + `
+User-agent: GoScrape
+Crawl-delay: 10 # seconds
+`
+	assert.Equal(t, 10*time.Second, ParseCrawlDelay([]byte(specific)))
+
+	assert.Equal(t, time.Duration(0), ParseCrawlDelay([]byte("User-agent: *\nCrawl-delay: soon\nDisallow:\n")))
+	assert.Equal(t, time.Duration(0), ParseCrawlDelay([]byte("User-agent: bingbot\nCrawl-delay: 5\n")))
+	assert.Equal(t, time.Duration(0), ParseCrawlDelay(nil))
+}
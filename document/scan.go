@@ -0,0 +1,114 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+
+	"github.com/cornelk/goscrape/htmlindex"
+	"github.com/cornelk/goscrape/work"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MaxNesting is the deepest nesting of elements in a page that is parsed into a tree.
+// Browsers impose a similar limit; real pages come nowhere near it.
+const MaxNesting = 512
+
+// TooComplex returns why a page should not be parsed into a tree, because it is larger
+// than maxSize bytes (unless this is zero) or its elements are nested more deeply than
+// MaxNesting. It returns blank if the page is safe to parse. The nesting is estimated
+// using the tokenizer, so this needs little memory, whatever the page.
+func TooComplex(data []byte, maxSize int64) string {
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return fmt.Sprintf("larger than %d bytes", maxSize)
+	}
+
+	depth := 0
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if !uncounted(atom.Lookup(name)) {
+				if depth++; depth > MaxNesting {
+					return fmt.Sprintf("nested more than %d elements deep", MaxNesting)
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if !uncounted(atom.Lookup(name)) && depth > 0 {
+				depth--
+			}
+		}
+	}
+}
+
+// uncounted returns true for the void elements and those whose end tags are normally
+// omitted, which would otherwise inflate the estimated nesting.
+func uncounted(a atom.Atom) bool {
+	switch a {
+	case atom.Area, atom.Base, atom.Br, atom.Col, atom.Embed, atom.Hr, atom.Img, atom.Input,
+		atom.Link, atom.Meta, atom.Param, atom.Source, atom.Track, atom.Wbr,
+		atom.Html, atom.Head, atom.Body, atom.Li, atom.Dt, atom.Dd, atom.P, atom.Rt, atom.Rp,
+		atom.Optgroup, atom.Option, atom.Colgroup, atom.Caption, atom.Thead, atom.Tbody,
+		atom.Tfoot, atom.Tr, atom.Td, atom.Th:
+		return true
+	}
+	return false
+}
+
+// ScanReferences finds the URLs referenced by a page using only the tokenizer, for pages
+// that are too complex to parse into a tree. Anchors with any of the link relations
+// skipRels are ignored. Unlike FindReferences, a <base> element only affects the
+// references that follow it.
+func ScanReferences(u *url.URL, data []byte, skipRels ...string) work.Refs {
+	base := u
+	found := make(map[string]*url.URL)
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return sortedRefs(found)
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.DataAtom == atom.A && len(skipRels) > 0 &&
+				hasRel(&html.Node{Type: html.ElementNode, Attr: token.Attr}, skipRels) {
+				continue
+			}
+
+			references := htmlindex.TokenURLs(base, token)
+			if token.DataAtom == atom.Base {
+				if len(references) == 1 {
+					if newBase, err := url.Parse(references[0]); err == nil {
+						base = newBase
+					}
+				}
+				continue
+			}
+
+			for _, reference := range references {
+				if ur, err := url.Parse(reference); err == nil {
+					ur.Fragment = ""
+					found[ur.String()] = ur
+				}
+			}
+		}
+	}
+}
+
+func sortedRefs(found map[string]*url.URL) work.Refs {
+	refs := make(work.Refs, 0, len(found))
+	for _, key := range slices.Sorted(maps.Keys(found)) {
+		refs = append(refs, found[key])
+	}
+	return refs
+}
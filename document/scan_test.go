@@ -0,0 +1,51 @@
+package document
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+)
+
+func TestTooComplex(t *testing.T) {
+	deep := strings.Repeat("<div>", MaxNesting+1) + "x" + strings.Repeat("</div>", MaxNesting+1)
+	wide := strings.Repeat("<div>x</div>", 10*MaxNesting)
+	list := "<ul>" + strings.Repeat("<li>x", 10*MaxNesting) + "</ul>"
+
+	assert.Equal(t, "", TooComplex([]byte(wide), 0))
+	assert.Equal(t, "", TooComplex([]byte(list), 0))
+	assert.Equal(t, "", TooComplex([]byte(deep[5:len(deep)-6]), 0))
+	assert.Equal(t, "nested more than 512 elements deep", TooComplex([]byte(deep), 0))
+	assert.Equal(t, "larger than 100 bytes", TooComplex([]byte(wide), 100))
+}
+
+func TestScanReferences(t *testing.T) {
+	u, _ := url.Parse("https://example.org/dir/page.html")
+	page := `<html><head><link rel="stylesheet" href="a.css"></head><body>
+<a href="/b#one">b</a><a href="/b#two">b</a><a href="/login" rel="nofollow">log in</a>
+<img src="c.png" srcset="c1.png 1x, c2.png 2x"><p><div><a href="d">d</a>
+<base href="https://example.org/other/"><a href="e">e</a>`
+
+	assert.Equal(t,
+		"example.org/b example.org/dir/a.css example.org/dir/c.png example.org/dir/c1.png example.org/dir/c2.png example.org/dir/d example.org/login example.org/other/e",
+		ScanReferences(u, []byte(page)).String())
+
+	assert.NotContains(t, ScanReferences(u, []byte(page), NoFollowRels...).String(), "login")
+}
+
+func TestWalkNodes(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<p>a<b>b</b></p><div><i>c</i></div><hr>`))
+	assert.NoError(t, err)
+
+	var visits []string
+	walkNodes(doc, func(node *html.Node) bool {
+		visits = append(visits, "+"+node.Data)
+		return node.Data != "div"
+	}, func(node *html.Node) {
+		visits = append(visits, "-"+node.Data)
+	})
+
+	assert.Equal(t, strings.Fields("+html +head -head +body +p +a -a +b +b -b -b -p +div +hr -hr -body -html"), visits)
+}
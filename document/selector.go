@@ -0,0 +1,345 @@
+package document
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector is a list of CSS selectors, any of which may match an element. It supports
+// the commonly-used subset of CSS: type, universal, #id, .class and attribute selectors
+// ([a], [a=v], [a~=v], [a|=v], [a^=v], [a$=v] and [a*=v]), joined by the descendant,
+// child (>), next-sibling (+) and subsequent-sibling (~) combinators. Pseudo-classes are
+// not supported. A nil Selector matches nothing.
+type Selector struct {
+	alternatives []complexSelector
+}
+
+// complexSelector is a sequence of compound selectors; combinators[i] joins parts[i]
+// to parts[i+1].
+type complexSelector struct {
+	parts       []compoundSelector
+	combinators []byte
+}
+
+type compoundSelector struct {
+	tag     string // blank for any
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	key, op, value string // op is blank when the attribute only needs to be present
+}
+
+// ParseSelectors parses one or more selector lists into a single Selector. It returns
+// nil if there are none.
+func ParseSelectors(lists []string) (*Selector, error) {
+	var alternatives []complexSelector
+	for _, list := range lists {
+		s, err := ParseSelector(list)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, s.alternatives...)
+	}
+
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+	return &Selector{alternatives: alternatives}, nil
+}
+
+// ParseSelector parses a comma-separated list of CSS selectors.
+func ParseSelector(list string) (*Selector, error) {
+	p := &selectorParser{s: list}
+	s := &Selector{}
+	for {
+		p.skipSpace()
+		c, err := p.parseComplex()
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", list, err)
+		}
+		s.alternatives = append(s.alternatives, c)
+
+		p.skipSpace()
+		if p.eof() {
+			return s, nil
+		}
+		if p.s[p.i] != ',' {
+			return nil, fmt.Errorf("selector %q: unexpected %q at %d", list, p.s[p.i], p.i)
+		}
+		p.i++
+	}
+}
+
+// Matches returns true if the element matches any of the selectors.
+func (s *Selector) Matches(node *html.Node) bool {
+	if s == nil || node.Type != html.ElementNode {
+		return false
+	}
+
+	for _, c := range s.alternatives {
+		if c.matches(node, len(c.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c complexSelector) matches(node *html.Node, i int) bool {
+	if !c.parts[i].matches(node) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch c.combinators[i-1] {
+	case '>':
+		parent := parentElement(node)
+		return parent != nil && c.matches(parent, i-1)
+
+	case '+':
+		sibling := previousElement(node)
+		return sibling != nil && c.matches(sibling, i-1)
+
+	case '~':
+		for sibling := previousElement(node); sibling != nil; sibling = previousElement(sibling) {
+			if c.matches(sibling, i-1) {
+				return true
+			}
+		}
+		return false
+
+	default: // descendant
+		for ancestor := parentElement(node); ancestor != nil; ancestor = parentElement(ancestor) {
+			if c.matches(ancestor, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (cs compoundSelector) matches(node *html.Node) bool {
+	if cs.tag != "" && cs.tag != node.Data {
+		return false
+	}
+
+	if cs.id != "" && getAttr(node, "id") != cs.id {
+		return false
+	}
+
+	if len(cs.classes) > 0 {
+		classes := strings.Fields(getAttr(node, "class"))
+		for _, class := range cs.classes {
+			if !slices.Contains(classes, class) {
+				return false
+			}
+		}
+	}
+
+	for _, a := range cs.attrs {
+		v, present := lookupAttr(node, a.key)
+		if !present || !a.matches(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a attrSelector) matches(v string) bool {
+	switch a.op {
+	case "=":
+		return v == a.value
+	case "~=":
+		return slices.Contains(strings.Fields(v), a.value)
+	case "|=":
+		return v == a.value || strings.HasPrefix(v, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(v, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(v, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(v, a.value)
+	default:
+		return true
+	}
+}
+
+func parentElement(node *html.Node) *html.Node {
+	parent := node.Parent
+	if parent == nil || parent.Type != html.ElementNode {
+		return nil
+	}
+	return parent
+}
+
+func previousElement(node *html.Node) *html.Node {
+	for sibling := node.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+		if sibling.Type == html.ElementNode {
+			return sibling
+		}
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type selectorParser struct {
+	s string
+	i int
+}
+
+func (p *selectorParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.i
+	for !p.eof() && strings.IndexByte(" \t\n\r\f", p.s[p.i]) >= 0 {
+		p.i++
+	}
+	return p.i > start
+}
+
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var c complexSelector
+	for {
+		cs, err := p.parseCompound()
+		if err != nil {
+			return c, err
+		}
+		c.parts = append(c.parts, cs)
+
+		spaced := p.skipSpace()
+		if p.eof() || p.s[p.i] == ',' {
+			return c, nil
+		}
+
+		combinator := byte(' ')
+		if strings.IndexByte(">+~", p.s[p.i]) >= 0 {
+			combinator = p.s[p.i]
+			p.i++
+			p.skipSpace()
+		} else if !spaced {
+			return c, fmt.Errorf("unexpected %q at %d", p.s[p.i], p.i)
+		}
+		c.combinators = append(c.combinators, combinator)
+	}
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var cs compoundSelector
+	start := p.i
+
+	if !p.eof() && p.s[p.i] == '*' {
+		p.i++
+	} else if name := p.parseIdent(); name != "" {
+		cs.tag = strings.ToLower(name)
+	}
+
+	for !p.eof() {
+		switch p.s[p.i] {
+		case '#':
+			p.i++
+			if cs.id = p.parseIdent(); cs.id == "" {
+				return cs, fmt.Errorf("missing id at %d", p.i)
+			}
+
+		case '.':
+			p.i++
+			class := p.parseIdent()
+			if class == "" {
+				return cs, fmt.Errorf("missing class at %d", p.i)
+			}
+			cs.classes = append(cs.classes, class)
+
+		case '[':
+			p.i++
+			a, err := p.parseAttr()
+			if err != nil {
+				return cs, err
+			}
+			cs.attrs = append(cs.attrs, a)
+
+		case ':':
+			return cs, fmt.Errorf("pseudo-classes are not supported at %d", p.i)
+
+		default:
+			if p.i == start {
+				return cs, fmt.Errorf("unexpected %q at %d", p.s[p.i], p.i)
+			}
+			return cs, nil
+		}
+	}
+
+	if p.i == start {
+		return cs, fmt.Errorf("missing selector at %d", p.i)
+	}
+	return cs, nil
+}
+
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	var a attrSelector
+	p.skipSpace()
+	if a.key = strings.ToLower(p.parseIdent()); a.key == "" {
+		return a, fmt.Errorf("missing attribute name at %d", p.i)
+	}
+	p.skipSpace()
+
+	if !p.eof() && p.s[p.i] == ']' {
+		p.i++
+		return a, nil
+	}
+
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.i:], op) {
+			a.op = op
+			p.i += len(op)
+			break
+		}
+	}
+	if a.op == "" {
+		return a, fmt.Errorf("unexpected attribute operator at %d", p.i)
+	}
+	p.skipSpace()
+
+	if !p.eof() && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		quote := p.s[p.i]
+		end := strings.IndexByte(p.s[p.i+1:], quote)
+		if end < 0 {
+			return a, fmt.Errorf("unterminated string at %d", p.i)
+		}
+		a.value = p.s[p.i+1 : p.i+1+end]
+		p.i += end + 2
+	} else {
+		a.value = p.parseIdent()
+	}
+	p.skipSpace()
+
+	if p.eof() || p.s[p.i] != ']' {
+		return a, fmt.Errorf("missing ] at %d", p.i)
+	}
+	p.i++
+	return a, nil
+}
+
+func (p *selectorParser) parseIdent() string {
+	start := p.i
+	for !p.eof() {
+		c := p.s[p.i]
+		if c == '-' || c == '_' || c >= 0x80 ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			p.i++
+		} else {
+			break
+		}
+	}
+	return p.s[start:p.i]
+}
@@ -0,0 +1,88 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body>
+<div id="banner" class="cookie notice"><p>Cookies!</p><button>OK</button></div>
+<main><aside class="ad"><img src="ad.gif"></aside><p lang="en-GB">Text</p><img src="pixel.gif" width="1" height="1"></main>
+<ul><li>one</li><li class="x">two</li><li>three</li></ul>
+</body></html>`))
+	require.NoError(t, err)
+
+	cases := map[string][]string{
+		"#banner":                 {"div"},
+		"div.cookie.notice":       {"div"},
+		"div.cookie.other":        nil,
+		"main p":                  {"p"},
+		"body > p":                nil,
+		"div > p, aside img":      {"p", "img"},
+		"img[width='1']":          {"img"},
+		`img[src$=".gif"]`:        {"img", "img"},
+		"[lang|=en]":              {"p"},
+		"[class~=notice]":         {"div"},
+		"img[src*=pix][height]":   {"img"},
+		"li.x + li":               {"li"},
+		"li.x ~ li":               {"li"},
+		"li + li":                 {"li", "li"},
+		"*.ad":                    {"aside"},
+		"UL LI.x":                 {"li"},
+		"aside[class^=a] > IMG  ": {"img"},
+	}
+
+	for selector, expected := range cases {
+		s, err := ParseSelector(selector)
+		require.NoError(t, err, selector)
+
+		var matched []string
+		walkElements(doc, func(node *html.Node) bool {
+			if s.Matches(node) {
+				matched = append(matched, node.Data)
+			}
+			return true
+		})
+		assert.Equal(t, expected, matched, selector)
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, selector := range []string{"", "div,", "> p", "a:hover", "[href", "[href=]x]", "p >", `[title="x]`, "div..x", "#"} {
+		_, err := ParseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+
+	s, err := ParseSelectors(nil)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestPrune(t *testing.T) {
+	u, _ := url.Parse("http://domain.com/")
+	b := []byte(`<html><head></head><body><div id="banner"><a href="/privacy">Privacy</a></div><p><a href="/about">About</a></p></body></html>`)
+
+	doc, err := ParseHTML(u, u, bytes.NewReader(b), nil)
+	require.NoError(t, err)
+
+	s, err := ParseSelectors([]string{"#banner", ".ad"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, doc.Prune(s))
+
+	refs, err := doc.FindReferences()
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	assert.Equal(t, "http://domain.com/about", refs[0].String())
+
+	fixed, changed, err := doc.FixURLReferences()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `<html><head></head><body><p><a href="about">About</a></p></body></html>`, string(fixed))
+}
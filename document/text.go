@@ -0,0 +1,156 @@
+package document
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TextLines extracts the normalised text of an HTML document, i.e. without its markup,
+// scripts or styles. Each block-level element starts a new line and the whitespace
+// within each line is collapsed. Blank lines are omitted.
+func TextLines(data []byte) []string {
+	var lines []string
+	var line strings.Builder
+	hidden := 0
+
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			flush()
+			return lines
+
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if a == atom.Script || a == atom.Style || a == atom.Template {
+				if tt == html.StartTagToken {
+					hidden++
+				} else if tt == html.EndTagToken && hidden > 0 {
+					hidden--
+				}
+			}
+			if isBlock(a) {
+				flush()
+			}
+
+		case html.TextToken:
+			if hidden == 0 {
+				line.Write(z.Text())
+			}
+		}
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.Address, atom.Article, atom.Aside, atom.Blockquote, atom.Br, atom.Dd, atom.Div,
+		atom.Dl, atom.Dt, atom.Fieldset, atom.Figcaption, atom.Figure, atom.Footer, atom.Form,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Header, atom.Hr, atom.Li,
+		atom.Main, atom.Nav, atom.Ol, atom.P, atom.Pre, atom.Section, atom.Table, atom.Td,
+		atom.Th, atom.Title, atom.Tr, atom.Ul, atom.Body, atom.Head, atom.Html:
+		return true
+	}
+	return false
+}
+
+// MainText extracts the normalised text of the main content of the page, without the
+// boilerplate around it. The content is the main element or, failing that, the first
+// article element or the body. Navigation, asides, forms and hidden elements are
+// omitted, along with scripts, styles and the headers and footers that are not part of
+// an article. Each block-level element starts
+// a new line; blank lines are omitted.
+func (d *HTMLDocument) MainText() []string {
+	root := findElement(d.doc, atom.Main)
+	if root == nil {
+		root = findElement(d.doc, atom.Article)
+	}
+	if root == nil {
+		root = findElement(d.doc, atom.Body)
+	}
+	if root == nil {
+		return nil
+	}
+
+	var lines []string
+	var line strings.Builder
+
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	walkNodes(root, func(node *html.Node) bool {
+		switch node.Type {
+		case html.TextNode:
+			line.WriteString(node.Data)
+			return false
+
+		case html.ElementNode:
+			if isBoilerplate(node) {
+				return false
+			}
+			if isBlock(node.DataAtom) {
+				flush()
+			}
+			return true
+		}
+		return false
+	}, func(node *html.Node) {
+		if isBlock(node.DataAtom) {
+			flush()
+		}
+	})
+	flush()
+	return lines
+}
+
+// findElement finds the first element of a kind, in document order.
+func findElement(doc *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(doc, func(node *html.Node) bool {
+		if node.DataAtom == a && found == nil {
+			found = node
+		}
+		return found == nil
+	})
+	return found
+}
+
+// isBoilerplate returns true for the elements that are not part of the content of a page.
+func isBoilerplate(node *html.Node) bool {
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Template, atom.Noscript, atom.Nav, atom.Aside, atom.Form,
+		atom.Button, atom.Select, atom.Iframe, atom.Svg, atom.Canvas:
+		return true
+
+	case atom.Header, atom.Footer:
+		for ancestor := node.Parent; ancestor != nil; ancestor = ancestor.Parent {
+			if ancestor.DataAtom == atom.Article {
+				return false // e.g. the article's title or byline
+			}
+		}
+		return true
+	}
+
+	switch strings.ToLower(getAttr(node, "role")) {
+	case "navigation", "banner", "contentinfo", "complementary", "search":
+		return true
+	}
+
+	_, hidden := lookupAttr(node, "hidden")
+	return hidden || getAttr(node, "aria-hidden") == "true"
+}
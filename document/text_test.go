@@ -0,0 +1,32 @@
+package document
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMainText(t *testing.T) {
+	u, _ := url.Parse("https://example.org/")
+
+	cases := map[string][]string{
+		`<html><head><title>T</title><style>p{}</style></head><body>
+<header><a href="/">Home</a></header><nav><a href="/a">A</a></nav>
+<main><article><header><h1>Headline</h1></header><p>First   paragraph,
+with <b>bold</b> text.</p><aside>Related</aside><p hidden>Hidden</p><script>var x;</script></article></main>
+<footer>Copyright</footer></body></html>`: {"Headline", "First paragraph, with bold text."},
+
+		`<html><body><div role="navigation">Menu</div><article><p>One</p></article><article><p>Two</p></article></body></html>`: {"One"},
+
+		`<html><body><div role="banner">Banner</div><p>Text<br>More</p><form><input name="q"></form></body></html>`: {"Text", "More"},
+	}
+
+	for page, expected := range cases {
+		doc, err := ParseHTML(u, u, bytes.NewReader([]byte(page)), nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, doc.MainText(), page)
+	}
+}
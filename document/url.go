@@ -19,7 +19,18 @@ func resolveURL(base *url.URL, reference, startURLHost, relativeToRoot string) s
 
 	resolvedURL := base.ResolveReference(ur)
 
+	if resolvedURL.Host == startURLHost && mapping.IsPageURL(resolvedURL) &&
+		(resolvedURL.RawQuery != "" || mapping.HasMappedExtension(resolvedURL)) {
+		// pages with a query are stored in files named after both path and query, and
+		// pages with a mapped extension in files with the other extension
+		resolvedURL.Path = mapping.GetPageFilePath(resolvedURL)
+		resolvedURL.RawQuery = ""
+	}
+
 	if resolvedURL.Host == startURLHost {
+		// the stored files have safe names, e.g. "con.txt" is stored as "con_.txt"
+		resolvedURL.Path = strings.TrimPrefix(mapping.GetFilePath(resolvedURL, false), ".")
+		resolvedURL.RawPath = ""
 		resolvedURL.Path = urlRelativeToOther(resolvedURL, base)
 		relativeToRoot = ""
 	}
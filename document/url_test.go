@@ -4,7 +4,9 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/cornelk/goscrape/mapping"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestResolveURL(t *testing.T) {
@@ -34,6 +36,11 @@ func TestResolveURL(t *testing.T) {
 		{baseURL: URL, reference: "brasil/index.html", resolved: "brasil/index.html"},
 		{baseURL: URL, reference: "brasil/rio/index.html", resolved: "brasil/rio/index.html"},
 		{baseURL: URL, reference: "../argentina/cat.jpg", resolved: "../argentina/cat.jpg"},
+		{baseURL: URL, reference: "search?q=cat", resolved: "search_q=cat.html"},
+		{baseURL: URL, reference: "/?page=2#top", resolved: "../index_page=2.html#top"},
+		{baseURL: URL, reference: "cat.jpg?v=1", resolved: "cat.jpg?v=1"},
+		{baseURL: URL, reference: "/con.txt", resolved: "../con_.txt"},
+		{baseURL: URL, reference: "trail.", resolved: "trail%252E"},
 	}
 
 	for _, c := range cases {
@@ -42,6 +49,24 @@ func TestResolveURL(t *testing.T) {
 	}
 }
 
+func TestResolveURL_PageExtensions(t *testing.T) {
+	require.NoError(t, mapping.SetPageExtensions(map[string]string{".php": ".html"}))
+	t.Cleanup(func() { _ = mapping.SetPageExtensions(nil) })
+
+	base := url.URL{Scheme: "https", Host: "petpic.xyz", Path: "/earth/index.php"}
+	cases := map[string]string{
+		"brasil.php":          "brasil.html",
+		"/mars/Rover.PHP#map": "../mars/Rover.html#map",
+		"search.php?q=cat":    "search_q=cat.html",
+		"brasil.aspx":         "brasil.aspx",
+		"cat.jpg":             "cat.jpg",
+	}
+
+	for reference, expected := range cases {
+		assert.Equal(t, expected, resolveURL(&base, reference, base.Host, ""), reference)
+	}
+}
+
 func Test_urlRelativeToOther(t *testing.T) {
 	type filePathCase struct {
 		srcURL          url.URL
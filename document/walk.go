@@ -0,0 +1,40 @@
+package document
+
+import "golang.org/x/net/html"
+
+// walkNodes visits every node below root, in document order. The children of a node are
+// visited only if enter returns true, after which leave is called, unless it is nil.
+// No recursion is used, so any depth of nesting is safe.
+func walkNodes(root *html.Node, enter func(*html.Node) bool, leave func(*html.Node)) {
+	node := root.FirstChild
+	for node != nil {
+		if enter(node) {
+			if node.FirstChild != nil {
+				node = node.FirstChild
+				continue
+			}
+			if leave != nil {
+				leave(node)
+			}
+		}
+
+		for node.NextSibling == nil {
+			node = node.Parent
+			if node == root {
+				return
+			}
+			if leave != nil {
+				leave(node)
+			}
+		}
+		node = node.NextSibling
+	}
+}
+
+// walkElements calls fn for every element below node, in document order. The children
+// of each element are visited only if fn returns true.
+func walkElements(node *html.Node, fn func(*html.Node) bool) {
+	walkNodes(node, func(n *html.Node) bool {
+		return n.Type != html.ElementNode || fn(n)
+	}, nil)
+}
@@ -0,0 +1,100 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// AcceptRule sets the Accept header of the requests for the URLs of some types.
+type AcceptRule struct {
+	any    bool // every URL
+	pages  bool
+	types  filter.Types
+	accept string
+}
+
+// NewAcceptRules compiles the Accept rules.
+func NewAcceptRules(rules []config.AcceptRule) ([]AcceptRule, error) {
+	compiled := make([]AcceptRule, 0, len(rules))
+	for _, rule := range rules {
+		c := AcceptRule{accept: rule.Accept}
+
+		var others []string
+		for _, item := range strings.Split(rule.Types, ",") {
+			switch item = strings.ToLower(strings.TrimSpace(item)); item {
+			case "*":
+				c.any = true
+			case "pages":
+				c.pages = true
+			default:
+				others = append(others, item)
+			}
+		}
+
+		types, err := filter.NewTypes(others, nil)
+		if err != nil {
+			return nil, fmt.Errorf("accept rule %q: %w", rule.Types, err)
+		}
+		c.types = types
+
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func (rule AcceptRule) matches(u *url.URL) bool {
+	if rule.any {
+		return true
+	}
+
+	if mapping.IsPageURL(u) {
+		return rule.pages
+	}
+
+	allowed, decided := rule.types.AllowsURL(u)
+	return rule.types.Present() && allowed && decided
+}
+
+// AcceptHeaders sets the Accept header of each request according to the first rule
+// that matches its URL. The requests for other URLs are unchanged.
+func AcceptHeaders(rules []AcceptRule) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			for _, rule := range rules {
+				if rule.matches(req.URL) {
+					req = req.Clone(req.Context())
+					req.Header.Set(headername.Accept, rule.accept)
+					break
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// varyKey gets the request headers that the response varies by, with the values that
+// were sent, e.g. "Accept: image/webp; Accept-Encoding: gzip". It is "*" if the
+// response varies unpredictably and blank if it doesn't vary.
+func varyKey(resp *http.Response) string {
+	var parts []string
+	for _, value := range resp.Header.Values(headername.Vary) {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			switch {
+			case name == "*":
+				return "*"
+			case name != "" && !slices.ContainsFunc(parts, func(p string) bool { return strings.HasPrefix(p, name+":") }):
+				parts = append(parts, name+": "+resp.Request.Header.Get(name))
+			}
+		}
+	}
+	return strings.Join(parts, "; ")
+}
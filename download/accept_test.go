@@ -0,0 +1,63 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptHeaders(t *testing.T) {
+	rules, err := NewAcceptRules([]config.AcceptRule{
+		{Types: "images, .pdf", Accept: "image/png, image/webp;q=0"},
+		{Types: "pages", Accept: "text/html"},
+		{Types: "*", Accept: "*/*"},
+	})
+	require.NoError(t, err)
+
+	var seen string
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		seen = req.Header.Get("Accept")
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+	rt := AcceptHeaders(rules)(base)
+
+	cases := map[string]string{
+		"http://example.org/photo.JPG":    "image/png, image/webp;q=0",
+		"http://example.org/doc.pdf":      "image/png, image/webp;q=0",
+		"http://example.org/about":        "text/html",
+		"http://example.org/a/index.html": "text/html",
+		"http://example.org/style.css":    "*/*",
+	}
+
+	for u, expected := range cases {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		_, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, seen, u)
+		assert.Empty(t, req.Header.Get("Accept"), "the request is not altered")
+	}
+
+	_, err = NewAcceptRules([]config.AcceptRule{{Types: "image/*/x", Accept: "*/*"}})
+	assert.Error(t, err)
+}
+
+func TestVaryKey(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.org/photo.jpg", nil)
+	req.Header.Set("Accept", "image/webp")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	cases := map[string][]string{
+		"": nil,
+		"Accept: image/webp; Accept-Encoding: gzip": {"accept, Accept-Encoding", "Accept"},
+		"Accept: image/webp; Cookie: ":              {"Accept", "Cookie"},
+		"*":                                         {"Accept", "*"},
+	}
+
+	for expected, vary := range cases {
+		resp := &http.Response{Request: req, Header: http.Header{"Vary": vary}}
+		assert.Equal(t, expected, varyKey(resp), vary)
+	}
+}
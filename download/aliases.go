@@ -0,0 +1,48 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/rickb777/acceptable/header"
+)
+
+// redirectStub is the page stored in place of a page that was permanently redirected,
+// so that the pages already stored with links to it still work.
+const redirectStub = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><meta http-equiv="refresh" content="0; url=%[1]s"><link rel="canonical" href="%[1]s"><title>Moved</title></head>
+<body><p>This page has moved to <a href="%[1]s">%[1]s</a>.</p></body></html>
+`
+
+// canonicalPage returns true if the response is a page on the same website that u was
+// permanently redirected to. The page is then stored at its own URL, rather than at u,
+// and u becomes its alias.
+func (d *Download) canonicalPage(u *url.URL, resp *http.Response) bool {
+	if d.Aliases == nil || resp.StatusCode != http.StatusOK || resp.Request.URL.Host != u.Host {
+		return false
+	}
+
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		if status := req.Response.StatusCode; status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			return false
+		}
+	}
+
+	return isHtml(header.ParseContentTypeFromHeaders(resp.Header))
+}
+
+// recordAlias notes that the page at from is stored at to, and stores a page at from
+// that redirects to it.
+func (d *Download) recordAlias(ctx context.Context, from, to *url.URL) {
+	d.Aliases.Add(from, to)
+	d.Logger.Debug("Alias", slog.String("url", from.String()), slog.String("canonical", to.String()))
+
+	link := html.EscapeString(document.RelativeLink(from, to))
+	_, _, _ = d.storeData(ctx, from, []byte(fmt.Sprintf(redirectStub, link)), time.Time{}, true)
+}
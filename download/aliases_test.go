@@ -0,0 +1,84 @@
+package download
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessURL_PermanentRedirect(t *testing.T) {
+	pages := map[string]string{
+		"/new/":  `<html><head></head><body><a href="/old">Self</a></body></html>`,
+		"/other": `<html><head></head><body><a href="/old#top">New</a> <a href="/gone">Gone</a></body></html>`,
+	}
+
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{Request: req, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+		switch req.URL.Path {
+		case "/old":
+			resp.StatusCode = http.StatusMovedPermanently
+			resp.Header.Set("Location", "/new/")
+		case "/gone":
+			resp.StatusCode = http.StatusFound
+			resp.Header.Set("Location", "/new/")
+		default:
+			resp.StatusCode = http.StatusOK
+			resp.Header.Set("Content-Type", "text/html")
+			resp.Body = io.NopCloser(strings.NewReader(pages[req.URL.Path]))
+		}
+		return resp, nil
+	})
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   &http.Client{Transport: transport},
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+		Aliases:  work.NewAliases(),
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/old"), Depth: 1})
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/new/", result.Item.URL.String())
+	assert.Equal(t, "https://example.org/old", result.Redirects[0].String())
+	assert.Equal(t, "https://example.org/new/", d.Aliases.Lookup(mustParse("https://example.org/old")).String())
+	assert.Equal(t, []string{"https://example.org/new/"}, refStrings(result.References))
+
+	stub, err := afero.ReadFile(fs, "old.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(stub), `url=new"`)
+
+	exists, err := afero.Exists(fs, "new/index.html")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/gone"), Depth: 1})
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/gone", result.Item.URL.String()) // a temporary redirect is not an alias
+	assert.Equal(t, 1, d.Aliases.Len())
+
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/other"), Depth: 1})
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"https://example.org/new/", "https://example.org/gone"}, refStrings(result.References))
+	data, err := afero.ReadFile(fs, "other.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<a href="new#top">New</a>`)
+}
+
+func refStrings(refs work.Refs) []string {
+	s := make([]string, len(refs))
+	for i, ref := range refs {
+		s[i] = ref.String()
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+package download
+
+import (
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/work"
+)
+
+// separateAlternates applies the configured treatment of AMP and mobile alternates
+// to the references of a page. The alternates are either removed or are returned
+// separately, to be fetched at the same depth as the page.
+func (d *Download) separateAlternates(doc *document.HTMLDocument, references work.Refs) (work.Refs, work.Refs) {
+	if d.Config.Alternates != config.AlternatesSkip && d.Config.Alternates != config.AlternatesPrefer {
+		return references, nil
+	}
+
+	alternates := doc.FindAlternates()
+	if len(alternates) == 0 {
+		return references, nil
+	}
+
+	isAlternate := make(map[string]bool, len(alternates))
+	for _, u := range alternates {
+		isAlternate[u.String()] = true
+	}
+
+	others := make(work.Refs, 0, len(references))
+	for _, u := range references {
+		if !isAlternate[u.String()] {
+			others = append(others, u)
+		}
+	}
+
+	if d.Config.Alternates == config.AlternatesSkip {
+		return others, nil
+	}
+	return others, alternates
+}
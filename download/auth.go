@@ -0,0 +1,331 @@
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Authenticator answers the authentication challenges of servers, choosing Digest
+// (SHA-256 or MD5) or Basic authentication according to what each server offers in its
+// 401 response. Once a host has given a challenge, the following requests to it are
+// authorized without waiting for another. Particular hosts can have credentials of
+// their own. It is shared by all the downloaders of a scrape. A nil Authenticator does
+// nothing.
+type Authenticator struct {
+	username, password string
+	hosts              []config.HostCredential
+
+	mu         sync.Mutex
+	challenges map[string]*challenge // keyed by host
+}
+
+// challenge is an authentication scheme and its parameters, from a WWW-Authenticate header.
+type challenge struct {
+	scheme string // lower case
+	params map[string]string
+	nc     int // the number of requests authorized using a Digest nonce
+}
+
+// NewAuthenticator returns nil if there are no credentials.
+func NewAuthenticator(username, password string, hosts []config.HostCredential) *Authenticator {
+	if username == "" && len(hosts) == 0 {
+		return nil
+	}
+	return &Authenticator{username: username, password: password, hosts: hosts, challenges: make(map[string]*challenge)}
+}
+
+// newCnonce gets the client nonce for Digest authentication.
+var newCnonce = func() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware authorizes the requests for the hosts that have credentials of their own,
+// and for the hosts that may be sent the default credentials. When such a request gets
+// a 401 response with a supported challenge, it is repeated once with the credentials.
+func (a *Authenticator) Middleware(allowed func(u *url.URL) bool) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		if a == nil {
+			return next
+		}
+
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			user, ok := a.userFor(req.URL, allowed)
+			if !ok {
+				return next.RoundTrip(req)
+			}
+
+			authorized, sent := a.authorize(req, user)
+			resp, err := next.RoundTrip(authorized)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			ch := bestChallenge(parseChallenges(resp.Header.Values(headername.WWWAuthenticate)))
+			if ch == nil || sent && ch.scheme == "basic" {
+				return resp, nil // unsupported, or the credentials were rejected
+			}
+
+			again, canRepeat := rewind(req)
+			if !canRepeat {
+				return resp, nil
+			}
+
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			a.mu.Lock()
+			a.challenges[req.URL.Host] = ch
+			a.mu.Unlock()
+
+			authorized, _ = a.authorize(again, user)
+			return next.RoundTrip(authorized)
+		})
+	}
+}
+
+// userFor chooses the credentials for a request: those of its host, if it has any,
+// otherwise the default credentials, if its host may be sent them.
+func (a *Authenticator) userFor(u *url.URL, allowed func(u *url.URL) bool) (config.HostCredential, bool) {
+	for _, hc := range a.hosts {
+		if hostMatches(hc.Host, u.Host) || hostMatches(hc.Host, u.Hostname()) {
+			return hc, true
+		}
+	}
+	return config.HostCredential{Username: a.username, Password: a.password}, a.username != "" && allowed(u)
+}
+
+// authorize adds the Authorization header if the host has given a challenge.
+func (a *Authenticator) authorize(req *http.Request, user config.HostCredential) (*http.Request, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ch := a.challenges[req.URL.Host]
+	if ch == nil {
+		return req, false
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set(headername.Authorization, credentials(ch, user, req.Method, req.URL.RequestURI()))
+	return req, true
+}
+
+// credentials gets the value of the Authorization header for a challenge.
+func credentials(ch *challenge, user config.HostCredential, method, uri string) string {
+	if ch.scheme == "basic" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username+":"+user.Password))
+	}
+
+	ch.nc++
+	return digestCredentials(ch.params, user.Username, user.Password, method, uri, ch.nc, newCnonce())
+}
+
+// digestCredentials computes the Digest response of RFC 7616 with qop "auth", or
+// of RFC 2069 if the server offers no qop.
+func digestCredentials(params map[string]string, username, password, method, uri string, nc int, cnonce string) string {
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	newHash, _ := digestHash(algorithm)
+	h := func(s string) string {
+		hasher := newHash()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := h(username + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s`, quote(username), quote(realm), quote(nonce), quote(uri), algorithm)
+
+	if hasToken(params["qop"], "auth") {
+		ncs := fmt.Sprintf("%08x", nc)
+		response := h(ha1 + ":" + nonce + ":" + ncs + ":" + cnonce + ":auth:" + ha2)
+		fmt.Fprintf(buf, `, response="%s", qop=auth, nc=%s, cnonce="%s"`, response, ncs, cnonce)
+	} else {
+		fmt.Fprintf(buf, `, response="%s"`, h(ha1+":"+nonce+":"+ha2))
+	}
+
+	if opaque, exists := params["opaque"]; exists {
+		fmt.Fprintf(buf, `, opaque="%s"`, quote(opaque))
+	}
+	return buf.String()
+}
+
+func digestHash(algorithm string) (func() hash.Hash, bool) {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		return md5.New, true
+	case "SHA-256":
+		return sha256.New, true
+	default:
+		return nil, false
+	}
+}
+
+// bestChallenge chooses the strongest supported challenge: Digest using SHA-256, then
+// Digest using MD5, then Basic.
+func bestChallenge(challenges []*challenge) *challenge {
+	var best *challenge
+	bestRank := 0
+	for _, ch := range challenges {
+		if rank := ch.rank(); rank > bestRank {
+			best, bestRank = ch, rank
+		}
+	}
+	return best
+}
+
+func (ch *challenge) rank() int {
+	switch ch.scheme {
+	case "basic":
+		return 1
+	case "digest":
+		qop, hasQop := ch.params["qop"]
+		if hasQop && !hasToken(qop, "auth") {
+			return 0 // only auth-int, which is not supported
+		}
+		algorithm := ch.params["algorithm"]
+		if algorithm == "" {
+			return 2
+		}
+		if _, supported := digestHash(algorithm); !supported {
+			return 0
+		}
+		if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+			return 3
+		}
+		return 2
+	default:
+		return 0
+	}
+}
+
+// parseChallenges parses WWW-Authenticate headers, each of which may hold several
+// challenges, e.g. `Digest realm="x", nonce="y", Basic realm="x"`.
+func parseChallenges(headers []string) []*challenge {
+	var challenges []*challenge
+	for _, hdr := range headers {
+		var current *challenge
+		s := hdr
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+
+			token := s[:tokenEnd(s)]
+			s = strings.TrimLeft(s[len(token):], " \t")
+			if token == "" {
+				break // malformed
+			}
+
+			if current == nil || !strings.HasPrefix(s, "=") {
+				// a new scheme
+				current = &challenge{scheme: strings.ToLower(token), params: make(map[string]string)}
+				challenges = append(challenges, current)
+				continue
+			}
+
+			var value string
+			s = strings.TrimLeft(s[1:], " \t")
+			value, s = paramValue(s)
+			current.params[strings.ToLower(token)] = value
+		}
+	}
+	return challenges
+}
+
+func tokenEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(" \t,=\"", s[i]) >= 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// paramValue parses a token or a quoted string, returning the rest of s.
+func paramValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := tokenEnd(s)
+		return s[:end], s[end:]
+	}
+
+	buf := &strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				buf.WriteByte(s[i])
+			}
+		case '"':
+			return buf.String(), s[i+1:]
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), ""
+}
+
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewind gets a copy of a request that can be sent again, which requires a fresh body.
+func rewind(req *http.Request) (*http.Request, bool) {
+	again := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return again, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	again.Body = body
+	return again, true
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Reauthenticator renews expired credentials, e.g. by logging in again or refreshing a
+// token, after which the rejected request is retried once. It is given the time at
+// which that request was sent, so that the credentials need not be renewed again if
+// this has already been done since then.
+type Reauthenticator func(ctx context.Context, sent time.Time) error
@@ -0,0 +1,148 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestCredentials(t *testing.T) {
+	// the examples in RFC 7616 section 3.9.1
+	params := map[string]string{
+		"realm":  "http-auth@example.org",
+		"qop":    "auth, auth-int",
+		"nonce":  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		"opaque": "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+	}
+	const cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	params["algorithm"] = "MD5"
+	md5 := digestCredentials(params, "Mufasa", "Circle of Life", "GET", "/dir/index.html", 1, cnonce)
+	assert.Contains(t, md5, `response="8ca523f5e9506fed4657c9700eebdbec"`)
+
+	params["algorithm"] = "SHA-256"
+	sha := digestCredentials(params, "Mufasa", "Circle of Life", "GET", "/dir/index.html", 1, cnonce)
+	assert.Equal(t, `Digest username="Mufasa", realm="http-auth@example.org", nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", algorithm=SHA-256, `+
+		`response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1", qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", `+
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`, sha)
+}
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="a \"b\"", qop="auth,auth-int", algorithm=SHA-256, nonce="n1", Digest realm="a", nonce=n2, Basic realm="a"`,
+		`Negotiate`,
+	})
+	require.Len(t, challenges, 4)
+	assert.Equal(t, "digest", challenges[0].scheme)
+	assert.Equal(t, map[string]string{"realm": `a "b"`, "qop": "auth,auth-int", "algorithm": "SHA-256", "nonce": "n1"}, challenges[0].params)
+	assert.Equal(t, map[string]string{"realm": "a", "nonce": "n2"}, challenges[1].params)
+	assert.Equal(t, "basic", challenges[2].scheme)
+	assert.Equal(t, "negotiate", challenges[3].scheme)
+
+	assert.Same(t, challenges[0], bestChallenge(challenges))
+	assert.Same(t, challenges[2], bestChallenge(challenges[2:]))
+	assert.Nil(t, bestChallenge(challenges[3:]))
+}
+
+func TestAuthenticator(t *testing.T) {
+	requests := 0
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		authorization := r.Header.Get("Authorization")
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/basic"):
+			if user, password, ok := r.BasicAuth(); ok && user == "user" && password == "secret" {
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+
+		case strings.HasPrefix(authorization, "Digest "):
+			params := parseChallenges([]string{authorization})[0].params
+			expected := digestCredentials(map[string]string{"realm": "test", "nonce": "abc", "qop": "auth", "algorithm": "SHA-256"},
+				"user", "secret", r.Method, r.URL.RequestURI(), 1, params["cnonce"])
+			if strings.Contains(expected, `response="`+params["response"]+`"`) {
+				return
+			}
+			fallthrough
+
+		default:
+			w.Header().Add("WWW-Authenticate", `Basic realm="test"`)
+			w.Header().Add("WWW-Authenticate", `Digest realm="test", nonce="abc", qop="auth", algorithm=SHA-256`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer origin.Close()
+
+	get := func(a *Authenticator, path string) int {
+		rt := a.Middleware(func(*url.URL) bool { return true })(http.DefaultTransport)
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, origin.URL+path, nil)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Digest is preferred to Basic
+	assert.Equal(t, http.StatusOK, get(NewAuthenticator("user", "secret", nil), "/digest"))
+	assert.Equal(t, 2, requests)
+
+	basic := NewAuthenticator("user", "secret", nil)
+	requests = 0
+	assert.Equal(t, http.StatusOK, get(basic, "/basic/1"))
+	assert.Equal(t, http.StatusOK, get(basic, "/basic/2"))
+	assert.Equal(t, 3, requests, "the second request is authorized without a challenge")
+
+	requests = 0
+	assert.Equal(t, http.StatusUnauthorized, get(NewAuthenticator("user", "wrong", nil), "/basic/1"))
+	assert.Equal(t, 2, requests)
+
+	requests = 0
+	assert.Equal(t, http.StatusUnauthorized, get(nil, "/basic/1"))
+	assert.Equal(t, 1, requests)
+}
+
+func TestAuthenticatorHostCredentials(t *testing.T) {
+	var users []string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, ok := r.BasicAuth()
+		users = append(users, user)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer origin.Close()
+	u, _ := url.Parse(origin.URL)
+
+	get := func(a *Authenticator, allowed bool) {
+		rt := a.Middleware(func(*url.URL) bool { return allowed })(http.DefaultTransport)
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, origin.URL, nil)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	hosts := []config.HostCredential{
+		{Host: "other.example.net", Username: "other"},
+		{Host: u.Hostname(), Username: "assets", Password: "secret"},
+	}
+
+	get(NewAuthenticator("user", "secret", hosts), false)
+	assert.Equal(t, []string{"", "assets"}, users, "the host's own credentials are sent even if it may not be sent the default ones")
+
+	users = nil
+	get(NewAuthenticator("user", "secret", hosts[:1]), true)
+	assert.Equal(t, []string{"", "user"}, users)
+
+	users = nil
+	get(NewAuthenticator("", "", hosts[:1]), true)
+	assert.Equal(t, []string{""}, users, "there are no default credentials")
+}
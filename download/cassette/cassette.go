@@ -0,0 +1,233 @@
+// Package cassette records HTTP responses during a crawl so that later crawls can be
+// replayed from them, without any network traffic. This allows offline reruns of the
+// rewrite pipeline and hermetic integration tests.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/rickb777/acceptable/headername"
+	"github.com/spf13/afero"
+)
+
+// rangeHeader is the request header that asks for part of a response.
+const rangeHeader = "Range"
+
+// Episode is one recorded response. The body is held verbatim, i.e. it may still
+// be gzip-encoded as per the Content-Encoding header. Ranged requests, e.g. for the
+// segments of a large file, are recorded separately for each range.
+type Episode struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Range      string      `json:"range,omitempty"`    // the Range header of the request, if any
+	FinalURL   string      `json:"finalUrl,omitempty"` // present when redirected
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Cassette holds recorded episodes in a JSON-lines file. It is safe for concurrent use.
+type Cassette struct {
+	file     string
+	fs       afero.Fs
+	w        afero.File
+	episodes map[string]Episode
+	mu       sync.Mutex
+	log      *logger.Logger
+}
+
+// Open reads the cassette file, if it exists. The returned cassette can be used for
+// replaying and/or recording.
+func Open(fs afero.Fs, file string, log *logger.Logger) (*Cassette, error) {
+	c := &Cassette{file: file, fs: fs, episodes: make(map[string]Episode), log: log}
+
+	f, err := fs.Open(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening cassette: %w", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<30) // allow for large bodies
+	for s.Scan() {
+		var ep Episode
+		if err := json.Unmarshal(s.Bytes(), &ep); err != nil {
+			return nil, fmt.Errorf("reading cassette %s: %w", file, err)
+		}
+		c.episodes[key(ep.Method, ep.URL, ep.Range)] = ep
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", file, err)
+	}
+
+	return c, nil
+}
+
+// Len gets the number of episodes in the cassette.
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.episodes)
+}
+
+// Close closes the cassette file if it is being recorded.
+func (c *Cassette) Close() error {
+	if c == nil {
+		return nil // no-op if absent
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.w == nil {
+		return nil
+	}
+
+	err := c.w.Close()
+	c.w = nil
+	return err
+}
+
+func key(method, url, byteRange string) string {
+	if byteRange != "" {
+		return method + " " + url + " " + byteRange
+	}
+	return method + " " + url
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Record is HTTP middleware that captures every response into the cassette.
+// The method value c.Record can be used as a download.Middleware. It must be outside
+// any middleware that answers conditional requests from a cache, because it makes
+// every request unconditional, so that the cassette holds whole responses rather than
+// 304 Not Modified responses, which would give nothing when replayed.
+func (c *Cassette) Record(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(headername.IfModifiedSince) != "" || req.Header.Get(headername.IfNoneMatch) != "" {
+			req = req.Clone(req.Context())
+			req.Header.Del(headername.IfModifiedSince)
+			req.Header.Del(headername.IfNoneMatch)
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("recording %s: %w", req.URL, err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		ep := Episode{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			Range:      req.Header.Get(rangeHeader),
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+		}
+
+		if resp.Request != nil && resp.Request.URL.String() != ep.URL {
+			ep.FinalURL = resp.Request.URL.String()
+		}
+
+		if err := c.append(ep); err != nil {
+			c.log.Error("Recording to cassette failed",
+				slog.String("url", ep.URL),
+				slog.String("file", c.file),
+				slog.Any("error", err))
+		}
+
+		return resp, nil
+	})
+}
+
+func (c *Cassette) append(ep Episode) error {
+	b, err := json.Marshal(ep)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.w == nil {
+		c.w, err = c.fs.OpenFile(c.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.episodes[key(ep.Method, ep.URL, ep.Range)] = ep
+	_, err = c.w.Write(append(b, '\n'))
+	return err
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Do serves a recorded response in place of any HTTP traffic, so the cassette can
+// be used as the scraper's HTTP client. Requests that were not recorded get a
+// 404 response.
+func (c *Cassette) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	ep, found := c.episodes[key(req.Method, req.URL.String(), req.Header.Get(rangeHeader))]
+	c.mu.Unlock()
+
+	if !found {
+		c.log.Debug("Not in cassette", slog.String("url", req.URL.String()))
+		return &http.Response{
+			Request:    req,
+			Status:     http.StatusText(http.StatusNotFound),
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+			Body:       io.NopCloser(&bytes.Buffer{}),
+		}, nil
+	}
+
+	if ep.FinalURL != "" {
+		final, err := http.NewRequestWithContext(req.Context(), req.Method, ep.FinalURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("replaying %s: %w", ep.URL, err)
+		}
+		final.Header = req.Header
+		req = final
+	}
+
+	header := ep.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Request:       req,
+		Status:        http.StatusText(ep.StatusCode),
+		StatusCode:    ep.StatusCode,
+		Header:        header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(ep.Body)),
+		ContentLength: int64(len(ep.Body)),
+	}, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
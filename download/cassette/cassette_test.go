@@ -0,0 +1,106 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`)
+	stub.GivenResponse(http.StatusNotFound, "http://example.org/x.css", "text/plain", `missing`)
+
+	recorder, err := Open(fs, "tape.jsonl", nil)
+	require.NoError(t, err)
+
+	rt := recorder.Record(roundTripperFunc(stub.Do))
+	for _, u := range []string{"http://example.org/", "http://example.org/x.css"} {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+	require.NoError(t, recorder.Close())
+
+	//-------------------------------------------
+
+	replayer, err := Open(fs, "tape.jsonl", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayer.Len())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.org/", nil)
+	resp, err := replayer.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `<html></html>`, string(body))
+
+	req, _ = http.NewRequest(http.MethodGet, "http://example.org/x.css", nil)
+	resp, err = replayer.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://example.org/unknown", nil)
+	resp, err = replayer.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRecordRangesUnconditionally(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	recorder, err := Open(fs, "tape.jsonl", nil)
+	require.NoError(t, err)
+
+	rt := recorder.Record(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Empty(t, req.Header.Get("If-Modified-Since"))
+		assert.Empty(t, req.Header.Get("If-None-Match"))
+		body := "whole"
+		status := http.StatusOK
+		if r := req.Header.Get("Range"); r != "" {
+			body = r
+			status = http.StatusPartialContent
+		}
+		return &http.Response{Request: req, StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+	}))
+
+	for _, byteRange := range []string{"", "bytes=0-9", "bytes=10-19"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.org/big.bin", nil)
+		req.Header.Set("If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT")
+		req.Header.Set("If-None-Match", `"abc"`)
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+	require.NoError(t, recorder.Close())
+
+	//-------------------------------------------
+
+	replayer, err := Open(fs, "tape.jsonl", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, replayer.Len())
+
+	for byteRange, expected := range map[string]string{"": "whole", "bytes=0-9": "bytes=0-9", "bytes=10-19": "bytes=10-19"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.org/big.bin", nil)
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		resp, err := replayer.Do(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, expected, string(body))
+	}
+}
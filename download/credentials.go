@@ -0,0 +1,75 @@
+package download
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// SendsCredentials reports whether the credentials, i.e. the Authorization header and
+// the custom headers, may be sent to a host. By default, they are only sent to the
+// start host and to the configured credential hosts, so that they don't leak to
+// third parties such as CDNs.
+func SendsCredentials(cfg config.Config, startHost, host string) bool {
+	if cfg.AnyHostCredentials || strings.EqualFold(host, startHost) {
+		return true
+	}
+
+	return slices.ContainsFunc(cfg.CredentialHosts, func(pattern string) bool {
+		return hostMatches(pattern, host)
+	})
+}
+
+// StripCredentials removes the credential headers from a request for a host that
+// may not be sent them. It is needed for redirects, which copy the headers of the
+// original request. The cookie jar decides separately which cookies are sent.
+func StripCredentials(cfg config.Config, startHost string, req *http.Request) {
+	if SendsCredentials(cfg, startHost, req.URL.Host) {
+		return
+	}
+
+	req.Header.Del(headername.Authorization)
+	req.Header.Del(headername.Cookie)
+	for key := range cfg.Header {
+		req.Header.Del(key)
+	}
+	for _, rule := range cfg.HeaderRules {
+		for key := range rule.Header {
+			req.Header.Del(key)
+		}
+	}
+}
+
+// Credentials sets the credential headers on the requests for the hosts that may be
+// sent them, replacing any existing values.
+func Credentials(hdrs http.Header, allowed func(u *url.URL) bool) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if len(hdrs) > 0 && allowed(req.URL) {
+				req = req.Clone(req.Context())
+				for key, values := range hdrs {
+					for _, value := range values {
+						req.Header.Set(key, value)
+					}
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// hostMatches matches a host with a pattern that is either a host name or "*." and a
+// domain, which matches the domain and all its subdomains.
+func hostMatches(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+
+	if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return host == pattern
+}
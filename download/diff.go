@@ -0,0 +1,73 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/textdiff"
+	"github.com/cornelk/goscrape/utc"
+)
+
+// DiffExtension is appended to the name of each stored page to give the name of the
+// file that holds the differences between its text and that of the previous version.
+const DiffExtension = ".diff"
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// pageText holds the text of a stored page.
+type pageText struct {
+	lines    []string
+	modified time.Time
+	exists   bool
+}
+
+// storedPageText reads the text of the stored page, if there is one.
+func (d *Download) storedPageText(filePath string) pageText {
+	info, err := d.Fs.Stat(filePath)
+	if err != nil {
+		return pageText{}
+	}
+
+	data, err := ioutil.ReadFile(d.Fs, filePath)
+	if err != nil {
+		return pageText{}
+	}
+
+	return pageText{lines: document.TextLines(data), modified: info.ModTime(), exists: true}
+}
+
+// storeDiff writes the differences between the text of the previous version of a page
+// and its new content. Nothing is written if the text is unchanged, so the diff file
+// always describes the most recent change.
+func (d *Download) storeDiff(ctx context.Context, u *url.URL, filePath string, previous pageText, data []byte) {
+	if !previous.exists {
+		return
+	}
+
+	diff := textdiff.Unified(
+		filePath+"\t"+previous.modified.UTC().Format(time.RFC3339),
+		filePath+"\t"+utc.Now().Format(time.RFC3339),
+		previous.lines, document.TextLines(data), diffContext)
+	if diff == "" {
+		return
+	}
+
+	if _, err := d.Writer.Write(ctx, d.Fs, filePath+DiffExtension, bytes.NewReader([]byte(diff))); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		d.Logger.Error("Writing diff failed",
+			slog.String("url", u.String()),
+			slog.String("file", filePath+DiffExtension),
+			slog.Any("error", err))
+		return
+	}
+
+	d.Logger.Info("Text changed", slog.String("url", u.String()), slog.String("diff", filePath+DiffExtension))
+}
@@ -1,7 +1,9 @@
 package download
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -10,19 +12,45 @@ import (
 	"time"
 
 	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/corpus"
 	"github.com/cornelk/goscrape/db"
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/download/ioutil"
 	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/images"
 	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/mapping"
 	"github.com/cornelk/goscrape/utc"
 	"github.com/cornelk/goscrape/work"
+	"github.com/rickb777/acceptable/header"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// Throttle controls the request rate. *throttle.Throttle is the standard
+// implementation; others can be injected.
+type Throttle interface {
+	// Sleep pauses for the current delay.
+	Sleep()
+	// SlowDown increases the delay.
+	SlowDown()
+	// Reset reverts the delay to its minimum.
+	Reset()
+	// IsNormal returns true when the delay is at its minimum.
+	IsNormal() bool
+	// Snapshot gets the current state.
+	Snapshot() throttle.Snapshot
+}
+
+var _ Throttle = new(throttle.Throttle)
+
 // Download fetches URLs one by one, sequentially.
 type Download struct {
 	Config   config.Config
@@ -30,60 +58,254 @@ type Download struct {
 	ETagsDB  *db.DB
 	StartURL *url.URL
 
-	Auth   string
-	Client HttpClient
-	Fs     afero.Fs // filesystem can be replaced with in-memory filesystem for testing
+	Auth           string          // preset Authorization header, sent with every request
+	Authenticator  *Authenticator  // answers Basic and Digest challenges; nil if there are no credentials
+	Reauthenticate Reauthenticator // renews expired credentials when a 401 or 403 response is received; nil for none
+	HeaderRules    []HeaderRule    // headers added to the requests for matching URLs
+	AcceptRules    []AcceptRule    // Accept headers pinned for the URLs of particular types
+	Aliases        *work.Aliases   // the pages that were permanently redirected; nil to store them at their original URLs
+	Client         HttpClient
+	Fs             afero.Fs           // filesystem can be replaced with in-memory filesystem for testing
+	Types          filter.Types       // decides which assets are kept, according to their media type
+	Rules          filter.Rules       // decide whether the links in each file are followed and whether it is stored
+	Prune          *document.Selector // elements removed from stored pages; nil for none
+	Corpus         *corpus.Corpus     // receives the text of every stored page; nil for none
+
+	Recoder *images.Recoder // limits the images re-encoded at once; nil for no limits
+	Writer  *ioutil.Writer  // flushes files to disk and writes them in the background; nil writes synchronously
+
+	Lockdown  Throttle           // increases sharply when server gives 429 (Too Many Requests) responses, then resets
+	LoopDelay Throttle           // increases only slightly when server gives 429; never decreases
+	Adaptive  *throttle.Adaptive // adapts to the server's latency and error rate; nil if disabled
+	Histogram Histogram          // accumulates the response status codes
+
+	Recorder       Middleware      // outermost middleware, which sees every request before the cached copies make it conditional; nil for none
+	Middleware     []Middleware    // extra middleware, applied after the built-in middleware
+	PostProcessors []PostProcessor // alter each page before it is stored
 
-	Lockdown  *throttle.Throttle // increases sharply when server gives 429 (Too Many Requests) responses, then resets
-	LoopDelay *throttle.Throttle // increases only slightly when server gives 429; never decreases
+	Logger *logger.Logger // nil logs to slog.Default
 }
 
+// ProcessURL fetches a URL and processes the response, i.e. Fetch followed by Process.
+// When the response is received but not stored, the result is returned along with
+// an error for which Unstored is true.
 func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *work.Result, error) {
-	var existingModified time.Time
+	fetched, err := d.Fetch(ctx, item)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.Process(ctx, fetched)
+}
 
+// Capture processes a response that was received by some other means, such as a
+// request forwarded by a proxy, as though it had been fetched. The response is not
+// closed by the caller.
+func (d *Download) Capture(ctx context.Context, item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	item.FilePath = mapping.GetFilePath(item.URL, true)
+	item.StartTime = utc.Now()
 
-	fileInfo, err := d.Fs.Stat(item.FilePath)
-	if err == nil && fileInfo != nil {
-		existingModified = fileInfo.ModTime()
-	}
+	_, span := startSpan(ctx, spanURL, item.URL)
+	span.SetAttributes(attribute.Int("depth", item.Depth), attribute.Bool("captured", true))
+	return d.Process(ctx, &Fetched{Item: item, resp: resp, span: span, cancel: func() {}})
+}
+
+// Fetched is a response that has yet to be processed.
+type Fetched struct {
+	Item      work.Item
+	resp      *http.Response
+	redirects work.Refs
+	alias     *url.URL // the original URL, when the page is stored at the URL it was redirected to
+	span      trace.Span
+	deadline  time.Time          // the processing deadline, which also bounds Process; zero for none
+	cancel    context.CancelFunc // releases the request context once the response is processed
+}
+
+// Buffered returns true if the response body has been read into memory, so that
+// it can be processed by some other goroutine. Otherwise, the response must be
+// processed promptly because the connection is still open.
+func (f *Fetched) Buffered() bool {
+	_, ok := f.resp.Body.(bufferedBody)
+	return ok
+}
+
+// bufferedBody is a response body that is held in memory.
+type bufferedBody struct {
+	*bytes.Reader
+}
+
+func (bufferedBody) Close() error { return nil }
+
+// Fetch sends the request for a URL and gets the response. Responses that need to
+// be parsed or rewritten, such as HTML pages, are read into memory so that this
+// CPU-bound work can be done separately.
+func (d *Download) Fetch(ctx context.Context, item work.Item) (*Fetched, error) {
+	item.FilePath = mapping.GetFilePath(item.URL, true)
+
+	existingModified := d.conditionalTime(item)
 
 	item.StartTime = utc.Now()
 
-	resp, err := d.httpGet(ctx, item.URL, existingModified)
+	parent, cancel := ctx, context.CancelFunc(func() {})
+	var deadline time.Time
+	if d.Config.ProcessTimeout > 0 {
+		// the deadline covers reading the body, which may happen later in Process
+		deadline = item.StartTime.Add(d.Config.ProcessTimeout)
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+
+	ctx, span := startSpan(ctx, spanURL, item.URL)
+	span.SetAttributes(attribute.Int("depth", item.Depth), attribute.Int("attempt", item.Attempt+1))
+	if !item.Queued.IsZero() {
+		span.SetAttributes(attribute.Int64("queue.wait_ms", item.StartTime.Sub(item.Queued).Milliseconds()))
+	}
+
+	fetchCtx, fetchSpan := startSpan(ctx, spanFetch, item.URL)
+	defer fetchSpan.End()
+
+	resp, err := d.httpGet(fetchCtx, item.URL, existingModified)
+	if err == nil && resp == nil {
+		panic("unexpected nil response")
+	}
+	if err == nil && d.needsProcessing(resp) {
+		err = d.bufferBody(resp)
+	} else if err == nil {
+		d.segmentBody(ctx, resp)
+	}
 	if err != nil {
-		logger.Error("Processing HTTP Request failed",
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		cancel()
+		if ctx.Err() != nil {
+			return nil, interrupted(parent, item) // cancelled, which is not a failure of the request
+		}
+		d.Logger.Error("Processing HTTP Request failed",
 			slog.String("url", item.URL.String()),
 			slog.Any("error", err))
-		return nil, nil, err
+		return nil, err
 	}
 
-	if resp == nil {
-		panic("unexpected nil response")
+	var alias *url.URL
+	redirects := redirectHops(resp)
+	if len(redirects) > 0 {
+		d.Logger.Debug("Redirected",
+			slog.String("url", item.URL.String()),
+			slog.String("via", redirects.String()),
+			slog.String("final", resp.Request.URL.String()))
+
+		if item.Depth == 0 && !d.Config.FixedStartURL {
+			// take account of redirection (only on the start page)
+			item.URL = resp.Request.URL
+		} else if item.Depth > 0 && d.canonicalPage(item.URL, resp) {
+			alias = item.URL
+			item.URL = resp.Request.URL
+			item.FilePath = mapping.GetFilePath(item.URL, true)
+		}
+	}
+
+	return &Fetched{Item: item, resp: resp, redirects: redirects, alias: alias, span: span, deadline: deadline, cancel: cancel}, nil
+}
+
+// interrupted gets the error for work that stopped because its context is done. This
+// is ErrTimedOut if only the processing deadline has passed.
+func interrupted(parent context.Context, item work.Item) error {
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s after %s: %w", item.URL, utc.Now().Sub(item.StartTime).Round(time.Millisecond), ErrTimedOut)
+}
+
+// Process handles a fetched response, storing the file and finding its references.
+func (d *Download) Process(ctx context.Context, fetched *Fetched) (*url.URL, *work.Result, error) {
+	item, resp, span := fetched.Item, fetched.resp, fetched.span
+	ctx = trace.ContextWithSpan(ctx, span)
+	defer span.End()
+
+	parent := ctx
+	defer fetched.cancel()
+	if !fetched.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, fetched.deadline)
+		defer cancel()
 	}
 
 	// n.b. for correct connection pooling in the HTTP client, every response must
 	// be fully consumed and closed
-	defer closeResponseBody(resp.Body, resp.Request.URL)
+	defer d.closeResponseBody(resp.Body, resp.Request.URL)
+
+	if ctx.Err() != nil {
+		return nil, nil, interrupted(parent, item) // the response is discarded
+	}
+
+	if fetched.alias != nil {
+		d.recordAlias(ctx, fetched.alias, item.URL) // before the page's own links are canonicalized
+	}
+
+	u, result, err := d.processResponse(ctx, item, resp)
+	if ctx.Err() != nil {
+		err = interrupted(parent, item) // the result is discarded
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, nil, err
+	}
+	if result != nil {
+		result.Redirects = fetched.redirects
+		result.Duration = utc.Now().Sub(item.StartTime)
+		span.SetAttributes(attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return u, result, err
+}
 
-	if item.Depth == 0 {
-		// take account of redirection (only on the start page)
-		item.URL = resp.Request.URL
+// needsProcessing returns true for the successful responses that will be parsed or
+// rewritten, rather than simply being stored. Stylesheets are rewritten as they are
+// stored, so they are not included.
+func (d *Download) needsProcessing(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || !d.Types.AllowsContentType(mediaTypeOf(resp)) {
+		return false
 	}
 
+	contentType := header.ParseContentTypeFromHeaders(resp.Header)
+	return isHtml(contentType) || isXHtml(contentType) ||
+		(contentType.Type == "image" && d.Config.ImageQuality != 0)
+}
+
+// bufferBody reads the response body into memory, as it was received (i.e. possibly
+// still compressed), and releases the connection.
+func (d *Download) bufferBody(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	d.closeResponseBody(resp.Body, resp.Request.URL)
+	if err != nil {
+		return fmt.Errorf("%s reading response body: %w", resp.Request.URL, err)
+	}
+	resp.Body = bufferedBody{bytes.NewReader(data)}
+	return nil
+}
+
+func (d *Download) processResponse(ctx context.Context, item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	switch resp.StatusCode {
 	case http.StatusOK:
+		if mediaType := mediaTypeOf(resp); !d.Types.AllowsContentType(mediaType) {
+			// the body is not read, which saves downloading it
+			d.Logger.Debug("Skipping by type", slog.String("url", item.URL.String()), slog.String("type", mediaType))
+			return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentType: mediaType}, fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+		}
+
 		// write the response body to a file, possibly modifying its hyperlinks
-		return d.response200(item, resp)
+		return d.response200(ctx, item, resp)
 
 	case http.StatusNotModified, http.StatusTeapot:
 		discardData(resp.Body) // discard anything present
-		return d.response304(item, resp)
+		return d.response304(ctx, item, resp)
 
 	case http.StatusNotFound:
 		discardData(resp.Body) // discard anything present
-		d.ETagsDB.Store(item.URL, db.Item{Expires: utc.Now().Add(d.Config.GetLaxAge())})
-		return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
+		now := utc.Now()
+		d.ETagsDB.Store(item.URL, db.Item{Expires: now.Add(d.Config.GetLaxAge()), Fetched: now, Status: resp.StatusCode})
+		return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, ErrClientError{Code: resp.StatusCode}
 
 	case http.StatusForbidden, http.StatusGone, http.StatusUnavailableForLegalReasons:
 		discardData(resp.Body) // discard anything present
@@ -93,19 +315,65 @@ func (d *Download) ProcessURL(ctx context.Context, item work.Item) (*url.URL, *w
 		discardData(resp.Body) // discard anything present
 		return d.response429(item, resp)
 
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		discardData(resp.Body) // discard anything present
+		return d.response5xx(item, resp)
+
 	default:
 		discardData(resp.Body) // didn't want it
+		if 400 <= resp.StatusCode && resp.StatusCode < 500 {
+			return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, ErrClientError{Code: resp.StatusCode}
+		}
 		return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
 	}
 }
 
 //-------------------------------------------------------------------------------------------------
 
+// conditionalTime gets the time used for a conditional request, which is zero when
+// there is no locally-stored file. The metadata store is preferred because file
+// timestamps are not reliable, e.g. after images have been recoded.
+func (d *Download) conditionalTime(item work.Item) time.Time {
+	if d.Config.Refetch {
+		return time.Time{} // the stored copy is to be replaced whatever its age
+	}
+
+	fileInfo, err := d.Fs.Stat(item.FilePath)
+	if err != nil || fileInfo == nil {
+		return time.Time{}
+	}
+
+	metadata := d.ETagsDB.Lookup(item.URL)
+	switch {
+	case !metadata.LastModified.IsZero():
+		return metadata.LastModified
+	case !metadata.Fetched.IsZero():
+		return metadata.Fetched
+	default:
+		return fileInfo.ModTime()
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// redirectHops lists the URLs that were redirected before arriving at the final response,
+// in the order they were visited.
+func redirectHops(resp *http.Response) work.Refs {
+	var hops work.Refs
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		hops = append(work.Refs{req.Response.Request.URL}, hops...)
+	}
+	return hops
+}
+
+//-------------------------------------------------------------------------------------------------
+
 // responseGone deletes obsolete/inaccessible files
 func (d *Download) responseGone(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	filePath := mapping.GetFilePath(item.URL, true)
 	_ = d.Fs.Remove(filePath)
-	return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
+	d.ETagsDB.Store(item.URL, db.Item{Fetched: utc.Now(), Status: resp.StatusCode})
+	return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, ErrClientError{Code: resp.StatusCode}
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -113,9 +381,16 @@ func (d *Download) responseGone(item work.Item, resp *http.Response) (*url.URL,
 // response429 handles too-many-request responses.
 func (d *Download) response429(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	// put this URL back into the work queue to be re-tried later
-	repeat := &work.Result{Item: item, StatusCode: http.StatusTooManyRequests, References: []*url.URL{item.URL}}
-	repeat.Item.Depth-- // because it will get incremented and we need the retry depth to be unchanged
-	return item.URL, repeat, nil
+	return item.URL, &work.Result{Item: item, StatusCode: http.StatusTooManyRequests, Requeue: true}, ErrTooManyRequests
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// response5xx handles transient server errors that persisted despite retries, and
+// maintenance windows, after which the host is expected to be back.
+func (d *Download) response5xx(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+	// put this URL back into the work queue to be re-tried later
+	return item.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, Requeue: true, ParkedUntil: d.maintenanceUntil(resp)}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
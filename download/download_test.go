@@ -1,15 +1,30 @@
 package download
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/db"
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/stubclient"
+	"github.com/cornelk/goscrape/utc"
 	"github.com/cornelk/goscrape/work"
+	"github.com/rickb777/acceptable/header"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestProcessURL_200_HTML(t *testing.T) {
@@ -77,3 +92,533 @@ func TestProcessURL_200_CSS(t *testing.T) {
 	assert.Contains(t, result.References, mustParse("https://example.org/doc/gopher.png"))
 	assert.Contains(t, result.References, mustParse("https://example.org/sub/food/cheese.png"))
 }
+
+func TestProcessURL_Refetch(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body>content</body></html>`, header.ETag{Hash: "hash"})
+
+	stub.Metadata = db.OpenDB(".", afero.NewMemMapFs(), nil)
+	defer os.Remove("./" + db.FileName)
+	defer stub.Metadata.Close()
+
+	u := mustParse("https://example.org/")
+	stub.Metadata.Store(u, db.Item{ETags: `"hash"`, Expires: utc.Now().Add(time.Hour)}) // not expired
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "index.html", []byte("challenge"), 0o644))
+
+	for _, refetch := range []bool{false, true} {
+		d := &Download{
+			Config:   config.Config{Refetch: refetch},
+			Client:   stub,
+			StartURL: u,
+			ETagsDB:  stub.Metadata,
+			Fs:       fs,
+		}
+
+		_, result, err := d.ProcessURL(context.Background(), work.Item{URL: u})
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(fs, "index.html")
+		require.NoError(t, err)
+		if refetch {
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			assert.Contains(t, string(data), "content")
+		} else {
+			assert.Equal(t, "challenge", string(data))
+		}
+	}
+}
+
+func TestProcessURL_503_Requeue(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusServiceUnavailable, "https://example.org/busy.css", "text/plain", "try later")
+
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       afero.NewMemMapFs(),
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/busy.css"), Depth: 3})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+	assert.True(t, result.Requeue)
+	assert.Empty(t, result.References)
+
+	again := result.Item.Requeue()
+	assert.Equal(t, 3, again.Depth)
+	assert.Equal(t, 1, again.Attempt)
+}
+
+func TestProcessURL_200_ExcludedType(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/media", "video/mp4", "...")
+
+	types, err := filter.NewTypes(nil, []string{"video"})
+	require.NoError(t, err)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       fs,
+		Types:    types,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/media")})
+
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+	assert.True(t, Unstored(err))
+	require.NotNil(t, result)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "video/mp4", result.ContentType)
+	assert.Zero(t, result.FileSize)
+
+	exists, _ := afero.Exists(fs, "media.html")
+	assert.False(t, exists)
+}
+
+func TestProcessURL_ClientErrors(t *testing.T) {
+	for _, code := range []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusGone} {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(code, "https://example.org/page", "text/html", "")
+
+		d := &Download{Client: stub, StartURL: mustParse("https://example.org/"), Fs: afero.NewMemMapFs()}
+		_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/page")})
+
+		var clientErr ErrClientError
+		require.ErrorAs(t, err, &clientErr, "%d", code)
+		assert.Equal(t, code, clientErr.Code)
+		assert.True(t, Unstored(err))
+		require.NotNil(t, result)
+		assert.Equal(t, code, result.StatusCode)
+	}
+}
+
+func TestProcessURL_TooManyRequests(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusTooManyRequests, "https://example.org/page", "text/html", "")
+
+	d := &Download{Client: stub, StartURL: mustParse("https://example.org/"), Fs: afero.NewMemMapFs()}
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/page")})
+
+	assert.ErrorIs(t, err, ErrTooManyRequests)
+	assert.True(t, Unstored(err))
+	require.NotNil(t, result)
+	assert.True(t, result.Requeue)
+}
+
+func TestProcessURL_StorageError(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body><a href="/about">About</a></body></html>`)
+
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       afero.NewReadOnlyFs(afero.NewMemMapFs()),
+		Logger:   logger.Discard(),
+	}
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+
+	var storageErr ErrStorage
+	require.ErrorAs(t, err, &storageErr)
+	assert.Equal(t, "./index.html", storageErr.File)
+	assert.True(t, Unstored(err))
+	require.NotNil(t, result)
+	assert.Equal(t, "example.org/about", result.References.String())
+}
+
+func TestUnstored(t *testing.T) {
+	assert.False(t, Unstored(nil))
+	assert.False(t, Unstored(ErrTimedOut))
+	assert.True(t, Unstored(fmt.Errorf("wrapped: %w", ErrClientError{Code: http.StatusNotFound})))
+}
+
+func TestProcessURL_200_SaveHeaders(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/a/style.css", "text/css", "p {}")
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{SaveHeaders: true},
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       fs,
+	}
+
+	_, _, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/a/style.css")})
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(fs, "a/style.css"+HeadersExtension)
+	require.NoError(t, err)
+
+	var stored StoredHeaders
+	require.NoError(t, json.Unmarshal(data, &stored))
+	assert.Equal(t, "https://example.org/a/style.css", stored.URL)
+	assert.Equal(t, http.StatusOK, stored.Status)
+	assert.Equal(t, "text/css", stored.Header.Get("Content-Type"))
+	assert.Empty(t, stored.Header.Get("Content-Length"))
+}
+
+func TestProcessURL_200_SaveDiffs(t *testing.T) {
+	stub := &stubclient.Client{}
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{SaveDiffs: true},
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       fs,
+	}
+
+	for _, body := range []string{
+		`<html><body><h1>News</h1><p>Old story</p></body></html>`,
+		`<html><body><h1>News</h1><p>New story</p></body></html>`,
+	} {
+		stub.GivenResponse(http.StatusOK, "https://example.org/news", "text/html", body)
+		_, _, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/news")})
+		require.NoError(t, err)
+	}
+
+	data, err := afero.ReadFile(fs, "news.html"+DiffExtension)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\n News\n-Old story\n+New story\n")
+}
+
+func TestProcessURL_200_RobotsMeta(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/private", "text/html",
+		`<html><head><meta name="robots" content="noindex, nofollow"></head><body><a href="/other">a</a></body></html>`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Robots: true},
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       fs,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/private")})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, result.References)
+	exists, _ := afero.Exists(fs, "private.html")
+	assert.False(t, exists)
+}
+
+func TestProcessURL_200_RobotsHeader(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/report.pdf", "application/pdf", "%PDF-1.4")
+	stub.GivenResponse(http.StatusOK, "https://example.org/list", "text/html", `<html><body><a href="/other">a</a></body></html>`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Robots: true},
+		Client:   stub,
+		StartURL: mustParse("http://example.org/"),
+		Fs:       fs,
+		Middleware: []Middleware{
+			func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					resp, err := next.RoundTrip(req)
+					if req.URL.Path == "/report.pdf" {
+						resp.Header.Set("X-Robots-Tag", "noindex")
+					} else {
+						resp.Header.Set("X-Robots-Tag", "otherbot: noindex, nofollow")
+						resp.Header.Add("X-Robots-Tag", "nofollow")
+					}
+					return resp, err
+				})
+			},
+		},
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/report.pdf")})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	exists, _ := afero.Exists(fs, "report.pdf")
+	assert.False(t, exists)
+
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/list")})
+	require.NoError(t, err)
+	assert.Empty(t, result.References)
+	exists, _ = afero.Exists(fs, "list.html")
+	assert.True(t, exists)
+}
+
+func TestProcessURL_200_Prune(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html",
+		`<html><head></head><body><div class="ad"><img src="/pixel.gif"></div><p>Text</p></body></html>`)
+
+	prune, err := document.ParseSelector(".ad")
+	require.NoError(t, err)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+		Prune:    prune,
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+
+	require.NoError(t, err)
+	assert.Empty(t, result.References)
+	data, err := afero.ReadFile(fs, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, `<html><head></head><body><p>Text</p></body></html>`, string(data))
+}
+
+func TestProcessURL_200_Inject(t *testing.T) {
+	utc.Now = func() time.Time { return time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC) }
+	defer func() { utc.Now = func() time.Time { return time.Now().UTC() } }()
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/a?b&c", "text/html",
+		`<html><head></head><body><p>Text</p></body></html>`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{Inject: `<p class="archived">Archived copy of {url} on {date}</p>`, InjectAt: config.InjectBottom},
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+	}
+
+	_, _, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/a?b&c")})
+
+	require.NoError(t, err)
+	data, err := afero.ReadFile(fs, "a_b&c.html")
+	require.NoError(t, err)
+	assert.Equal(t, `<html><head></head><body><p>Text</p><p class="archived">Archived copy of https://example.org/a?b&amp;c on 2024-05-06</p></body></html>`, string(data))
+}
+
+func TestProcessURL_200_PostProcessors(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><head></head><body><p>Text</p></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `<html><head></head><body><p>A</p></body></html>`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       fs,
+		PostProcessors: []PostProcessor{
+			func(u *url.URL, page []byte) ([]byte, error) {
+				if u.Path == "/a" {
+					return nil, errors.New("refused")
+				}
+				return bytes.ToUpper(page), nil
+			},
+		},
+	}
+
+	_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Hash)
+	data, err := afero.ReadFile(fs, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, `<HTML><HEAD></HEAD><BODY><P>TEXT</P></BODY></HTML>`, string(data))
+
+	_, result, err = d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/a")})
+	require.NoError(t, err)
+	assert.Empty(t, result.Hash)
+	exists, _ := afero.Exists(fs, "a.html")
+	assert.False(t, exists)
+}
+
+func TestProcessURL_200_Alternates(t *testing.T) {
+	page := `<html><head><link rel="amphtml" href="/story/amp/"></head>
+<body><a href="/story/amp/">AMP</a> <a href="/other">Other</a></body></html>`
+
+	cases := map[string]struct{ references, pagination string }{
+		config.AlternatesInclude: {references: "example.org/story/amp/ example.org/story/amp/ example.org/other"},
+		config.AlternatesSkip:    {references: "example.org/other"},
+		config.AlternatesPrefer:  {references: "example.org/other", pagination: "example.org/story/amp/"},
+	}
+
+	for mode, expected := range cases {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(http.StatusOK, "https://example.org/story", "text/html", page)
+
+		d := &Download{
+			Config:   config.Config{Alternates: mode},
+			Client:   stub,
+			StartURL: mustParse("https://example.org/"),
+			Fs:       afero.NewMemMapFs(),
+		}
+
+		_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/story")})
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, strings.Fields(expected.references), strings.Fields(result.References.String()), mode)
+		assert.Equal(t, expected.pagination, result.Pagination.String(), mode)
+	}
+}
+
+func TestFetchThenProcess(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/file.pdf", "application/pdf", "pdf")
+
+	fs := afero.NewMemMapFs()
+	d := &Download{Client: stub, StartURL: mustParse("https://example.org/"), Fs: fs}
+
+	page, err := d.Fetch(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+	require.NoError(t, err)
+	assert.True(t, page.Buffered())
+
+	pdf, err := d.Fetch(context.Background(), work.Item{URL: mustParse("https://example.org/file.pdf")})
+	require.NoError(t, err)
+	assert.False(t, pdf.Buffered())
+
+	_, result, err := d.Process(context.Background(), page)
+	require.NoError(t, err)
+	assert.Equal(t, "example.org/a", result.References.String())
+
+	_, result, err = d.Process(context.Background(), pdf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.FileSize)
+}
+
+func TestProcessTimeout(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a>`)
+
+	fs := afero.NewMemMapFs()
+	d := &Download{Client: stub, StartURL: mustParse("https://example.org/"), Fs: fs}
+	d.Config.ProcessTimeout = 10 * time.Millisecond
+
+	page, err := d.Fetch(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond) // e.g. waiting for a processing worker
+	_, result, err := d.Process(context.Background(), page)
+	require.ErrorIs(t, err, ErrTimedOut)
+	assert.Nil(t, result)
+
+	exists, _ := afero.Exists(fs, "index.html")
+	assert.False(t, exists)
+}
+
+func TestProcessTimeout_Fetch(t *testing.T) {
+	d := &Download{Client: blockingClient{}, StartURL: mustParse("https://example.org/"), Fs: afero.NewMemMapFs()}
+	d.Config.ProcessTimeout = 10 * time.Millisecond
+
+	_, err := d.Fetch(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+	require.ErrorIs(t, err, ErrTimedOut)
+
+	// cancelling the whole crawl is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.Fetch(ctx, work.Item{URL: mustParse("https://example.org/")})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrTimedOut)
+}
+
+// blockingClient never responds until the request is cancelled.
+type blockingClient struct{}
+
+func (blockingClient) Do(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestProcessURL_200_TooComplex(t *testing.T) {
+	page := `<html><body><a href="/a">a</a>` + strings.Repeat("<div>", document.MaxNesting+1) + `<a href="/b">b</a></body></html>`
+	for _, scan := range []bool{false, true} {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", page)
+		fs := afero.NewMemMapFs()
+		d := &Download{Client: stub, StartURL: mustParse("https://example.org/"), Fs: fs}
+		d.Config.ScanLargeHTML = scan
+
+		_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/")})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+
+		if scan {
+			assert.Equal(t, "example.org/a example.org/b", result.References.String())
+		} else {
+			assert.Empty(t, result.References)
+		}
+
+		data, err := afero.ReadFile(fs, "index.html")
+		require.NoError(t, err)
+		assert.Equal(t, page, string(data)) // stored verbatim
+	}
+}
+
+func TestProcessURL_200_SaveHeadersRsync(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		_, _ = w.Write([]byte("p {}"))
+	}))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	d := &Download{
+		Config:   config.Config{SaveHeaders: true, Rsync: true},
+		Client:   server.Client(),
+		StartURL: mustParse(server.URL),
+		Fs:       fs,
+	}
+
+	_, _, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse(server.URL + "/style.css")})
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(fs, "style.css"+HeadersExtension)
+	require.NoError(t, err)
+
+	var stored StoredHeaders
+	require.NoError(t, json.Unmarshal(data, &stored))
+	assert.Equal(t, "text/css", stored.Header.Get("Content-Type"))
+	assert.Empty(t, stored.Header.Get("Date"), "it differs on every fetch")
+
+	info, err := fs.Stat("style.css" + HeadersExtension)
+	require.NoError(t, err)
+	assert.True(t, modified.Equal(info.ModTime()), "the sidecar is dated like the file")
+}
+
+func TestProcessURL_200_Unchanged(t *testing.T) {
+	stub := &stubclient.Client{}
+	metadata := db.OpenDB(".", afero.NewMemMapFs(), nil)
+	defer os.Remove("./" + db.FileName)
+	defer metadata.Close()
+
+	fs := afero.NewMemMapFs()
+	u := mustParse("https://example.org/")
+	d := &Download{
+		Client:   stub,
+		StartURL: u,
+		ETagsDB:  metadata,
+		Fs:       fs,
+	}
+	longAgo := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, c := range []struct {
+		body      string
+		unchanged bool
+	}{
+		{body: `<html><body>content</body></html>`},
+		{body: `<html><body>content</body></html>`, unchanged: true},
+		{body: `<html><body>changed</body></html>`},
+	} {
+		stub.GivenResponse(http.StatusOK, u.String(), "text/html", c.body)
+
+		_, result, err := d.ProcessURL(context.Background(), work.Item{URL: u})
+		require.NoError(t, err)
+		assert.NotEmpty(t, result.Hash)
+
+		info, err := fs.Stat("index.html")
+		require.NoError(t, err)
+		assert.Equal(t, c.unchanged, longAgo.Equal(info.ModTime()), c.body)
+		require.NoError(t, fs.Chtimes("index.html", longAgo, longAgo))
+	}
+}
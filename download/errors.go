@@ -0,0 +1,61 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrTimedOut is returned when a URL takes longer than Config.ProcessTimeout to fetch,
+// parse, rewrite and store. Nothing is stored for the URL.
+var ErrTimedOut = errors.New("processing timed out")
+
+// The errors that ProcessURL and Process return along with a result, when a response
+// was received but not stored. Library users can tell them apart with errors.Is and
+// errors.As; the scraper carries on after them.
+var (
+	// ErrTooManyRequests is returned for a 429 response. The result asks for the URL
+	// to be attempted again later.
+	ErrTooManyRequests = errors.New("too many requests")
+
+	// ErrUnsupportedContentType is returned when the media type of a response is
+	// excluded by the type filter. The body is not read.
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// ErrClientError is returned for a 4xx response other than 429.
+type ErrClientError struct {
+	Code int
+}
+
+func (e ErrClientError) Error() string {
+	return fmt.Sprintf("client error %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// ErrStorage is returned when the file for a response could not be written. The
+// result still holds what was found, such as the references of a page. Unlike the
+// other errors returned along with a result, it stops the scraper, because whatever
+// prevented the write, such as a full disk, would most likely lose every later file
+// too.
+type ErrStorage struct {
+	File string
+	Err  error
+}
+
+func (e ErrStorage) Error() string {
+	return fmt.Sprintf("storing %s: %v", e.File, e.Err)
+}
+
+func (e ErrStorage) Unwrap() error {
+	return e.Err
+}
+
+// Unstored returns true if err is one of the errors that are returned along with a
+// result, i.e. ErrTooManyRequests, ErrUnsupportedContentType, ErrClientError or
+// ErrStorage. Any other error means that there is no result.
+func Unstored(err error) bool {
+	var clientErr ErrClientError
+	var storageErr ErrStorage
+	return errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrUnsupportedContentType) ||
+		errors.As(err, &clientErr) || errors.As(err, &storageErr)
+}
@@ -0,0 +1,52 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/document"
+)
+
+// externalStub is the page through which external links are routed; it shows the
+// URL from its fragment, provided that this is an http or https URL.
+const externalStub = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Leaving the archive</title></head>
+<body>
+<h1>You are leaving the archive</h1>
+<p>This link leads to a website that is not part of the archive. It needs an internet connection, and what it leads to may have changed or gone.</p>
+<p><a id="link" rel="external noopener noreferrer">Continue</a> or <a href="javascript:history.back()">go back</a>.</p>
+<script>
+var target = decodeURIComponent(location.hash.slice(1));
+if (/^https?:\/\//i.test(target)) {
+  var link = document.getElementById("link");
+  link.href = target;
+  link.textContent = target;
+}
+</script>
+</body></html>
+`
+
+// annotateExternalLinks marks the links to other websites, as configured.
+func (d *Download) annotateExternalLinks(doc *document.HTMLDocument) {
+	switch d.Config.ExternalLinks {
+	case config.ExternalLinksAnnotate:
+		doc.AnnotateExternalLinks(false)
+	case config.ExternalLinksStub:
+		doc.AnnotateExternalLinks(true)
+	}
+}
+
+// StoreExternalStub writes the page through which external links are routed, if
+// this is required.
+func (d *Download) StoreExternalStub(ctx context.Context) error {
+	if d.Config.ExternalLinks != config.ExternalLinksStub {
+		return nil
+	}
+
+	if _, err := d.Writer.Write(ctx, d.Fs, document.ExternalStubPage, strings.NewReader(externalStub)); err != nil {
+		return fmt.Errorf("writing %s: %w", document.ExternalStubPage, err)
+	}
+	return nil
+}
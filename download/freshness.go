@@ -0,0 +1,69 @@
+package download
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// expiry gets the time at which the cached copy of a response becomes stale, or zero
+// if it must always be revalidated. Normally, this is given by the Expires header.
+// With RespectCacheControl, it follows the rules of RFC 9111 instead: the max-age and
+// s-maxage directives of Cache-Control take precedence over Expires, allowing for
+// the Age header, and no-cache or no-store mean there is no freshness at all.
+func (d *Download) expiry(resp *http.Response, now time.Time) time.Time {
+	expires, _ := header.ParseHTTPDateTime(resp.Header.Get(headername.Expires))
+	if !d.Config.RespectCacheControl {
+		return expires
+	}
+
+	directives := cacheControl(resp.Header)
+	if _, noCache := directives["no-cache"]; noCache {
+		return time.Time{}
+	}
+	if _, noStore := directives["no-store"]; noStore {
+		return time.Time{}
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if seconds, err := strconv.Atoi(directives[name]); err == nil {
+			age, _ := strconv.Atoi(resp.Header.Get("Age"))
+			if seconds <= age {
+				return time.Time{}
+			}
+			return now.Add(time.Duration(seconds-age) * time.Second)
+		}
+	}
+
+	if expires.IsZero() {
+		return expires
+	}
+
+	// the lifetime is relative to the server's clock, which may differ from ours
+	if date, err := header.ParseHTTPDateTime(resp.Header.Get("Date")); err == nil && !date.IsZero() {
+		if !expires.After(date) {
+			return time.Time{}
+		}
+		return now.Add(expires.Sub(date))
+	}
+	return expires
+}
+
+// cacheControl parses the Cache-Control directives, which are keyed in lowercase.
+// Directives without a value have blank values.
+func cacheControl(hdr http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range hdr.Values(headername.CacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
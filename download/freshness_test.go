@@ -0,0 +1,38 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	expires := "Mon, 06 May 2024 13:00:00 GMT"
+
+	cases := []struct {
+		respect  bool
+		header   http.Header
+		expected time.Time
+	}{
+		{false, http.Header{"Expires": {expires}, "Cache-Control": {"max-age=60"}}, now.Add(time.Hour)},
+		{false, http.Header{"Cache-Control": {"max-age=60"}}, time.Time{}},
+		{true, http.Header{"Expires": {expires}, "Cache-Control": {"public, max-age=60"}}, now.Add(time.Minute)},
+		{true, http.Header{"Cache-Control": {"max-age=60, s-maxage=\"120\""}}, now.Add(2 * time.Minute)},
+		{true, http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, now.Add(40 * time.Second)},
+		{true, http.Header{"Cache-Control": {"max-age=60"}, "Age": {"90"}}, time.Time{}},
+		{true, http.Header{"Cache-Control": {"No-Cache, max-age=60"}}, time.Time{}},
+		{true, http.Header{"Cache-Control": {"no-store"}, "Expires": {expires}}, time.Time{}},
+		{true, http.Header{"Expires": {expires}, "Date": {"Mon, 06 May 2024 11:30:00 GMT"}}, now.Add(90 * time.Minute)},
+		{true, http.Header{"Expires": {expires}}, now.Add(time.Hour)},
+		{true, http.Header{"Expires": {"0"}}, time.Time{}},
+	}
+
+	for _, c := range cases {
+		d := &Download{Config: config.Config{RespectCacheControl: c.respect}}
+		assert.Equal(t, c.expected, d.expiry(&http.Response{Header: c.header}, now), "%v %v", c.respect, c.header)
+	}
+}
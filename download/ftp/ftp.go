@@ -0,0 +1,550 @@
+// Package ftp fetches ftp:// and ftps:// URLs as though they were HTTP requests, so that
+// the files on FTP servers, which are still common for older mirrors and firmware, are
+// downloaded by the same client and middleware as web pages, and are stored and
+// referenced in the same way. Directories are presented as HTML index pages that link
+// to their entries, so that they can be crawled.
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default ports; ftps:// uses implicit TLS, i.e. the connection is encrypted from
+// the start, as in curl.
+const (
+	defaultPort    = "21"
+	defaultTLSPort = "990"
+)
+
+// replyTimeout bounds the wait for the final reply to a transfer, once its data
+// connection has been closed.
+const replyTimeout = 10 * time.Second
+
+// Transport is an http.RoundTripper for ftp:// and ftps:// URLs, for use with
+// http.Transport.RegisterProtocol. Only GET and HEAD requests are supported. Each
+// request uses a connection of its own, in passive mode.
+//
+// The username and password are taken from the URL or else from the Basic
+// Authorization header of the request; without them, the login is anonymous. A
+// rejected login gets a 401 response with a Basic challenge, so that the credentials
+// can be supplied in the same way as for websites. Files that don't exist get 404
+// responses, and a directory requested without a trailing slash is redirected to
+// the URL with one, as web servers do.
+type Transport struct {
+	Dial      func(ctx context.Context, network, address string) (net.Conn, error) // nil for the default dialer
+	TLSConfig *tls.Config                                                          // for ftps:// URLs; nil for the defaults
+}
+
+// entry is an item in a directory listing.
+type entry struct {
+	name  string
+	isDir bool
+}
+
+// RoundTrip gets the file or the directory listing for the URL of the request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return response(req, http.StatusMethodNotAllowed, http.Header{"Allow": {"GET, HEAD"}}, nil, 0), nil
+	}
+
+	if !safeArguments(req) {
+		// the path and credentials are sent as arguments of commands, so a line break
+		// in them, e.g. %0D%0A in the URL, would smuggle in another command
+		return response(req, http.StatusBadRequest, nil, nil, 0), nil
+	}
+
+	c, err := t.connect(req.Context(), req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(req)
+	if err != nil {
+		c.close()
+		var reply *textproto.Error
+		if errors.As(err, &reply) {
+			return response(req, statusFor(reply.Code), nil, nil, 0), nil
+		}
+		return nil, fmt.Errorf("ftp %s: %w", req.URL.Host, err)
+	}
+	return resp, nil
+}
+
+// safeArguments checks that the path and credentials of a request contain no CR, LF
+// or NUL characters, which cannot be sent in the arguments of FTP commands.
+func safeArguments(req *http.Request) bool {
+	args := []string{req.URL.Path}
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		args = append(args, req.URL.User.Username(), password)
+	}
+	if u, p, ok := req.BasicAuth(); ok {
+		args = append(args, u, p)
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\r\n\x00") {
+			return false
+		}
+	}
+	return true
+}
+
+// conn is the control connection of an FTP session.
+type conn struct {
+	netConn net.Conn
+	text    *textproto.Conn
+	host    string      // the host name, for the data connections
+	tls     *tls.Config // for the data connections; nil for ftp://
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+	ctx     context.Context
+	stop    func() bool // stops the connection being closed when the request is cancelled
+}
+
+// connect dials the server and reads its greeting.
+func (t *Transport) connect(ctx context.Context, u *url.URL) (*conn, error) {
+	dial := t.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+		if u.Scheme == "ftps" {
+			port = defaultTLSPort
+		}
+	}
+
+	netConn, err := dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("ftp %s: %w", u.Host, err)
+	}
+
+	c := &conn{netConn: netConn, host: u.Hostname(), dial: dial, ctx: ctx}
+
+	if u.Scheme == "ftps" {
+		c.tls = t.TLSConfig.Clone()
+		if c.tls == nil {
+			c.tls = &tls.Config{}
+		}
+		if c.tls.ServerName == "" {
+			c.tls.ServerName = u.Hostname()
+		}
+		if c.tls.ClientSessionCache == nil {
+			// many servers require the data connections to resume the TLS session
+			c.tls.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		}
+		c.netConn = tls.Client(netConn, c.tls)
+	}
+
+	c.text = textproto.NewConn(c.netConn)
+	c.stop = context.AfterFunc(ctx, func() { c.netConn.Close() })
+
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		c.close()
+		return nil, fmt.Errorf("ftp %s: %w", u.Host, err)
+	}
+	return c, nil
+}
+
+// close ends the session.
+func (c *conn) close() {
+	c.stop()
+	_ = c.netConn.SetDeadline(time.Now().Add(replyTimeout))
+	_, _, _ = c.cmd(0, "QUIT")
+	c.netConn.Close()
+}
+
+// cmd sends a command and reads the reply, which is an error if its code differs
+// from expect, as per textproto.Conn.ReadResponse.
+func (c *conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+// get logs in and answers the request.
+func (c *conn) get(req *http.Request) (*http.Response, error) {
+	user, password := "anonymous", "anonymous@"
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+		password, _ = req.URL.User.Password()
+	} else if u, p, ok := req.BasicAuth(); ok {
+		user, password = u, p
+	}
+
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code == 530 || code == 332 {
+		c.close()
+		challenge := http.Header{"Www-Authenticate": {`Basic realm="FTP"`}}
+		return response(req, http.StatusUnauthorized, challenge, nil, 0), nil
+	} else if code != 230 {
+		return nil, &textproto.Error{Code: code, Msg: "login failed"}
+	}
+
+	if c.tls != nil {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return nil, err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return nil, err
+	}
+
+	p := req.URL.Path
+	if p == "" {
+		p = "/"
+	}
+
+	if strings.HasSuffix(p, "/") {
+		return c.list(req, p)
+	}
+	return c.retrieve(req, p)
+}
+
+// retrieve gets a file.
+func (c *conn) retrieve(req *http.Request, p string) (*http.Response, error) {
+	size := int64(-1) // unknown
+	_, msg, err := c.cmd(213, "SIZE %s", p)
+	var reply *textproto.Error
+	switch {
+	case err == nil:
+		size, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+
+	case errors.As(err, &reply) && (reply.Code == 500 || reply.Code == 502):
+		// the server doesn't implement SIZE
+
+	default:
+		if errors.As(err, &reply) && reply.Code/100 == 5 {
+			if _, _, err := c.cmd(2, "CWD %s", p); err == nil {
+				c.close()
+				location := *req.URL
+				location.Path += "/"
+				return response(req, http.StatusMovedPermanently, http.Header{"Location": {location.String()}}, nil, 0), nil
+			}
+		}
+		return nil, err
+	}
+
+	hdr := http.Header{}
+	contentType := mime.TypeByExtension(path.Ext(p))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	hdr.Set("Content-Type", contentType)
+	if size >= 0 {
+		hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	if _, msg, err := c.cmd(213, "MDTM %s", p); err == nil {
+		if modified, ok := parseTime(msg); ok {
+			hdr.Set("Last-Modified", modified.Format(http.TimeFormat))
+
+			since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+			if err == nil && !modified.Truncate(time.Second).After(since) {
+				c.close()
+				return response(req, http.StatusNotModified, hdr, nil, 0), nil
+			}
+		}
+	}
+
+	if req.Method == http.MethodHead {
+		c.close()
+		return response(req, http.StatusOK, hdr, nil, size), nil
+	}
+
+	data, err := c.transfer("RETR %s", p)
+	if err != nil {
+		return nil, err
+	}
+	body := &dataBody{data: data, c: c, stop: context.AfterFunc(c.ctx, func() { data.Close() })}
+	return response(req, http.StatusOK, hdr, body, size), nil
+}
+
+// list gets the listing of a directory, as an HTML page.
+func (c *conn) list(req *http.Request, p string) (*http.Response, error) {
+	if _, _, err := c.cmd(2, "CWD %s", p); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.entries("MLSD", parseMLSD)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code/100 == 5 {
+		entries, err = c.entries("LIST", parseLIST) // the server is older than RFC 3659
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.close()
+
+	page := indexPage(p, entries)
+	hdr := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	hdr.Set("Content-Length", strconv.Itoa(len(page)))
+	if req.Method == http.MethodHead {
+		return response(req, http.StatusOK, hdr, nil, int64(len(page))), nil
+	}
+	return response(req, http.StatusOK, hdr, io.NopCloser(bytes.NewReader(page)), int64(len(page))), nil
+}
+
+// entries gets the listing of the current directory, using the command.
+func (c *conn) entries(command string, parse func(string) (entry, bool)) ([]entry, error) {
+	data, err := c.transfer(command)
+	if err != nil {
+		return nil, err
+	}
+
+	listing, err := io.ReadAll(data)
+	data.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for _, line := range strings.Split(string(listing), "\n") {
+		if e, ok := parse(strings.TrimRight(line, "\r")); ok && e.name != "." && e.name != ".." {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.name, b.name) })
+	return entries, nil
+}
+
+// transfer opens a passive data connection and sends the command that uses it.
+func (c *conn) transfer(format string, args ...any) (net.Conn, error) {
+	port, err := c.passivePort()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.dial(c.ctx, "tcp", net.JoinHostPort(c.host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := c.cmd(1, format, args...); err != nil {
+		data.Close()
+		return nil, err
+	}
+
+	if c.tls != nil {
+		data = tls.Client(data, c.tls)
+	}
+	return data, nil
+}
+
+// passivePort asks the server for the port of a data connection, using EPSV or else
+// PASV. The address given by PASV is ignored in favour of the host name, because it
+// is often wrong behind NAT, and following it would allow the server to direct
+// connections elsewhere.
+func (c *conn) passivePort() (string, error) {
+	code, msg, err := c.cmd(0, "EPSV")
+	if err != nil {
+		return "", err
+	}
+
+	if code == 229 { // e.g. "Entering Extended Passive Mode (|||6446|)"
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return "", fmt.Errorf("unexpected EPSV reply %q", msg)
+		}
+		return msg[start+4 : end], nil
+	}
+
+	_, msg, err = c.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+
+	// e.g. "Entering Passive Mode (192,168,1,2,25,46)"
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	fields := strings.Split(msg[start+1:max(start+1, end)], ",")
+	if start < 0 || len(fields) != 6 {
+		return "", fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	high, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	low, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	return strconv.Itoa(high<<8 | low), nil
+}
+
+// dataBody is the body of a file being retrieved. Closing it ends the session.
+type dataBody struct {
+	data net.Conn
+	c    *conn
+	stop func() bool // stops the data connection being closed when the request is cancelled
+}
+
+func (b *dataBody) Read(p []byte) (int, error) {
+	return b.data.Read(p)
+}
+
+func (b *dataBody) Close() error {
+	b.stop()
+	err := b.data.Close()
+	_ = b.c.netConn.SetDeadline(time.Now().Add(replyTimeout))
+	_, _, _ = b.c.text.ReadResponse(2) // the transfer is complete, or was aborted
+	b.c.close()
+	return err
+}
+
+// response makes a response to the request.
+func response(req *http.Request, status int, hdr http.Header, body io.ReadCloser, length int64) *http.Response {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	if body == nil {
+		body = http.NoBody
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+// statusFor gets the HTTP status that corresponds to an FTP reply code.
+func statusFor(code int) int {
+	switch {
+	case code == 550 || code == 553 || code == 450:
+		return http.StatusNotFound // the file is unavailable
+	case code == 530 || code == 532:
+		return http.StatusForbidden
+	case code == 421 || code/100 == 4:
+		return http.StatusServiceUnavailable // transient
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// parseTime parses the modification time from an MDTM reply, which is in UTC, e.g.
+// "20230116103000" or "20230116103000.123".
+func parseTime(s string) (time.Time, bool) {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), ".")
+	t, err := time.Parse("20060102150405", s)
+	return t, err == nil
+}
+
+// parseMLSD parses a line of an RFC 3659 listing, e.g.
+// "type=file;size=1024;modify=20230116103000; firmware.bin".
+func parseMLSD(line string) (entry, bool) {
+	facts, name, found := strings.Cut(line, " ")
+	if !found || name == "" {
+		return entry{}, false
+	}
+
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, _ := strings.Cut(fact, "=")
+		if strings.EqualFold(key, "type") {
+			switch strings.ToLower(value) {
+			case "dir":
+				return entry{name: name, isDir: true}, true
+			case "cdir", "pdir":
+				return entry{}, false
+			}
+		}
+	}
+	return entry{name: name}, true
+}
+
+// parseLIST parses a line of a Unix-style listing, e.g.
+// "drwxr-xr-x 2 ftp ftp 4096 Jan 16 10:30 pub", or of a DOS-style one, e.g.
+// "01-16-23  10:30AM  <DIR>  pub". Symbolic links are presented as files.
+func parseLIST(line string) (entry, bool) {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) >= 4 && strings.Contains(fields[0], "-") && len(fields[0]) == 8: // DOS
+		return entry{name: afterFields(line, 3), isDir: fields[2] == "<DIR>"}, true
+
+	case len(fields) >= 9: // Unix
+		name := afterFields(line, 8)
+		if fields[0][0] == 'l' {
+			name, _, _ = strings.Cut(name, " -> ")
+		}
+		return entry{name: name, isDir: fields[0][0] == 'd'}, name != ""
+	}
+	return entry{}, false
+}
+
+// afterFields gets the rest of the line after the first n fields, so that names
+// containing spaces are kept intact.
+func afterFields(line string, n int) string {
+	rest := line
+	for range n {
+		rest = strings.TrimLeft(rest, " \t")
+		i := strings.IndexAny(rest, " \t")
+		if i < 0 {
+			return ""
+		}
+		rest = rest[i:]
+	}
+	return strings.TrimLeft(rest, " \t")
+}
+
+// indexPage makes the HTML page for a directory listing. The subdirectories are
+// linked with trailing slashes.
+func indexPage(dir string, entries []entry) []byte {
+	var buf bytes.Buffer
+	title := html.EscapeString("Index of " + dir)
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n", title, title)
+	if dir != "/" {
+		buf.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+
+	for _, e := range entries {
+		name, href := e.name, url.PathEscape(e.name)
+		if strings.Contains(href, ":") {
+			href = "./" + href // not a scheme
+		}
+		if e.isDir {
+			name += "/"
+			href += "/"
+		}
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(name))
+	}
+
+	buf.WriteString("</ul>\n</body></html>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,301 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// server is a minimal FTP server for testing, which serves files from memory.
+type server struct {
+	files    map[string]string // paths of files and their content; directories are implied
+	password string            // required for the user "alice"; blank for anonymous logins
+	noEPSV   bool              // only PASV is supported
+	noMLSD   bool              // only LIST is supported
+	addr     string
+}
+
+func newServer(t *testing.T, s *server) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	s.addr = listener.Addr().String()
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *server) isDir(p string) bool {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	reply := func(format string, args ...any) { fmt.Fprintf(c, format+"\r\n", args...) }
+
+	var data net.Listener
+	dir := "/"
+	reply("220 ready")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+		switch command {
+		case "USER":
+			if arg == "alice" && s.password != "" || arg == "anonymous" {
+				reply("331 password please")
+			} else {
+				reply("530 not allowed")
+			}
+		case "PASS":
+			if s.password == "" && arg == "anonymous@" || s.password != "" && arg == s.password {
+				reply("230 logged in")
+			} else {
+				reply("530 login incorrect")
+			}
+		case "TYPE":
+			reply("200 ok")
+		case "SIZE", "MDTM":
+			content, exists := s.files[arg]
+			switch {
+			case !exists:
+				reply("550 no such file")
+			case command == "SIZE":
+				reply("213 %d", len(content))
+			default:
+				reply("213 20230116103000")
+			}
+		case "CWD":
+			if arg == "/" || s.isDir(arg) {
+				dir = strings.TrimSuffix(arg, "/") + "/"
+				reply("250 ok")
+			} else {
+				reply("550 no such directory")
+			}
+		case "EPSV", "PASV":
+			if command == "EPSV" && s.noEPSV {
+				reply("500 unknown command")
+				continue
+			}
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			port := data.Addr().(*net.TCPAddr).Port
+			if command == "EPSV" {
+				reply("229 Entering Extended Passive Mode (|||%d|)", port)
+			} else {
+				reply("227 Entering Passive Mode (10,1,2,3,%d,%d)", port>>8, port&0xff) // the address is ignored
+			}
+		case "RETR", "MLSD", "LIST":
+			content, exists := s.files[arg]
+			if command == "RETR" && !exists || command == "MLSD" && s.noMLSD {
+				data.Close()
+				reply("550 unavailable")
+				continue
+			}
+			if command != "RETR" {
+				content = s.listing(dir, command == "MLSD")
+			}
+			reply("150 opening data connection")
+			dc, err := data.Accept()
+			data.Close()
+			if err == nil {
+				_, _ = io.WriteString(dc, content)
+				dc.Close()
+			}
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *server) listing(dir string, mlsd bool) string {
+	var names []string
+	subdirs := map[string]bool{}
+	for name := range s.files {
+		rest, found := strings.CutPrefix(name, dir)
+		if !found {
+			continue
+		}
+		if sub, _, isDir := strings.Cut(rest, "/"); isDir {
+			if !subdirs[sub] {
+				subdirs[sub] = true
+				names = append(names, sub+"/")
+			}
+		} else {
+			names = append(names, rest)
+		}
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	if mlsd {
+		b.WriteString("type=cdir; .\r\n")
+	}
+	for _, name := range names {
+		isDir := strings.HasSuffix(name, "/")
+		name = strings.TrimSuffix(name, "/")
+		switch {
+		case mlsd && isDir:
+			fmt.Fprintf(&b, "type=dir;modify=20230116103000; %s\r\n", name)
+		case mlsd:
+			fmt.Fprintf(&b, "type=file;size=%d; %s\r\n", len(s.files[path.Join(dir, name)]), name)
+		case isDir:
+			fmt.Fprintf(&b, "drwxr-xr-x 2 ftp ftp 4096 Jan 16 10:30 %s\r\n", name)
+		default:
+			fmt.Fprintf(&b, "-rw-r--r-- 1 ftp ftp %d Jan 16 10:30 %s\r\n", len(s.files[path.Join(dir, name)]), name)
+		}
+	}
+	return b.String()
+}
+
+func get(t *testing.T, rawURL string, hdr http.Header) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+	if hdr != nil {
+		req.Header = hdr
+	}
+
+	resp, err := (&Transport{}).RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(body)
+}
+
+var files = map[string]string{
+	"/pub/firmware v2.bin": "firmware",
+	"/pub/README":          "read me",
+	"/pub/old/v1.bin":      "old",
+}
+
+func TestTransportFile(t *testing.T) {
+	s := newServer(t, &server{files: files})
+
+	resp, body := get(t, "ftp://"+s.addr+"/pub/firmware%20v2.bin", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "firmware", body)
+	assert.Equal(t, int64(8), resp.ContentLength)
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Mon, 16 Jan 2023 10:30:00 GMT", resp.Header.Get("Last-Modified"))
+
+	resp, _ = get(t, "ftp://"+s.addr+"/pub/README", http.Header{"If-Modified-Since": {"Tue, 17 Jan 2023 00:00:00 GMT"}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = get(t, "ftp://"+s.addr+"/pub/missing.bin", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get(t, "ftp://"+s.addr+"/pub/old", nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "ftp://"+s.addr+"/pub/old/", resp.Header.Get("Location"))
+}
+
+func TestTransportListing(t *testing.T) {
+	expected := `<h1>Index of /pub/</h1>
+<ul>
+<li><a href="../">../</a></li>
+<li><a href="README">README</a></li>
+<li><a href="firmware%20v2.bin">firmware v2.bin</a></li>
+<li><a href="old/">old/</a></li>
+</ul>`
+
+	for _, s := range []*server{{files: files}, {files: files, noEPSV: true, noMLSD: true}} {
+		s = newServer(t, s)
+		resp, body := get(t, "ftp://"+s.addr+"/pub/", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Contains(t, body, expected, "EPSV %t, MLSD %t", !s.noEPSV, !s.noMLSD)
+	}
+
+	s := newServer(t, &server{files: files})
+	resp, _ := get(t, "ftp://"+s.addr+"/private/", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTransportLogin(t *testing.T) {
+	s := newServer(t, &server{files: files, password: "secret"})
+
+	resp, _ := get(t, "ftp://"+s.addr+"/pub/README", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Basic realm="FTP"`, resp.Header.Get("WWW-Authenticate"))
+
+	hdr := http.Header{}
+	(&http.Request{Header: hdr}).SetBasicAuth("alice", "secret")
+	resp, body := get(t, "ftp://"+s.addr+"/pub/README", hdr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "read me", body)
+
+	resp, body = get(t, "ftp://alice:secret@"+s.addr+"/pub/README", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "read me", body)
+}
+
+func TestTransportLineBreaks(t *testing.T) {
+	s := newServer(t, &server{files: files})
+
+	for _, u := range []string{
+		"ftp://" + s.addr + "/pub/README%0D%0ADELE%20x",
+		"ftp://" + s.addr + "/pub/README%00",
+		"ftp://alice%0D%0ADELE%20x:secret@" + s.addr + "/pub/README",
+		"ftp://alice:secret%0A@" + s.addr + "/pub/README",
+	} {
+		resp, _ := get(t, u, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, u)
+	}
+}
+
+func TestParseLIST(t *testing.T) {
+	for line, expected := range map[string]entry{
+		"drwxr-xr-x 2 ftp ftp 4096 Jan 16 10:30 pub":                 {name: "pub", isDir: true},
+		"-rw-r--r-- 1 ftp ftp 1024 Jan 16  2023 release notes.txt":   {name: "release notes.txt"},
+		"lrwxrwxrwx 1 ftp ftp    9 Jan 16 10:30 latest -> v2/fw.bin": {name: "latest"},
+		"01-16-23  10:30AM       <DIR>          firmware":            {name: "firmware", isDir: true},
+		"01-16-23  10:30AM                 1024 fw v2.bin":           {name: "fw v2.bin"},
+	} {
+		e, ok := parseLIST(line)
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, e, line)
+	}
+
+	_, ok := parseLIST("total 12")
+	assert.False(t, ok)
+}
+
+func TestParseTime(t *testing.T) {
+	modified, ok := parseTime("20230116103000.123")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2023, 1, 16, 10, 30, 0, 0, time.UTC), modified)
+}
@@ -0,0 +1,290 @@
+// Package gemini fetches gemini:// URLs as though they were HTTP requests, so that
+// Gemini capsules can be archived by the same client, middleware and processing as
+// websites. Gemtext pages are rendered as HTML, so that their links are followed and
+// rewritten, and so that the archive can be browsed.
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultPort is the port of Gemini servers.
+const defaultPort = "1965"
+
+// maxHeader is the longest response header allowed; the meta is at most 1024 bytes.
+const maxHeader = 1029
+
+// Transport is an http.RoundTripper for gemini:// URLs, for use with
+// http.Transport.RegisterProtocol. Only GET and HEAD requests are supported; HEAD
+// gets the whole response, which is then discarded.
+//
+// Gemini servers nearly always use self-signed certificates, so certificates are not
+// verified: any certificate is accepted on every connection, unless VerifyConnection
+// rejects it. Nor are they remembered, as clients that trust them on first use do.
+// The response statuses are translated into their HTTP equivalents, e.g. 51 (not
+// found) becomes 404 and 31 (permanent redirect) becomes 301.
+type Transport struct {
+	Dial             func(ctx context.Context, network, address string) (net.Conn, error) // nil for the default dialer
+	VerifyConnection func(tls.ConnectionState) error                                      // checks each connection, e.g. for pinned certificates; nil for none
+}
+
+// RoundTrip sends the request and translates the response.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return response(req, http.StatusMethodNotAllowed, http.Header{"Allow": {"GET, HEAD"}}, nil), nil
+	}
+
+	dial := t.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	port := req.URL.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	ctx := req.Context()
+	netConn, err := dial(ctx, "tcp", net.JoinHostPort(req.URL.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("gemini %s: %w", req.URL.Host, err)
+	}
+
+	conn := tls.Client(netConn, &tls.Config{
+		ServerName:         req.URL.Hostname(),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, //nolint:gosec // certificates are nearly always self-signed, so they are not verified
+		VerifyConnection:   t.VerifyConnection,
+	})
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	u := *req.URL
+	u.User = nil
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	if _, err := io.WriteString(conn, u.String()+"\r\n"); err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("gemini %s: %w", req.URL.Host, err)
+	}
+
+	r := bufio.NewReader(conn)
+	status, meta, err := readHeader(r)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("gemini %s: %w", req.URL.Host, err)
+	}
+
+	if status/10 != 2 {
+		stop()
+		conn.Close()
+		return failure(req, status, meta), nil
+	}
+
+	body := &connBody{Reader: r, conn: conn, stop: stop}
+	mediaType, params, err := mime.ParseMediaType(meta)
+	if meta == "" || err == nil && mediaType == "text/gemini" {
+		// the default type is text/gemini, in UTF-8
+		gemtext, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gemini %s: %w", req.URL.Host, err)
+		}
+		page := toHTML(gemtext, params["lang"])
+		hdr := http.Header{"Content-Type": {"text/html; charset=utf-8"}, "Content-Length": {strconv.Itoa(len(page))}}
+		return response(req, http.StatusOK, hdr, io.NopCloser(bytes.NewReader(page))), nil
+	}
+
+	return response(req, http.StatusOK, http.Header{"Content-Type": {meta}}, body), nil
+}
+
+// readHeader reads the response header, e.g. "20 text/gemini".
+func readHeader(r *bufio.Reader) (int, string, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return 0, "", fmt.Errorf("reading response header: %w", err)
+	}
+	if len(line) > maxHeader {
+		return 0, "", fmt.Errorf("response header too long")
+	}
+
+	code, meta, _ := strings.Cut(strings.TrimRight(string(line), "\r\n"), " ")
+	status, err := strconv.Atoi(code)
+	if err != nil || len(code) != 2 {
+		return 0, "", fmt.Errorf("malformed response header %q", line)
+	}
+	return status, strings.TrimSpace(meta), nil
+}
+
+// failure makes the HTTP equivalent of a response other than success.
+func failure(req *http.Request, status int, meta string) *http.Response {
+	switch {
+	case status == 30 || status == 31:
+		code := http.StatusFound
+		if status == 31 {
+			code = http.StatusMovedPermanently
+		}
+		return response(req, code, http.Header{"Location": {meta}}, nil)
+	case status == 44:
+		return response(req, http.StatusTooManyRequests, http.Header{"Retry-After": {meta}}, nil)
+	case status/10 == 4:
+		return response(req, http.StatusServiceUnavailable, nil, nil)
+	case status == 51:
+		return response(req, http.StatusNotFound, nil, nil)
+	case status == 52:
+		return response(req, http.StatusGone, nil, nil)
+	case status == 53:
+		return response(req, http.StatusMisdirectedRequest, nil, nil) // proxy request refused
+	case status/10 == 6:
+		return response(req, http.StatusForbidden, nil, nil) // a client certificate is required
+	default:
+		return response(req, http.StatusBadRequest, nil, nil) // input is expected, or the request was bad
+	}
+}
+
+// connBody is the body of a response, which is read from the connection.
+type connBody struct {
+	*bufio.Reader
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *connBody) Close() error {
+	b.stop()
+	return b.conn.Close()
+}
+
+// response makes a response to the request.
+func response(req *http.Request, status int, hdr http.Header, body io.ReadCloser) *http.Response {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	if body == nil {
+		body = http.NoBody
+	}
+	length := int64(-1)
+	if n, err := strconv.ParseInt(hdr.Get("Content-Length"), 10, 64); err == nil {
+		length = n
+	} else if body == http.NoBody {
+		length = 0
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+// toHTML renders a gemtext page as HTML. Each link line becomes a paragraph with a link,
+// and the title is taken from the first heading. lang is the language of the page, if
+// known.
+func toHTML(gemtext []byte, lang string) []byte {
+	var body bytes.Buffer
+	var title string
+	inList, inPre := false, false
+
+	endList := func() {
+		if inList {
+			body.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for _, line := range strings.Split(string(gemtext), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if strings.HasPrefix(line, "```") {
+			endList()
+			if inPre {
+				body.WriteString("</pre>\n")
+			} else {
+				body.WriteString("<pre>")
+			}
+			inPre = !inPre
+			continue
+		}
+		if inPre {
+			body.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		if item, isItem := strings.CutPrefix(line, "* "); isItem {
+			if !inList {
+				body.WriteString("<ul>\n")
+				inList = true
+			}
+			fmt.Fprintf(&body, "<li>%s</li>\n", html.EscapeString(item))
+			continue
+		}
+		endList()
+
+		switch {
+		case strings.HasPrefix(line, "=>"):
+			fields := strings.Fields(strings.TrimPrefix(line, "=>"))
+			if len(fields) == 0 {
+				continue
+			}
+			label := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, "=>")), fields[0]))
+			if label == "" {
+				label = fields[0]
+			}
+			fmt.Fprintf(&body, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(fields[0]), html.EscapeString(label))
+
+		case strings.HasPrefix(line, "#"):
+			level := min(len(line)-len(strings.TrimLeft(line, "#")), 3)
+			text := strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if title == "" {
+				title = text
+			}
+			fmt.Fprintf(&body, "<h%d>%s</h%d>\n", level, html.EscapeString(text), level)
+
+		case strings.HasPrefix(line, ">"):
+			fmt.Fprintf(&body, "<blockquote>%s</blockquote>\n", html.EscapeString(strings.TrimSpace(line[1:])))
+
+		case strings.TrimSpace(line) == "":
+			// blank lines only separate the other lines
+
+		default:
+			fmt.Fprintf(&body, "<p>%s</p>\n", html.EscapeString(line))
+		}
+	}
+	endList()
+	if inPre {
+		body.WriteString("</pre>\n")
+	}
+
+	var page bytes.Buffer
+	page.WriteString("<!DOCTYPE html>\n<html")
+	if lang != "" {
+		fmt.Fprintf(&page, " lang=\"%s\"", html.EscapeString(lang))
+	}
+	fmt.Fprintf(&page, "><head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n", html.EscapeString(title))
+	page.Write(body.Bytes())
+	page.WriteString("</body></html>\n")
+	return page.Bytes()
+}
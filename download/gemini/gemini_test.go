@@ -0,0 +1,139 @@
+package gemini
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer starts a Gemini server that gives the responses for the paths of the
+// requested URLs, or 51 (not found). It returns the base URL of the capsule.
+func newServer(t *testing.T, responses map[string]string) string {
+	certs := httptest.NewUnstartedServer(nil)
+	certs.StartTLS() // for its self-signed certificate
+	config := certs.TLS.Clone()
+	certs.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				request, err := bufio.NewReader(c).ReadString('\n')
+				if err != nil {
+					return
+				}
+				resp := "51 Not found\r\n"
+				if u, err := url.Parse(strings.TrimSpace(request)); err == nil && u.Scheme == "gemini" {
+					if r, exists := responses[u.Path]; exists {
+						resp = r
+					}
+				}
+				_, _ = io.WriteString(c, resp)
+			}()
+		}
+	}()
+	return "gemini://" + listener.Addr().String()
+}
+
+func get(t *testing.T, rawURL string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+
+	resp, err := (&Transport{}).RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(body)
+}
+
+func TestTransport(t *testing.T) {
+	base := newServer(t, map[string]string{
+		"/":          "20 text/gemini; lang=en\r\n# Capsule\r\n=> /log/ Log\r\n",
+		"/photo.jpg": "20 image/jpeg\r\nJPEG",
+		"/old":       "31 /new\r\n",
+		"/busy":      "44 60\r\n",
+	})
+
+	resp, body := get(t, base)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<html lang="en"><head><meta charset="utf-8"><title>Capsule</title></head>`)
+	assert.Contains(t, body, `<p><a href="/log/">Log</a></p>`)
+
+	resp, body = get(t, base+"/photo.jpg")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "JPEG", body)
+
+	resp, _ = get(t, base+"/old")
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/new", resp.Header.Get("Location"))
+
+	resp, _ = get(t, base+"/busy")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	resp, _ = get(t, base+"/missing")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTransportVerifyConnection(t *testing.T) {
+	base := newServer(t, map[string]string{"/": "20 text/plain\r\nhello"})
+	req, err := http.NewRequest(http.MethodGet, base, nil)
+	require.NoError(t, err)
+
+	errPinned := errors.New("not the pinned certificate")
+	transport := &Transport{VerifyConnection: func(cs tls.ConnectionState) error {
+		require.NotEmpty(t, cs.PeerCertificates)
+		return errPinned
+	}}
+	_, err = transport.RoundTrip(req)
+	assert.ErrorIs(t, err, errPinned)
+}
+
+func TestToHTML(t *testing.T) {
+	gemtext := "# Notes & <things>\n" +
+		"Some text.\n" +
+		"\n" +
+		"=> gemini://example.org/a.gmi\n" +
+		"=>  b.gmi  The second  page\n" +
+		"* one\n" +
+		"* two\n" +
+		"> quoted\n" +
+		"```alt\n" +
+		"  <pre>\n" +
+		"```\n" +
+		"### Deep\n"
+
+	expected := "<h1>Notes &amp; &lt;things&gt;</h1>\n" +
+		"<p>Some text.</p>\n" +
+		"<p><a href=\"gemini://example.org/a.gmi\">gemini://example.org/a.gmi</a></p>\n" +
+		"<p><a href=\"b.gmi\">The second  page</a></p>\n" +
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n" +
+		"<blockquote>quoted</blockquote>\n" +
+		"<pre>  &lt;pre&gt;\n</pre>\n" +
+		"<h3>Deep</h3>\n"
+
+	page := string(toHTML([]byte(gemtext), ""))
+	assert.Contains(t, page, "<html><head><meta charset=\"utf-8\"><title>Notes &amp; &lt;things&gt;</title></head>")
+	assert.Contains(t, page, "<body>\n"+expected+"</body>")
+}
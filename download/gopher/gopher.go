@@ -0,0 +1,243 @@
+// Package gopher fetches gopher:// URLs as though they were HTTP requests, so that
+// Gopher holes can be archived by the same client, middleware and processing as
+// websites. Menus are rendered as HTML, so that their links are followed and
+// rewritten, and so that the archive can be browsed.
+package gopher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// defaultPort is the port of Gopher servers.
+const defaultPort = "70"
+
+// Transport is an http.RoundTripper for gopher:// URLs, for use with
+// http.Transport.RegisterProtocol. Only GET and HEAD requests are supported; HEAD
+// gets the whole response, which is then discarded.
+//
+// As in RFC 4266, the path of a URL is the item type followed by the selector, e.g.
+// "/0/about.txt" is the text file "/about.txt"; a blank path is the root menu. The
+// query, if any, is sent as the search terms. Gopher has no statuses, so a menu that
+// consists only of an error is treated as not found; everything else succeeds.
+type Transport struct {
+	Dial func(ctx context.Context, network, address string) (net.Conn, error) // nil for the default dialer
+}
+
+// RoundTrip sends the selector and gets the item.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return response(req, http.StatusMethodNotAllowed, http.Header{"Allow": {"GET, HEAD"}}, nil), nil
+	}
+
+	dial := t.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	port := req.URL.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	itemType, selector := byte('1'), ""
+	if p := strings.TrimPrefix(req.URL.Path, "/"); p != "" {
+		itemType, selector = p[0], p[1:]
+	}
+	if req.URL.RawQuery != "" {
+		query, _ := url.QueryUnescape(req.URL.RawQuery)
+		selector += "\t" + query
+	}
+
+	if strings.ContainsAny(selector, "\r\n\x00") {
+		// a line break, e.g. %0D%0A in the URL, would end the selector early
+		return response(req, http.StatusBadRequest, nil, nil), nil
+	}
+
+	ctx := req.Context()
+	conn, err := dial(ctx, "tcp", net.JoinHostPort(req.URL.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("gopher %s: %w", req.URL.Host, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	if _, err := io.WriteString(conn, selector+"\r\n"); err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("gopher %s: %w", req.URL.Host, err)
+	}
+
+	body := &connBody{conn: conn, stop: stop}
+
+	switch itemType {
+	case '1', '7': // menus and search results
+		menu, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gopher %s: %w", req.URL.Host, err)
+		}
+
+		items := parseMenu(menu)
+		if len(items) == 1 && items[0].itemType == '3' {
+			return response(req, http.StatusNotFound, nil, nil), nil
+		}
+
+		page := toHTML(items, selector)
+		hdr := http.Header{"Content-Type": {"text/html; charset=utf-8"}, "Content-Length": {strconv.Itoa(len(page))}}
+		return response(req, http.StatusOK, hdr, io.NopCloser(bytes.NewReader(page))), nil
+
+	case '0':
+		return response(req, http.StatusOK, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, body), nil
+
+	default:
+		return response(req, http.StatusOK, http.Header{"Content-Type": {contentType(itemType, selector)}}, body), nil
+	}
+}
+
+// contentType gets the media type of an item, from its type or else its extension.
+func contentType(itemType byte, selector string) string {
+	switch itemType {
+	case 'h':
+		return "text/html"
+	case 'g':
+		return "image/gif"
+	}
+
+	if t := mime.TypeByExtension(path.Ext(selector)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// item is an entry in a menu.
+type item struct {
+	itemType byte
+	display  string
+	selector string
+	host     string
+	port     string
+}
+
+// parseMenu parses the lines of a menu, each of which is the item type and the
+// display string, selector, host and port separated by tabs. A line "." ends the menu.
+func parseMenu(menu []byte) []item {
+	var items []item
+	s := bufio.NewScanner(bytes.NewReader(menu))
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "." {
+			break
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line[1:], "\t")
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		items = append(items, item{itemType: line[0], display: fields[0], selector: fields[1], host: fields[2], port: fields[3]})
+	}
+	return items
+}
+
+// link gets the URL of the item, which is blank for information lines and others that
+// cannot be followed.
+func (it item) link() string {
+	switch it.itemType {
+	case 'i', '3', '2', '8', 'T':
+		return "" // information, errors, CSO, telnet and tn3270
+	}
+
+	if it.itemType == 'h' {
+		if target, ok := strings.CutPrefix(it.selector, "URL:"); ok {
+			return target // a link to a website or other resource
+		}
+	}
+
+	host := it.host
+	if it.port != "" && it.port != defaultPort {
+		host = net.JoinHostPort(it.host, it.port)
+	}
+	u := url.URL{Scheme: "gopher", Host: host, Path: "/" + string(it.itemType) + it.selector}
+	return u.String()
+}
+
+// toHTML renders a menu as HTML, with a link for each item that can be followed.
+func toHTML(items []item, selector string) []byte {
+	var buf bytes.Buffer
+	title := html.EscapeString(selector)
+	if title == "" {
+		title = "/"
+	}
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<pre>\n", title)
+
+	for _, it := range items {
+		display := html.EscapeString(it.display)
+		if href := it.link(); href != "" {
+			fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(href), display)
+		} else {
+			buf.WriteString(display + "\n")
+		}
+	}
+
+	buf.WriteString("</pre>\n</body></html>\n")
+	return buf.Bytes()
+}
+
+// connBody is the body of a response, which is read from the connection.
+type connBody struct {
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *connBody) Read(p []byte) (int, error) {
+	return b.conn.Read(p)
+}
+
+func (b *connBody) Close() error {
+	b.stop()
+	return b.conn.Close()
+}
+
+// response makes a response to the request.
+func response(req *http.Request, status int, hdr http.Header, body io.ReadCloser) *http.Response {
+	if hdr == nil {
+		hdr = http.Header{}
+	}
+	if body == nil {
+		body = http.NoBody
+	}
+	length := int64(-1)
+	if n, err := strconv.ParseInt(hdr.Get("Content-Length"), 10, 64); err == nil {
+		length = n
+	} else if body == http.NoBody {
+		length = 0
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
@@ -0,0 +1,105 @@
+package gopher
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer starts a Gopher server that gives the items for the requested selectors,
+// or an error menu. It returns the base URL of the hole.
+func newServer(t *testing.T, items map[string]string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				selector, err := bufio.NewReader(c).ReadString('\n')
+				if err != nil {
+					return
+				}
+				selector = strings.TrimRight(selector, "\r\n")
+				item, exists := items[selector]
+				if !exists {
+					item = "3'" + selector + "' does not exist\t\terror.host\t1\r\n.\r\n"
+				}
+				_, _ = io.WriteString(c, item)
+			}()
+		}
+	}()
+	return "gopher://" + listener.Addr().String()
+}
+
+func get(t *testing.T, rawURL string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+
+	resp, err := (&Transport{}).RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(body)
+}
+
+func TestTransport(t *testing.T) {
+	base := newServer(t, map[string]string{
+		"": "iWelcome to <the> hole\t\tfake\t0\r\n" +
+			"0About\t/about.txt\tgopher.example.org\t70\r\n" +
+			"1Phlog\t/phlog\tgopher.example.org\t7070\r\n" +
+			"IPhoto\t/photo.png\tgopher.example.org\t70\r\n" +
+			"hWebsite\tURL:https://example.org/\tgopher.example.org\t70\r\n" +
+			".\r\n",
+		"/about.txt":     "About this hole",
+		"/find\tgo lang": "0Result\t/result.txt\tgopher.example.org\t70\r\n.\r\n",
+	})
+
+	resp, body := get(t, base+"/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, "<pre>\n"+
+		"Welcome to &lt;the&gt; hole\n"+
+		"<a href=\"gopher://gopher.example.org/0/about.txt\">About</a>\n"+
+		"<a href=\"gopher://gopher.example.org:7070/1/phlog\">Phlog</a>\n"+
+		"<a href=\"gopher://gopher.example.org/I/photo.png\">Photo</a>\n"+
+		"<a href=\"https://example.org/\">Website</a>\n"+
+		"</pre>")
+
+	resp, body = get(t, base+"/0/about.txt")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "About this hole", body)
+
+	resp, body = get(t, base+"/7/find?go%20lang")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<a href=\"gopher://gopher.example.org/0/result.txt\">Result</a>")
+
+	resp, _ = get(t, base+"/1/missing")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get(t, base+"/0/about.txt%0D%0A/secret")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = get(t, base+"/7/find?go%0D%0Alang")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestContentType(t *testing.T) {
+	assert.Equal(t, "image/gif", contentType('g', "/anim"))
+	assert.Equal(t, "image/png", contentType('I', "/photo.png"))
+	assert.Equal(t, "application/octet-stream", contentType('9', "/archive"))
+}
@@ -0,0 +1,92 @@
+package download
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// HeaderRule adds headers to the requests for the URLs that match its host and paths.
+type HeaderRule struct {
+	host   string // exact, or "*.example.org" for any subdomain
+	paths  filter.Filter
+	header http.Header
+}
+
+// NewHeaderRules compiles the header rules. Patterns that don't start with a host name
+// apply to startHost.
+func NewHeaderRules(rules []config.HeaderRule, startHost string) ([]HeaderRule, error) {
+	var compiled []HeaderRule
+	for _, rule := range rules {
+		host, path := startHost, rule.Pattern
+		if !strings.HasPrefix(path, "/") {
+			host, path, _ = strings.Cut(path, "/")
+			path = "/" + path
+		}
+
+		if path == "/" {
+			path = "/**" // the whole host
+		}
+
+		re, err := filter.GlobToRegexp(path)
+		if err != nil {
+			return nil, fmt.Errorf("header rule: %w", err)
+		}
+
+		paths, err := filter.New([]string{re})
+		if err != nil {
+			return nil, fmt.Errorf("header rule %q: %w", rule.Pattern, err)
+		}
+
+		compiled = append(compiled, HeaderRule{host: host, paths: paths, header: rule.Header})
+	}
+	return compiled, nil
+}
+
+func (rule HeaderRule) matches(u *url.URL, log *logger.Logger) bool {
+	if !hostMatches(rule.host, u.Host) {
+		return false
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return rule.paths.Matches(&url.URL{Path: path}, "Adding headers", log)
+}
+
+// URLHeaders sets the headers of the rules that match each request, replacing any
+// existing values. The cookies of all the matching rules are sent together.
+func URLHeaders(rules []HeaderRule, log *logger.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			cloned := false
+			for _, rule := range rules {
+				if !rule.matches(req.URL, log) {
+					continue
+				}
+
+				if !cloned {
+					req = req.Clone(req.Context())
+					cloned = true
+				}
+
+				for key, values := range rule.header {
+					for _, value := range values {
+						if key == headername.Cookie && req.Header.Get(key) != "" {
+							value = req.Header.Get(key) + "; " + value
+						}
+						req.Header.Set(key, value)
+					}
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// HeadersExtension is appended to the name of each stored file to give the name of the
+// sidecar file that holds its response headers.
+const HeadersExtension = ".headers.json"
+
+// StoredHeaders is the content of each sidecar file.
+type StoredHeaders struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// omittedHeaders don't describe the stored file, which is decompressed, or are
+// connection-specific, or may hold secrets.
+var omittedHeaders = []string{
+	headername.ContentEncoding,
+	headername.ContentLength,
+	"Transfer-Encoding",
+	"Connection",
+	"Keep-Alive",
+	"Set-Cookie",
+}
+
+// volatileHeaders differ each time that a file is fetched, so they are omitted in
+// rsync mode, where unchanged sidecar files must not be rewritten.
+var volatileHeaders = []string{
+	"Date",
+	"Age",
+	"Expires",
+}
+
+// storeHeaders writes the response headers into a sidecar file next to the file
+// holding the response body.
+func (d *Download) storeHeaders(ctx context.Context, u *url.URL, filePath string, resp *http.Response) {
+	hdr := resp.Header.Clone()
+	for _, name := range omittedHeaders {
+		hdr.Del(name)
+	}
+	if d.Config.Rsync {
+		for _, name := range volatileHeaders {
+			hdr.Del(name)
+		}
+	}
+
+	data, err := json.MarshalIndent(StoredHeaders{URL: u.String(), Status: resp.StatusCode, Header: hdr}, "", "  ")
+	if err != nil {
+		d.Logger.Error("Encoding headers failed", slog.String("url", u.String()), slog.Any("error", err))
+		return
+	}
+
+	sidecar := filePath + HeadersExtension
+	if _, err = d.Writer.Write(ctx, d.Fs, sidecar, bytes.NewReader(append(data, '\n'))); err != nil {
+		if ctx.Err() == nil {
+			d.Logger.Error("Writing headers failed",
+				slog.String("url", u.String()),
+				slog.String("file", sidecar),
+				slog.Any("error", err))
+		}
+		return
+	}
+
+	if d.Config.Rsync {
+		// the sidecar is dated like the file it describes
+		if lastModified, err := header.ParseHTTPDateTime(resp.Header.Get(headername.LastModified)); err == nil && !lastModified.IsZero() {
+			if err := d.Fs.Chtimes(sidecar, lastModified, lastModified); err != nil {
+				d.Logger.Error("Updating file timestamps failed", slog.String("file", sidecar), slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -1,14 +1,27 @@
 package download
 
 import (
+	"maps"
 	"sync"
 )
 
+// Histogram accumulates HTTP response status codes. *SyncCounter is the standard
+// implementation; others can be injected, e.g. to export to a metrics system.
+type Histogram interface {
+	// Increment adds one to the bucket indicated by code.
+	Increment(code int)
+
+	// Snapshot gets a copy of the histogram.
+	Snapshot() map[int]int
+}
+
 type SyncCounter struct {
 	m  map[int]int
 	mu sync.Mutex
 }
 
+var _ Histogram = new(SyncCounter)
+
 func NewHistogram() *SyncCounter {
 	return &SyncCounter{m: make(map[int]int)}
 }
@@ -20,7 +33,9 @@ func (c *SyncCounter) Increment(code int) {
 	c.m[code]++
 }
 
-// Map accesses the histogram. This is not safe for concurrent use.
-func (c *SyncCounter) Map() map[int]int {
-	return c.m
+// Snapshot gets a copy of the histogram. This is safe for concurrent use.
+func (c *SyncCounter) Snapshot() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.m)
 }
@@ -1,24 +1,19 @@
 package download
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"github.com/cornelk/goscrape/utc"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
 
-	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/utc"
 	"github.com/rickb777/acceptable/header"
 	"github.com/rickb777/acceptable/headername"
 )
 
-// Counters accumulates HTTP response status codes.
-var Counters = NewHistogram()
-
 // httpGet performs one HTTP 'get' request, with as many retries as needed, up to the
 // configured limit. Unless an error arises, the response body must be fully
 // consumed and then closed.
@@ -28,46 +23,10 @@ func (d *Download) httpGet(ctx context.Context, u *url.URL, lastModified time.Ti
 	if err != nil {
 		return nil, fmt.Errorf("creating HTTP request: %w", err)
 	}
-	req.Header.Set(headername.AcceptEncoding, "gzip")
-
-	if d.Config.UserAgent != "" {
-		req.Header.Set(headername.UserAgent, d.Config.UserAgent)
-	}
-
-	if d.Auth != "" {
-		req.Header.Set(headername.Authorization, d.Auth)
-	}
 
 	// lastModified is only set when a locally-cached file exists
 	if !lastModified.IsZero() {
 		req.Header.Set(headername.IfModifiedSince, lastModified.Format(header.RFC1123))
-
-		metadata := d.ETagsDB.Lookup(u)
-		if d.Config.LaxAge >= 0 {
-			now := utc.Now()
-			if now.Before(metadata.Expires.Add(d.Config.LaxAge)) ||
-				now.Before(lastModified.Add(d.Config.LaxAge)) {
-				// not yet expired so no need for any HTTP traffic - report as 'teapot'
-				return &http.Response{
-					Request:       req,
-					Status:        http.StatusText(http.StatusTeapot),
-					StatusCode:    http.StatusTeapot, // treated like StatusNotModified
-					Header:        http.Header{},
-					Body:          io.NopCloser(&bytes.Buffer{}),
-					ContentLength: 0,
-				}, nil
-			}
-		}
-
-		if len(metadata.ETags) > 0 {
-			req.Header.Set(headername.IfNoneMatch, metadata.ETags)
-		}
-	}
-
-	for key, values := range d.Config.Header {
-		for _, value := range values {
-			req.Header.Set(key, value)
-		}
 	}
 
 	tries := d.Config.Tries
@@ -75,54 +34,65 @@ func (d *Download) httpGet(ctx context.Context, u *url.URL, lastModified time.Ti
 		tries = 1
 	}
 
-	// this loop provides retries if 5xx server errors arise
-	for i := 0; i < tries; i++ {
-		d.LoopDelay.Sleep() // mild rate limiter
-		d.Lockdown.Sleep()  // severe rate limiter during 429 lockdown
+	rt := d.roundTripper()
+	renewed := false
 
-		resp, err = d.Client.Do(req)
+	// this loop provides retries if 5xx server errors arise, and one more if the
+	// credentials are renewed
+	for i := 0; i < tries; i++ {
+		sent := utc.Now()
+		resp, err = rt.RoundTrip(req.Clone(ctx)) // a clone, so that cookies added by the client are not repeated
 		if err != nil {
 			// halt the application
 			return nil, fmt.Errorf("sending HTTP GET %s: %w", u, err)
 		}
 
-		Counters.Increment(resp.StatusCode)
-		args := []any{slog.String("url", u.String()), slog.Int("status", resp.StatusCode)}
-		args = addHeaderValue(args, resp.Header, headername.ContentType)
-		args = addHeaderValue(args, resp.Header, headername.ContentLength)
-		args = addHeaderValue(args, resp.Header, headername.LastModified)
-		args = addHeaderValue(args, resp.Header, headername.ContentEncoding)
-		args = addHeaderValue(args, resp.Header, headername.Vary)
-		logger.Debug(http.MethodGet, args...)
-
 		switch {
 		// 1xx status codes are never returned
-		// 3xx redirect status code - handled by http.Client (up to 10 redirections)
+		// 3xx redirect status code - mostly handled by http.Client; the remainder
+		// were not followed because of the redirect policy
+		case 300 <= resp.StatusCode && resp.StatusCode < 400 && resp.StatusCode != http.StatusNotModified:
+			return resp, nil // this url will be logged then discarded
+
+		// 503 during a maintenance window - retrying is futile until it has ended
+		case !d.maintenanceUntil(resp).IsZero():
+			return resp, nil // this URL will be re-tried after the window
 
 		// 5xx status code = server error - retry the specified number of times
 		case resp.StatusCode >= 500:
-			d.Lockdown.SlowDown() // back off request rate whilst the server is abnormal
 			// retry logic continues below
 
 		case resp.StatusCode == http.StatusTooManyRequests:
-			d.Lockdown.SlowDown()  // back off request rate whilst we're being throttled by the server
-			d.LoopDelay.SlowDown() // never return to the original speed
-			return resp, nil       // this URL will be re-tried later
+			return resp, nil // this URL will be re-tried later
+
+		// 401 or 403 - the login session or token may have expired, so it is renewed
+		// once and this URL is re-tried straight away
+		case (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) &&
+			d.Reauthenticate != nil && !renewed:
+			renewed = true
+			if err := d.Reauthenticate(ctx, sent); err != nil {
+				d.Logger.Warn("Renewing the credentials failed",
+					slog.String("url", req.URL.String()),
+					slog.Int("code", resp.StatusCode),
+					slog.Any("error", err))
+				return resp, nil // this url will be logged then discarded
+			}
+			discardData(resp.Body)
+			d.closeResponseBody(resp.Body, req.URL)
+			tries++ // the retry is in addition to those for server errors
+			continue
 
-		// 4xx status code = client error
+		// 4xx status code = client error (also 'teapot' from the cache)
 		case resp.StatusCode >= 400:
-			d.Lockdown.Reset()
 			// returning no error allows ongoing downloading of other URLs
 			return resp, nil // this url will be logged then discarded
 
 		// 304 not modified - no download but scan for links if possible
 		case resp.StatusCode == http.StatusNotModified:
-			d.Lockdown.Reset()
 			return resp, nil
 
 		// 2xx status code = success
 		case 200 <= resp.StatusCode && resp.StatusCode < 300:
-			d.Lockdown.Reset()
 			return resp, nil
 
 		default:
@@ -131,7 +101,9 @@ func (d *Download) httpGet(ctx context.Context, u *url.URL, lastModified time.Ti
 		}
 
 		if i+1 < tries {
-			logger.Warn(http.StatusText(resp.StatusCode),
+			discardData(resp.Body)
+			d.closeResponseBody(resp.Body, req.URL)
+			d.Logger.Warn(http.StatusText(resp.StatusCode),
 				slog.String("url", req.URL.String()),
 				slog.Int("code", resp.StatusCode))
 		}
@@ -140,9 +112,9 @@ func (d *Download) httpGet(ctx context.Context, u *url.URL, lastModified time.Ti
 	return resp, nil // allow this URL to be abandoned
 }
 
-func closeResponseBody(c io.Closer, u *url.URL) {
+func (d *Download) closeResponseBody(c io.Closer, u *url.URL) {
 	if err := c.Close(); err != nil {
-		logger.Error("Closing HTTP response body failed",
+		d.Logger.Error("Closing HTTP response body failed",
 			slog.Any("url", u),
 			slog.Any("error", err))
 	}
@@ -2,6 +2,7 @@ package download
 
 import (
 	"context"
+	"errors"
 	"github.com/cornelk/goscrape/download/throttle"
 	"github.com/cornelk/goscrape/stubclient"
 	"github.com/cornelk/goscrape/utc"
@@ -154,7 +155,7 @@ func TestGet304UsingEtag(t *testing.T) {
 	stub := &stubclient.Client{}
 	stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`, header.ETag{Hash: "hash"})
 
-	stub.Metadata = db.OpenDB(".", afero.NewMemMapFs())
+	stub.Metadata = db.OpenDB(".", afero.NewMemMapFs(), nil)
 	defer os.Remove("./" + db.FileName)
 	defer stub.Metadata.Close()
 
@@ -182,7 +183,7 @@ func TestGet304UsingEtag(t *testing.T) {
 func TestNotYetExpired(t *testing.T) {
 	stub := &stubclient.Client{}
 
-	stub.Metadata = db.OpenDB(".", afero.NewMemMapFs())
+	stub.Metadata = db.OpenDB(".", afero.NewMemMapFs(), nil)
 	defer os.Remove("./" + db.FileName)
 	defer stub.Metadata.Close()
 
@@ -235,3 +236,64 @@ func mustParse(s string) *url.URL {
 	}
 	return u
 }
+
+func TestGet401Reauthenticate(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusUnauthorized, "http://example.org/", "text/html", `<html></html>`)
+
+	var renewals []time.Time
+	d := &Download{
+		Client: stub,
+		Reauthenticate: func(ctx context.Context, sent time.Time) error {
+			renewals = append(renewals, sent)
+			stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`)
+			return nil
+		},
+	}
+
+	before := utc.Now()
+	resp, err := d.httpGet(context.Background(), mustParse("http://example.org/"), time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, renewals, 1)
+	assert.False(t, renewals[0].Before(before))
+}
+
+func TestGet403ReauthenticateOnce(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusForbidden, "http://example.org/", "text/html", `<html></html>`)
+
+	renewals := 0
+	d := &Download{
+		Client: stub,
+		Reauthenticate: func(ctx context.Context, sent time.Time) error {
+			renewals++
+			return nil
+		},
+	}
+
+	resp, err := d.httpGet(context.Background(), mustParse("http://example.org/"), time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "still rejected after renewing")
+	assert.Equal(t, 1, renewals)
+}
+
+func TestGet403ReauthenticateFails(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusForbidden, "http://example.org/", "text/html", `<html></html>`)
+
+	d := &Download{
+		Client: stub,
+		Reauthenticate: func(ctx context.Context, sent time.Time) error {
+			stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`)
+			return errors.New("login refused")
+		},
+	}
+
+	resp, err := d.httpGet(context.Background(), mustParse("http://example.org/"), time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "not retried")
+}
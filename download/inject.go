@@ -0,0 +1,39 @@
+package download
+
+import (
+	"html"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/utc"
+	"golang.org/x/net/html/atom"
+)
+
+// inject inserts the configured snippet into a page, replacing the {url} and {date}
+// placeholders with the page's URL and the date it was downloaded.
+func (d *Download) inject(doc *document.HTMLDocument, u *url.URL) {
+	if d.Config.Inject == "" {
+		return
+	}
+
+	snippet := strings.NewReplacer(
+		"{url}", html.EscapeString(u.String()),
+		"{date}", utc.Now().Format(time.DateOnly),
+	).Replace(d.Config.Inject)
+
+	target, atStart := atom.Body, true
+	switch d.Config.InjectAt {
+	case config.InjectBottom:
+		atStart = false
+	case config.InjectHead:
+		target, atStart = atom.Head, false
+	}
+
+	if err := doc.Inject(snippet, target, atStart); err != nil {
+		d.Logger.Warn("Injecting snippet failed", slog.String("url", u.String()), slog.Any("error", err))
+	}
+}
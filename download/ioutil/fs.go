@@ -2,15 +2,14 @@ package ioutil
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log/slog"
 	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"strconv"
 
-	"github.com/cornelk/goscrape/logger"
 	"github.com/spf13/afero"
 )
 
@@ -27,21 +26,34 @@ func CreateDirectory(fs afero.Fs, path string) error {
 		return nil
 	}
 
-	logger.Debug("Creating dir", slog.String("path", path))
 	if err := fs.MkdirAll(path, os.ModePerm); err != nil {
 		return fmt.Errorf("creating directory '%s': %w", path, err)
 	}
 	return nil
 }
 
+// WriteFileAtomically writes a file by writing a temporary file then renaming it,
+// so that the file is never seen partly written. A previous version of the file that
+// has the same content is not replaced, so it keeps its modification time and any
+// hard links to it; this keeps incremental backups and rsync transfers small.
 func WriteFileAtomically(fs afero.Fs, filePath string, data io.Reader) (int64, error) {
+	return writeFileAtomically(context.Background(), fs, filePath, data, false)
+}
+
+// writeFileAtomically is WriteFileAtomically, optionally flushing the file to stable
+// storage before renaming it. If the context is cancelled, writing stops and the
+// temporary file is removed, leaving any previous version of the file in place.
+func writeFileAtomically(ctx context.Context, fs afero.Fs, filePath string, data io.Reader, flush bool) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	dir := filepath.Dir(filePath)
 
 	if err := CreateDirectory(fs, dir); err != nil {
 		return 0, err
 	}
 
-	logger.Debug("Creating file", slog.String("path", filePath))
 	// writing the file may take much time, so write to a temporary file first
 	f, err := fs.Create(filePath + randomSuffix)
 	if err != nil {
@@ -49,17 +61,36 @@ func WriteFileAtomically(fs afero.Fs, filePath string, data io.Reader) (int64, e
 	}
 
 	var length int64
-	if length, err = io.Copy(f, data); err != nil {
+	if length, err = io.Copy(f, contextReader{ctx: ctx, r: data}); err != nil {
 		// nolint: wrapcheck
 		_ = f.Close() // try to close and remove file but ignore any error
 		_ = fs.Remove(filePath + randomSuffix)
 		return length, fmt.Errorf("writing to file: %w", err)
 	}
 
+	if sameContent(fs, filePath, filePath+randomSuffix) {
+		_ = f.Close()
+		_ = fs.Remove(filePath + randomSuffix)
+		return length, nil // unchanged, so not rewritten
+	}
+
+	if flush {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			_ = fs.Remove(filePath + randomSuffix)
+			return length, fmt.Errorf("flushing file: %w", err)
+		}
+	}
+
 	if err := f.Close(); err != nil {
 		return length, fmt.Errorf("closing file: %w", err)
 	}
 
+	if err := ctx.Err(); err != nil {
+		_ = fs.Remove(filePath + randomSuffix)
+		return length, err
+	}
+
 	// rename the file so it appears (almost) instantly in the filesystem
 	if err := fs.Rename(filePath+randomSuffix, filePath); err != nil {
 		return length, fmt.Errorf("renaming %s to %s: %w", filePath+randomSuffix, filePath, err)
@@ -67,6 +98,60 @@ func WriteFileAtomically(fs afero.Fs, filePath string, data io.Reader) (int64, e
 	return length, nil
 }
 
+// sameContent reports whether two files exist and have the same content.
+func sameContent(fs afero.Fs, a, b string) bool {
+	fa, err := fs.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+
+	fb, err := fs.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+
+	if ia, ib := statSize(fa), statSize(fb); ia < 0 || ia != ib {
+		return false
+	}
+
+	bufA, bufB := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			return (errA == io.EOF || errA == io.ErrUnexpectedEOF) && errA == errB
+		}
+	}
+}
+
+// statSize gets the size of an open file, or -1 if it cannot be found.
+func statSize(f afero.File) int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// contextReader stops reading once its context is done, so that writing a large file
+// can be cancelled part way through.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
 func ReadFile(fs afero.Fs, filePath string) ([]byte, error) {
 	f, err := fs.Open(filePath)
 	if err != nil {
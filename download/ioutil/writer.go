@@ -0,0 +1,211 @@
+package ioutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/spf13/afero"
+)
+
+// Writer writes files atomically and flushes them to stable storage, either each
+// file as it is written or all the recently-written files at intervals. It can also
+// write in-memory data in the background. It is safe for concurrent use.
+//
+// A nil *Writer writes every file synchronously and leaves flushing to the
+// operating system.
+type Writer struct {
+	syncEach bool
+	interval time.Duration
+
+	queue chan pendingWrite
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	mu       sync.Mutex // guards unsynced
+	unsynced map[fileRef]struct{}
+
+	closing sync.RWMutex // guards sending to the queue whilst it might be closed
+	closed  atomic.Bool
+
+	log *logger.Logger
+}
+
+type fileRef struct {
+	fs   afero.Fs
+	path string
+}
+
+type pendingWrite struct {
+	fileRef
+	data    []byte
+	modTime time.Time
+}
+
+// NewWriter creates a Writer. If syncEach is true, each file is flushed before it
+// is renamed into place. Otherwise, if interval is positive, the files written
+// are flushed together at this interval. If queue is positive, WriteBehind uses
+// a queue of this capacity. Close must be called when finished.
+func NewWriter(syncEach bool, interval time.Duration, queue int, log *logger.Logger) *Writer {
+	w := &Writer{
+		syncEach: syncEach,
+		log:      log,
+		stop:     make(chan struct{}),
+		unsynced: make(map[fileRef]struct{}),
+	}
+
+	if !syncEach && interval > 0 {
+		w.interval = interval
+		w.wg.Add(1)
+		go w.flushPeriodically()
+	}
+
+	if queue > 0 {
+		w.queue = make(chan pendingWrite, queue)
+		w.wg.Add(1)
+		go w.writeQueued()
+	}
+
+	return w
+}
+
+// Write writes a file atomically, flushing it according to the policy. If the context
+// is cancelled, the file is not written.
+func (w *Writer) Write(ctx context.Context, fs afero.Fs, filePath string, data io.Reader) (int64, error) {
+	if w == nil {
+		return writeFileAtomically(ctx, fs, filePath, data, false)
+	}
+
+	w.log.Debug("Creating file", slog.String("path", filePath))
+	syncNow := w.syncEach || (w.closed.Load() && w.interval > 0)
+	length, err := writeFileAtomically(ctx, fs, filePath, data, syncNow)
+	if err == nil && !syncNow && w.interval > 0 {
+		w.mu.Lock()
+		w.unsynced[fileRef{fs: fs, path: filePath}] = struct{}{}
+		w.mu.Unlock()
+	}
+	return length, err
+}
+
+// WriteBehind writes in-memory data to a file, then sets its modification time
+// unless this is zero. If there is a queue, this returns as soon as the data has
+// been queued and any error is logged later. Waiting for space in the queue stops
+// if the context is cancelled, but the data that has been queued is always written.
+func (w *Writer) WriteBehind(ctx context.Context, fs afero.Fs, filePath string, data []byte, modTime time.Time) error {
+	pending := pendingWrite{fileRef: fileRef{fs: fs, path: filePath}, data: data, modTime: modTime}
+
+	if w != nil && w.queue != nil {
+		w.closing.RLock()
+		defer w.closing.RUnlock()
+		if !w.closed.Load() {
+			select {
+			case w.queue <- pending: // n.b. this blocks whilst the queue is full
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	return w.write(ctx, pending)
+}
+
+func (w *Writer) write(ctx context.Context, pending pendingWrite) error {
+	if _, err := w.Write(ctx, pending.fs, pending.path, bytes.NewReader(pending.data)); err != nil {
+		return err
+	}
+
+	if !pending.modTime.IsZero() {
+		if err := pending.fs.Chtimes(pending.path, pending.modTime, pending.modTime); err != nil {
+			return fmt.Errorf("updating file timestamps: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) writeQueued() {
+	defer w.wg.Done()
+	for pending := range w.queue {
+		if err := w.write(context.Background(), pending); err != nil {
+			w.log.Error("Writing to file failed",
+				slog.String("file", pending.path),
+				slog.Any("error", err))
+		}
+	}
+}
+
+func (w *Writer) flushPeriodically() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.flush(); err != nil {
+				w.log.Error("Flushing files failed", slog.Any("error", err))
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flush flushes all the files written since the last flush.
+func (w *Writer) flush() error {
+	w.mu.Lock()
+	files := w.unsynced
+	w.unsynced = make(map[fileRef]struct{})
+	w.mu.Unlock()
+
+	var errs []error
+	for file := range files {
+		errs = append(errs, syncFile(file.fs, file.path))
+	}
+	return errors.Join(errs...)
+}
+
+// Close waits for the queued files to be written, then flushes any files that
+// have not yet been flushed. Afterwards, the Writer can still be used, but it
+// writes synchronously.
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.closing.Lock()
+	if w.closed.Load() {
+		w.closing.Unlock()
+		return nil
+	}
+	w.closed.Store(true)
+	if w.queue != nil {
+		close(w.queue)
+	}
+	close(w.stop)
+	w.closing.Unlock()
+
+	w.wg.Wait()
+	return w.flush()
+}
+
+func syncFile(fs afero.Fs, filePath string) error {
+	f, err := fs.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("opening file '%s': %w", filePath, err)
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("flushing file '%s': %w", filePath, err)
+	}
+	return nil
+}
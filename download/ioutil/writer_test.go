@@ -0,0 +1,145 @@
+package ioutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterWriteBehind(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	w := NewWriter(false, time.Millisecond, 2, logger.Discard())
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.WriteBehind(context.Background(), fs, fmt.Sprintf("dir/%d.html", i), []byte("hello"), modTime))
+	}
+	require.NoError(t, w.Close())
+
+	for i := 0; i < 10; i++ {
+		data, err := afero.ReadFile(fs, fmt.Sprintf("dir/%d.html", i))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	}
+
+	info, err := fs.Stat("dir/0.html")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+	assert.Empty(t, w.unsynced)
+
+	// after closing, files are written synchronously
+	require.NoError(t, w.WriteBehind(context.Background(), fs, "late.html", []byte("late"), time.Time{}))
+	exists, _ := afero.Exists(fs, "late.html")
+	assert.True(t, exists)
+}
+
+func TestWriterSyncEach(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	w := NewWriter(true, 0, 0, logger.Discard())
+
+	n, err := w.Write(context.Background(), fs, "a.css", bytes.NewReader([]byte("body{}")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Empty(t, w.unsynced)
+	require.NoError(t, w.Close())
+}
+
+func TestNilWriter(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	var w *Writer
+
+	require.NoError(t, w.WriteBehind(context.Background(), fs, "a.txt", []byte("a"), time.Time{}))
+	_, err := w.Write(context.Background(), fs, "b.txt", bytes.NewReader([]byte("b")))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	data, _ := afero.ReadFile(fs, "a.txt")
+	assert.Equal(t, "a", string(data))
+}
+
+func TestWriterCancelled(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	w := NewWriter(false, 0, 0, logger.Discard())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := w.Write(ctx, fs, "dir/a.html", bytes.NewReader([]byte("hello")))
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, w.WriteBehind(ctx, fs, "dir/b.html", []byte("hello"), time.Time{}), context.Canceled)
+	require.NoError(t, w.Close())
+
+	for _, name := range []string{"dir/a.html", "dir/b.html", "dir/a.html" + randomSuffix, "dir/b.html" + randomSuffix} {
+		exists, _ := afero.Exists(fs, name)
+		assert.False(t, exists, name)
+	}
+}
+
+func TestWriterCancelledPartWay(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	ctx, cancel := context.WithCancel(context.Background())
+	data := io.MultiReader(bytes.NewReader([]byte("hello")), cancellingReader(cancel))
+
+	_, err := writeFileAtomically(ctx, fs, "a.html", data, false)
+	require.ErrorIs(t, err, context.Canceled)
+
+	for _, name := range []string{"a.html", "a.html" + randomSuffix} {
+		exists, _ := afero.Exists(fs, name)
+		assert.False(t, exists, name)
+	}
+}
+
+func TestWriterWriteBehindCancelledWhenFull(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	w := &Writer{queue: make(chan pendingWrite, 1), stop: make(chan struct{})} // nothing drains the queue
+	require.NoError(t, w.WriteBehind(context.Background(), fs, "a.html", []byte("a"), time.Time{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, w.WriteBehind(ctx, fs, "b.html", []byte("b"), time.Time{}), context.DeadlineExceeded)
+}
+
+// cancellingReader cancels the context when it is first read.
+type cancellingReader context.CancelFunc
+
+func (c cancellingReader) Read([]byte) (int, error) {
+	c()
+	return 0, io.EOF
+}
+
+func TestWriterUnchanged(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	w := NewWriter(false, 0, 0, logger.Discard())
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, err := w.Write(context.Background(), fs, "a.html", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.NoError(t, fs.Chtimes("a.html", modTime, modTime))
+
+	n, err := w.Write(context.Background(), fs, "a.html", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	info, err := fs.Stat("a.html")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()), "the unchanged file is not rewritten")
+	exists, _ := afero.Exists(fs, "a.html"+randomSuffix)
+	assert.False(t, exists)
+
+	for _, changed := range []string{"hellO", "hello!", "hell"} {
+		_, err = w.Write(context.Background(), fs, "a.html", bytes.NewReader([]byte(changed)))
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(fs, "a.html")
+		require.NoError(t, err)
+		assert.Equal(t, changed, string(data))
+	}
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,81 @@
+package download
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/work"
+)
+
+// linkHeaderPagination finds the next and previous pages listed in the Link headers
+// (RFC 8288), e.g.
+//
+//	Link: <https://example.org/items?page=3>; rel="next", </items?page=1>; rel="prev"
+//
+// Relative links are resolved against base.
+func linkHeaderPagination(hdr http.Header, base *url.URL) work.Refs {
+	var result work.Refs
+	for _, value := range hdr.Values("Link") {
+		for _, link := range splitLinks(value) {
+			target, params, ok := parseLink(link)
+			if !ok || !document.IsPaginationRel(params["rel"]) {
+				continue
+			}
+
+			if u, err := base.Parse(target); err == nil {
+				u.Fragment = ""
+				result = append(result, u)
+			}
+		}
+	}
+	return result
+}
+
+// splitLinks splits a Link header value at the commas that separate links, ignoring
+// commas within the angle brackets or quoted strings.
+func splitLinks(value string) []string {
+	var result []string
+	var inURL, inQuotes bool
+	start := 0
+	for i, c := range value {
+		switch {
+		case c == '<' && !inQuotes:
+			inURL = true
+		case c == '>' && !inQuotes:
+			inURL = false
+		case c == '"' && !inURL:
+			inQuotes = !inQuotes
+		case c == ',' && !inURL && !inQuotes:
+			result = append(result, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, value[start:])
+}
+
+// parseLink parses one link such as `<url>; rel="next"`. Parameter names are
+// converted to lowercase.
+func parseLink(link string) (target string, params map[string]string, ok bool) {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(link, "<") {
+		return "", nil, false
+	}
+
+	end := strings.IndexByte(link, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+
+	target = strings.TrimSpace(link[1:end])
+	params = make(map[string]string)
+	for _, param := range strings.Split(link[end+1:], ";") {
+		name, value, _ := strings.Cut(param, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			params[name] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return target, params, true
+}
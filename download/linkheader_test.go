@@ -0,0 +1,21 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkHeaderPagination(t *testing.T) {
+	hdr := http.Header{}
+	hdr.Add("Link", `<https://example.org/items?page=3>; rel="next", </items?page=1>; rel="prev last"`)
+	hdr.Add("Link", `<https://example.org/style.css>; rel=preload; as=style, <https://example.org/a,b>; title="x, y"; rel=next`)
+	hdr.Add("Link", `malformed; rel=next`)
+
+	refs := linkHeaderPagination(hdr, mustParse("https://example.org/items?page=2"))
+
+	assert.Equal(t, "example.org/items example.org/items example.org/a,b", refs.String())
+	assert.Equal(t, "page=3", refs[0].RawQuery)
+	assert.Equal(t, "page=1", refs[1].RawQuery)
+}
@@ -0,0 +1,46 @@
+package download
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cornelk/goscrape/utc"
+)
+
+// maintenanceUntil gets the end of the maintenance window announced by a response, or
+// zero if there is none.
+func (d *Download) maintenanceUntil(resp *http.Response) time.Time {
+	return announcedMaintenance(resp, d.Config.Maintenance, utc.Now())
+}
+
+// announcedMaintenance gets the end of the maintenance window announced by a 503 Service
+// Unavailable response whose Retry-After is at least the threshold from now; a
+// shorter Retry-After denotes a transient error. It returns zero if there is no such
+// window, or if the threshold is negative. Retry-After is either a number of seconds
+// or an HTTP date.
+func announcedMaintenance(resp *http.Response, threshold time.Duration, now time.Time) time.Time {
+	if resp.StatusCode != http.StatusServiceUnavailable || threshold < 0 {
+		return time.Time{}
+	}
+
+	var until time.Time
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 || seconds > math.MaxInt64/int64(time.Second) {
+			return time.Time{}
+		}
+		until = now.Add(time.Duration(seconds) * time.Second)
+	} else if date, err := http.ParseTime(value); err == nil {
+		until = date.UTC()
+	} else {
+		return time.Time{}
+	}
+
+	if until.Sub(now) < threshold {
+		return time.Time{}
+	}
+	return until
+}
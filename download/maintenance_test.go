@@ -0,0 +1,41 @@
+package download
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnouncedMaintenance(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		threshold  time.Duration
+		expected   time.Time
+	}{
+		{"seconds", http.StatusServiceUnavailable, "3600", time.Minute, now.Add(time.Hour)},
+		{"date", http.StatusServiceUnavailable, "Sat, 01 Jun 2024 14:00:00 GMT", time.Minute, now.Add(2 * time.Hour)},
+		{"transient", http.StatusServiceUnavailable, "5", time.Minute, time.Time{}},
+		{"absent", http.StatusServiceUnavailable, "", time.Minute, time.Time{}},
+		{"invalid", http.StatusServiceUnavailable, "soon", time.Minute, time.Time{}},
+		{"negative", http.StatusServiceUnavailable, "-3600", time.Minute, time.Time{}},
+		{"overflow", http.StatusServiceUnavailable, "99999999999999999", time.Minute, time.Time{}},
+		{"not 503", http.StatusBadGateway, "3600", time.Minute, time.Time{}},
+		{"disabled", http.StatusServiceUnavailable, "3600", -1, time.Time{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: c.status, Header: http.Header{}}
+			if c.retryAfter != "" {
+				resp.Header.Set("Retry-After", c.retryAfter)
+			}
+			assert.Equal(t, c.expected, announcedMaintenance(resp, c.threshold, now))
+		})
+	}
+}
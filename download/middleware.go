@@ -0,0 +1,255 @@
+package download
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cornelk/goscrape/db"
+	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Middleware wraps a round-tripper with extra behaviour, such as logging or
+// rate limiting. Each middleware must call next unless it wants to short-circuit
+// the request.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper interface.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps base with the middleware. The first middleware is the outermost,
+// i.e. it sees each request first and each response last.
+func Chain(base http.RoundTripper, mw ...Middleware) http.RoundTripper {
+	rt := base
+	for i := len(mw) - 1; i >= 0; i-- {
+		rt = mw[i](rt)
+	}
+	return rt
+}
+
+// clientRoundTripper allows any HttpClient to be at the heart of a middleware chain.
+func clientRoundTripper(client HttpClient) http.RoundTripper {
+	return RoundTripperFunc(client.Do)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Headers sets the given headers on every request, replacing any existing values.
+func Headers(hdrs http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if len(hdrs) > 0 {
+				req = req.Clone(req.Context())
+				for key, values := range hdrs {
+					for _, value := range values {
+						req.Header.Set(key, value)
+					}
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Caching avoids HTTP traffic for conditional requests (i.e. those that have an
+// If-Modified-Since header) when the cached copy has not yet expired, or was fetched
+// within laxAge; these requests are answered with a 'teapot' response. Otherwise,
+// the ETags from the store are added to the request. A negative laxAge always
+// causes revalidation.
+func Caching(store *db.DB, laxAge time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			lastModified, err := header.ParseHTTPDateTime(req.Header.Get(headername.IfModifiedSince))
+			if err != nil || lastModified.IsZero() {
+				return next.RoundTrip(req) // unconditional request
+			}
+
+			metadata := store.Lookup(req.URL)
+			if laxAge >= 0 {
+				fetched := metadata.Fetched
+				if fetched.IsZero() {
+					fetched = lastModified
+				}
+
+				now := utc.Now()
+				if now.Before(metadata.Expires.Add(laxAge)) ||
+					now.Before(fetched.Add(laxAge)) {
+					// not yet expired so no need for any HTTP traffic - report as 'teapot'
+					return &http.Response{
+						Request:       req,
+						Status:        http.StatusText(http.StatusTeapot),
+						StatusCode:    http.StatusTeapot, // treated like StatusNotModified
+						Header:        http.Header{},
+						Body:          io.NopCloser(&bytes.Buffer{}),
+						ContentLength: 0,
+					}, nil
+				}
+			}
+
+			if len(metadata.ETags) > 0 {
+				req = req.Clone(req.Context())
+				req.Header.Set(headername.IfNoneMatch, metadata.ETags)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// RateLimit pauses before every request according to the throttles. Afterwards,
+// the lockdown throttle backs off when the server reports errors or too many
+// requests, and is reset otherwise. The loop delay only ever increases.
+func RateLimit(lockdown, loopDelay Throttle) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			loopDelay.Sleep() // mild rate limiter
+			lockdown.Sleep()  // severe rate limiter during 429 lockdown
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case resp.StatusCode >= 500:
+				lockdown.SlowDown() // back off request rate whilst the server is abnormal
+
+			case resp.StatusCode == http.StatusTooManyRequests:
+				lockdown.SlowDown()  // back off request rate whilst we're being throttled by the server
+				loopDelay.SlowDown() // never return to the original speed
+
+			default:
+				lockdown.Reset()
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// AdaptiveRateLimit pauses before every request according to the adaptive throttle,
+// which then observes the latency of each response and whether it failed.
+func AdaptiveRateLimit(adaptive *throttle.Adaptive) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			adaptive.Sleep()
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			latency := time.Since(start)
+
+			if err != nil {
+				adaptive.Observe(latency, true)
+				return nil, err
+			}
+
+			failed := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+			adaptive.Observe(latency, failed)
+			return resp, nil
+		})
+	}
+}
+
+// Logging counts the response status codes in the histogram and logs the
+// main response headers at debug level to log. The histogram is optional.
+func Logging(histogram Histogram, log *logger.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if histogram != nil {
+				histogram.Increment(resp.StatusCode)
+			}
+			args := []any{slog.String("url", req.URL.String()), slog.Int("status", resp.StatusCode)}
+			args = addHeaderValue(args, resp.Header, headername.ContentType)
+			args = addHeaderValue(args, resp.Header, headername.ContentLength)
+			args = addHeaderValue(args, resp.Header, headername.LastModified)
+			args = addHeaderValue(args, resp.Header, headername.ContentEncoding)
+			args = addHeaderValue(args, resp.Header, headername.Vary)
+			log.Debug(req.Method, args...)
+
+			return resp, nil
+		})
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// roundTripper assembles the built-in middleware around the client, followed by
+// any extra middleware supplied by the user, which are therefore nearest the client.
+// The recorder, if any, is outside them all.
+func (d *Download) roundTripper() http.RoundTripper {
+	builtIn := []Middleware{
+		Caching(d.ETagsDB, d.Config.LaxAge),
+		Headers(d.requestHeaders()),
+		Credentials(d.credentialHeaders(), d.sendsCredentials),
+		AcceptHeaders(d.AcceptRules),
+		URLHeaders(d.HeaderRules, d.Logger),
+		d.Authenticator.Middleware(d.sendsCredentials),
+		RateLimit(orNoThrottle(d.Lockdown), orNoThrottle(d.LoopDelay)),
+		AdaptiveRateLimit(d.Adaptive),
+		Logging(d.Histogram, d.Logger),
+	}
+	if d.Recorder != nil {
+		builtIn = append([]Middleware{d.Recorder}, builtIn...)
+	}
+	return Chain(clientRoundTripper(d.Client), append(builtIn, d.Middleware...)...)
+}
+
+// sendsCredentials reports whether the credential headers may be sent with a request.
+// They are always sent when there is no start URL.
+func (d *Download) sendsCredentials(u *url.URL) bool {
+	return d.StartURL == nil || SendsCredentials(d.Config, d.StartURL.Host, u.Host)
+}
+
+// orNoThrottle substitutes a no-op throttle if t is absent.
+func orNoThrottle(t Throttle) Throttle {
+	if t == nil {
+		return (*throttle.Throttle)(nil)
+	}
+	return t
+}
+
+// requestHeaders gets the headers that are added to every request.
+func (d *Download) requestHeaders() http.Header {
+	hdrs := http.Header{}
+	hdrs.Set(headername.AcceptEncoding, "gzip")
+
+	if d.Config.UserAgent != "" {
+		hdrs.Set(headername.UserAgent, d.Config.UserAgent)
+	}
+
+	return hdrs
+}
+
+// credentialHeaders gets the headers that are only added to the requests for hosts
+// that may be sent the credentials.
+func (d *Download) credentialHeaders() http.Header {
+	hdrs := http.Header{}
+	if d.Auth != "" {
+		hdrs.Set(headername.Authorization, d.Auth)
+	}
+
+	for key, values := range d.Config.Header {
+		for _, value := range values {
+			hdrs.Set(key, value)
+		}
+	}
+
+	return hdrs
+}
@@ -0,0 +1,168 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainOrder(t *testing.T) {
+	var trail []string
+
+	tracer := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				trail = append(trail, name+">")
+				resp, err := next.RoundTrip(req)
+				trail = append(trail, "<"+name)
+				return resp, err
+			})
+		}
+	}
+
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trail = append(trail, "client")
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+
+	rt := Chain(base, tracer("a"), tracer("b"))
+	req, _ := http.NewRequest(http.MethodGet, "http://example.org/", nil)
+	_, err := rt.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a>", "b>", "client", "<b", "<a"}, trail)
+}
+
+func TestUserMiddleware(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`)
+
+	var seen http.Header
+
+	d := &Download{
+		Config: config.Config{
+			UserAgent: "Foo/Bar",
+		},
+		Client: stub,
+		Middleware: []Middleware{
+			Headers(http.Header{"X-Token": []string{"abc"}}),
+			func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					seen = req.Header
+					return next.RoundTrip(req)
+				})
+			},
+		},
+	}
+
+	resp, err := d.httpGet(context.Background(), mustParse("http://example.org/"), time.Time{})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "abc", seen.Get("X-Token"))
+	assert.Equal(t, "Foo/Bar", seen.Get("User-Agent"))
+}
+
+func TestLoggingHistogram(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "http://example.org/", "text/html", `<html></html>`)
+	stub.GivenResponse(http.StatusNotFound, "http://example.org/x", "text/html", `<html></html>`)
+
+	histogram := NewHistogram()
+	d := &Download{
+		Client:    stub,
+		Histogram: histogram,
+	}
+
+	for _, u := range []string{"http://example.org/", "http://example.org/x", "http://example.org/"} {
+		_, err := d.httpGet(context.Background(), mustParse(u), time.Time{})
+		require.NoError(t, err)
+	}
+
+	snapshot := histogram.Snapshot()
+	assert.Equal(t, map[int]int{200: 2, 404: 1}, snapshot)
+
+	snapshot[200] = 99 // snapshots are copies
+	assert.Equal(t, 2, histogram.Snapshot()[200])
+}
+
+func TestURLHeaders(t *testing.T) {
+	rules, err := NewHeaderRules(config.MakeHeaderRules(
+		[]string{"/api/* Authorization: Bearer xyz", "*.cdn.org X-Cdn: 1"},
+		[]string{"/api/v2/ session=s1", "/api/** beta=on"},
+	), "example.org")
+	require.NoError(t, err)
+
+	var seen http.Header
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		seen = req.Header
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+	rt := URLHeaders(rules, nil)(base)
+
+	cases := map[string][3]string{
+		"http://example.org/api/users":    {"Bearer xyz", "beta=on", ""},
+		"http://example.org/api/v2/users": {"Bearer xyz", "session=s1; beta=on", ""},
+		"http://example.org/about":        {"", "", ""},
+		"http://other.org/api/users":      {"", "", ""},
+		"http://img.cdn.org/a.png":        {"", "", "1"},
+		"http://cdn.org/":                 {"", "", "1"},
+		"http://badcdn.org/":              {"", "", ""},
+	}
+
+	for u, expected := range cases {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		_, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, [3]string{seen.Get("Authorization"), seen.Get("Cookie"), seen.Get("X-Cdn")}, u)
+		assert.Empty(t, req.Header, u)
+	}
+}
+
+func TestCredentialsOnlyForAllowedHosts(t *testing.T) {
+	stub := &stubclient.Client{}
+	var seen http.Header
+
+	d := &Download{
+		Config: config.Config{
+			Header:          http.Header{"X-Token": []string{"abc"}},
+			CredentialHosts: []string{"*.example.net"},
+		},
+		StartURL: mustParse("http://example.org/"),
+		Auth:     "Basic xyz",
+		Client:   stub,
+		Middleware: []Middleware{
+			func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					seen = req.Header
+					return next.RoundTrip(req)
+				})
+			},
+		},
+	}
+
+	cases := map[string]bool{
+		"http://example.org/a.html":    true,
+		"http://EXAMPLE.org/a.html":    true,
+		"http://cdn.example.net/a.js":  true,
+		"http://example.net/a.js":      true,
+		"http://cdn.example.com/a.js":  false,
+		"http://sub.example.org/a.css": false,
+	}
+
+	for u, expected := range cases {
+		stub.GivenResponse(http.StatusOK, u, "text/plain", "")
+		resp, err := d.httpGet(context.Background(), mustParse(u), time.Time{})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected, seen.Get("X-Token") == "abc", u)
+		assert.Equal(t, expected, seen.Get("Authorization") == "Basic xyz", u)
+		assert.Equal(t, "gzip", seen.Get("Accept-Encoding"), u)
+	}
+}
@@ -2,8 +2,10 @@ package download
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/cornelk/goscrape/mapping"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -12,23 +14,38 @@ import (
 
 	"github.com/cornelk/goscrape/document"
 	"github.com/cornelk/goscrape/download/ioutil"
-	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/utc"
 	"github.com/cornelk/goscrape/work"
+	"github.com/rickb777/acceptable/headername"
 )
 
-func (d *Download) response304(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+func (d *Download) response304(ctx context.Context, item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+	if resp.StatusCode == http.StatusNotModified {
+		// successfully revalidated
+		metadata := d.ETagsDB.Lookup(item.URL)
+		metadata.Fetched = utc.Now()
+		metadata.Status = resp.StatusCode
+		if d.Config.RespectCacheControl {
+			metadata.Expires = d.expiry(resp, metadata.Fetched) // revalidation refreshes the lifetime
+		}
+		if etag := resp.Header.Get(headername.ETag); etag != "" {
+			metadata.ETags = etag
+		}
+		d.ETagsDB.Store(item.URL, metadata)
+	}
+
 	ext := strings.ToLower(path.Ext(item.URL.Path))
 
 	switch ext {
 	case ".html", ".htm":
-		return d.html304(item, resp)
+		return d.html304(ctx, item, resp)
 
 	case ".css":
-		return d.css304(item, resp.StatusCode)
+		return d.css304(ctx, item, resp.StatusCode)
 
 	default:
 		if strings.HasSuffix(item.URL.Path, "/") {
-			return d.html304(item, resp)
+			return d.html304(ctx, item, resp)
 		}
 	}
 
@@ -39,43 +56,62 @@ func (d *Download) response304(item work.Item, resp *http.Response) (*url.URL, *
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) html304(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+func (d *Download) html304(ctx context.Context, item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	var references work.Refs
 
 	filePath := mapping.GetFilePath(item.URL, true)
 	data, err := ioutil.ReadFile(d.Fs, filePath)
 	if err != nil {
-		logger.Debug("absent HTML file", slog.Any("error", err))
+		d.Logger.Debug("absent HTML file", slog.Any("error", err))
 		return nil, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
 	}
 
-	doc, err := document.ParseHTML(item.URL, d.StartURL, bytes.NewReader(data))
+	_, span := startSpan(ctx, spanParse, item.URL)
+	defer span.End()
+
+	doc, err := document.ParseHTML(item.URL, d.StartURL, bytes.NewReader(data), d.Logger)
 	if err != nil {
 		return nil, nil, fmt.Errorf("parsing HTML: %w", err)
 	}
 
-	references, err = doc.FindReferences()
+	if d.Corpus != nil {
+		d.exportText(item.URL, doc, doc.Metadata()) // the text is exported even though the page is unchanged
+	}
+
+	if d.pageRobots(item, resp, doc).NoFollow {
+		return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode}, nil
+	}
+
+	references, err = doc.FindReferences(d.skipRels()...)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	references, alternates := d.separateAlternates(doc, references)
+
 	// use the URL that the website returned as new base url for the
 	// scrape, in case a redirect changed it (only for the start page)
-	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, References: references}, nil
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, References: references, Pagination: alternates}, nil
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) css304(item work.Item, statusCode int) (*url.URL, *work.Result, error) {
+func (d *Download) css304(ctx context.Context, item work.Item, statusCode int) (*url.URL, *work.Result, error) {
 	var references work.Refs
 	filePath := mapping.GetFilePath(item.URL, false)
-	data, err := ioutil.ReadFile(d.Fs, filePath)
+	f, err := d.Fs.Open(filePath)
 	if err != nil {
-		logger.Debug("absent CSS file", slog.Any("error", err))
+		d.Logger.Debug("absent CSS file", slog.Any("error", err))
 		return nil, &work.Result{Item: item, StatusCode: statusCode}, nil
 	}
+	defer f.Close()
 
-	_, references = document.CheckCSSForUrls(item.URL, d.StartURL.Host, data)
+	_, span := startSpan(ctx, spanParse, item.URL)
+	references, err = document.RewriteCSS(item.URL, d.StartURL.Host, f, io.Discard, d.Logger)
+	span.End()
+	if err != nil {
+		d.Logger.Error("Reading CSS file failed", slog.String("file", filePath), slog.Any("error", err))
+	}
 
 	return nil, &work.Result{Item: item, StatusCode: statusCode, References: references}, nil
 }
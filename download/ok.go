@@ -3,6 +3,9 @@ package download
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,61 +16,151 @@ import (
 	"github.com/cornelk/goscrape/db"
 	"github.com/cornelk/goscrape/document"
 	"github.com/cornelk/goscrape/download/ioutil"
-	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/utc"
 	"github.com/cornelk/goscrape/work"
 	"github.com/rickb777/acceptable/header"
 	"github.com/rickb777/acceptable/headername"
 )
 
-func (d *Download) response200(item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
+func (d *Download) response200(ctx context.Context, item work.Item, resp *http.Response) (*url.URL, *work.Result, error) {
 	contentType := header.ParseContentTypeFromHeaders(resp.Header)
 	lastModified, _ := header.ParseHTTPDateTime(resp.Header.Get(headername.LastModified))
 	isGzip := resp.Header.Get(headername.ContentEncoding) == "gzip"
 
-	metadata := db.Item{ETags: resp.Header.Get(headername.ETag)}
-	if expires := resp.Header.Get(headername.Expires); expires != "" {
-		metadata.Expires, _ = header.ParseHTTPDateTime(expires)
+	now := utc.Now()
+	metadata := db.Item{
+		ETags:        resp.Header.Get(headername.ETag),
+		Expires:      d.expiry(resp, now),
+		LastModified: lastModified,
+		Fetched:      now,
+		Status:       resp.StatusCode,
 	}
 
+	isAPage := isHtml(contentType) || isXHtml(contentType)
+	robots := d.headerRobots(item, resp)
+
+	var u *url.URL
+	var result *work.Result
+	var err error
+	if robots.NoIndex && !isAPage {
+		d.Logger.Debug("Not storing noindex file", slog.String("url", item.String()))
+		result = &work.Result{Item: item, StatusCode: resp.StatusCode, Gzip: isGzip}
+	} else if d.Config.ListURLs && !isAPage {
+		result = &work.Result{Item: item, StatusCode: resp.StatusCode, Gzip: isGzip}
+	} else {
+		u, result, err = d.response200ByType(ctx, item, resp, lastModified, contentType, isGzip)
+	}
+
+	if result != nil {
+		if d.Config.FollowNext {
+			result.Pagination = append(result.Pagination, linkHeaderPagination(resp.Header, resp.Request.URL)...)
+		}
+		if robots.NoFollow {
+			result.References = nil
+			result.Pagination = nil
+		}
+		result.ContentType = mediaTypeOf(resp)
+		result.Vary = varyKey(resp)
+		metadata.Hash = result.Hash
+
+		if result.Hash != "" {
+			result.FilePath = mapping.GetFilePath(item.URL, isAPage)
+			if d.Config.SaveHeaders {
+				d.storeHeaders(ctx, item.URL, result.FilePath, resp)
+			}
+		}
+	}
+	if metadata.Hash == "" {
+		// the file was not rewritten so its hash is unchanged
+		metadata.Hash = d.ETagsDB.Lookup(item.URL).Hash
+	}
 	d.ETagsDB.Store(item.URL, metadata)
 
+	return u, result, err
+}
+
+func (d *Download) response200ByType(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
 	switch {
 	case isHtml(contentType) || isXHtml(contentType):
-		return d.html200(item, resp, lastModified, contentType, isGzip)
+		return d.html200(ctx, item, resp, lastModified, contentType, isGzip)
 
 	case isCSS(contentType):
-		return d.css200(item, resp, lastModified, isGzip)
+		return d.css200(ctx, item, resp, lastModified, isGzip)
 
 	//case isSVG(contentType):
 	//	return d.svg200(item, resp, lastModified, isGzip)
 
 	case contentType.Type == "image" && d.Config.ImageQuality != 0:
-		return d.image200(item, resp, lastModified, contentType, isGzip)
+		return d.image200(ctx, item, resp, lastModified, contentType, isGzip)
 
 	default:
-		return d.other200(item, resp, lastModified, isGzip)
+		return d.other200(ctx, item, resp, lastModified, isGzip)
 	}
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) html200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
-	var references work.Refs
-
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
+func (d *Download) html200(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
+	contentLength, data, err := d.bufferEntireResponse(resp, isGzip)
 	if err != nil {
 		return nil, nil, fmt.Errorf("buffering %s: %w", contentType.String(), err)
 	}
 
-	doc, err := document.ParseHTML(item.URL, d.StartURL, bytes.NewReader(data))
+	if reason := document.TooComplex(data, d.Config.MaxHTMLSize); reason != "" {
+		return d.unparsedHTML200(ctx, item, resp, lastModified, contentLength, data, isGzip, reason)
+	}
+
+	_, span := startSpan(ctx, spanParse, item.URL)
+	doc, err := document.ParseHTML(item.URL, d.StartURL, bytes.NewReader(data), d.Logger)
+	span.End()
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s: %w", contentType.String(), err)
 	}
 
+	robots := d.pageRobots(item, resp, doc)
+
+	if n := doc.Prune(d.Prune); n > 0 {
+		d.Logger.Debug("Pruned", slog.String("url", item.String()), slog.Int("elements", n))
+	}
+
+	if d.Aliases.Len() > 0 {
+		doc.Canonicalize(d.Aliases.Lookup)
+	}
+
+	metadata := doc.Metadata()
+	if metadata.Language == "" {
+		metadata.Language = resp.Header.Get(headername.ContentLanguage)
+	}
+
+	// the links are found before they are rewritten
+	var references, pagination work.Refs
+	if robots.NoFollow {
+		d.Logger.Debug("Not following links of nofollow page", slog.String("url", item.String()))
+	} else {
+		references, pagination, err = d.pageLinks(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if d.Config.ListURLs {
+		return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Gzip: isGzip, References: references, Pagination: pagination, Metadata: metadata}, nil
+	}
+
+	if !robots.NoIndex {
+		d.exportText(item.URL, doc, metadata) // before the snippet is injected
+	}
+
+	// the snippet is injected after the links are found, so that it is stored verbatim
+	d.inject(doc, item.URL)
+	d.annotateExternalLinks(doc)
+
+	_, span = startSpan(ctx, spanRewrite, item.URL)
 	fixed, hasChanges, err := doc.FixURLReferences()
+	span.End()
 	if err != nil {
-		logger.Error("Fixing file references failed",
+		d.Logger.Error("Fixing file references failed",
 			slog.String("url", item.String()),
 			slog.Any("error", err))
 		return nil, nil, nil
@@ -76,17 +169,83 @@ func (d *Download) html200(item work.Item, resp *http.Response, lastModified tim
 	if hasChanges {
 		data = fixed
 	}
-	rdr := bytes.NewReader(data)
-	fileSize := d.storeDownload(item.URL, rdr, lastModified, true)
 
-	references, err = doc.FindReferences()
-	if err != nil {
-		return nil, nil, err
+	var fileSize int64
+	var hash string
+	var storeErr error
+	if robots.NoIndex {
+		d.Logger.Debug("Not storing noindex page", slog.String("url", item.String()))
+	} else if data, err = d.postProcess(item.URL, data); err != nil {
+		d.Logger.Error("Not storing page", slog.String("url", item.String()), slog.Any("error", err))
+	} else {
+		var previous pageText
+		if d.Config.SaveDiffs {
+			previous = d.storedPageText(mapping.GetFilePath(item.URL, true))
+		}
+
+		fileSize, hash, storeErr = d.storeData(ctx, item.URL, data, lastModified, true)
+
+		if d.Config.SaveDiffs && hash != "" {
+			d.storeDiff(ctx, item.URL, mapping.GetFilePath(item.URL, true), previous, data)
+		}
 	}
 
 	// use the URL that the website returned as new base url for the
 	// scrape, in case a redirect changed it (only for the start page)
-	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Gzip: isGzip, References: references}, nil
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Hash: hash, Metadata: metadata, Gzip: isGzip, References: references, Pagination: pagination}, storeErr
+}
+
+// unparsedHTML200 handles a page that is too large or too deeply nested to be parsed
+// safely. It is stored verbatim, without its links being rewritten. With ScanLargeHTML,
+// its links are found using only the tokenizer; otherwise, they are not followed.
+func (d *Download) unparsedHTML200(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, contentLength int64, data []byte, isGzip bool, reason string) (*url.URL, *work.Result, error) {
+	d.Logger.Warn("Page not parsed", slog.String("url", item.String()), slog.String("reason", reason))
+
+	robots := d.headerRobots(item, resp)
+
+	var references work.Refs
+	if d.Config.ScanLargeHTML && !robots.NoFollow {
+		_, span := startSpan(ctx, spanParse, item.URL)
+		references = document.ScanReferences(item.URL, data, d.skipRels()...)
+		span.End()
+	}
+
+	if d.Config.ListURLs {
+		return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Gzip: isGzip, References: references}, nil
+	}
+
+	var fileSize int64
+	var hash string
+	var storeErr error
+	if robots.NoIndex {
+		d.Logger.Debug("Not storing noindex page", slog.String("url", item.String()))
+	} else if data, err := d.postProcess(item.URL, data); err != nil {
+		d.Logger.Error("Not storing page", slog.String("url", item.String()), slog.Any("error", err))
+	} else {
+		fileSize, hash, storeErr = d.storeData(ctx, item.URL, data, lastModified, true)
+	}
+
+	return resp.Request.URL, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Hash: hash, Gzip: isGzip, References: references}, storeErr
+}
+
+// pageLinks finds the links in a page that are to be followed, separating those
+// that have the same depth as the page from the rest.
+func (d *Download) pageLinks(doc *document.HTMLDocument) (references, pagination work.Refs, err error) {
+	references, err = doc.FindReferences(d.skipRels()...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d.Config.Forms {
+		references = append(references, doc.FindForms(d.Config.FormValues)...)
+	}
+
+	references, pagination = d.separateAlternates(doc, references)
+	if d.Config.FollowNext {
+		pagination = append(pagination, doc.FindPagination()...)
+	}
+
+	return references, pagination, nil
 }
 
 //-------------------------------------------------------------------------------------------------
@@ -106,7 +265,7 @@ func (d *Download) html200(item work.Item, resp *http.Response, lastModified tim
 //
 //	fixed, hasChanges, err := doc.FixURLReferences()
 //	if err != nil {
-//		logger.Error("Fixing file references failed",
+//		d.Logger.Error("Fixing file references failed",
 //			slog.String("url", item.String()),
 //			slog.Any("error", err))
 //		return nil, nil, nil
@@ -130,49 +289,81 @@ func (d *Download) html200(item work.Item, resp *http.Response, lastModified tim
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) css200(item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
-	var references work.Refs
+// css200 rewrites a stylesheet as it is written to its file, so that it is never held
+// in memory, however large it is.
+func (d *Download) css200(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
+	counter := &countingReader{r: resp.Body}
+	var rdr io.Reader = counter
 
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
-	if err != nil {
-		return nil, nil, fmt.Errorf("buffering text/css: %w", err)
+	if isGzip {
+		gr, err := gzip.NewReader(rdr)
+		if err != nil {
+			d.Logger.Error("Decompressing gzip response failed",
+				slog.Any("url", resp.Request.URL),
+				slog.Any("error", err))
+			return nil, nil, err
+		}
+		defer gr.Close() // this only closes the gzipper, not the response body
+		rdr = gr
 	}
 
-	data, references = document.CheckCSSForUrls(item.URL, d.StartURL.Host, data)
+	_, span := startSpan(ctx, spanRewrite, item.URL)
+	defer span.End()
 
-	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+	var references work.Refs
+	var rewriteErr error
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		references, rewriteErr = document.RewriteCSS(item.URL, d.StartURL.Host, rdr, pw, d.Logger)
+		pw.CloseWithError(rewriteErr)
+	}()
+
+	fileSize, hash, storeErr := d.storeDownload(ctx, item.URL, pr, lastModified, false)
+	_, _ = io.Copy(io.Discard, pr) // the references are needed even if the file was not written
+	<-done
+
+	if rewriteErr != nil {
+		return nil, nil, fmt.Errorf("rewriting text/css: %w", rewriteErr)
+	}
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, FileSize: fileSize, Gzip: isGzip, References: references}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Hash: hash, Gzip: isGzip, References: references}, storeErr
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) image200(item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
-	contentLength, data, err := bufferEntireResponse(resp, isGzip)
+func (d *Download) image200(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, contentType header.ContentType, isGzip bool) (*url.URL, *work.Result, error) {
+	contentLength, data, err := d.bufferEntireResponse(resp, isGzip)
 	if err != nil {
 		return nil, nil, fmt.Errorf("buffering %s: %w", contentType.String(), err)
 	}
 
-	data = d.Config.ImageQuality.CheckImageForRecode(item.URL, data)
-	if d.Config.ImageQuality != 0 {
+	_, span := startSpan(ctx, spanRewrite, item.URL)
+	data, err = d.Recoder.Recode(ctx, d.Config.ImageQuality, item.URL, data)
+	span.End()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.Config.ImageQuality != 0 && !d.Config.Rsync {
 		lastModified = time.Time{} // altered images can't be safely time-stamped
 	}
 
-	fileSize := d.storeDownload(item.URL, bytes.NewReader(data), lastModified, false)
+	fileSize, hash, err := d.storeData(ctx, item.URL, data, lastModified, false)
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Gzip: isGzip, FileSize: fileSize}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: contentLength, Gzip: isGzip, FileSize: fileSize, Hash: hash}, err
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func (d *Download) other200(item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
+func (d *Download) other200(ctx context.Context, item work.Item, resp *http.Response, lastModified time.Time, isGzip bool) (*url.URL, *work.Result, error) {
 	counter := &countingReader{r: resp.Body}
 	var rdr io.Reader = counter
 
 	if isGzip {
 		gr, err := gzip.NewReader(rdr)
 		if err != nil {
-			logger.Error("Decompressing gzip response failed",
+			d.Logger.Error("Decompressing gzip response failed",
 				slog.Any("url", resp.Request.URL),
 				slog.Any("error", err))
 			return nil, nil, err
@@ -182,53 +373,109 @@ func (d *Download) other200(item work.Item, resp *http.Response, lastModified ti
 	}
 
 	// store without buffering entire file into memory
-	fileSize := d.storeDownload(item.URL, rdr, lastModified, false)
+	fileSize, hash, err := d.storeDownload(ctx, item.URL, rdr, lastModified, false)
 
-	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Gzip: isGzip}, nil
+	return nil, &work.Result{Item: item, StatusCode: resp.StatusCode, ContentLength: counter.n, FileSize: fileSize, Hash: hash, Gzip: isGzip}, err
 }
 
 //-------------------------------------------------------------------------------------------------
 
 // storeDownload writes the download to a file, if a known binary file is detected,
-// processing of the file as page to look for links is skipped.
-func (d *Download) storeDownload(u *url.URL, data io.Reader, lastModified time.Time, isAPage bool) (fileSize int64) {
+// processing of the file as page to look for links is skipped. The SHA-256 hash of
+// the file is computed as it is written; it is blank if nothing was written.
+func (d *Download) storeDownload(ctx context.Context, u *url.URL, data io.Reader, lastModified time.Time, isAPage bool) (fileSize int64, hash string, err error) {
 	filePath := mapping.GetFilePath(u, isAPage)
 
 	if !isAPage && ioutil.FileExists(d.Fs, filePath) {
-		return 0
+		return 0, "", nil
 	}
 
-	var err error
-	if fileSize, err = ioutil.WriteFileAtomically(d.Fs, filePath, data); err != nil {
-		logger.Error("Writing to file failed",
+	_, span := startSpan(ctx, spanStore, u)
+	defer span.End()
+
+	previous := d.storedHash(u, filePath)
+	hasher := sha256.New()
+
+	if fileSize, err = d.Writer.Write(ctx, d.Fs, filePath, io.TeeReader(data, hasher)); err != nil {
+		if ctx.Err() != nil {
+			return fileSize, "", nil // cancelled
+		}
+		d.Logger.Error("Writing to file failed",
 			slog.String("URL", u.String()),
 			slog.String("file", filePath),
 			slog.Any("error", err))
-		return fileSize
+		return fileSize, "", ErrStorage{File: filePath, Err: err}
+	}
+
+	hash = hex.EncodeToString(hasher.Sum(nil))
+	if hash == previous {
+		return fileSize, hash, nil // the writer left the unchanged file in place, with its timestamps
 	}
 
 	if !lastModified.IsZero() {
 		if err := d.Fs.Chtimes(filePath, lastModified, lastModified); err != nil {
-			logger.Error("Updating file timestamps failed",
+			d.Logger.Error("Updating file timestamps failed",
 				slog.String("URL", u.String()),
 				slog.String("file", filePath),
 				slog.Any("error", err))
 		}
 	}
 
-	return fileSize
+	return fileSize, hash, nil
+}
+
+// storeData is like storeDownload, for data held in memory. The file may be written
+// in the background.
+func (d *Download) storeData(ctx context.Context, u *url.URL, data []byte, lastModified time.Time, isAPage bool) (fileSize int64, hash string, err error) {
+	filePath := mapping.GetFilePath(u, isAPage)
+
+	if !isAPage && ioutil.FileExists(d.Fs, filePath) {
+		return 0, "", nil
+	}
+
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	if hash == d.storedHash(u, filePath) {
+		return int64(len(data)), hash, nil // unchanged, so neither the file nor its timestamps are touched
+	}
+
+	_, span := startSpan(ctx, spanStore, u)
+	defer span.End()
+
+	if err := d.Writer.WriteBehind(ctx, d.Fs, filePath, data, lastModified); err != nil {
+		if ctx.Err() != nil {
+			return 0, "", nil // cancelled
+		}
+		d.Logger.Error("Writing to file failed",
+			slog.String("URL", u.String()),
+			slog.String("file", filePath),
+			slog.Any("error", err))
+		return 0, "", ErrStorage{File: filePath, Err: err}
+	}
+
+	return int64(len(data)), hash, nil
+}
+
+// storedHash gets the SHA-256 hash recorded when the file for u was last written, if
+// that file is still there, so that writing the same content again can be skipped.
+func (d *Download) storedHash(u *url.URL, filePath string) string {
+	hash := d.ETagsDB.Lookup(u).Hash
+	if hash == "" || !ioutil.FileExists(d.Fs, filePath) {
+		return ""
+	}
+	return hash
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func bufferEntireResponse(resp *http.Response, isGzip bool) (int64, []byte, error) {
+func (d *Download) bufferEntireResponse(resp *http.Response, isGzip bool) (int64, []byte, error) {
 	counter := &countingReader{r: resp.Body}
 	var rdr io.Reader = counter
 
 	if isGzip {
 		gr, err := gzip.NewReader(rdr)
 		if err != nil {
-			logger.Error("Decompressing gzip response failed",
+			d.Logger.Error("Decompressing gzip response failed",
 				slog.Any("url", resp.Request.URL),
 				slog.Any("error", err))
 			return 0, nil, err
@@ -260,6 +507,15 @@ func (r *countingReader) Read(p []byte) (n int, err error) {
 
 //-------------------------------------------------------------------------------------------------
 
+// mediaTypeOf gets the media type of a response, e.g. "text/html", without any parameters.
+func mediaTypeOf(resp *http.Response) string {
+	contentType := header.ParseContentTypeFromHeaders(resp.Header)
+	if contentType.Type == "" {
+		return ""
+	}
+	return contentType.Type + "/" + contentType.Subtype
+}
+
 func isHtml(contentType header.ContentType) bool {
 	return contentType.Type == "text" && contentType.Subtype == "html"
 }
@@ -0,0 +1,46 @@
+package download
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cornelk/goscrape/config"
+)
+
+// ErrCertificatePin is the cause of a connection failing because the server presented
+// a certificate other than those pinned for its host, which may mean that the
+// connection is being intercepted.
+var ErrCertificatePin = errors.New("certificate does not match the pinned fingerprint")
+
+// VerifyPins checks the certificate of each TLS connection to a host that has pinned
+// certificates, for use as tls.Config.VerifyConnection. This is in addition to the
+// usual verification against the trusted certificate authorities. Connections to other
+// hosts are not affected.
+func VerifyPins(pins []config.CertPin) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		var pinned []string
+		for _, pin := range pins {
+			if hostMatches(pin.Host, cs.ServerName) {
+				pinned = append(pinned, pin.Fingerprint)
+			}
+		}
+		if len(pinned) == 0 {
+			return nil
+		}
+
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("%s presented no certificate: %w", cs.ServerName, ErrCertificatePin)
+		}
+
+		sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+		if slices.Contains(pinned, fingerprint) {
+			return nil
+		}
+		return fmt.Errorf("%s presented a certificate with SHA-256 fingerprint %s: %w", cs.ServerName, fingerprint, ErrCertificatePin)
+	}
+}
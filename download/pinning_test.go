@@ -0,0 +1,47 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	other := hex.EncodeToString(make([]byte, sha256.Size))
+
+	get := func(pins ...config.CertPin) error {
+		transport := server.Client().Transport.(*http.Transport).Clone() // with a fresh connection
+		transport.TLSClientConfig.VerifyConnection = VerifyPins(pins)
+		transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		}
+		client := &http.Client{Transport: transport}
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://example.com/", nil) // named in the test certificate
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, get(config.CertPin{Host: "example.com", Fingerprint: fingerprint}))
+	require.NoError(t, get(config.CertPin{Host: "example.com", Fingerprint: other}, config.CertPin{Host: "example.com", Fingerprint: fingerprint}))
+	require.NoError(t, get(config.CertPin{Host: "other.example.com", Fingerprint: other}), "another host is pinned")
+
+	err := get(config.CertPin{Host: "example.com", Fingerprint: other})
+	require.ErrorIs(t, err, ErrCertificatePin)
+	assert.ErrorContains(t, err, fingerprint)
+}
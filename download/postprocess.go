@@ -0,0 +1,22 @@
+package download
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// PostProcessor alters a page after its links have been rewritten and before it is
+// stored, e.g. to remove clutter that is specific to a website. It returns the page
+// that is stored instead.
+type PostProcessor func(u *url.URL, page []byte) ([]byte, error)
+
+// postProcess applies the post-processors to a page, in order.
+func (d *Download) postProcess(u *url.URL, page []byte) ([]byte, error) {
+	for _, process := range d.PostProcessors {
+		var err error
+		if page, err = process(u, page); err != nil {
+			return nil, fmt.Errorf("post-processing %s: %w", u, err)
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,50 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Probe requests u once via the middleware chain and reads the response body into
+// memory. The request of the returned response holds the final URL, after any
+// redirects.
+func (d *Download) Probe(ctx context.Context, u *url.URL) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+
+	return d.send(req)
+}
+
+// PostForm posts the form values to u once via the middleware chain, e.g. to log in;
+// the client's cookie jar keeps any cookies that the response sets.
+func (d *Download) PostForm(ctx context.Context, u *url.URL, values url.Values) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set(headername.ContentType, "application/x-www-form-urlencoded")
+
+	return d.send(req)
+}
+
+func (d *Download) send(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := d.roundTripper().RoundTrip(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sending HTTP %s %s: %w", req.Method, req.URL, err)
+	}
+	defer d.closeResponseBody(resp.Body, resp.Request.URL)
+
+	_, data, err := d.bufferEntireResponse(resp, resp.Header.Get(headername.ContentEncoding) == "gzip")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, data, nil
+}
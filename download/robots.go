@@ -0,0 +1,44 @@
+package download
+
+import (
+	"net/http"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/work"
+)
+
+// headerRobots gets the directives of the X-Robots-Tag headers, if they are to be honoured,
+// combined with the decisions of the follow and store rules.
+func (d *Download) headerRobots(item work.Item, resp *http.Response) document.Robots {
+	robots := d.ruleRobots(item, resp)
+	if !d.Config.Robots {
+		return robots
+	}
+	return robots.Merge(document.ParseRobotsHeader(resp.Header.Values("X-Robots-Tag")))
+}
+
+// pageRobots gets the directives of the X-Robots-Tag headers combined with those
+// of the page's robots meta tags, if they are to be honoured, and with the decisions
+// of the follow and store rules.
+func (d *Download) pageRobots(item work.Item, resp *http.Response, doc *document.HTMLDocument) document.Robots {
+	robots := d.headerRobots(item, resp)
+	if !d.Config.Robots {
+		return robots
+	}
+	return robots.Merge(doc.Robots())
+}
+
+// ruleRobots expresses the decisions of the follow and store rules as directives.
+func (d *Download) ruleRobots(item work.Item, resp *http.Response) document.Robots {
+	c := filter.Candidate{URL: item.URL, Parent: item.Referrer, Depth: item.Depth, ContentType: mediaTypeOf(resp)}
+	return document.Robots{NoIndex: !d.Rules.Store.Allows(c), NoFollow: !d.Rules.Follow.Allows(c)}
+}
+
+// skipRels gets the link relations of anchors that are not to be followed.
+func (d *Download) skipRels() []string {
+	if !d.Config.SkipRels {
+		return nil
+	}
+	return document.NoFollowRels
+}
@@ -0,0 +1,224 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// The headers of ranged requests.
+const (
+	acceptRanges = "Accept-Ranges"
+	contentRange = "Content-Range"
+	rangeHeader  = "Range"
+	ifRange      = "If-Range"
+)
+
+// segment is a part of a file, from start up to but excluding end.
+type segment struct {
+	start, end int64
+	file       *os.File      // where the part was written; nil for the first part
+	done       chan struct{} // closed when the part has been downloaded or has failed
+	err        error
+}
+
+// segmentBody replaces the body of a large response with one that is downloaded in
+// parallel segments, when the configuration asks for this and the server supports
+// ranged requests, so that a single connection's throughput does not limit it. The
+// first segment is read from the original response as usual; each of the others is
+// requested with a Range header and written to a temporary file as it arrives.
+//
+// The If-Range header ensures that every segment comes from the same version of the
+// file, and each must be a partial response for exactly the range requested. If any
+// segment fails these checks, the rest of the file is read from the original response
+// instead, as if segments had not been used.
+func (d *Download) segmentBody(ctx context.Context, resp *http.Response) {
+	segments := d.segmentsOf(resp)
+	if len(segments) < 2 {
+		return
+	}
+
+	validator := resp.Header.Get(headername.ETag)
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get(headername.LastModified)
+	}
+
+	d.Logger.Debug("Downloading in segments",
+		slog.String("url", resp.Request.URL.String()),
+		slog.Int("segments", len(segments)),
+		slog.Int64("size", resp.ContentLength))
+
+	ctx, cancel := context.WithCancel(ctx)
+	for _, s := range segments[1:] {
+		go func() {
+			defer close(s.done)
+			s.err = d.fetchSegment(ctx, resp.Request.URL, validator, resp.ContentLength, s)
+		}()
+	}
+
+	resp.Body = &segmentedBody{original: resp.Body, segments: segments, cancel: cancel, url: resp.Request.URL, log: d.Logger}
+}
+
+// segmentsOf divides a response into segments, if it is eligible. Responses that were
+// compressed in transit, or that have no strong validator, are not.
+func (d *Download) segmentsOf(resp *http.Response) []*segment {
+	size := resp.ContentLength
+	n := int64(d.Config.Segments)
+	if n < 2 || resp.StatusCode != http.StatusOK || size < max(d.Config.SegmentSize, n) ||
+		resp.Header.Get(acceptRanges) != "bytes" || resp.Header.Get(headername.ContentEncoding) != "" || resp.Uncompressed {
+		return nil
+	}
+
+	if etag := resp.Header.Get(headername.ETag); (etag == "" || strings.HasPrefix(etag, "W/")) && resp.Header.Get(headername.LastModified) == "" {
+		return nil
+	}
+
+	segments := make([]*segment, n)
+	for i := range n {
+		segments[i] = &segment{start: size * i / n, end: size * (i + 1) / n, done: make(chan struct{})}
+	}
+	return segments
+}
+
+// fetchSegment downloads one segment into a temporary file.
+func (d *Download) fetchSegment(ctx context.Context, u *url.URL, validator string, size int64, s *segment) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set(rangeHeader, fmt.Sprintf("bytes=%d-%d", s.start, s.end-1))
+	req.Header.Set(ifRange, validator)
+
+	resp, err := d.roundTripper().RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer d.closeResponseBody(resp.Body, u) // the body of an unexpected response is not read
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("ranged request got %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	want := fmt.Sprintf("bytes %d-%d/%d", s.start, s.end-1, size)
+	if got := resp.Header.Get(contentRange); got != want || resp.Header.Get(headername.ContentEncoding) != "" {
+		return fmt.Errorf("ranged request got %q instead of %q", got, want)
+	}
+
+	s.file, err = os.CreateTemp("", "goscrape-segment-*")
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(s.file, resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading segment: %w", err)
+	}
+	if n != s.end-s.start {
+		return fmt.Errorf("segment has %d bytes instead of %d", n, s.end-s.start)
+	}
+
+	_, err = s.file.Seek(0, io.SeekStart)
+	return err
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// segmentedBody reads the segments in turn, waiting for each to be downloaded. The first
+// segment, and any after a segment that failed, are read from the original response.
+type segmentedBody struct {
+	original io.ReadCloser
+	segments []*segment
+	cancel   context.CancelFunc
+	url      *url.URL
+	log      *logger.Logger
+
+	current   int       // the index of the segment being read
+	reader    io.Reader // the rest of the current segment; nil before it has been opened
+	remaining int64     // the number of bytes left in the current segment
+	closeOnce sync.Once
+}
+
+func (b *segmentedBody) Read(p []byte) (int, error) {
+	if b.reader == nil {
+		if b.current == len(b.segments) {
+			return 0, io.EOF
+		}
+		if err := b.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := b.reader.Read(p[:min(int64(len(p)), b.remaining)])
+	b.remaining -= int64(n)
+	switch {
+	case b.remaining == 0:
+		b.reader = nil
+		b.current++
+		return n, nil
+	case errors.Is(err, io.EOF):
+		return n, io.ErrUnexpectedEOF // every segment must be complete
+	default:
+		return n, err
+	}
+}
+
+// open starts reading the current segment.
+func (b *segmentedBody) open() error {
+	s := b.segments[b.current]
+	b.remaining = s.end - s.start
+
+	if b.current == 0 {
+		b.reader = b.original
+		return nil
+	}
+
+	<-s.done
+	if s.err == nil {
+		b.reader = s.file
+		return nil
+	}
+
+	// the original response continues after the first segment, so the segments that
+	// have already been read from files are skipped
+	b.log.Warn("Segment failed; reading the rest of the file from a single connection",
+		slog.String("url", b.url.String()),
+		slog.Int64("start", s.start),
+		slog.Any("error", s.err))
+
+	if _, err := io.CopyN(io.Discard, b.original, s.start-b.segments[0].end); err != nil {
+		return fmt.Errorf("%s skipping to segment: %w", b.url, err)
+	}
+
+	last := b.segments[len(b.segments)-1]
+	b.remaining = last.end - s.start
+	b.current = len(b.segments) - 1
+	b.reader = b.original
+	return nil
+}
+
+// Close stops any segments still being downloaded and removes their temporary files.
+func (b *segmentedBody) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		b.cancel()
+		for _, s := range b.segments[1:] {
+			<-s.done
+			if s.file != nil {
+				_ = s.file.Close()
+				_ = os.Remove(s.file.Name())
+			}
+		}
+		err = b.original.Close()
+	})
+	return err
+}
@@ -0,0 +1,116 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeServer serves content, counting the ranged requests. These get the changed
+// content instead, when it is given.
+func rangeServer(t *testing.T, content, changed []byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var ranged atomic.Int32
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Header.Get("Range") == "" || changed == nil {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("Range") != "" {
+				ranged.Add(1)
+			}
+			http.ServeContent(w, r, "big.bin", modified, bytes.NewReader(content))
+			return
+		}
+
+		ranged.Add(1)
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "big.bin", modified.Add(time.Hour), bytes.NewReader(changed))
+	}))
+	t.Cleanup(server.Close)
+	return server, &ranged
+}
+
+func bigContent(seed byte) []byte {
+	content := make([]byte, 100_003)
+	for i := range content {
+		content[i] = byte(i*7) + seed
+	}
+	return content
+}
+
+func TestSegmentedDownload(t *testing.T) {
+	cases := map[string]struct {
+		changed     []byte
+		segmentSize int64
+		ranged      int32 // the number of ranged requests, or the least if some may be cancelled
+		cancelled   bool
+	}{
+		"segments":           {segmentSize: 1000, ranged: 3},
+		"changed mid-way":    {changed: bigContent(1), segmentSize: 1000, ranged: 1, cancelled: true},
+		"smaller than limit": {segmentSize: 1 << 20, ranged: 0},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			content := bigContent(0)
+			server, ranged := rangeServer(t, content, c.changed)
+
+			fs := afero.NewMemMapFs()
+			d := &Download{
+				Config: config.Config{Segments: 4, SegmentSize: c.segmentSize},
+				Client: server.Client(),
+				Fs:     fs,
+			}
+
+			_, result, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse(server.URL + "/big.bin")})
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			if c.cancelled {
+				// the first segment to fail cancels the others, which may not have been sent yet
+				assert.GreaterOrEqual(t, ranged.Load(), c.ranged)
+			} else {
+				assert.Equal(t, c.ranged, ranged.Load())
+			}
+
+			stored, err := afero.ReadFile(fs, "big.bin")
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(content, stored), "the original version is stored intact")
+		})
+	}
+}
+
+func TestSegmentsOf(t *testing.T) {
+	d := &Download{Config: config.Config{Segments: 3}}
+	resp := &http.Response{StatusCode: http.StatusOK, ContentLength: 10, Header: http.Header{}}
+	assert.Nil(t, d.segmentsOf(resp), "no Accept-Ranges")
+
+	resp.Header.Set("Accept-Ranges", "bytes")
+	assert.Nil(t, d.segmentsOf(resp), "no validator")
+
+	resp.Header.Set("ETag", `W/"weak"`)
+	assert.Nil(t, d.segmentsOf(resp), "weak validator")
+
+	resp.Header.Set("ETag", `"strong"`)
+	segments := d.segmentsOf(resp)
+	require.Len(t, segments, 3)
+	assert.Equal(t, [][2]int64{{0, 3}, {3, 6}, {6, 10}}, [][2]int64{
+		{segments[0].start, segments[0].end},
+		{segments[1].start, segments[1].end},
+		{segments[2].start, segments[2].end},
+	})
+
+	resp.Header.Set("Content-Encoding", "gzip")
+	assert.Nil(t, d.segmentsOf(resp), "compressed")
+}
@@ -0,0 +1,21 @@
+package download
+
+import (
+	"log/slog"
+	"net/url"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+)
+
+// exportText adds the main text of a stored page to the corpus, if there is one.
+func (d *Download) exportText(u *url.URL, doc *document.HTMLDocument, metadata *work.Metadata) {
+	if d.Corpus == nil {
+		return
+	}
+
+	if err := d.Corpus.Add(u, mapping.GetFilePath(u, true), metadata, doc.MainText()); err != nil {
+		d.Logger.Error("Exporting text failed", slog.String("url", u.String()), slog.Any("error", err))
+	}
+}
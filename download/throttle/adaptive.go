@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	fastWeight = 0.3  // responsiveness of the recent latency average
+	slowWeight = 0.05 // responsiveness of the baseline latency average
+	congestion = 1.5  // recent latency above baseline by this factor indicates congestion
+	steps      = 20   // number of additive steps between the floor and the ceiling
+)
+
+// Adaptive is a delay timer that adapts to the server's latency trend and error rate,
+// using an additive-increase/multiplicative-decrease (AIMD) algorithm applied to the
+// request rate. So when the server is slowing down or giving errors, the delay doubles,
+// up to the ceiling. Otherwise, it decreases by a small step, down to the floor.
+// It is safe for use across multiple goroutines.
+//
+// All methods in a nil *Adaptive are no-op.
+type Adaptive struct {
+	floor, ceiling, step time.Duration
+
+	delay     time.Duration
+	slowDowns int64
+	recent    float64 // fast-moving average latency (ns)
+	baseline  float64 // slow-moving average latency (ns)
+	mu        sync.Mutex
+}
+
+// NewAdaptive returns a new Adaptive throttle with the floor and ceiling specified.
+//   - If floor is less than zero it is set to zero.
+//   - If ceiling is less than or equal to floor, the throttle is disabled and nil is returned.
+func NewAdaptive(floor, ceiling time.Duration) *Adaptive {
+	if floor < 0 {
+		floor = 0
+	}
+	if ceiling <= floor {
+		return nil
+	}
+
+	step := (ceiling - floor) / steps
+	if step < time.Millisecond {
+		step = time.Millisecond
+	}
+
+	return &Adaptive{floor: floor, ceiling: ceiling, step: step, delay: floor}
+}
+
+// Observe records the latency of a response and whether it failed, i.e. it was a server
+// error or too-many-requests, and adjusts the delay accordingly.
+func (a *Adaptive) Observe(latency time.Duration, failed bool) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ns := float64(latency)
+	if a.baseline == 0 {
+		a.recent = ns
+		a.baseline = ns
+	} else {
+		a.recent += fastWeight * (ns - a.recent)
+		a.baseline += slowWeight * (ns - a.baseline)
+	}
+
+	if failed || a.recent > a.baseline*congestion {
+		a.slowDowns++
+		a.delay = min(max(2*a.delay, a.step), a.ceiling) // multiplicative decrease of rate
+	} else {
+		a.delay = max(a.delay-a.step, a.floor) // additive increase of rate
+	}
+}
+
+// Delay gets the current delay duration.
+func (a *Adaptive) Delay() time.Duration {
+	if a == nil {
+		return 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.delay
+}
+
+// Snapshot gets the current state of the throttle.
+func (a *Adaptive) Snapshot() Snapshot {
+	if a == nil {
+		return Snapshot{}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return Snapshot{Delay: a.delay, SlowDowns: a.slowDowns}
+}
+
+// Sleep pauses this goroutine for the current delay. If the delay is zero,
+// Sleep behaves as a no-op.
+func (a *Adaptive) Sleep() {
+	if d := a.Delay(); d > 0 {
+		time.Sleep(d)
+	}
+}
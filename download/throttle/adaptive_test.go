@@ -0,0 +1,55 @@
+package throttle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveErrors(t *testing.T) {
+	a := throttle.NewAdaptive(0, 2*time.Second)
+	assert.Equal(t, time.Duration(0), a.Delay())
+
+	a.Observe(10*time.Millisecond, true)
+	assert.Equal(t, 100*time.Millisecond, a.Delay())
+
+	a.Observe(10*time.Millisecond, true)
+	assert.Equal(t, 200*time.Millisecond, a.Delay())
+
+	for range 10 {
+		a.Observe(10*time.Millisecond, true)
+	}
+	assert.Equal(t, 2*time.Second, a.Delay())
+
+	a.Observe(10*time.Millisecond, false)
+	assert.Equal(t, 1900*time.Millisecond, a.Delay())
+
+	for range 30 {
+		a.Observe(10*time.Millisecond, false)
+	}
+	assert.Equal(t, time.Duration(0), a.Delay())
+}
+
+func TestAdaptiveLatency(t *testing.T) {
+	a := throttle.NewAdaptive(50*time.Millisecond, time.Second)
+	assert.Equal(t, 50*time.Millisecond, a.Delay())
+
+	for range 20 {
+		a.Observe(100*time.Millisecond, false)
+	}
+	assert.Equal(t, 50*time.Millisecond, a.Delay())
+
+	// the server slows down sharply
+	a.Observe(time.Second, false)
+	assert.Equal(t, 100*time.Millisecond, a.Delay())
+}
+
+func TestAdaptiveDisabled(t *testing.T) {
+	a := throttle.NewAdaptive(time.Second, time.Second)
+	assert.Nil(t, a)
+	a.Observe(time.Second, true)
+	assert.Equal(t, time.Duration(0), a.Delay())
+	a.Sleep()
+}
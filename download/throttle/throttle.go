@@ -11,10 +11,18 @@ import (
 //
 // All methods in a nil *Throttle are no-op.
 type Throttle struct {
-	delay   atomic.Int64
-	min     int64
-	initial int64
-	extra   int64
+	delay     atomic.Int64
+	slowDowns atomic.Int64
+	min       int64
+	initial   int64
+	extra     int64
+}
+
+// Snapshot is a point-in-time copy of the state of a throttle, e.g. for exporting
+// to a metrics system.
+type Snapshot struct {
+	Delay     time.Duration `json:"delay"`     // the current delay
+	SlowDowns int64         `json:"slowDowns"` // the number of times the throttle has slowed down
 }
 
 // New returns a new Throttle with the minimum, initial and extra values specified.
@@ -46,6 +54,7 @@ func New(minimum, initialStep, extraStep time.Duration) *Throttle {
 // This provides a linear back-off (n.b. not exponential).
 func (t *Throttle) SlowDown() {
 	if t != nil {
+		t.slowDowns.Add(1)
 		if !t.delay.CompareAndSwap(t.min, t.initial) {
 			t.delay.Add(t.extra)
 		}
@@ -87,6 +96,14 @@ func (t *Throttle) Delay() time.Duration {
 	return time.Duration(t.delay.Load())
 }
 
+// Snapshot gets the current state of the throttle.
+func (t *Throttle) Snapshot() Snapshot {
+	if t == nil {
+		return Snapshot{}
+	}
+	return Snapshot{Delay: time.Duration(t.delay.Load()), SlowDowns: t.slowDowns.Load()}
+}
+
 // Sleep pauses this goroutine for the current loop delay. If the delay is zero,
 // Sleep behaves as a no-op.
 func (t *Throttle) Sleep() {
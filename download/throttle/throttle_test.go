@@ -42,5 +42,7 @@ func TestThrottle(t *testing.T) {
 
 		th.SpeedUp()
 		assert.Equal(t, minimum, th.Delay(), "%s", minimum)
+
+		assert.Equal(t, throttle.Snapshot{Delay: minimum, SlowDowns: 3}, th.Snapshot(), "%s", minimum)
 	}
 }
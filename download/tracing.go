@@ -0,0 +1,28 @@
+package download
+
+import (
+	"context"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates OpenTelemetry spans for each URL and each of its phases. Unless
+// a tracer provider has been registered, this is a no-op.
+var tracer = otel.Tracer("github.com/cornelk/goscrape/download")
+
+// Phases of processing each URL, used as span names.
+const (
+	spanURL     = "url"
+	spanFetch   = "fetch"
+	spanParse   = "parse"
+	spanRewrite = "rewrite"
+	spanStore   = "store"
+)
+
+// startSpan starts a span for one phase of processing a URL.
+func startSpan(ctx context.Context, name string, u *url.URL) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("url.full", u.String())))
+}
@@ -0,0 +1,61 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessURL_Spans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body><a href="/a">a</a></body></html>`)
+
+	d := &Download{
+		Client:   stub,
+		StartURL: mustParse("https://example.org/"),
+		Fs:       afero.NewMemMapFs(),
+	}
+
+	_, _, err := d.ProcessURL(context.Background(), work.Item{URL: mustParse("https://example.org/"), Queued: utc.Now()})
+	require.NoError(t, err)
+
+	var names []string
+	var root sdktrace.ReadOnlySpan
+	for _, span := range exporter.GetSpans().Snapshots() {
+		names = append(names, span.Name())
+		if span.Name() == spanURL {
+			root = span
+		}
+	}
+	assert.ElementsMatch(t, []string{spanFetch, spanParse, spanRewrite, spanStore, spanURL}, names)
+
+	require.NotNil(t, root)
+	for _, span := range exporter.GetSpans().Snapshots() {
+		if span.Name() != spanURL {
+			assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), span.Name())
+		}
+	}
+
+	attributes := map[string]any{}
+	for _, kv := range root.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, int64(200), attributes["http.response.status_code"])
+	assert.Equal(t, int64(1), attributes["attempt"])
+	assert.Contains(t, attributes, "queue.wait_ms")
+}
@@ -0,0 +1,29 @@
+package wayback
+
+import "regexp"
+
+var (
+	// the scripts and styles inserted at the start of the head
+	rewriteInclude = regexp.MustCompile(`(?s)<script[^>]+src="[^"]*/_static/js/[^"]*".*?<!-- End Wayback Rewrite JS Include -->\s*`)
+
+	// the banner inserted at the start of the body
+	toolbarInsert = regexp.MustCompile(`(?s)<!-- BEGIN WAYBACK TOOLBAR INSERT -->.*?<!-- END WAYBACK TOOLBAR INSERT -->\s*`)
+
+	// the comments appended after the end of the page
+	archiveComments = regexp.MustCompile(`(?s)<!--\s*(?:FILE ARCHIVED ON|playback timings).*?-->\s*`)
+
+	// links that were rewritten to point into the archive, e.g.
+	// https://web.archive.org/web/20190601000000/http://example.org/ or /web/20190601000000im_/http://example.org/a.png
+	rewrittenLink = regexp.MustCompile(`(?:(?:https?:)?//web\.archive\.org)?/web/[0-9]{14}(?:[a-z]{2}_)?/((?:https?:)?//)`)
+)
+
+// Strip removes the toolbar, scripts and comments that the Wayback Machine inserts
+// into archived pages, and restores the original links. Pages fetched using
+// ArchiveURL don't normally need this, but it does no harm.
+func Strip(data []byte) []byte {
+	data = rewriteInclude.ReplaceAll(data, nil)
+	data = toolbarInsert.ReplaceAll(data, nil)
+	data = archiveComments.ReplaceAll(data, nil)
+	data = rewrittenLink.ReplaceAll(data, []byte("$1"))
+	return data
+}
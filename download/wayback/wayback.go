@@ -0,0 +1,154 @@
+// Package wayback fetches pages from the Internet Archive's Wayback Machine instead
+// of the live website, so that dead websites can be mirrored from the archive.
+package wayback
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/rickb777/acceptable/header"
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Host is the host of the Wayback Machine.
+const Host = "web.archive.org"
+
+var timestampPattern = regexp.MustCompile(`^[0-9]{1,14}$`)
+
+// ValidateTimestamp checks a timestamp, which has the form YYYYMMDDhhmmss or any
+// shorter prefix of it, e.g. 2019 or 20190601.
+func ValidateTimestamp(timestamp string) error {
+	if !timestampPattern.MatchString(timestamp) {
+		return fmt.Errorf("wayback timestamp %q: must be YYYYMMDDhhmmss or a prefix of it", timestamp)
+	}
+	return nil
+}
+
+// ArchiveURL gets the URL of the capture of u nearest to the timestamp. The 'id_'
+// flag asks for the content as originally captured, i.e. without the Wayback
+// toolbar and without rewritten links.
+func ArchiveURL(u *url.URL, timestamp string) *url.URL {
+	original := *u
+	original.Fragment = ""
+	archived, _ := url.Parse("https://" + Host + "/web/" + timestamp + "id_/" + original.String())
+	return archived
+}
+
+// OriginalURL gets the original URL from a Wayback Machine URL, such as
+// https://web.archive.org/web/20190601000000id_/http://example.org/.
+func OriginalURL(archived *url.URL) (*url.URL, bool) {
+	if archived.Host != Host {
+		return nil, false
+	}
+
+	rest, found := strings.CutPrefix(archived.EscapedPath(), "/web/")
+	if !found {
+		return nil, false
+	}
+
+	_, rest, found = strings.Cut(rest, "/") // drop the timestamp and flags
+	if !found {
+		return nil, false
+	}
+
+	if archived.RawQuery != "" {
+		rest += "?" + archived.RawQuery
+	}
+
+	original, err := url.Parse(rest)
+	if err != nil || original.Host == "" {
+		return nil, false
+	}
+	return original, true
+}
+
+// Middleware fetches every request from the Wayback Machine, using the captures
+// nearest to the timestamp. The responses appear to come from the original URLs,
+// except that redirects between captures of different URLs are preserved. Any
+// Wayback toolbar and rewritten links are stripped from HTML and CSS.
+func Middleware(timestamp string) download.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return download.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			archived := req.Clone(req.Context())
+			archived.URL = ArchiveURL(req.URL, timestamp)
+			archived.Host = archived.URL.Host
+
+			resp, err := next.RoundTrip(archived)
+			if err != nil {
+				return nil, err
+			}
+
+			resp.Request = originalRequest(req, resp.Request)
+
+			if resp.StatusCode == http.StatusOK {
+				if err := stripBody(resp); err != nil {
+					return nil, fmt.Errorf("%s: %w", req.URL, err)
+				}
+			}
+
+			return resp, nil
+		})
+	}
+}
+
+// originalRequest substitutes the original request for the final archive request.
+// The Wayback Machine redirects to the nearest capture, which is not of interest,
+// but it also replays redirects to other URLs, which appear as one redirect.
+func originalRequest(req, final *http.Request) *http.Request {
+	if final == nil {
+		return req
+	}
+
+	original, ok := OriginalURL(final.URL)
+	if !ok || original.String() == req.URL.String() {
+		return req
+	}
+
+	redirected := req.Clone(req.Context())
+	redirected.URL = original
+	redirected.Host = original.Host
+	redirected.Response = &http.Response{Request: req}
+	return redirected
+}
+
+// stripBody removes the Wayback additions from HTML and CSS responses. Any gzip
+// encoding is removed in the process.
+func stripBody(resp *http.Response) error {
+	contentType := header.ParseContentTypeFromHeaders(resp.Header)
+	switch contentType.Type + "/" + contentType.Subtype {
+	case "text/html", "application/xhtml+xml", "text/css":
+	default:
+		return nil
+	}
+
+	defer resp.Body.Close()
+
+	var rdr io.Reader = resp.Body
+	if resp.Header.Get(headername.ContentEncoding) == "gzip" {
+		gr, err := gzip.NewReader(rdr)
+		if err != nil {
+			return fmt.Errorf("decompressing gzip response: %w", err)
+		}
+		defer gr.Close()
+		rdr = gr
+	}
+
+	data, err := io.ReadAll(rdr)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	stripped := Strip(data)
+	resp.Body = io.NopCloser(bytes.NewReader(stripped))
+	resp.ContentLength = int64(len(stripped))
+	resp.Header.Del(headername.ContentEncoding)
+	resp.Header.Del(headername.ContentLength)
+	return nil
+}
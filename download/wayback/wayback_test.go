@@ -0,0 +1,110 @@
+package wayback
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	assert.NoError(t, ValidateTimestamp("2019"))
+	assert.NoError(t, ValidateTimestamp("20190601123456"))
+	assert.Error(t, ValidateTimestamp(""))
+	assert.Error(t, ValidateTimestamp("2019-06-01"))
+	assert.Error(t, ValidateTimestamp("201906011234567"))
+}
+
+func TestArchiveURL(t *testing.T) {
+	u := ArchiveURL(mustParse("http://example.org/search?q=a%20b#top"), "2019")
+	assert.Equal(t, "https://web.archive.org/web/2019id_/http://example.org/search?q=a%20b", u.String())
+
+	original, ok := OriginalURL(u)
+	require.True(t, ok)
+	assert.Equal(t, "http://example.org/search?q=a%20b", original.String())
+
+	_, ok = OriginalURL(mustParse("https://web.archive.org/about/"))
+	assert.False(t, ok)
+	_, ok = OriginalURL(mustParse("http://example.org/web/2019/http://example.org/"))
+	assert.False(t, ok)
+}
+
+func TestStrip(t *testing.T) {
+	page := `<html><head><script type="text/javascript" src="/_static/js/bundle-playback.js?v=1" charset="utf-8"></script>
+<script type="text/javascript">__wm.init("https://web.archive.org/web");</script>
+<link rel="stylesheet" type="text/css" href="/_static/css/banner-styles.css?v=1" />
+<!-- End Wayback Rewrite JS Include -->
+<title>Home</title></head>
+<body><!-- BEGIN WAYBACK TOOLBAR INSERT -->
+<div id="wm-ipp">toolbar</div>
+<!-- END WAYBACK TOOLBAR INSERT -->
+<a href="https://web.archive.org/web/20190601000000/http://example.org/about">About</a>
+<img src="/web/20190601000000im_/http://example.org/logo.png">
+<a href="/web/2019/latest">Not rewritten</a>
+</body></html>
+<!--
+     FILE ARCHIVED ON 00:00:00 Jun 01, 2019 AND RETRIEVED FROM THE
+     INTERNET ARCHIVE ON 00:00:00 Jan 01, 2024.
+-->
+<!--
+playback timings (ms):
+  captures_list: 1.0
+-->`
+
+	expected := `<html><head><title>Home</title></head>
+<body><a href="http://example.org/about">About</a>
+<img src="http://example.org/logo.png">
+<a href="/web/2019/latest">Not rewritten</a>
+</body></html>
+`
+
+	assert.Equal(t, expected, string(Strip([]byte(page))))
+}
+
+func TestMiddleware(t *testing.T) {
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = gw.Write([]byte(`<a href="https://web.archive.org/web/20190601000000/http://example.org/b">b</a>`))
+	require.NoError(t, gw.Close())
+
+	var requested []string
+	archive := download.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		// the archive redirects to the nearest capture, and replays the site's redirect from /a to /b
+		first := &http.Request{URL: req.URL}
+		second := &http.Request{URL: mustParse("https://web.archive.org/web/20190601000000id_/http://example.org/a"), Response: &http.Response{Request: first}}
+		final := &http.Request{URL: mustParse("https://web.archive.org/web/20190601000000id_/http://example.org/b"), Response: &http.Response{Request: second}}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}},
+			Body:       io.NopCloser(&gzipped),
+			Request:    final,
+		}, nil
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.org/a", nil)
+	resp, err := Middleware("2019")(archive).RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"https://web.archive.org/web/2019id_/http://example.org/a"}, requested)
+	assert.Equal(t, "http://example.org/b", resp.Request.URL.String())
+	assert.Equal(t, req, resp.Request.Response.Request)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `<a href="http://example.org/b">b</a>`, string(body))
+}
@@ -0,0 +1,621 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// Expr is a small boolean expression, written in a subset of CEL (the Common Expression
+// Language), that decides something about a candidate URL, e.g.
+//
+//	depth < 3 && path.startsWith("/docs/") && !query.contains("sort=")
+//
+// The variables are url, scheme, host, path, query, parent and type, which are strings,
+// and depth, which is an integer. parent is the URL of the page in which the candidate
+// was found, or blank; type is its media type, which is guessed from the file extension
+// until the response gives it. Values are compared using ==, !=, <, <=, > and >=, and
+// "in" tests whether a value is in a list such as ["a", "b"]. Strings have the methods
+// contains, startsWith, endsWith and matches, whose regular expression must be a literal
+// (r"..." avoids doubling the backslashes). The tests are combined using !, && and ||,
+// with parentheses as needed. The expression is type-checked when it is parsed, so it
+// cannot fail when it is evaluated. A nil Expr allows everything.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// Candidate is a URL that an Expr decides about.
+type Candidate struct {
+	URL         *url.URL
+	Parent      *url.URL // nil if not known
+	Depth       int
+	ContentType string // the media type, without parameters; blank if not yet known
+}
+
+// ParseExpr parses an expression. It returns nil if the expression is blank.
+func ParseExpr(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+
+	p := &exprParser{s: src}
+	if err := p.next(); err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+
+	root, err := p.parseOr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = fmt.Errorf("unexpected %q at %d", p.tok.text, p.tok.pos)
+	}
+	if err == nil && root.kind() != kindBool {
+		err = errors.New("the result must be true or false")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// String gets the source of the expression.
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+// Allows evaluates the expression for a candidate URL.
+func (e *Expr) Allows(c Candidate) bool {
+	if e == nil {
+		return true
+	}
+
+	vars := exprVars{
+		"url":    c.URL.String(),
+		"scheme": c.URL.Scheme,
+		"host":   c.URL.Host,
+		"path":   c.URL.Path,
+		"query":  c.URL.RawQuery,
+		"parent": "",
+		"type":   c.ContentType,
+		"depth":  c.Depth,
+	}
+	if c.Parent != nil {
+		vars["parent"] = c.Parent.String()
+	}
+	if c.ContentType == "" {
+		vars["type"] = GuessType(c.URL)
+	}
+
+	return e.root.eval(vars).(bool)
+}
+
+// GuessType guesses the media type of a URL from its file extension. Pages are assumed
+// to be text/html. It returns blank if the extension is not recognised.
+func GuessType(u *url.URL) string {
+	if mapping.IsPageURL(u) {
+		return "text/html"
+	}
+
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(u.Path))), ";")
+	return mediaType
+}
+
+// Rules are the expressions that decide whether each URL is fetched, whether the links
+// in it are followed and whether it is stored. Any of them may be nil.
+type Rules struct {
+	Fetch  *Expr
+	Follow *Expr
+	Store  *Expr
+}
+
+// NewRules parses the expressions of the rules. Blank expressions allow everything.
+func NewRules(fetch, follow, store string) (Rules, error) {
+	var rules Rules
+	var err1, err2, err3 error
+	rules.Fetch, err1 = ParseExpr(fetch)
+	rules.Follow, err2 = ParseExpr(follow)
+	rules.Store, err3 = ParseExpr(store)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return Rules{}, err
+	}
+	return rules, nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type exprKind int
+
+const (
+	kindBool exprKind = iota
+	kindInt
+	kindString
+)
+
+func (k exprKind) String() string {
+	return [...]string{"bool", "int", "string"}[k]
+}
+
+// exprVars holds the values of the variables, which are bool, int or string.
+type exprVars map[string]any
+
+var exprVarKinds = map[string]exprKind{
+	"url":    kindString,
+	"scheme": kindString,
+	"host":   kindString,
+	"path":   kindString,
+	"query":  kindString,
+	"parent": kindString,
+	"type":   kindString,
+	"depth":  kindInt,
+}
+
+type exprNode interface {
+	kind() exprKind
+	eval(vars exprVars) any
+}
+
+type literalNode struct {
+	value any
+	k     exprKind
+}
+
+func (n literalNode) kind() exprKind      { return n.k }
+func (n literalNode) eval(_ exprVars) any { return n.value }
+
+type variableNode struct {
+	name string
+	k    exprKind
+}
+
+func (n variableNode) kind() exprKind         { return n.k }
+func (n variableNode) eval(vars exprVars) any { return vars[n.name] }
+
+type notNode struct {
+	x exprNode
+}
+
+func (n notNode) kind() exprKind         { return kindBool }
+func (n notNode) eval(vars exprVars) any { return !n.x.eval(vars).(bool) }
+
+type logicalNode struct {
+	and  bool // otherwise or
+	x, y exprNode
+}
+
+func (n logicalNode) kind() exprKind { return kindBool }
+
+func (n logicalNode) eval(vars exprVars) any {
+	x := n.x.eval(vars).(bool)
+	if x != n.and {
+		return x // short circuit
+	}
+	return n.y.eval(vars).(bool)
+}
+
+type compareNode struct {
+	op   string
+	x, y exprNode
+}
+
+func (n compareNode) kind() exprKind { return kindBool }
+
+func (n compareNode) eval(vars exprVars) any {
+	x, y := n.x.eval(vars), n.y.eval(vars)
+	switch n.op {
+	case "==":
+		return x == y
+	case "!=":
+		return x != y
+	}
+
+	var c int
+	if n.x.kind() == kindInt {
+		c = x.(int) - y.(int)
+	} else {
+		c = strings.Compare(x.(string), y.(string))
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type inNode struct {
+	x    exprNode
+	list []exprNode
+}
+
+func (n inNode) kind() exprKind { return kindBool }
+
+func (n inNode) eval(vars exprVars) any {
+	x := n.x.eval(vars)
+	return slices.ContainsFunc(n.list, func(item exprNode) bool { return item.eval(vars) == x })
+}
+
+type methodNode struct {
+	name      string
+	recv, arg exprNode
+	re        *regexp.Regexp // for matches
+}
+
+func (n methodNode) kind() exprKind { return kindBool }
+
+func (n methodNode) eval(vars exprVars) any {
+	s := n.recv.eval(vars).(string)
+	if n.re != nil {
+		return n.re.MatchString(s)
+	}
+
+	arg := n.arg.eval(vars).(string)
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, arg)
+	case "startsWith":
+		return strings.HasPrefix(s, arg)
+	default:
+		return strings.HasSuffix(s, arg)
+	}
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // the source of the token, or the value of a string
+	pos  int
+}
+
+type exprParser struct {
+	s   string
+	i   int
+	tok token
+}
+
+var exprPuncts = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+// next reads the next token.
+func (p *exprParser) next() error {
+	for p.i < len(p.s) && strings.IndexByte(" \t\n\r", p.s[p.i]) >= 0 {
+		p.i++
+	}
+
+	start := p.i
+	if p.i >= len(p.s) {
+		p.tok = token{kind: tokEOF, text: "end", pos: start}
+		return nil
+	}
+
+	c := p.s[p.i]
+	switch {
+	case c == '"' || c == '\'':
+		return p.lexString(start, false)
+
+	case c == 'r' && p.i+1 < len(p.s) && (p.s[p.i+1] == '"' || p.s[p.i+1] == '\''):
+		p.i++
+		return p.lexString(start, true)
+
+	case isIdentByte(c) && !isDigit(c):
+		for p.i < len(p.s) && isIdentByte(p.s[p.i]) {
+			p.i++
+		}
+		p.tok = token{kind: tokIdent, text: p.s[start:p.i], pos: start}
+		return nil
+
+	case isDigit(c):
+		for p.i < len(p.s) && isDigit(p.s[p.i]) {
+			p.i++
+		}
+		p.tok = token{kind: tokInt, text: p.s[start:p.i], pos: start}
+		return nil
+	}
+
+	for _, punct := range exprPuncts {
+		if strings.HasPrefix(p.s[p.i:], punct) {
+			p.i += len(punct)
+			p.tok = token{kind: tokPunct, text: punct, pos: start}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected %q at %d", c, start)
+}
+
+// lexString reads a quoted string. Escapes are recognised unless it is raw.
+func (p *exprParser) lexString(start int, raw bool) error {
+	quote := p.s[p.i]
+	p.i++
+
+	buf := &strings.Builder{}
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == quote:
+			p.tok = token{kind: tokString, text: buf.String(), pos: start}
+			return nil
+
+		case c == '\\' && !raw && p.i < len(p.s):
+			e := p.s[p.i]
+			p.i++
+			switch e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case '\\', '"', '\'':
+				buf.WriteByte(e)
+			default:
+				return fmt.Errorf("unknown escape \\%c at %d", e, p.i-2)
+			}
+
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return fmt.Errorf("unterminated string at %d", start)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || isDigit(c)
+}
+
+// accept consumes the current token if it is the given punctuation.
+func (p *exprParser) accept(punct string) (bool, error) {
+	if p.tok.kind != tokPunct || p.tok.text != punct {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+func (p *exprParser) expect(punct string) error {
+	if ok, err := p.accept(punct); ok || err != nil {
+		return err
+	}
+	return fmt.Errorf("expected %q at %d", punct, p.tok.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogical("&&", p.parseRelation)
+}
+
+func (p *exprParser) parseLogical(op string, operand func() (exprNode, error)) (exprNode, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		pos := p.tok.pos
+		if ok, err := p.accept(op); err != nil {
+			return nil, err
+		} else if !ok {
+			return x, nil
+		}
+
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != kindBool || y.kind() != kindBool {
+			return nil, fmt.Errorf("%s needs true or false on both sides at %d", op, pos)
+		}
+		x = logicalNode{and: op == "&&", x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseRelation() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	op, pos := p.tok.text, p.tok.pos
+	switch {
+	case p.tok.kind == tokIdent && op == "in":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return p.parseList(x)
+
+	case p.tok.kind != tokPunct || !slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, op):
+		return x, nil
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	y, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	if x.kind() != y.kind() {
+		return nil, fmt.Errorf("cannot compare %s with %s at %d", x.kind(), y.kind(), pos)
+	}
+	if x.kind() == kindBool && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("cannot order true or false at %d", pos)
+	}
+	return compareNode{op: op, x: x, y: y}, nil
+}
+
+// parseList parses the list on the right of "in".
+func (p *exprParser) parseList(x exprNode) (exprNode, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	n := inNode{x: x}
+	for {
+		if ok, err := p.accept("]"); ok || err != nil {
+			return n, err
+		}
+
+		if len(n.list) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		pos := p.tok.pos
+		item, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if item.kind() != x.kind() {
+			return nil, fmt.Errorf("cannot compare %s with %s at %d", x.kind(), item.kind(), pos)
+		}
+		n.list = append(n.list, item)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	pos := p.tok.pos
+	if ok, err := p.accept("!"); err != nil {
+		return nil, err
+	} else if ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != kindBool {
+			return nil, fmt.Errorf("! needs true or false at %d", pos)
+		}
+		return notNode{x: x}, nil
+	}
+
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if ok, err := p.accept("."); err != nil {
+			return nil, err
+		} else if !ok {
+			return x, nil
+		}
+
+		if x, err = p.parseMethod(x); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseMethod parses a method call on a string, after the dot.
+func (p *exprParser) parseMethod(recv exprNode) (exprNode, error) {
+	name, pos := p.tok.text, p.tok.pos
+	if p.tok.kind != tokIdent || !slices.Contains([]string{"contains", "startsWith", "endsWith", "matches"}, name) {
+		return nil, fmt.Errorf("unknown method %q at %d", name, pos)
+	}
+	if recv.kind() != kindString {
+		return nil, fmt.Errorf("%s needs a string at %d", name, pos)
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	argTok := p.tok
+	arg, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if arg.kind() != kindString {
+		return nil, fmt.Errorf("%s needs a string argument at %d", name, argTok.pos)
+	}
+
+	n := methodNode{name: name, recv: recv, arg: arg}
+	if name == "matches" {
+		lit, ok := arg.(literalNode)
+		if !ok {
+			return nil, fmt.Errorf("matches needs a literal regular expression at %d", argTok.pos)
+		}
+		if n.re, err = regexp.Compile(lit.value.(string)); err != nil {
+			return nil, fmt.Errorf("at %d: %w", argTok.pos, err)
+		}
+	}
+
+	return n, p.expect(")")
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		return literalNode{value: tok.text, k: kindString}, p.next()
+
+	case tokInt:
+		v, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: %w", tok.pos, err)
+		}
+		return literalNode{value: v, k: kindInt}, p.next()
+
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return literalNode{value: tok.text == "true", k: kindBool}, p.next()
+		}
+
+		k, known := exprVarKinds[tok.text]
+		if !known {
+			return nil, fmt.Errorf("unknown variable %q at %d", tok.text, tok.pos)
+		}
+		return variableNode{name: tok.text, k: k}, p.next()
+
+	case tokPunct:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
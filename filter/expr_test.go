@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprAllows(t *testing.T) {
+	parent, _ := url.Parse("http://x.org/docs/")
+
+	cases := map[string][]bool{
+		// for http://x.org/docs/a.html at depth 2, http://x.org/logo.png?v=1 at depth 4 and a PDF
+		`true`:      {true, true, true},
+		`depth < 3`: {true, false, true},
+		`depth >= 3 || path.startsWith("/docs/")`:              {true, true, false},
+		`!query.contains("v=")`:                                {true, false, true},
+		`type == "text/html"`:                                  {true, false, false},
+		`type in ["image/png", "application/pdf"]`:             {false, true, true},
+		`host == "x.org" && scheme != "https"`:                 {true, true, true},
+		`parent.endsWith("/docs/")`:                            {true, true, false},
+		`url.matches(r"\.(png|gif)\b")`:                        {false, true, false},
+		`(depth == 2 || depth == 4) && !(type == 'image/png')`: {true, false, false},
+		`"docs" < "logs" && path > "/a"`:                       {true, true, true},
+	}
+
+	candidates := []Candidate{
+		{URL: mustParse("http://x.org/docs/a.html"), Parent: parent, Depth: 2},
+		{URL: mustParse("http://x.org/logo.png?v=1"), Parent: parent, Depth: 4},
+		{URL: mustParse("http://x.org/report"), Depth: 1, ContentType: "application/pdf"},
+	}
+
+	for src, expected := range cases {
+		e, err := ParseExpr(src)
+		require.NoError(t, err, src)
+		for i, c := range candidates {
+			assert.Equal(t, expected[i], e.Allows(c), "%s %s", src, c.URL)
+		}
+	}
+}
+
+func TestExprNil(t *testing.T) {
+	e, err := ParseExpr("  ")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+	assert.True(t, e.Allows(Candidate{URL: mustParse("http://x.org/")}))
+}
+
+func TestExprErrors(t *testing.T) {
+	cases := map[string]string{
+		`depth`:                 "the result must be true or false",
+		`depth < "3"`:           "cannot compare int with string at 6",
+		`size < 3`:              `unknown variable "size" at 0`,
+		`path.length()`:         `unknown method "length" at 5`,
+		`depth.contains("1")`:   "contains needs a string at 6",
+		`path.matches(query)`:   "matches needs a literal regular expression at 13",
+		`path.matches("(")`:     "missing closing )",
+		`path == "/a`:           "unterminated string at 8",
+		`depth < 3 &&`:          `unexpected "end" at 12`,
+		`depth < 3 depth`:       `unexpected "depth" at 10`,
+		`type in ["a", 1]`:      "cannot compare string with int at 14",
+		`!path`:                 "! needs true or false at 0",
+		`path || true`:          "|| needs true or false on both sides at 5",
+		`true < false`:          "cannot order true or false at 5",
+		`path == "a" # comment`: `unexpected '#' at 12`,
+		`(depth < 3`:            `expected ")" at 10`,
+		`path == "\q"`:          `unknown escape \q at 9`,
+	}
+
+	for src, expected := range cases {
+		_, err := ParseExpr(src)
+		require.Error(t, err, src)
+		assert.Contains(t, err.Error(), expected, src)
+	}
+}
+
+func TestNewRules(t *testing.T) {
+	rules, err := NewRules("depth < 3", "", `type == "text/html"`)
+	require.NoError(t, err)
+	assert.Equal(t, "depth < 3", rules.Fetch.String())
+	assert.Nil(t, rules.Follow)
+	assert.NotNil(t, rules.Store)
+
+	_, err = NewRules("depth <", "", "path ==")
+	require.Error(t, err)
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
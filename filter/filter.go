@@ -34,10 +34,10 @@ func (filter Filter) Present() bool {
 	return len(filter) > 0
 }
 
-func (filter Filter) Matches(url *url.URL, intent string) bool {
+func (filter Filter) Matches(url *url.URL, intent string, log *logger.Logger) bool {
 	for _, re := range filter {
 		if re.MatchString(url.Path) {
-			logger.Debug(intent,
+			log.Debug(intent,
 				slog.String("url", url.String()),
 				slog.Any("expression", re))
 			return true
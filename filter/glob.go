@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// GlobToRegexp translates a wget or rsync style glob pattern into a regular expression
+// that is matched against URL paths. The pattern matches whole path segments:
+//
+//   - a pattern starting with '/' is anchored at the root, e.g. "/cgi-bin";
+//     otherwise it can match at any segment, e.g. "*.zip" or "tmp/cache";
+//   - a pattern ending with '/' matches only directories, i.e. the paths within them;
+//     otherwise it also matches the paths within any directory it matches;
+//   - '*' matches any characters except '/', '**' matches any characters, '?' matches
+//     one character except '/' and [...] matches one character of a class, which is
+//     negated by a leading '!' or '^'. A backslash quotes the following character.
+func GlobToRegexp(pattern string) (string, error) {
+	buf := &strings.Builder{}
+	rest, anchored := strings.CutPrefix(pattern, "/")
+	rest, directory := strings.CutSuffix(rest, "/")
+
+	if anchored {
+		buf.WriteString("^/")
+	} else {
+		buf.WriteString("/")
+	}
+
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; c {
+		case '*':
+			if i+1 < len(rest) && rest[i+1] == '*' {
+				buf.WriteString(".*")
+				i++
+			} else {
+				buf.WriteString("[^/]*")
+			}
+
+		case '?':
+			buf.WriteString("[^/]")
+
+		case '[':
+			end := classEnd(rest, i)
+			if end < 0 {
+				return "", fmt.Errorf("glob %q: unterminated [", pattern)
+			}
+			buf.WriteString(translateClass(rest[i+1 : end]))
+			i = end
+
+		case '\\':
+			if i+1 < len(rest) {
+				i++
+			}
+			buf.WriteString(regexp.QuoteMeta(rest[i : i+1]))
+
+		default:
+			buf.WriteString(regexp.QuoteMeta(rest[i : i+1]))
+		}
+	}
+
+	if directory {
+		buf.WriteString("/")
+	} else {
+		buf.WriteString("(/|$)")
+	}
+
+	return buf.String(), nil
+}
+
+// classEnd finds the ']' that closes the character class starting at i. A ']' first in
+// the class, possibly after the negation, is a member of the class.
+func classEnd(s string, i int) int {
+	j := i + 1
+	if j < len(s) && (s[j] == '!' || s[j] == '^') {
+		j++
+	}
+	if j < len(s) && s[j] == ']' {
+		j++
+	}
+	end := strings.IndexByte(s[j:], ']')
+	if end < 0 {
+		return -1
+	}
+	return j + end
+}
+
+func translateClass(class string) string {
+	buf := &strings.Builder{}
+	buf.WriteByte('[')
+	if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+		buf.WriteByte('^')
+		class = class[1:]
+	}
+	for i := 0; i < len(class); i++ {
+		if class[i] == '\\' || class[i] == '[' || class[i] == ']' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(class[i])
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+// ReadGlobs reads a list of glob patterns, one per line, as in an rsync exclude file,
+// and translates them into regular expressions using GlobToRegexp. Blank lines and
+// comment lines, which start with '#' or ';', are ignored. rsync's "- " prefix for
+// exclusion rules is also allowed.
+func ReadGlobs(r io.Reader) ([]string, error) {
+	var regexps []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		re, err := GlobToRegexp(strings.TrimPrefix(line, "- "))
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, scanner.Err()
+}
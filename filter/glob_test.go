@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := map[string]map[string]bool{
+		"*.zip": {
+			"/a.zip":          true,
+			"/files/b.zip":    true,
+			"/files/b.zip/x":  true,
+			"/files/b.zipper": false,
+		},
+		"/cgi-bin": {
+			"/cgi-bin":        true,
+			"/cgi-bin/run.sh": true,
+			"/a/cgi-bin/x":    false,
+			"/cgi-binary":     false,
+		},
+		"tmp/": {
+			"/tmp/a":   true,
+			"/x/tmp/a": true,
+			"/tmp":     false,
+			"/a/tmp":   false,
+		},
+		"/private/**/draft-?.html": {
+			"/private/a/b/draft-1.html": true,
+			"/private/a/draft-2.html":   true,
+			"/private/a/draft-10.html":  false,
+			"/public/a/draft-1.html":    false,
+		},
+		"img[0-9].[!g]*": {
+			"/img1.png":  true,
+			"/img1.gif":  false,
+			"/imgx.png":  false,
+			"/a/img2.jp": true,
+		},
+		`a\*b.c`: {
+			"/a*b.c":  true,
+			"/axxb.c": false,
+			"/a*bxc":  false,
+		},
+	}
+
+	for glob, paths := range cases {
+		re, err := GlobToRegexp(glob)
+		require.NoError(t, err, glob)
+
+		f, err := New([]string{re})
+		require.NoError(t, err, glob)
+
+		for path, expected := range paths {
+			assert.Equal(t, expected, Filter(f).Matches(&url.URL{Path: path}, "test", nil), "%s %s", glob, path)
+		}
+	}
+
+	_, err := GlobToRegexp("img[0-9")
+	assert.Error(t, err)
+}
+
+func TestReadGlobs(t *testing.T) {
+	input := `# wget -R and -X lists
+*.iso
+; rsync comment
+- /cache/
+
+`
+	regexps, err := ReadGlobs(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []string{`/[^/]*\.iso(/|$)`, `^/cache/`}, regexps)
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// typeGroups are the named groups of media types. Each entry is either a file
+// extension (starting with '.') or a media type; a media type ending with '/'
+// matches all of its subtypes.
+var typeGroups = map[string][]string{
+	"images":   {"image/", ".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif", ".svg", ".ico", ".bmp", ".tif", ".tiff"},
+	"fonts":    {"font/", "application/font-woff", "application/vnd.ms-fontobject", ".woff", ".woff2", ".ttf", ".otf", ".eot"},
+	"video":    {"video/", ".mp4", ".m4v", ".webm", ".mov", ".avi", ".mkv", ".mpg", ".mpeg", ".ogv"},
+	"audio":    {"audio/", ".mp3", ".m4a", ".aac", ".ogg", ".oga", ".opus", ".wav", ".flac"},
+	"archives": {"application/zip", "application/gzip", "application/x-gzip", "application/x-tar", "application/x-bzip2", "application/x-xz", "application/x-7z-compressed", "application/vnd.rar", "application/x-rar-compressed", ".zip", ".gz", ".tgz", ".tar", ".bz2", ".xz", ".7z", ".rar"},
+}
+
+// typeSet holds file extensions and media types.
+type typeSet struct {
+	exts   map[string]bool
+	mimes  []string
+	active bool
+}
+
+// Types decides which assets are downloaded according to their media type. HTML
+// pages are always downloaded, because they are needed to find other URLs.
+type Types struct {
+	include typeSet
+	exclude typeSet
+}
+
+// NewTypes creates a media type filter. Each item in the lists is a group name
+// (images, fonts, video, audio or archives), a media type such as "application/pdf"
+// or "image/*", or a file extension such as ".pdf". Items may be separated by commas.
+func NewTypes(include, exclude []string) (Types, error) {
+	in, err1 := newTypeSet(include)
+	ex, err2 := newTypeSet(exclude)
+	if err1 != nil {
+		return Types{}, err1
+	}
+	if err2 != nil {
+		return Types{}, err2
+	}
+	return Types{include: in, exclude: ex}, nil
+}
+
+func newTypeSet(list []string) (typeSet, error) {
+	set := typeSet{exts: make(map[string]bool)}
+	for _, items := range list {
+		for _, item := range strings.Split(items, ",") {
+			item = strings.ToLower(strings.TrimSpace(item))
+			switch {
+			case item == "":
+				continue
+			case typeGroups[item] != nil:
+				set.add(typeGroups[item]...)
+			case strings.HasPrefix(item, "."):
+				set.add(item)
+			case strings.HasSuffix(item, "/*"):
+				set.add(strings.TrimSuffix(item, "*"))
+			case strings.Count(item, "/") == 1:
+				set.add(item)
+			case !strings.ContainsAny(item, "/*"):
+				set.add("." + item) // extension without its dot
+			default:
+				return typeSet{}, fmt.Errorf("%q: unrecognised media type", item)
+			}
+		}
+	}
+	return set, nil
+}
+
+func (set *typeSet) add(items ...string) {
+	for _, item := range items {
+		if strings.HasPrefix(item, ".") {
+			set.exts[item] = true
+		} else {
+			set.mimes = append(set.mimes, item)
+		}
+		set.active = true
+	}
+}
+
+func (set typeSet) matches(mediaType, ext string) bool {
+	if ext != "" && set.exts[ext] {
+		return true
+	}
+	if mediaType == "" {
+		return false
+	}
+	for _, m := range set.mimes {
+		if mediaType == m || (strings.HasSuffix(m, "/") && strings.HasPrefix(mediaType, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Present returns true if any media types have been specified.
+func (t Types) Present() bool {
+	return t.include.active || t.exclude.active
+}
+
+// AllowsURL decides whether a URL may be downloaded, based only on its file extension.
+// The decision is deferred (decided is false) when the extension doesn't identify the
+// media type, for example for pages.
+func (t Types) AllowsURL(u *url.URL) (allowed, decided bool) {
+	if !t.Present() || mapping.IsPageURL(u) {
+		return true, false
+	}
+
+	ext := strings.ToLower(filepath.Ext(u.Path))
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+
+	if t.exclude.matches(mediaType, ext) {
+		return false, true
+	}
+
+	if t.include.active && !t.include.matches(mediaType, ext) {
+		if mediaType == "" {
+			return true, false // unknown extension; use the Content-Type later
+		}
+		return false, true
+	}
+
+	return true, true
+}
+
+// AllowsContentType decides whether a response may be kept, based on its media type,
+// e.g. "image/png". HTML is always allowed.
+func (t Types) AllowsContentType(mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	if !t.Present() || mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return true
+	}
+
+	if t.exclude.matches(mediaType, "") {
+		return false
+	}
+
+	return !t.include.active || t.include.matches(mediaType, "")
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypesExclude(t *testing.T) {
+	types, err := NewTypes(nil, []string{"video,audio", "fonts", "application/pdf"})
+	require.NoError(t, err)
+	assert.True(t, types.Present())
+
+	cases := map[string][2]bool{
+		"http://x.org/":           {true, false},
+		"http://x.org/page.html":  {true, false},
+		"http://x.org/movie.mp4":  {false, true},
+		"http://x.org/font.woff2": {false, true},
+		"http://x.org/doc.pdf":    {false, true},
+		"http://x.org/photo.jpg":  {true, true},
+	}
+
+	for s, expected := range cases {
+		u, _ := url.Parse(s)
+		allowed, decided := types.AllowsURL(u)
+		assert.Equal(t, expected, [2]bool{allowed, decided}, s)
+	}
+
+	assert.False(t, types.AllowsContentType("video/mp4"))
+	assert.False(t, types.AllowsContentType("Application/PDF"))
+	assert.True(t, types.AllowsContentType("image/png"))
+	assert.True(t, types.AllowsContentType("text/html"))
+}
+
+func TestTypesInclude(t *testing.T) {
+	types, err := NewTypes([]string{"images", "css", "text/css"}, nil)
+	require.NoError(t, err)
+
+	cases := map[string][2]bool{
+		"http://x.org/":            {true, false},
+		"http://x.org/style.css":   {true, true},
+		"http://x.org/photo.JPG":   {true, true},
+		"http://x.org/movie.mp4":   {false, true},
+		"http://x.org/data.xyzzy9": {true, false},
+	}
+
+	for s, expected := range cases {
+		u, _ := url.Parse(s)
+		allowed, decided := types.AllowsURL(u)
+		assert.Equal(t, expected, [2]bool{allowed, decided}, s)
+	}
+
+	assert.True(t, types.AllowsContentType("image/webp"))
+	assert.True(t, types.AllowsContentType("text/html"))
+	assert.False(t, types.AllowsContentType("application/javascript"))
+}
+
+func TestTypesAbsent(t *testing.T) {
+	types, err := NewTypes(nil, nil)
+	require.NoError(t, err)
+	assert.False(t, types.Present())
+	assert.True(t, types.AllowsContentType("video/mp4"))
+
+	_, err = NewTypes([]string{"a/b/c"}, nil)
+	assert.Error(t, err)
+}
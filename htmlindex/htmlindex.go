@@ -36,51 +36,32 @@ func (h *Index) Index(baseURL *url.URL, node *html.Node) {
 
 // findBaseHref finds the URL from the <base href="..."/> element, if there is one.
 func (h *Index) findBaseHref(node *html.Node) (baseURL *url.URL) {
-	if node.FirstChild == nil {
-		return nil
-	}
-
-	for child := node.FirstChild; child != nil; child = child.NextSibling {
-		if child.Type != html.ElementNode {
-			continue
+	forEachElement(node, func(child *html.Node) bool {
+		if child.DataAtom != atom.Base || child.Parent.DataAtom != atom.Head {
+			return true
 		}
 
-		if child.DataAtom == atom.Base && node.DataAtom == atom.Head {
-			var references []string
-
-			info, ok := Nodes[atom.Base]
-			if ok {
-				references = nodeAttributeURLs(nil, child, info.parser, info.Attributes...)
-			}
+		var references []string
 
-			if len(references) == 1 {
-				if newBase, err := url.Parse(references[0]); err == nil {
-					return newBase
-				} else {
-					return nil
-				}
-			}
+		info, ok := Nodes[atom.Base]
+		if ok {
+			references = nodeAttributeURLs(nil, child, info.parser, info.Attributes...)
 		}
 
-		if baseURL = h.findBaseHref(child); baseURL != nil {
-			return baseURL
+		if len(references) != 1 {
+			return true
 		}
-	}
+
+		baseURL, _ = url.Parse(references[0]) // nil if it is invalid
+		return false
+	})
 
 	return baseURL
 }
 
-// indexChildren indexes all the children of node. References are resolved relative to baseURL.
+// indexChildren indexes all the descendants of node. References are resolved relative to baseURL.
 func (h *Index) indexChildren(baseURL *url.URL, node *html.Node) {
-	if node.FirstChild == nil {
-		return
-	}
-
-	for child := node.FirstChild; child != nil; child = child.NextSibling {
-		if child.Type != html.ElementNode {
-			continue
-		}
-
+	forEachElement(node, func(child *html.Node) bool {
 		var references []string
 
 		info, ok := Nodes[child.DataAtom]
@@ -97,8 +78,32 @@ func (h *Index) indexChildren(baseURL *url.URL, node *html.Node) {
 		for _, reference := range references {
 			m[reference] = append(m[reference], child)
 		}
+		return true
+	})
+}
+
+// forEachElement calls fn for every element below node, in document order, until fn
+// returns false. No recursion is used, so any depth of nesting is safe.
+func forEachElement(node *html.Node, fn func(*html.Node) bool) {
+	child := node.FirstChild
+	for child != nil {
+		if child.Type == html.ElementNode {
+			if !fn(child) {
+				return
+			}
+			if child.FirstChild != nil {
+				child = child.FirstChild
+				continue
+			}
+		}
 
-		h.indexChildren(baseURL, child)
+		for child.NextSibling == nil {
+			child = child.Parent
+			if child == node {
+				return
+			}
+		}
+		child = child.NextSibling
 	}
 }
 
@@ -136,6 +141,18 @@ func (h *Index) Nodes(tag atom.Atom) map[string][]*html.Node {
 	return map[string][]*html.Node{}
 }
 
+// TokenURLs returns the resolved URLs referenced by the attributes of a start tag. It is
+// for pages that are scanned with the tokenizer rather than parsed into a tree.
+func TokenURLs(baseURL *url.URL, token html.Token) []string {
+	info, ok := Nodes[token.DataAtom]
+	if !ok {
+		return nil
+	}
+
+	node := &html.Node{Type: html.ElementNode, DataAtom: token.DataAtom, Data: token.Data, Attr: token.Attr}
+	return nodeAttributeURLs(baseURL, node, info.parser, info.Attributes...)
+}
+
 // nodeAttributeURLs returns resolved URLs based on the base URL and the HTML node attribute values.
 func nodeAttributeURLs(baseURL *url.URL, node *html.Node,
 	parser nodeAttributeParser, attributeName ...string) []string {
@@ -17,18 +17,18 @@ import (
 
 type ImageQuality int
 
-func (q ImageQuality) CheckImageForRecode(url *url.URL, data []byte) []byte {
+func (q ImageQuality) CheckImageForRecode(url *url.URL, data []byte, log *logger.Logger) []byte {
 	kind, err := filetype.Match(data)
 	if err != nil || kind == types.Unknown {
 		return data
 	}
 
 	if kind.MIME.Type == matchers.TypeJpeg.MIME.Type && kind.MIME.Subtype == matchers.TypeJpeg.MIME.Subtype {
-		return q.recodeJPEG(url, data)
+		return q.recodeJPEG(url, data, log)
 	}
 
 	if kind.MIME.Type == matchers.TypePng.MIME.Type && kind.MIME.Subtype == matchers.TypePng.MIME.Subtype {
-		return q.recodePNG(url, data)
+		return q.recodePNG(url, data, log)
 	}
 
 	return data
@@ -48,7 +48,7 @@ func (q ImageQuality) encodeJPEG(img image.Image) []byte {
 }
 
 // recodeJPEG recodes the image and returns it if it is smaller than before.
-func (q ImageQuality) recodeJPEG(url fmt.Stringer, data []byte) []byte {
+func (q ImageQuality) recodeJPEG(url fmt.Stringer, data []byte, log *logger.Logger) []byte {
 	inBuf := bytes.NewBuffer(data)
 	img, err := jpeg.Decode(inBuf)
 	if err != nil {
@@ -60,7 +60,7 @@ func (q ImageQuality) recodeJPEG(url fmt.Stringer, data []byte) []byte {
 		return data
 	}
 
-	logger.Debug("Recoded JPEG",
+	log.Debug("Recoded JPEG",
 		slog.String("url", url.String()),
 		slog.Int("size_original", len(data)),
 		slog.Int("size_recoded", len(encoded)))
@@ -68,7 +68,7 @@ func (q ImageQuality) recodeJPEG(url fmt.Stringer, data []byte) []byte {
 }
 
 // recodePNG recodes the image and returns it if it is smaller than before.
-func (q ImageQuality) recodePNG(url fmt.Stringer, data []byte) []byte {
+func (q ImageQuality) recodePNG(url fmt.Stringer, data []byte, log *logger.Logger) []byte {
 	inBuf := bytes.NewBuffer(data)
 	img, err := png.Decode(inBuf)
 	if err != nil {
@@ -80,7 +80,7 @@ func (q ImageQuality) recodePNG(url fmt.Stringer, data []byte) []byte {
 		return data
 	}
 
-	logger.Debug("Recoded PNG",
+	log.Debug("Recoded PNG",
 		slog.String("url", url.String()),
 		slog.Int("size_original", len(data)),
 		slog.Int("size_recoded", len(encoded)))
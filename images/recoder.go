@@ -0,0 +1,121 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"log/slog"
+	"net/url"
+	"runtime"
+	"sync"
+
+	"github.com/cornelk/goscrape/logger"
+)
+
+// DefaultMemory is the default limit on the memory used by images being re-encoded.
+const DefaultMemory = 256 << 20
+
+// Recoder re-encodes images using a limited number of workers at once, within a
+// limit on the memory used by the decoded images. Images that would exceed the
+// memory limit on their own are left as they are. It is safe for concurrent use.
+// A nil *Recoder re-encodes without any limits.
+type Recoder struct {
+	slots  chan struct{}
+	memory int64
+	used   int64
+	mu     sync.Mutex
+	cond   *sync.Cond
+	log    *logger.Logger
+}
+
+// NewRecoder creates a Recoder. If workers is zero, the number of CPUs is used; if
+// memory (in bytes) is zero, DefaultMemory is used.
+func NewRecoder(workers int, memory int64, log *logger.Logger) *Recoder {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if memory < 1 {
+		memory = DefaultMemory
+	}
+
+	r := &Recoder{
+		slots:  make(chan struct{}, workers),
+		memory: memory,
+		log:    log,
+	}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// Recode re-encodes the image data at the given quality, if this makes it smaller.
+// It waits while all the workers are busy or there is not enough memory, unless the
+// context is cancelled, in which case it returns the context's error.
+func (r *Recoder) Recode(ctx context.Context, q ImageQuality, u *url.URL, data []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return data, err
+	}
+
+	if r == nil {
+		return q.CheckImageForRecode(u, data, nil), nil
+	}
+
+	cost := decodedSize(data)
+	if cost > r.memory {
+		r.log.Debug("Image too large to recode",
+			slog.String("url", u.String()),
+			slog.Int64("memory", cost))
+		return data, nil
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return data, ctx.Err()
+	}
+
+	if err := r.acquire(ctx, cost); err != nil {
+		return data, err
+	}
+	defer r.release(cost)
+
+	return q.CheckImageForRecode(u, data, r.log), nil
+}
+
+func (r *Recoder) acquire(ctx context.Context, n int64) error {
+	// wake the waiters when the context is cancelled, so that they can give up
+	stop := context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.cond.Broadcast()
+	})
+	defer stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.used+n > r.memory {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.cond.Wait()
+	}
+	r.used += n
+	return nil
+}
+
+func (r *Recoder) release(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used -= n
+	r.cond.Broadcast()
+}
+
+// decodedSize estimates the memory needed to re-encode an image: its pixels, at
+// four bytes each, plus the encoded output. Only the image header is read.
+func decodedSize(data []byte) int64 {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return int64(len(data)) // unknown formats are not decoded
+	}
+	return int64(cfg.Width)*int64(cfg.Height)*4 + int64(len(data))
+}
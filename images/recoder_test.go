@@ -0,0 +1,107 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func samplePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * y), G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+func TestRecoderMemoryLimit(t *testing.T) {
+	u, _ := url.Parse("http://example.org/a.png")
+	data := samplePNG(t, 100, 100)
+
+	ctx := context.Background()
+
+	small := NewRecoder(1, 1000, logger.Discard())
+	same, err := small.Recode(ctx, 50, u, data)
+	require.NoError(t, err)
+	assert.Equal(t, data, same, "too large to recode")
+
+	r := NewRecoder(2, 0, logger.Discard())
+	recoded, err := r.Recode(ctx, 50, u, data)
+	require.NoError(t, err)
+	assert.Less(t, len(recoded), len(data))
+
+	var nilRecoder *Recoder
+	same, err = nilRecoder.Recode(ctx, 50, u, data)
+	require.NoError(t, err)
+	assert.Equal(t, recoded, same)
+}
+
+func TestRecoderCancelled(t *testing.T) {
+	u, _ := url.Parse("http://example.org/a.png")
+	data := samplePNG(t, 50, 50)
+	cost := decodedSize(data)
+
+	// waiting for a worker
+	busy := NewRecoder(1, 0, logger.Discard())
+	busy.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	same, err := busy.Recode(ctx, 50, u, data)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, data, same)
+
+	// waiting for memory
+	full := NewRecoder(2, cost, logger.Discard())
+	require.NoError(t, full.acquire(context.Background(), cost))
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = full.Recode(ctx, 50, u, data)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, cost, full.used)
+}
+
+func TestRecoderMemoryWait(t *testing.T) {
+	cost := decodedSize(samplePNG(t, 50, 50))
+
+	r := NewRecoder(4, 2*cost, logger.Discard()) // memory allows only two at once
+
+	var active, peak atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.acquire(context.Background(), cost))
+			n := active.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+			r.release(cost)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak.Load(), int64(2))
+	assert.Equal(t, int64(0), r.used)
+}
@@ -3,16 +3,42 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	sloghttp "github.com/samber/slog-http"
 	"io"
 	"log/slog"
 	"os"
 	"sync/atomic"
+
+	sloghttp "github.com/samber/slog-http"
 )
 
-func Create(w io.Writer, opts *slog.HandlerOptions) {
-	Logger = slog.New(slog.NewTextHandler(w, opts))
+// Logger is able to handle concurrent logging safely. It counts the errors and warnings
+// that it logs, from which the exit code is decided. Each scrape has its own, so that
+// scrapes in the same process don't interleave their counts. A nil Logger writes to
+// slog.Default and counts nothing.
+type Logger struct {
+	slog *slog.Logger
+
+	// FailOnWarn makes warnings count as errors in the ExitCode.
+	FailOnWarn bool
+
+	errorCount, warnCount atomic.Int64
+}
+
+// New returns a logger that writes to a handler.
+func New(h slog.Handler) *Logger {
+	return &Logger{slog: slog.New(h)}
+}
+
+// Create returns a logger that writes text to w.
+func Create(w io.Writer, opts *slog.HandlerOptions) *Logger {
+	return New(slog.NewTextHandler(w, opts))
+}
+
+// Discard returns a logger that writes nothing, which is useful in tests.
+func Discard() *Logger {
+	return Create(io.Discard, nil)
 }
 
 func HttpLogConfig() sloghttp.Config {
@@ -32,37 +58,71 @@ func HttpLogConfig() sloghttp.Config {
 	}
 }
 
-var errorCount atomic.Int64
+// The exit codes of the command, from which scripts and schedulers can tell how it went.
+const (
+	ExitOK      = 0 // completed cleanly
+	ExitErrors  = 1 // completed, but errors were logged, or warnings with FailOnWarn
+	ExitAborted = 2 // did not complete, e.g. because it was interrupted or failed
+	ExitConfig  = 3 // the command line or configuration is invalid
+)
 
-// Logger is a global logger that is able to handle concurrent logging safely.
-var Logger = slog.Default()
+// Slog gets the underlying slog.Logger, e.g. for HTTP middleware.
+func (l *Logger) Slog() *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l.slog
+}
 
-func Log(level slog.Level, msg string, args ...any) {
-	Logger.Log(nil, level, msg, args...)
+func (l *Logger) Log(level slog.Level, msg string, args ...any) {
+	l.Slog().Log(context.Background(), level, msg, args...)
 }
 
-func Debug(msg string, args ...any) {
-	Log(slog.LevelDebug, msg, args...)
+func (l *Logger) Debug(msg string, args ...any) {
+	l.Log(slog.LevelDebug, msg, args...)
 }
 
-func Info(msg string, args ...any) {
-	Log(slog.LevelInfo, msg, args...)
+func (l *Logger) Info(msg string, args ...any) {
+	l.Log(slog.LevelInfo, msg, args...)
 }
 
-func Warn(msg string, args ...any) {
-	Log(slog.LevelWarn, msg, args...)
+func (l *Logger) Warn(msg string, args ...any) {
+	l.Log(slog.LevelWarn, msg, args...)
+	if l != nil {
+		l.warnCount.Add(1)
+	}
 }
 
-func Error(msg string, args ...any) {
-	Log(slog.LevelError, msg, args...)
-	errorCount.Add(1)
+// Report logs a report, such as the statistics at the end of a scrape, at warning level
+// so that it is normally visible. Unlike Warn, it is not counted as a warning.
+func (l *Logger) Report(msg string, args ...any) {
+	l.Log(slog.LevelWarn, msg, args...)
 }
 
-func Errorf(msg string, args ...any) {
-	Log(slog.LevelError, fmt.Sprintf(msg, args...))
-	errorCount.Add(1)
+func (l *Logger) Error(msg string, args ...any) {
+	l.Log(slog.LevelError, msg, args...)
+	if l != nil {
+		l.errorCount.Add(1)
+	}
+}
+
+func (l *Logger) Errorf(msg string, args ...any) {
+	l.Error(fmt.Sprintf(msg, args...))
+}
+
+// ExitCode gets the exit code of a command that has completed: ExitErrors if any
+// errors have been logged, or any warnings when FailOnWarn is set, otherwise ExitOK.
+func (l *Logger) ExitCode() int {
+	if l == nil {
+		return ExitOK
+	}
+	if l.errorCount.Load() > 0 || (l.FailOnWarn && l.warnCount.Load() > 0) {
+		return ExitErrors
+	}
+	return ExitOK
 }
 
-var Exit = func() {
-	os.Exit(int(errorCount.Load()))
+// Exit terminates the command with an exit code.
+var Exit = func(code int) {
+	os.Exit(code)
 }
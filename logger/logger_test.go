@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	log := Discard()
+
+	assert.Equal(t, ExitOK, log.ExitCode())
+
+	log.FailOnWarn = true
+	log.Report("report")
+	assert.Equal(t, ExitOK, log.ExitCode(), "reports are not warnings")
+
+	log.FailOnWarn = false
+	log.Warn("warning")
+	assert.Equal(t, ExitOK, log.ExitCode())
+
+	log.FailOnWarn = true
+	assert.Equal(t, ExitErrors, log.ExitCode())
+
+	log.FailOnWarn = false
+	log.Error("error")
+	assert.Equal(t, ExitErrors, log.ExitCode())
+}
+
+func TestExitCode_Separate(t *testing.T) {
+	a, b := Discard(), Discard()
+
+	a.Error("error")
+	assert.Equal(t, ExitErrors, a.ExitCode())
+	assert.Equal(t, ExitOK, b.ExitCode())
+}
+
+func TestNilLogger(t *testing.T) {
+	var log *Logger
+	log.Warn("warning")
+	log.Error("error")
+	assert.Equal(t, ExitOK, log.ExitCode())
+	assert.NotNil(t, log.Slog())
+}
@@ -1,29 +1,50 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"maps"
+	"net"
 	"net/http"
 	urlpkg "net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/cornelk/goscrape/blocklist"
+	"github.com/cornelk/goscrape/bookmarklet"
 	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/corpus"
+	"github.com/cornelk/goscrape/crawllog"
+	"github.com/cornelk/goscrape/dashboard"
 	"github.com/cornelk/goscrape/db"
 	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/download/cassette"
 	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/filter"
 	"github.com/cornelk/goscrape/images"
 	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/manifest"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/mirror"
+	"github.com/cornelk/goscrape/pipeline"
 	"github.com/cornelk/goscrape/scraper"
 	"github.com/cornelk/goscrape/server"
+	"github.com/cornelk/goscrape/stats"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/watch"
+	"github.com/cornelk/goscrape/work"
 	"github.com/rickb777/servefiles/v3"
 	"github.com/spf13/afero"
 )
@@ -34,6 +55,9 @@ var (
 	date    = ""
 )
 
+// dash shows the progress of the scrape when -dashboard is given; otherwise it is nil.
+var dash *dashboard.Dashboard
+
 type Strings []string
 
 // String is an implementation of the flag.Value interface
@@ -52,61 +76,310 @@ func (i *Strings) Set(value string) error {
 type Arguments struct {
 	URLs []*urlpkg.URL
 
-	Include   Strings
-	Exclude   Strings
-	Directory string
-
-	Concurrency  int
-	Depth        int
-	ImageQuality int
-	Timeout      time.Duration
-	LoopDelay    time.Duration
-	LaxAge       time.Duration
-	Tries        int
+	Include       Strings
+	Refresh       string
+	Refetch       bool
+	Exclude       Strings
+	ExcludeFile   string
+	IncludeTypes  Strings
+	ExcludeTypes  Strings
+	FetchIf       string
+	FollowIf      string
+	StoreIf       string
+	Plugins       Strings
+	PageExt       Strings
+	Directory     string
+	Staging       bool
+	Snapshots     bool
+	Git           bool
+	SaveHeaders   bool
+	SaveDiffs     bool
+	Fsync         string
+	FsyncInterval time.Duration
+	WriteBehind   int
+	Rsync         bool
+	Manifest      bool
+	Verify        bool
+	CheckLinks    bool
+	GC            bool
+	DryRun        bool
+	CheckConfig   bool
+	Text          string
+
+	LinkDuplicates string
+	Zip            string
+	Sitemap        string
+	Listing        bool
+	Checksums      string
+	Torrent        string
+	TorrentTracker Strings
+	TorrentWebSeed Strings
+	IPFS           string
+	Fingerprints   string
+	Republish      string
+	RepublishBase  string
+
+	Concurrency        int
+	HostConcurrency    int
+	ProcessConcurrency int
+	ProcessQueue       int
+	Segments           int
+	SegmentSize        int
+	Depth              int
+	AssetDepth         int
+	MaxURLLength       int
+	MaxQueryParams     int
+	ImageQuality       int
+	ImageWorkers       int
+	ImageMemory        int
+	Timeout            time.Duration
+	ProcessTimeout     time.Duration
+	LoopDelay          time.Duration
+	MinDelay           time.Duration
+	MaxDelay           time.Duration
+	CrawlDelay         bool
+	LaxAge             time.Duration
+	Tries              int
+	MaxAttempts        int
+	RetryAtEnd         bool
+	MaxErrors          int
+	MaxErrorRate       float64
+	Maintenance        time.Duration
+	MaxMaintenance     time.Duration
+
+	RespectCacheControl bool
+
+	MaxRedirects      int
+	SameHostRedirects bool
+	FixedStartURL     bool
+	UpgradeHTTPS      bool
+	SameScheme        bool
+
+	Pagination Strings
+	SeedFile   string
+	FollowNext bool
+	Forms      bool
+	FormValues Strings
+	Robots     bool
+	SkipRels   bool
+	Alternates string
+	Prune      Strings
+	Inject     string
+	InjectAt   string
+
+	ExternalLinks string
+
+	MaxHTMLSize   int
+	ScanLargeHTML bool
 
 	Serve      bool
 	ServerPort int
 
+	Watch       time.Duration
+	Capture     string
+	Bookmarklet string
+	Stdin       bool
+	ListURLs    string
+	Threshold   float64
+	Webhook     string
+	OnChange    string
+
 	CookieFile     string
 	SaveCookieFile string
 
-	Headers   Strings
-	Proxy     string
-	User      string
-	UserAgent string
-
-	Verbose bool
-	Debug   bool
+	RecordFile string
+	ReplayFile string
+	StatsFile  string
+	QueueFile  string
+	CrawlLog   string
+	Dashboard  bool
+	Blocklist  string
+	Trace      bool
+
+	Headers    Strings
+	URLHeaders Strings
+	URLCookies Strings
+	Accept     Strings
+	Proxy      string
+	User       string
+	UserAgent  string
+	Wayback    string
+	Origin     string
+	SmallWeb   bool
+
+	CredentialHosts    Strings
+	AnyHostCredentials bool
+	HostUsers          Strings
+
+	Login           string
+	LoginValues     Strings
+	SessionURL      string
+	SessionStatus   int
+	SessionContains string
+	SessionInterval time.Duration
+
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	TLSSessionCache     int
+	CertPins            Strings
+	ConnectTo           Strings
+
+	Verbose    bool
+	Debug      bool
+	FailOnWarn bool
 }
 
 func declareFlags() Arguments {
 	var arguments Arguments
 
+	flag.StringVar(&arguments.Refresh, "refresh", "", "re-crawl only the pages under this `URL prefix` within the existing mirror in -dir, along with their assets, instead of the URLs given")
+	flag.BoolVar(&arguments.Refetch, "refetch", false, "download the URLs given again into the existing mirror in -dir, unconditionally, along with their assets, without following their links to other pages")
 	flag.Var(&arguments.Include, "i", "only include URLs that match a `regular expression` (can be repeated)")
 	flag.Var(&arguments.Exclude, "x", "exclude URLs that match a `regular expression` (can be repeated)")
+	flag.StringVar(&arguments.ExcludeFile, "excludefile", "", "`file` of wget or rsync style glob patterns, one per line, e.g. *.iso or /cgi-bin/; URLs whose paths match are excluded as for -x")
+	flag.Var(&arguments.IncludeTypes, "includetypes", "only download assets of these `types`: media types (e.g. image/*), extensions (e.g. .pdf) or groups: images, fonts, video, audio, archives (comma separated; can be repeated)")
+	flag.Var(&arguments.ExcludeTypes, "excludetypes", "don't download assets of these `types`, as for -includetypes")
+	flag.StringVar(&arguments.FetchIf, "fetchif", "", "only fetch URLs for which an `expression` is true, e.g. 'depth < 3 && path.startsWith(\"/docs/\")'; see the README for its variables")
+	flag.StringVar(&arguments.FollowIf, "followif", "", "only follow the links in fetched pages for which an `expression` is true, as for -fetchif")
+	flag.StringVar(&arguments.StoreIf, "storeif", "", "only store fetched files for which an `expression` is true, as for -fetchif")
+	flag.Var(&arguments.PageExt, "pageext", "\".from=.to\" stores the pages whose URLs have the extension .from (e.g. .php) in files with the extension .to (e.g. .html), rewriting the links to them (can be repeated)")
+	flag.Var(&arguments.Plugins, "plugin", "load a Go plugin `file` that provides URL filters, page post-processors or middleware (can be repeated)")
 	flag.StringVar(&arguments.Directory, "dir", "", "`directory` to write files to and to serve files from")
+	flag.BoolVar(&arguments.Staging, "staging", false, "write into a staging directory next to -dir, which replaces -dir only when the scrape succeeds")
+	flag.BoolVar(&arguments.Snapshots, "snapshots", false, "write each scrape into a new dated snapshot directory within -dir, sharing unchanged files with the previous snapshot")
+	flag.BoolVar(&arguments.Git, "git", false, "commit the changes made by each scrape into a git repository in -dir")
+	flag.BoolVar(&arguments.SaveHeaders, "saveheaders", false, "write the response headers of each file into a sidecar .headers.json file")
+	flag.BoolVar(&arguments.SaveDiffs, "savediffs", false, "when a page changes, write the changes to its text into a sidecar .diff file")
+	flag.StringVar(&arguments.Fsync, "fsync", config.FsyncNone, "when written files are flushed to disk: 'none' leaves this to the operating system, 'file' flushes each file, 'periodic' flushes recent files together every -fsyncinterval")
+	flag.DurationVar(&arguments.FsyncInterval, "fsyncinterval", config.DefaultFsyncInterval, "the interval (with units, e.g. 1s) between flushes for -fsync periodic")
+	flag.IntVar(&arguments.WriteBehind, "writebehind", 0, "the number of files that may be queued to be written in the background (default none: files are written as they are downloaded)")
+	flag.BoolVar(&arguments.Rsync, "rsync", false, "keep -dir stable for replicating it with rsync: files are dated by their Last-Modified time wherever it is known, including recoded images and -saveheaders sidecars, and the sidecars omit headers that change on every fetch")
+	flag.BoolVar(&arguments.Manifest, "manifest", false, "record the SHA-256 hash of every stored file in "+manifest.FileName+", and the metadata of every page in "+manifest.PagesFileName+", in -dir")
+	flag.StringVar(&arguments.Text, "text", "", "export the plain text of every stored page, without its markup or boilerplate: 'tree' writes a text file for each page within "+corpus.TreeDir+" in -dir, 'jsonl' writes a JSON object for each page into "+corpus.FileName+" in -dir")
+	flag.StringVar(&arguments.LinkDuplicates, "linkduplicates", "", "after scraping, replace the files that have identical content (e.g. under two hosts) with 'hard' links or 'symlink' symbolic links to one copy; requires -manifest")
+	flag.StringVar(&arguments.Fingerprints, "fingerprints", "", "after scraping, 'report' the fingerprinted assets in -dir that have several versions (e.g. app.a1b2c3.js and app.d4e5f6.js), or also 'collect' the versions that no stored page refers to any more")
+	flag.StringVar(&arguments.Zip, "zip", "", "after scraping, also write the files in -dir into this zip archive, which is safe to extract on any operating system: characters in file names that Windows forbids, such as : and ?, are percent-encoded")
+	flag.StringVar(&arguments.Sitemap, "sitemap", "", "after scraping, write "+mirror.SitemapFileName+" in -dir, listing the stored pages as they will be found when -dir is republished at this `URL`")
+	flag.StringVar(&arguments.Checksums, "checksums", "", "after scraping, write the SHA-256 hashes of the stored files into "+mirror.ChecksumsFileName+" for verifying with sha256sum -c: 'top' writes one file in -dir, 'dir' writes one in each directory")
+	flag.StringVar(&arguments.Torrent, "torrent", "", "after scraping, write a BitTorrent metainfo `file` for sharing the files in -dir")
+	flag.Var(&arguments.TorrentTracker, "torrenttracker", "with -torrent, the announce `URL` of a tracker (can be repeated; the first is preferred; default none, for trackerless DHT peers)")
+	flag.Var(&arguments.TorrentWebSeed, "torrentwebseed", "with -torrent, a `URL` at which -dir is also published, for downloading from the web when there are no peers (can be repeated)")
+	flag.StringVar(&arguments.IPFS, "ipfs", "", "after scraping, add the files in -dir to the IPFS node with this API `URL` (e.g. http://127.0.0.1:5001), pin them and print the CID")
+	flag.BoolVar(&arguments.Listing, "listing", false, "after scraping, write "+mirror.ListingFileName+" in -dir, listing and linking to all the stored files")
+	flag.StringVar(&arguments.Republish, "republish", "", "copy the mirror in -dir into this new `directory`, with the links in its pages rewritten for hosting elsewhere, instead of scraping")
+	flag.StringVar(&arguments.RepublishBase, "republishbase", "", "with -republish, make the links to mirrored files absolute for hosting the copy at this `URL`; otherwise they are all made relative")
+	flag.BoolVar(&arguments.CheckConfig, "checkconfig", false, "check the options, URLs and output directory, writing any problems as JSON, instead of scraping")
+	flag.BoolVar(&arguments.Verify, "verify", false, "check the files in -dir against "+manifest.FileName+" instead of scraping")
+	flag.BoolVar(&arguments.CheckLinks, "checklinks", false, "check that every local reference in the pages and stylesheets in -dir leads to a stored file, instead of scraping")
+	flag.BoolVar(&arguments.GC, "gc", false, "remove the files in -dir that are neither in "+manifest.FileName+" nor referred to by the stored pages and stylesheets that are, instead of scraping")
+	flag.BoolVar(&arguments.DryRun, "dryrun", false, "with -gc, only list the files that would be removed")
 
 	flag.IntVar(&arguments.Concurrency, "concurrency", 1, "the number of concurrent downloads")
+	flag.IntVar(&arguments.HostConcurrency, "hostconcurrency", 0, "the number of concurrent downloads from any one host (default no extra limit)")
+	flag.IntVar(&arguments.ProcessConcurrency, "processconcurrency", 0, "the number of concurrent workers that parse and rewrite pages, stylesheets and images, separately from the downloads (default none: the downloads do this work)")
+	flag.IntVar(&arguments.ProcessQueue, "processqueue", 0, "the number of downloaded files that may wait for the -processconcurrency workers (default twice their number)")
+	flag.IntVar(&arguments.Segments, "segments", 0, "the number of parallel ranged requests used to download each large file, where the server supports them (default a single request)")
+	flag.IntVar(&arguments.SegmentSize, "segmentsize", 64, "the size in MiB from which files are downloaded in -segments")
 	flag.IntVar(&arguments.Depth, "depth", 0, "download depth limit (default unlimited)")
+	flag.IntVar(&arguments.AssetDepth, "assetdepth", 0, "download depth limit for assets such as images and stylesheets (default two more than -depth)")
+	flag.IntVar(&arguments.MaxURLLength, "maxurllength", 0, "the longest URL that is downloaded; longer URLs are reported as rejected (default unlimited)")
+	flag.IntVar(&arguments.MaxQueryParams, "maxqueryparams", 0, "the most query parameters in a URL that is downloaded; URLs with more are reported as rejected (default unlimited)")
 	flag.IntVar(&arguments.ImageQuality, "imagequality", 0, "image quality reduction, minimum 1 to maximum 99 (re-encoding disabled by default)")
+	flag.IntVar(&arguments.ImageWorkers, "imageworkers", 0, "the number of images re-encoded at once (default the number of CPUs)")
+	flag.IntVar(&arguments.ImageMemory, "imagememory", images.DefaultMemory>>20, "limit in MiB on the memory used by images being re-encoded; larger images are not re-encoded")
 	flag.DurationVar(&arguments.Timeout, "timeout", 0, "time limit (with units, e.g. 1s) for each HTTP request to connect and read the response")
+	flag.DurationVar(&arguments.ProcessTimeout, "processtimeout", 0, "time limit (with units, e.g. 1m) to fetch, parse, rewrite and store each URL; URLs that take longer are reported and skipped")
 	flag.DurationVar(&arguments.LoopDelay, "loopdelay", 0, "delay (with units, e.g. 1s) used between any two downloads")
+	flag.DurationVar(&arguments.MinDelay, "mindelay", 0, "lowest adaptive delay (with units, e.g. 1s) between downloads; requires -maxdelay")
+	flag.DurationVar(&arguments.MaxDelay, "maxdelay", 0, "highest adaptive delay (with units, e.g. 1s) between downloads; the delay adapts to the server's latency and error rate (disabled by default)")
+	flag.BoolVar(&arguments.CrawlDelay, "crawldelay", false, "read the website's robots.txt and wait at least its Crawl-delay between downloads; the delay in effect is logged and reported in the statistics")
 	flag.DurationVar(&arguments.LaxAge, "laxage", 0, "adds to the 'expires' timestamp specified by the origin server, or creates one if absent; if the origin is too conservative, this helps when doing successive runs; a negative value causes revalidation instead")
+	flag.BoolVar(&arguments.RespectCacheControl, "respectcachecontrol", false, "take the lifetime of the files from the Cache-Control max-age given by the origin server, as well as the 'expires' timestamp, so that successive runs skip the files that are still fresh")
 	flag.IntVar(&arguments.Tries, "tries", 1, "the number of tries to download each file if the server gives a 5xx error")
+	flag.IntVar(&arguments.MaxAttempts, "maxattempts", config.DefaultMaxAttempts, "the number of times each file is attempted, being requeued after 429 or persistent 5xx errors")
+	flag.BoolVar(&arguments.RetryAtEnd, "retryatend", false, "attempt the requeued files again only in a final pass, once the rest of the scrape has finished, rather than straight away")
+	flag.IntVar(&arguments.MaxErrors, "maxerrors", 0, "abort the scrape once more than this number of files have failed with error responses other than 404 and 410 (default unlimited)")
+	flag.Float64Var(&arguments.MaxErrorRate, "maxerrorrate", 0, "abort the scrape once more than this fraction (e.g. 0.5) of the last 100 files have failed with error responses other than 404 and 410 (default unlimited)")
+	flag.DurationVar(&arguments.Maintenance, "maintenance", config.DefaultMaintenance, "the shortest Retry-After of a 503 response that is taken as a maintenance window: the website is left alone until it ends, even in later runs, without using up attempts; negative to disable")
+	flag.DurationVar(&arguments.MaxMaintenance, "maxmaintenance", config.DefaultMaxMaintenance, "the longest maintenance window that is waited out; a later Retry-After is cut short, and each file waits out at most -maxattempts windows before they use up its attempts")
+
+	flag.IntVar(&arguments.MaxRedirects, "maxredirects", config.DefaultMaxRedirects, "the maximum number of redirects followed for each request; 0 follows none")
+	flag.BoolVar(&arguments.SameHostRedirects, "samehostredirects", false, "don't follow redirects that lead to a different host")
+	flag.BoolVar(&arguments.FixedStartURL, "fixedstart", false, "don't use the redirected start page as the new start URL")
+	flag.BoolVar(&arguments.UpgradeHTTPS, "https", false, "use https:// instead of an http:// start URL when the website supports it (this is always tried when the start URL has no scheme)")
+	flag.BoolVar(&arguments.SameScheme, "samescheme", false, "treat http:// and https:// links to the start host as the same site, fetching them all using the scheme of the start URL")
+
+	flag.Var(&arguments.Pagination, "paginate", "URL `pattern` such as \"/page/{1..200}\" listing pages to fetch regardless of depth (can be repeated)")
+	flag.StringVar(&arguments.SeedFile, "seeds", "", "`file` listing further URLs to fetch regardless of depth, one per line, e.g. exported from analytics; lines starting with # are ignored")
+	flag.BoolVar(&arguments.FollowNext, "next", false, "follow rel=next/prev links and Link headers at the same depth, so that whole series of pages are fetched")
+	flag.BoolVar(&arguments.Forms, "forms", false, "follow the URLs from submitting simple GET forms with each of their choices")
+	flag.Var(&arguments.FormValues, "formvalue", "\"name=value\" to submit in forms; repeating a name gives separate submissions")
+	flag.BoolVar(&arguments.Robots, "robots", false, "honour robots meta tags and X-Robots-Tag headers: don't store noindex pages and don't follow the links of nofollow pages")
+	flag.BoolVar(&arguments.SkipRels, "skipnofollow", false, "don't follow links marked rel=nofollow, ugc or sponsored, such as login links and comment spam")
+	flag.StringVar(&arguments.Alternates, "alternates", config.AlternatesInclude, "treatment of AMP and mobile alternate pages: 'include' follows them like other links, 'skip' doesn't follow them, 'prefer' follows them at the same depth as their pages")
+	flag.Var(&arguments.Prune, "prune", "remove the elements that match a CSS `selector` (e.g. \"#cookie-banner, .ad, img[width=\"1\"]\") from stored pages (can be repeated)")
+	flag.StringVar(&arguments.Inject, "inject", "", "HTML `snippet` inserted into stored pages, e.g. a banner; {url} and {date} are replaced by the page's URL and download date; @file reads the snippet from a file")
+	flag.StringVar(&arguments.InjectAt, "injectat", config.InjectTop, "where the -inject snippet is inserted: 'top' or 'bottom' of the body, or the end of the 'head'")
+	flag.StringVar(&arguments.ExternalLinks, "externallinks", config.ExternalLinksKeep, "treatment of links to other websites in stored pages: 'keep' leaves them unchanged, 'annotate' opens them in a new window with a title showing where they lead, 'stub' also routes them through a local page warning that they leave the archive")
+
+	flag.IntVar(&arguments.MaxHTMLSize, "maxhtmlsize", 32, "limit in MiB on the size of pages that are parsed; larger pages are stored verbatim and their links are not followed, 0 for unlimited")
+	flag.BoolVar(&arguments.ScanLargeHTML, "scanlargehtml", false, "find the links in pages that are too large or too deeply nested to parse, using a lightweight scan; they are still stored verbatim")
 
 	flag.BoolVar(&arguments.Serve, "serve", false, "serve the website using a webserver; scraping will only happen on demand")
 	flag.IntVar(&arguments.ServerPort, "port", 8080, "port to use for the webserver")
 
+	flag.DurationVar(&arguments.Watch, "watch", 0, "watch the URLs for changes, checking them at this `interval` (with units, e.g. 1h); links are not followed")
+	flag.StringVar(&arguments.Capture, "capture", "", "run a reverse proxy for the website on this listen `address` (e.g. localhost:8000) and store the pages browsed through it; links are not followed")
+	flag.StringVar(&arguments.Bookmarklet, "bookmarklet", "", "serve a bookmarklet on this listen `address` (e.g. localhost:8001) that archives the page being viewed in the browser: it is added to the scrape in progress if it belongs there, otherwise the page and its assets are captured")
+	flag.BoolVar(&arguments.Stdin, "stdin", false, "read URLs from stdin, one per line, and write a JSON result for each to stdout; links are not followed but are listed in the results")
+	flag.StringVar(&arguments.ListURLs, "listurls", "", "crawl the pages without storing any files and write the URLs found to stdout, in 'json' or 'csv' `format`; assets are listed but not fetched")
+	flag.Float64Var(&arguments.Threshold, "threshold", 0, "when watching, the proportion of text (from 0 to 1) that must change to give a notification; 0 for any change")
+	flag.StringVar(&arguments.Webhook, "webhook", "", "when watching, `URL` to which each change is posted as JSON")
+	flag.StringVar(&arguments.OnChange, "onchange", "", "when watching, `command` to run for each change; GOSCRAPE_URL, GOSCRAPE_FILE etc describe the change")
+
 	flag.StringVar(&arguments.CookieFile, "cookies", "", "file containing the cookie content")
 	flag.StringVar(&arguments.SaveCookieFile, "savecookiefile", "", "file to save the cookie content")
 
+	flag.StringVar(&arguments.RecordFile, "record", "", "cassette `file` in which to record all HTTP responses")
+	flag.StringVar(&arguments.ReplayFile, "replay", "", "cassette `file` from which to replay HTTP responses instead of using the network")
+	flag.StringVar(&arguments.StatsFile, "stats", "", "JSON `file` in which to write the crawl statistics")
+	flag.StringVar(&arguments.Blocklist, "blocklist", "", "`file` listing the hosts (e.g. ads.example.net or *.example.net) and URL prefixes (e.g. example.org/calendar/) not to download from, one per line; it is reloaded whenever it changes")
+	flag.StringVar(&arguments.CrawlLog, "crawllog", "", "JSON lines `file` in which to write a record of every fetch, or - for stdout")
+	flag.BoolVar(&arguments.Dashboard, "dashboard", false, "show a full-screen dashboard of the scrape, with keys to pause, skip the current host, change the speed or quit")
+	flag.StringVar(&arguments.QueueFile, "queuefile", "", "JSON `file` in which to write a snapshot of the pending queue and the URLs seen so far, whenever SIGUSR1 is received")
+	flag.BoolVar(&arguments.Trace, "trace", false, "export OpenTelemetry traces via OTLP/HTTP (also enabled by OTEL_EXPORTER_OTLP_ENDPOINT)")
+
 	flag.Var(&arguments.Headers, "H", "\"name:value\" HTTP header to use for scraping (can be repeated)")
+	flag.Var(&arguments.URLHeaders, "urlheader", "\"pattern name:value\" HTTP header sent only for URLs matching the glob pattern, e.g. \"/api/* Authorization:Bearer xyz\"; patterns not starting with / start with a host name (can be repeated)")
+	flag.Var(&arguments.URLCookies, "urlcookie", "\"pattern name=value\" cookie sent only for URLs matching the glob pattern, as for -urlheader (can be repeated)")
+	flag.Var(&arguments.Accept, "accept", "\"types: value\" Accept header sent for URLs of the types, which are pages, * or as for -includetypes, e.g. \"images: image/png, image/webp;q=0\" (can be repeated; the first matching rule applies)")
 	flag.StringVar(&arguments.Proxy, "proxy", "", "HTTP proxy to use for scraping")
-	flag.StringVar(&arguments.User, "user", "", "user[:password] to use for HTTP authentication")
+	flag.StringVar(&arguments.User, "user", "", "user[:password] to use for HTTP Basic or Digest authentication, as each server requires")
 	flag.StringVar(&arguments.UserAgent, "useragent", "", "user agent to use for scraping")
+	flag.StringVar(&arguments.Origin, "origin", "", "with a file:// start URL, the `URL` of the website that the local tree was exported from: links to it lead within the tree, and the assets missing from it are fetched from there")
+	flag.BoolVar(&arguments.SmallWeb, "smallweb", false, "also archive gemini:// and gopher:// URLs, rendering gemtext pages and Gopher menus as HTML (experimental)")
+	flag.StringVar(&arguments.Wayback, "wayback", "", "fetch the Wayback Machine captures nearest to the `timestamp` (YYYYMMDDhhmmss or a prefix, e.g. 2019) instead of the live website")
+
+	flag.Var(&arguments.CredentialHosts, "credentialhost", "`host` (e.g. api.example.org or *.example.org) that is sent the -user and -H headers, besides the start host (can be repeated)")
+	flag.BoolVar(&arguments.AnyHostCredentials, "anyhostcredentials", false, "send the -user and -H headers to every host, including third parties such as CDNs")
+	flag.Var(&arguments.HostUsers, "hostuser", "\"host user[:password]\" for authenticating with a host (e.g. assets.example.net or *.example.net) using its own credentials instead of -user (can be repeated)")
+
+	flag.StringVar(&arguments.Login, "login", "", "`URL` (may be relative to the start URL) to which the -loginvalue fields are posted before scraping, and again whenever the -sessionurl check fails")
+	flag.Var(&arguments.LoginValues, "loginvalue", "\"name=value\" field of the login form (can be repeated)")
+	flag.StringVar(&arguments.SessionURL, "sessionurl", "", "`URL` (may be relative to the start URL) fetched every -sessioninterval to check that the login session is still valid")
+	flag.IntVar(&arguments.SessionStatus, "sessionstatus", http.StatusOK, "the status of the -sessionurl response when the session is valid")
+	flag.StringVar(&arguments.SessionContains, "sessioncontains", "", "`text` in the -sessionurl response when the session is valid")
+	flag.DurationVar(&arguments.SessionInterval, "sessioninterval", config.DefaultSessionInterval, "the interval (with units, e.g. 30s) between session checks")
+
+	flag.IntVar(&arguments.MaxIdleConnsPerHost, "maxidleconnsperhost", 0, "the number of idle connections kept for reuse with each host (default the concurrency, but at least 2)")
+	flag.DurationVar(&arguments.IdleConnTimeout, "idleconntimeout", 0, "how long (with units, e.g. 30s) idle connections are kept for reuse (default 90s)")
+	flag.IntVar(&arguments.TLSSessionCache, "tlssessioncache", config.DefaultTLSSessionCache, "the number of TLS sessions cached for resumption, which avoids repeating full handshakes; a negative number disables resumption")
+	flag.Var(&arguments.ConnectTo, "connectto", "\"host address\" connect to address (host:port, or unix:/path for a Unix domain socket) for the URLs of host (or host:port), e.g. to reach an application in a container; the URLs and Host header are unchanged (can be repeated)")
+	flag.Var(&arguments.CertPins, "pincert", "\"host fingerprint\" the SHA-256 fingerprint of the certificate that a host (e.g. intranet.example.org or *.example.org) must present, as printed by openssl x509 -fingerprint -sha256; the scrape stops if it presents any other (can be repeated)")
 
 	flag.BoolVar(&arguments.Verbose, "v", false, "verbose output")
 	flag.BoolVar(&arguments.Debug, "z", false, "debug output")
+	flag.BoolVar(&arguments.FailOnWarn, "failonwarn", false, "exit with status 1 if any warnings were logged, e.g. for files that could not be downloaded, as well as errors")
 
 	flag.Parse()
 
@@ -125,28 +398,61 @@ func declareFlags() Arguments {
 func main() {
 	args := declareFlags()
 
-	createLogger(args)
+	if args.Dashboard {
+		dash = dashboard.New(os.Stdout)
+	}
+
+	log := createLogger(args)
+
+	if args.CheckConfig {
+		logger.Exit(checkConfig(os.Stdout, args, flag.Args(), log))
+	}
 
 	var err error
 	args.URLs, err = parseAll(flag.Args())
 	if err != nil {
-		logger.Errorf("Invalid URL: %s\n", err)
-		logger.Exit()
+		log.Errorf("Invalid URL: %s\n", err)
+		logger.Exit(logger.ExitConfig)
+	}
+
+	if args.Refresh != "" {
+		if len(args.URLs) > 0 || args.SeedFile != "" {
+			log.Errorf("-refresh cannot be combined with URLs to scrape\n")
+			logger.Exit(logger.ExitConfig)
+		}
+		if args.URLs, err = parseAll([]string{args.Refresh}); err != nil {
+			log.Errorf("Invalid URL: %s\n", err)
+			logger.Exit(logger.ExitConfig)
+		}
 	}
 
 	ctx := context.Background()
 	//ctx := app.Context() // provides signal handler cancellation
 
-	if !args.Serve && len(args.URLs) == 0 {
-		logger.Errorf("Must provide -serve or URLs to scrape\n")
+	if !args.Serve && !args.Verify && !args.CheckLinks && !args.GC && args.Republish == "" && !args.Stdin && args.Bookmarklet == "" && len(args.URLs) == 0 && args.SeedFile == "" {
+		log.Errorf("Must provide -serve or URLs to scrape\n")
 		flag.Usage()
-		logger.Exit()
+		logger.Exit(logger.ExitConfig)
 	}
 
 	cfg, err := buildConfig(args)
 	if err != nil {
-		logger.Errorf("Config error: %s\n", err)
-		logger.Exit()
+		log.Errorf("Config error: %s\n", err)
+		logger.Exit(logger.ExitConfig)
+	}
+
+	if len(args.URLs) == 0 && len(cfg.Seeds) > 0 {
+		// the first seed becomes the start URL
+		if args.URLs, err = parseAll(cfg.Seeds[:1]); err != nil {
+			log.Errorf("Invalid URL: %s\n", err)
+			logger.Exit(logger.ExitConfig)
+		}
+	}
+
+	shutdownTracing, err := startTracing(ctx, args.Trace)
+	if err != nil {
+		log.Errorf("Tracing error: %s\n", err)
+		logger.Exit(logger.ExitConfig)
 	}
 
 	fs := afero.NewOsFs()
@@ -155,17 +461,110 @@ func main() {
 		db.DeleteFile(fs) // get rid of stale cache
 	}
 
-	if len(args.URLs) > 0 {
-		if err := scrapeURLs(ctx, fs, *cfg, args.SaveCookieFile, args.Serve, int16(args.ServerPort), args.URLs); err != nil {
-			logger.Errorf("Scraping execution error: %s\n", err)
+	ctx, stopDashboard := dash.Start(ctx, os.Stdin)
+	exit := logger.Exit
+	logger.Exit = func(code int) {
+		stopDashboard() // restores the terminal
+		exit(code)
+	}
+
+	bookmarks, stopBookmarklet, err := startBookmarklet(ctx, fs, *cfg, args.Bookmarklet, log)
+	if err != nil {
+		log.Errorf("Bookmarklet error: %s\n", err)
+		logger.Exit(logger.ExitConfig)
+	}
+
+	var failed bool // the command did not complete
+	if args.Verify {
+		if err := verifyManifest(fs, cfg.Directory, log); err != nil {
+			log.Errorf("Verification error: %s\n", err)
+			failed = true
+		}
+
+	} else if args.CheckLinks {
+		if err := checkLinks(cfg.Directory, log); err != nil {
+			log.Errorf("Link check error: %s\n", err)
+			failed = true
+		}
+
+	} else if args.GC {
+		if err := collectOrphans(fs, cfg.Directory, args.DryRun, log); err != nil {
+			log.Errorf("Garbage collection error: %s\n", err)
+			failed = true
+		}
+
+	} else if args.Republish != "" {
+		if err := republish(cfg.Directory, args, log); err != nil {
+			log.Errorf("Republishing error: %s\n", err)
+			failed = true
+		}
+
+	} else if args.Stdin {
+		if err := pipelineURLs(ctx, fs, *cfg, log); err != nil {
+			log.Errorf("Pipeline execution error: %s\n", err)
+			failed = true
+		}
+
+	} else if len(args.URLs) > 0 && args.Capture != "" {
+		if err := captureURLs(ctx, fs, *cfg, args, log); err != nil {
+			log.Errorf("Capture execution error: %s\n", err)
+			failed = true
+		}
+
+	} else if len(args.URLs) > 0 && args.ListURLs != "" {
+		if err := listURLs(ctx, *cfg, args, log); err != nil {
+			log.Errorf("Listing execution error: %s\n", err)
+			failed = true
+		}
+
+	} else if len(args.URLs) > 0 && args.Watch > 0 {
+		if err := watchURLs(ctx, fs, *cfg, args, log); err != nil {
+			log.Errorf("Watching execution error: %s\n", err)
+			failed = true
+		}
+
+	} else if len(args.URLs) > 0 && args.Snapshots {
+		if err := scrapeSnapshot(ctx, fs, *cfg, args, bookmarks, log); err != nil {
+			log.Errorf("Scraping execution error: %s\n", err)
+			failed = true
+		}
+
+	} else if len(args.URLs) > 0 && args.Staging {
+		if err := scrapeStaged(ctx, fs, *cfg, args, bookmarks, log); err != nil {
+			log.Errorf("Scraping execution error: %s\n", err)
+			failed = true
+		} else {
+			commitToGit(ctx, cfg.Directory, args.Git, log)
+		}
+
+	} else if len(args.URLs) > 0 {
+		if err := scrapeURLs(ctx, fs, *cfg, args, args.URLs, bookmarks, log); err != nil {
+			log.Errorf("Scraping execution error: %s\n", err)
+			failed = true
+		} else {
+			commitToGit(ctx, cfg.Directory, args.Git, log)
 		}
 
 	} else if args.Serve {
-		if err := server.ServeDirectory(ctx, nil, cfg.Directory, int16(args.ServerPort)); err != nil {
-			logger.Errorf("Server execution error: %s\n", err)
+		if err := server.ServeDirectory(ctx, nil, cfg.Directory, int16(args.ServerPort), log); err != nil {
+			log.Errorf("Server execution error: %s\n", err)
+			failed = true
 		}
+
+	} else if args.Bookmarklet != "" {
+		awaitInterrupt(ctx)
+	}
+
+	stopBookmarklet()
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Tracing error: %s\n", err)
+	}
+
+	if failed {
+		logger.Exit(logger.ExitAborted)
 	}
-	logger.Exit()
+	logger.Exit(log.ExitCode())
 }
 
 func parseAll(urls []string) (list []*urlpkg.URL, err error) {
@@ -189,105 +588,1024 @@ func buildConfig(args Arguments) (*config.Config, error) {
 		}
 	}
 
+	hostCredentials, err := config.MakeHostCredentials(args.HostUsers)
+	if err != nil {
+		return nil, fmt.Errorf("-hostuser %w", err)
+	}
+
+	connectTo, err := config.MakeConnectRules(args.ConnectTo)
+	if err != nil {
+		return nil, fmt.Errorf("-connectto %w", err)
+	}
+
+	certPins, err := config.MakeCertPins(args.CertPins)
+	if err != nil {
+		return nil, fmt.Errorf("-pincert %w", err)
+	}
+
 	imageQuality := args.ImageQuality
 	if args.ImageQuality < 0 || args.ImageQuality >= 100 {
 		imageQuality = 0
 	}
 
+	if args.Staging && (args.Directory == "" || args.Serve) {
+		return nil, errors.New("-staging requires -dir and cannot be used with -serve")
+	}
+
+	if args.Snapshots && (args.Directory == "" || args.Serve || args.Staging || args.Git) {
+		return nil, errors.New("-snapshots requires -dir and cannot be used with -serve, -staging or -git")
+	}
+
+	if args.Git && args.Directory == "" {
+		return nil, errors.New("-git requires -dir")
+	}
+
+	pageExtensions := make(map[string]string, len(args.PageExt))
+	for _, s := range args.PageExt {
+		from, to, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("-pageext %q: must be \".from=.to\"", s)
+		}
+		pageExtensions[from] = to
+	}
+	if args.SmallWeb {
+		for _, ext := range []string{".gmi", ".gemini"} {
+			if _, exists := pageExtensions[ext]; !exists {
+				pageExtensions[ext] = ".html" // gemtext pages are rendered as HTML
+			}
+		}
+	}
+	if err := mapping.SetPageExtensions(pageExtensions); err != nil {
+		return nil, fmt.Errorf("-pageext: %w", err)
+	}
+
+	switch args.LinkDuplicates {
+	case "", mirror.LinkHard, mirror.LinkSymbolic:
+	default:
+		return nil, fmt.Errorf("-linkduplicates %q: must be hard or symlink", args.LinkDuplicates)
+	}
+
+	switch args.Checksums {
+	case "", mirror.ChecksumsTop, mirror.ChecksumsPerDirectory:
+	default:
+		return nil, fmt.Errorf("-checksums %q: must be top or dir", args.Checksums)
+	}
+
+	if args.Torrent == "" && (len(args.TorrentTracker) > 0 || len(args.TorrentWebSeed) > 0) {
+		return nil, errors.New("-torrenttracker and -torrentwebseed require -torrent")
+	}
+	for _, s := range append(slices.Clone(args.TorrentTracker), args.TorrentWebSeed...) {
+		if u, err := urlpkg.Parse(s); err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("-torrenttracker/-torrentwebseed %q: must be an absolute URL", s)
+		}
+	}
+
+	if args.IPFS != "" {
+		if u, err := urlpkg.Parse(args.IPFS); err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("-ipfs %q: must be an absolute URL", args.IPFS)
+		}
+	}
+
+	switch args.Fingerprints {
+	case "", mirror.FingerprintsReport, mirror.FingerprintsCollect:
+	default:
+		return nil, fmt.Errorf("-fingerprints %q: must be report or collect", args.Fingerprints)
+	}
+
+	if args.LinkDuplicates != "" && !args.Manifest {
+		return nil, errors.New("-linkduplicates requires -manifest")
+	}
+
+	var refresh string
+	if args.Refresh != "" {
+		u, err := urlpkg.Parse(args.Refresh)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("-refresh %q: must be an absolute URL", args.Refresh)
+		}
+		if !ioutil.FileExists(afero.NewOsFs(), filepath.Join(args.Directory, mapping.HostDir(u.Host))) {
+			return nil, fmt.Errorf("-refresh %q: there is no mirror of %s in %q", args.Refresh, u.Host, args.Directory)
+		}
+		refresh = u.String()
+	}
+
+	if args.Refetch {
+		if len(args.URLs) == 0 {
+			return nil, errors.New("-refetch requires URLs to download")
+		}
+		for _, u := range args.URLs {
+			if !ioutil.FileExists(afero.NewOsFs(), filepath.Join(args.Directory, mapping.HostDir(u.Host))) {
+				return nil, fmt.Errorf("-refetch %s: there is no mirror of %s in %q", u, u.Host, args.Directory)
+			}
+		}
+	}
+
+	if args.Dashboard && (args.Stdin || args.ListURLs != "" || args.CrawlLog == "-") {
+		return nil, errors.New("-dashboard cannot be used with -stdin, -listurls or -crawllog -")
+	}
+
+	if args.DryRun && !args.GC {
+		return nil, errors.New("-dryrun requires -gc")
+	}
+
+	if args.MinDelay > 0 {
+		if args.MaxDelay == 0 {
+			return nil, errors.New("-mindelay requires -maxdelay")
+		}
+		if args.MinDelay >= args.MaxDelay {
+			return nil, fmt.Errorf("-mindelay %s must be less than -maxdelay %s", args.MinDelay, args.MaxDelay)
+		}
+	}
+
+	if args.RepublishBase != "" {
+		if args.Republish == "" {
+			return nil, errors.New("-republishbase requires -republish")
+		}
+		if u, err := urlpkg.Parse(args.RepublishBase); err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("-republishbase %q: must be an absolute URL", args.RepublishBase)
+		}
+	}
+
+	if args.Bookmarklet != "" {
+		if _, _, err := net.SplitHostPort(args.Bookmarklet); err != nil {
+			return nil, fmt.Errorf("-bookmarklet %q: must be a listen address, e.g. localhost:8001", args.Bookmarklet)
+		}
+		if args.ListURLs != "" {
+			return nil, errors.New("-bookmarklet cannot be used with -listurls")
+		}
+	}
+
+	if args.Capture != "" {
+		if _, _, err := net.SplitHostPort(args.Capture); err != nil {
+			return nil, fmt.Errorf("-capture %q: must be a listen address, e.g. localhost:8000", args.Capture)
+		}
+		if len(args.URLs) != 1 || args.URLs[0].Scheme == "file" {
+			return nil, errors.New("-capture requires one http or https start URL")
+		}
+		if args.Serve || args.Watch > 0 || args.ListURLs != "" || args.Stdin {
+			return nil, errors.New("-capture cannot be used with -serve, -watch, -listurls or -stdin")
+		}
+	}
+
+	if args.Origin != "" {
+		u, err := urlpkg.Parse(args.Origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("-origin %q: must be the http or https URL of a website, without a path", args.Origin)
+		}
+		if len(args.URLs) == 0 || args.URLs[0].Scheme != "file" {
+			return nil, errors.New("-origin requires a file:// start URL")
+		}
+	}
+
+	if args.Sitemap != "" {
+		if u, err := urlpkg.Parse(args.Sitemap); err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("-sitemap %q: must be an absolute URL", args.Sitemap)
+		}
+	}
+
+	switch args.Fsync {
+	case "", config.FsyncNone, config.FsyncFile, config.FsyncPeriodic:
+	default:
+		return nil, fmt.Errorf("-fsync %q: must be none, file or periodic", args.Fsync)
+	}
+
+	if args.Segments < 0 || args.SegmentSize < 0 {
+		return nil, fmt.Errorf("-segments %d, -segmentsize %d: must not be negative", args.Segments, args.SegmentSize)
+	}
+
+	if args.MaxErrorRate < 0 || args.MaxErrorRate > 1 {
+		return nil, fmt.Errorf("-maxerrorrate %g: must be between 0 and 1", args.MaxErrorRate)
+	}
+
+	switch args.Alternates {
+	case "", config.AlternatesInclude, config.AlternatesSkip, config.AlternatesPrefer:
+	default:
+		return nil, fmt.Errorf("-alternates %q: must be include, skip or prefer", args.Alternates)
+	}
+
+	switch args.ListURLs {
+	case "", "json", "csv":
+	default:
+		return nil, fmt.Errorf("-listurls %q: must be json or csv", args.ListURLs)
+	}
+
+	switch args.Text {
+	case "", corpus.FormatTree, corpus.FormatJSONL:
+	default:
+		return nil, fmt.Errorf("-text %q: must be tree or jsonl", args.Text)
+	}
+
+	switch args.InjectAt {
+	case "", config.InjectTop, config.InjectBottom, config.InjectHead:
+	default:
+		return nil, fmt.Errorf("-injectat %q: must be top, bottom or head", args.InjectAt)
+	}
+
+	switch args.ExternalLinks {
+	case "", config.ExternalLinksKeep, config.ExternalLinksAnnotate, config.ExternalLinksStub:
+	default:
+		return nil, fmt.Errorf("-externallinks %q: must be keep, annotate or stub", args.ExternalLinks)
+	}
+
+	inject := args.Inject
+	if name, isFile := strings.CutPrefix(inject, "@"); isFile {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading -inject file: %w", err)
+		}
+		inject = string(b)
+	}
+
+	excludes, err := readExcludeFile(args.ExcludeFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading -excludefile: %w", err)
+	}
+
+	seeds, err := readSeedFile(args.SeedFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading -seeds file: %w", err)
+	}
+
 	cookies, err := readCookieFile(args.CookieFile)
 	if err != nil {
 		return nil, fmt.Errorf("reading cookie: %w", err)
 	}
 
+	maxRedirects := args.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = config.NoRedirects // zero in the config means the default
+	}
+
 	return &config.Config{
 		Includes: args.Include,
-		Excludes: args.Exclude,
-
-		Concurrency:  args.Concurrency,
-		MaxDepth:     args.Depth,
-		ImageQuality: images.ImageQuality(imageQuality),
-		Timeout:      args.Timeout,
-		LoopDelay:    args.LoopDelay,
-		LaxAge:       args.LaxAge,
-		Tries:        args.Tries,
-
-		Directory: args.Directory,
-		Username:  username,
-		Password:  password,
-
-		Cookies:   cookies,
-		Header:    config.MakeHeaders(args.Headers),
-		Proxy:     args.Proxy,
-		UserAgent: args.UserAgent,
+		Refresh:  refresh,
+		Refetch:  args.Refetch,
+		Excludes: slices.Concat(args.Exclude, excludes),
+
+		IncludeTypes: args.IncludeTypes,
+		ExcludeTypes: args.ExcludeTypes,
+
+		FetchIf:  args.FetchIf,
+		FollowIf: args.FollowIf,
+		StoreIf:  args.StoreIf,
+		Plugins:  args.Plugins,
+
+		Concurrency:        args.Concurrency,
+		HostConcurrency:    args.HostConcurrency,
+		ProcessConcurrency: args.ProcessConcurrency,
+		ProcessQueue:       args.ProcessQueue,
+		Segments:           args.Segments,
+		SegmentSize:        int64(args.SegmentSize) << 20,
+		MaxDepth:           args.Depth,
+		MaxAssetDepth:      args.AssetDepth,
+		MaxURLLength:       args.MaxURLLength,
+		MaxQueryParams:     args.MaxQueryParams,
+		ImageQuality:       images.ImageQuality(imageQuality),
+		ImageWorkers:       args.ImageWorkers,
+		ImageMemory:        int64(args.ImageMemory) << 20,
+		Timeout:            args.Timeout,
+		ProcessTimeout:     args.ProcessTimeout,
+		LoopDelay:          args.LoopDelay,
+		MinDelay:           args.MinDelay,
+		MaxDelay:           args.MaxDelay,
+		CrawlDelay:         args.CrawlDelay,
+		LaxAge:             args.LaxAge,
+		Tries:              args.Tries,
+		MaxAttempts:        args.MaxAttempts,
+		RetryAtEnd:         args.RetryAtEnd,
+		MaxErrors:          args.MaxErrors,
+		MaxErrorRate:       args.MaxErrorRate,
+		Maintenance:        args.Maintenance,
+		MaxMaintenance:     args.MaxMaintenance,
+
+		RespectCacheControl: args.RespectCacheControl,
+
+		MaxRedirects:      maxRedirects,
+		SameHostRedirects: args.SameHostRedirects,
+		FixedStartURL:     args.FixedStartURL,
+		UpgradeHTTPS:      args.UpgradeHTTPS,
+		SameScheme:        args.SameScheme,
+
+		Pagination: args.Pagination,
+		Seeds:      seeds,
+		FollowNext: args.FollowNext,
+		Forms:      args.Forms,
+		FormValues: config.MakeFormValues(args.FormValues),
+		Robots:     args.Robots,
+		SkipRels:   args.SkipRels,
+		Alternates: args.Alternates,
+		Prune:      args.Prune,
+		Inject:     inject,
+		InjectAt:   args.InjectAt,
+
+		ExternalLinks: args.ExternalLinks,
+		ListURLs:      args.ListURLs != "",
+
+		MaxHTMLSize:   int64(args.MaxHTMLSize) << 20,
+		ScanLargeHTML: args.ScanLargeHTML,
+
+		Directory:     args.Directory,
+		SaveHeaders:   args.SaveHeaders,
+		SaveDiffs:     args.SaveDiffs,
+		Fsync:         args.Fsync,
+		FsyncInterval: args.FsyncInterval,
+		WriteBehind:   args.WriteBehind,
+		Rsync:         args.Rsync,
+		Username:      username,
+		Password:      password,
+
+		Cookies:     cookies,
+		Header:      config.MakeHeaders(args.Headers),
+		HeaderRules: config.MakeHeaderRules(args.URLHeaders, args.URLCookies),
+		AcceptRules: config.MakeAcceptRules(args.Accept),
+		Proxy:       args.Proxy,
+		UserAgent:   args.UserAgent,
+		Wayback:     args.Wayback,
+		Origin:      args.Origin,
+		SmallWeb:    args.SmallWeb,
+
+		CredentialHosts:    args.CredentialHosts,
+		AnyHostCredentials: args.AnyHostCredentials,
+		HostCredentials:    hostCredentials,
+
+		LoginURL:        args.Login,
+		LoginValues:     config.MakeFormValues(args.LoginValues),
+		SessionURL:      args.SessionURL,
+		SessionStatus:   args.SessionStatus,
+		SessionContains: args.SessionContains,
+		SessionInterval: args.SessionInterval,
+
+		MaxIdleConnsPerHost: args.MaxIdleConnsPerHost,
+		IdleConnTimeout:     args.IdleConnTimeout,
+		TLSSessionCache:     args.TLSSessionCache,
+		CertPins:            certPins,
+		ConnectTo:           connectTo,
 	}, nil
 }
 
-func scrapeURLs(ctx context.Context, fs afero.Fs, cfg config.Config, saveCookieFile string, serve bool, serverPort int16, urls []*urlpkg.URL) error {
-	etagStore := db.Open()
+// scrapeURLs scrapes each of the URLs in turn. Pages submitted by the bookmarklet, if
+// bookmarks is not nil, are added to the scrape in progress.
+func scrapeURLs(ctx context.Context, fs afero.Fs, cfg config.Config, args Arguments, urls []*urlpkg.URL, bookmarks *bookmarklet.Server, log *logger.Logger) error {
+	etagStore := db.Open(log)
 	defer etagStore.Close()
 
+	recorder, replayer, err := openCassettes(args.RecordFile, args.ReplayFile, log)
+	if err != nil {
+		return err
+	}
+	defer recorder.Close()
+
 	var webServer *http.Server
 	var errChan chan error
+	var exhausted []work.Result
+	histogram := download.NewHistogram()
+	aggregator := stats.New()
+
+	var files *manifest.Manifest
+	if args.Manifest {
+		if files, err = manifest.Read(fs, cfg.Directory); err != nil {
+			return err
+		}
+	}
+
+	texts, err := corpus.New(fs, cfg.Directory, args.Text)
+	if err != nil {
+		return err
+	}
+	defer texts.Close()
+
+	crawlLog, closeCrawlLog, err := openCrawlLog(args.CrawlLog, log)
+	if err != nil {
+		return err
+	}
+	defer closeCrawlLog()
+
+	blocked, stopBlocklist, err := openBlocklist(ctx, args.Blocklist, log)
+	if err != nil {
+		return err
+	}
+	defer stopBlocklist()
 
 	for i, url := range urls {
-		sc, err := scraper.New(cfg, url, afero.NewBasePathFs(fs, cfg.Directory))
+		sc, err := scraper.New(cfg, url, afero.NewBasePathFs(fs, cfg.Directory), log)
 		if err != nil {
 			return fmt.Errorf("initializing scraper: %w", err)
 		}
 
 		sc.ETagsDB = etagStore
+		sc.Histogram = histogram
+		sc.Stats = aggregator
+		sc.Manifest = files
+		sc.Corpus = texts
+		sc.CrawlLog = crawlLog
+		sc.Blocklist = blocked
+
+		if replayer != nil {
+			sc.Client = replayer
+		}
+
+		if recorder != nil {
+			sc.Recorder = recorder.Record
+		}
 
-		if serve && i == 0 {
-			webServer, errChan, err = server.LaunchWebserver(sc, cfg.Directory, serverPort)
+		if args.Serve && i == 0 {
+			webServer, errChan, err = server.LaunchWebserver(sc, cfg.Directory, int16(args.ServerPort), log)
 			if err != nil {
 				return fmt.Errorf("launching webserver: %w", err)
 			}
 		}
 
-		logger.Info("Scraping", slog.String("url", sc.URL.String()))
-		if err = sc.Start(ctx); err != nil {
+		log.Info("Scraping", slog.String("url", sc.URL.String()))
+		dash.Watch(sc)
+		bookmarks.Watch(sc)
+		stopDumping := dumpQueueOnSignal(sc, args.QueueFile)
+		err = sc.Start(ctx)
+		stopDumping()
+		if err != nil {
 			if errors.Is(err, context.Canceled) {
-				logger.Exit()
+				logger.Exit(logger.ExitAborted)
+			}
+
+			if errors.Is(err, scraper.ErrSkipped) {
+				log.Warn("Skipped", slog.String("url", sc.URL.String()))
+				continue
+			}
+
+			if errors.Is(err, scraper.ErrErrorBudget) {
+				saveAbortedState(fs, cfg.Directory, args.QueueFile, sc, files)
 			}
 
 			return fmt.Errorf("scraping '%s': %w", sc.URL, err)
 		}
 
-		if saveCookieFile != "" {
-			if err := saveCookies(saveCookieFile, sc.Cookies()); err != nil {
+		exhausted = append(exhausted, sc.Exhausted()...)
+
+		if args.SaveCookieFile != "" {
+			if err := saveCookies(args.SaveCookieFile, sc.Cookies()); err != nil {
 				return fmt.Errorf("saving cookies: %w", err)
 			}
 		}
 	}
 
-	reportHistogram()
+	if args.Fingerprints != "" {
+		if err := unifyFingerprints(cfg.Directory, args.Fingerprints, files, log); err != nil {
+			return fmt.Errorf("fingerprinted assets: %w", err)
+		}
+	}
+
+	if err := files.Write(fs, cfg.Directory); err != nil {
+		return err
+	}
+
+	if args.LinkDuplicates != "" {
+		linked, saved, err := mirror.LinkDuplicates(cfg.Directory, files.Duplicates(), args.LinkDuplicates)
+		if err != nil {
+			return fmt.Errorf("linking duplicates: %w", err)
+		}
+		log.Info("Linked duplicates", slog.Int("files", linked), slog.Int64("saved", saved))
+	}
+
+	if args.Sitemap != "" {
+		base, _ := urlpkg.Parse(args.Sitemap) // already validated
+		pages, err := mirror.WriteSitemap(cfg.Directory, base)
+		if err != nil {
+			return fmt.Errorf("writing sitemap: %w", err)
+		}
+		log.Info("Wrote sitemap", slog.String("file", mirror.SitemapFileName), slog.Int("pages", pages))
+	}
+
+	if args.Listing {
+		files, err := mirror.WriteListing(cfg.Directory)
+		if err != nil {
+			return fmt.Errorf("writing listing: %w", err)
+		}
+		log.Info("Wrote listing", slog.String("file", mirror.ListingFileName), slog.Int("files", files))
+	}
+
+	if args.Checksums != "" {
+		files, err := mirror.WriteChecksums(cfg.Directory, args.Checksums)
+		if err != nil {
+			return fmt.Errorf("writing checksums: %w", err)
+		}
+		log.Info("Wrote checksums", slog.String("file", mirror.ChecksumsFileName), slog.Int("files", files))
+	}
+
+	if args.Zip != "" {
+		entries, duplicates, err := mirror.WriteZip(cfg.Directory, args.Zip)
+		if err != nil {
+			return err
+		}
+		for _, file := range duplicates {
+			log.Warn("Not archived: its name differs only in case from another file", slog.String("file", file))
+		}
+		log.Info("Archived", slog.String("file", args.Zip), slog.Int("entries", entries))
+	}
+
+	if args.Torrent != "" {
+		sources := make([]string, len(urls))
+		for i, u := range urls {
+			sources[i] = u.String()
+		}
+		files, infoHash, err := mirror.WriteTorrent(cfg.Directory, args.Torrent, mirror.Torrent{
+			Trackers: args.TorrentTracker,
+			WebSeeds: args.TorrentWebSeed,
+			Comment:  "mirror of " + strings.Join(sources, " "),
+		})
+		if err != nil {
+			return err
+		}
+		log.Info("Wrote torrent", slog.String("file", args.Torrent), slog.Int("files", files), slog.String("infohash", infoHash))
+	}
+
+	if args.IPFS != "" {
+		cid, files, err := mirror.AddToIPFS(ctx, &http.Client{}, args.IPFS, cfg.Directory)
+		if err != nil {
+			return err
+		}
+		log.Info("Added to IPFS", slog.String("cid", cid), slog.Int("files", files))
+
+		var out io.Writer = os.Stdout
+		if dash != nil {
+			out = dash // still running, so the CID is kept for when it stops
+		}
+		fmt.Fprintln(out, cid)
+	}
+
+	reportHistogram(histogram.Snapshot(), log)
+	reportExhausted(exhausted, log)
+
+	summary := aggregator.Summary(histogram.Snapshot())
+	summary.Log(log)
+	if err := saveStats(args.StatsFile, summary); err != nil {
+		return fmt.Errorf("saving statistics: %w", err)
+	}
 
 	return server.AwaitWebserver(ctx, webServer, errChan)
 }
 
-func reportHistogram() {
-	m := download.Counters.Map()
+// scrapeStaged scrapes into a staging directory, which then replaces the published
+// directory only if the scrape succeeded.
+func scrapeStaged(ctx context.Context, fs afero.Fs, cfg config.Config, args Arguments, bookmarks *bookmarklet.Server, log *logger.Logger) error {
+	published := cfg.Directory
+
+	staging, err := mirror.PrepareStaging(published)
+	if err != nil {
+		return err
+	}
+
+	cfg.Directory = staging
+	if err := scrapeURLs(ctx, fs, cfg, args, args.URLs, bookmarks, log); err != nil {
+		log.Warn("The published directory is unchanged", slog.String("dir", published), slog.String("staging", staging))
+		return err
+	}
+
+	log.Info("Publishing", slog.String("dir", published), slog.String("staging", staging))
+	return mirror.Publish(published, staging)
+}
+
+// scrapeSnapshot scrapes into a new snapshot directory, which becomes the latest
+// snapshot only if the scrape succeeded.
+func scrapeSnapshot(ctx context.Context, fs afero.Fs, cfg config.Config, args Arguments, bookmarks *bookmarklet.Server, log *logger.Logger) error {
+	partial, err := mirror.PrepareSnapshot(cfg.Directory, utc.Now())
+	if err != nil {
+		return err
+	}
+
+	cfg.Directory = partial
+	if err := scrapeURLs(ctx, fs, cfg, args, args.URLs, bookmarks, log); err != nil {
+		log.Warn("The snapshot is incomplete", slog.String("dir", partial))
+		return err
+	}
+
+	snapshot, err := mirror.PublishSnapshot(partial)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Snapshot complete", slog.String("dir", snapshot))
+	return nil
+}
+
+// watchURLs checks the URLs repeatedly until interrupted.
+func watchURLs(ctx context.Context, fs afero.Fs, cfg config.Config, args Arguments, log *logger.Logger) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	etagStore := db.Open(log)
+	defer etagStore.Close()
+
+	cfg.LaxAge = -1 // always revalidate
+
+	w := &watch.Watcher{Interval: args.Watch, Threshold: args.Threshold}
+
+	for _, url := range args.URLs {
+		sc, err := scraper.New(cfg, url, afero.NewBasePathFs(fs, cfg.Directory), log)
+		if err != nil {
+			return fmt.Errorf("initializing scraper: %w", err)
+		}
+
+		sc.ETagsDB = etagStore
+		w.Targets = append(w.Targets, watch.Target{URL: sc.URL, Download: sc.Downloader()})
+	}
+
+	if args.Webhook != "" {
+		w.Notify = append(w.Notify, watch.Webhook(&http.Client{Timeout: time.Minute}, args.Webhook))
+	}
+
+	if args.OnChange != "" {
+		w.Notify = append(w.Notify, watch.Command(args.OnChange))
+	}
+
+	log.Info("Watching", slog.Int("urls", len(w.Targets)), slog.Duration("interval", args.Watch))
+	return w.Run(ctx)
+}
+
+// startBookmarklet serves the bookmarklet, if there is an address for it, until the
+// function returned is called. The server is nil if there is no address.
+func startBookmarklet(ctx context.Context, fs afero.Fs, cfg config.Config, address string, log *logger.Logger) (*bookmarklet.Server, func(), error) {
+	if address == "" {
+		return nil, func() {}, nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookmarks := bookmarklet.New(func(ctx context.Context, u *urlpkg.URL) error {
+		return capturePage(ctx, fs, cfg, u, log)
+	}, log)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := bookmarks.Run(ctx, listener); err != nil {
+			log.Error("Bookmarklet failed", slog.Any("error", err))
+		}
+	}()
+
+	return bookmarks, func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// capturePage stores a page submitted by the bookmarklet, along with its assets. The
+// metadata store is not used, because a scrape may be using it at the same time.
+func capturePage(ctx context.Context, fs afero.Fs, cfg config.Config, u *urlpkg.URL, log *logger.Logger) error {
+	cfg.PageOnly = true
+	cfg.Seeds, cfg.Pagination = nil, nil
+
+	sc, err := scraper.New(cfg, u, afero.NewBasePathFs(fs, cfg.Directory), log)
+	if err != nil {
+		return fmt.Errorf("initializing scraper: %w", err)
+	}
+	return sc.Start(ctx)
+}
+
+// awaitInterrupt waits until the process is interrupted.
+func awaitInterrupt(ctx context.Context) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
+
+// captureURLs runs a reverse proxy for the website of the start URL, storing the pages
+// that are browsed through it until interrupted.
+func captureURLs(ctx context.Context, fs afero.Fs, cfg config.Config, args Arguments, log *logger.Logger) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	etagStore := db.Open(log)
+	defer etagStore.Close()
+
+	var files *manifest.Manifest
+	var err error
+	if args.Manifest {
+		if files, err = manifest.Read(fs, cfg.Directory); err != nil {
+			return err
+		}
+	}
+
+	crawlLog, closeCrawlLog, err := openCrawlLog(args.CrawlLog, log)
+	if err != nil {
+		return err
+	}
+	defer closeCrawlLog()
+
+	blocked, stopBlocklist, err := openBlocklist(ctx, args.Blocklist, log)
+	if err != nil {
+		return err
+	}
+	defer stopBlocklist()
+
+	sc, err := scraper.New(cfg, args.URLs[0], afero.NewBasePathFs(fs, cfg.Directory), log)
+	if err != nil {
+		return fmt.Errorf("initializing scraper: %w", err)
+	}
+
+	sc.ETagsDB = etagStore
+	sc.Manifest = files
+	sc.CrawlLog = crawlLog
+	sc.Blocklist = blocked
+
+	listener, err := net.Listen("tcp", args.Capture)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.Capture(ctx, listener); err != nil {
+		return fmt.Errorf("capturing '%s': %w", sc.URL, err)
+	}
+
+	return files.Write(fs, cfg.Directory)
+}
+
+// listURLs crawls the websites without storing anything, then writes the URLs found
+// to stdout.
+func listURLs(ctx context.Context, cfg config.Config, args Arguments, log *logger.Logger) error {
+	var inventory scraper.Inventory
+
+	blocked, stopBlocklist, err := openBlocklist(ctx, args.Blocklist, log)
+	if err != nil {
+		return err
+	}
+	defer stopBlocklist()
+
+	for _, url := range args.URLs {
+		sc, err := scraper.New(cfg, url, afero.NewMemMapFs(), log)
+		if err != nil {
+			return fmt.Errorf("initializing scraper: %w", err)
+		}
+
+		sc.Blocklist = blocked
+
+		log.Info("Listing", slog.String("url", sc.URL.String()))
+		if err = sc.Start(ctx); err != nil {
+			return fmt.Errorf("listing '%s': %w", sc.URL, err)
+		}
+
+		inventory = append(inventory, sc.Inventory()...)
+	}
+
+	if args.ListURLs == "csv" {
+		return inventory.WriteCSV(os.Stdout)
+	}
+	return inventory.WriteJSON(os.Stdout)
+}
+
+// pipelineURLs processes the URLs read from stdin, writing their results to stdout.
+func pipelineURLs(ctx context.Context, fs afero.Fs, cfg config.Config, log *logger.Logger) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	etagStore := db.Open(log)
+	defer etagStore.Close()
+
+	cfg.WriteBehind = 0 // each result is reported after its file has been written
+
+	downloaders := make(map[string]*download.Download) // keyed by host
+	downloader := func(u *urlpkg.URL) (*download.Download, error) {
+		if d, exists := downloaders[u.Host]; exists {
+			return d, nil
+		}
+
+		sc, err := scraper.New(cfg, u, afero.NewBasePathFs(fs, cfg.Directory), log)
+		if err != nil {
+			return nil, fmt.Errorf("initializing scraper: %w", err)
+		}
+
+		sc.ETagsDB = etagStore
+		downloaders[u.Host] = sc.Downloader()
+		return downloaders[u.Host], nil
+	}
+
+	return pipeline.Run(ctx, os.Stdin, os.Stdout, downloader)
+}
+
+// verifyManifest checks the files in the directory against its manifest, and reports
+// any files with identical content.
+func verifyManifest(fs afero.Fs, dir string, log *logger.Logger) error {
+	files, err := manifest.Read(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	if len(files.Files()) == 0 {
+		return fmt.Errorf("%s has no files listed in %s", dir, manifest.FileName)
+	}
+
+	missing, changed, err := files.Verify(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range missing {
+		log.Warn("Missing", slog.String("file", file))
+	}
+
+	for _, file := range changed {
+		log.Warn("Changed", slog.String("file", file))
+	}
+
+	for hash, identical := range files.Duplicates() {
+		log.Info("Identical files", slog.String("sha256", hash), slog.Any("files", identical))
+	}
+
+	log.Report("Verified", slog.Int("files", len(files.Files())), slog.Int("missing", len(missing)), slog.Int("changed", len(changed)))
+	if len(missing) > 0 || len(changed) > 0 {
+		return fmt.Errorf("%d files are missing and %d have changed", len(missing), len(changed))
+	}
+	return nil
+}
+
+// unifyFingerprints reports the fingerprinted assets that have several versions and,
+// if required, removes the versions that are no longer referred to.
+func unifyFingerprints(dir, how string, files *manifest.Manifest, log *logger.Logger) error {
+	assets, err := mirror.FingerprintedAssets(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range assets {
+		log.Info("Fingerprinted asset", slog.String("asset", asset.Asset), slog.Int("versions", len(asset.Files)), slog.Any("referenced", asset.Referenced))
+		for _, identical := range asset.Identical {
+			log.Info("Identical versions", slog.String("asset", asset.Asset), slog.Any("files", identical))
+		}
+	}
+
+	if how != mirror.FingerprintsCollect {
+		return nil
+	}
+
+	removed, err := mirror.CollectSuperseded(dir, assets)
+	for _, file := range removed {
+		files.Remove(file)
+		log.Info("Removed superseded version", slog.String("file", file))
+	}
+	return err
+}
+
+// republish copies the mirror in the directory for hosting elsewhere.
+func republish(dir string, args Arguments, log *logger.Logger) error {
+	var base *urlpkg.URL
+	if args.RepublishBase != "" {
+		base, _ = urlpkg.Parse(args.RepublishBase) // already validated
+	}
+
+	pages, err := mirror.Republish(dir, args.Republish, base)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Republished", slog.String("dir", args.Republish), slog.Int("pages", pages))
+	return nil
+}
+
+// checkLinks reports the local references in the directory that are dangling.
+func checkLinks(dir string, log *logger.Logger) error {
+	dangling, err := mirror.DanglingReferences(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range dangling {
+		log.Warn("Dangling reference", slog.String("file", ref.File), slog.String("target", ref.Target))
+	}
+
+	if len(dangling) > 0 {
+		return fmt.Errorf("%d references are dangling", len(dangling))
+	}
+
+	log.Report("Checked links")
+	return nil
+}
+
+// collectOrphans removes the files in the directory that are neither in its manifest
+// nor referred to by the pages and stylesheets that are.
+func collectOrphans(fs afero.Fs, dir string, dryRun bool, log *logger.Logger) error {
+	files, err := manifest.Read(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	if len(files.Files()) == 0 {
+		return fmt.Errorf("%s has no files listed in %s", dir, manifest.FileName)
+	}
+
+	orphans, err := mirror.Orphans(dir, func(file string) bool { return files.Hash(file) != "" })
+	if err != nil {
+		return err
+	}
+
+	for _, file := range orphans {
+		log.Report("Orphan", slog.String("file", file))
+	}
+
+	if dryRun {
+		log.Report("Found orphans", slog.Int("files", len(orphans)))
+		return nil
+	}
+
+	if err := mirror.RemoveFiles(dir, orphans); err != nil {
+		return err
+	}
+
+	log.Report("Removed orphans", slog.Int("files", len(orphans)))
+	return nil
+}
+
+// commitToGit commits the changes made by the scrape, if required.
+func commitToGit(ctx context.Context, dir string, required bool, log *logger.Logger) {
+	if !required {
+		return
+	}
+
+	changes, err := mirror.GitCommit(ctx, dir, utc.Now())
+	if err != nil {
+		log.Errorf("Git error: %s\n", err)
+		return
+	}
+
+	if changes.Empty() {
+		log.Info("Nothing to commit", slog.String("dir", dir))
+	} else {
+		log.Info("Committed", slog.String("dir", dir), slog.String("changes", changes.Summary()))
+	}
+}
+
+// openCassettes opens the cassettes for recording and replaying, either of which may be absent.
+func openCassettes(recordFile, replayFile string, log *logger.Logger) (recorder, replayer *cassette.Cassette, err error) {
+	if recordFile != "" && recordFile == replayFile {
+		return nil, nil, errors.New("cannot record and replay the same cassette file")
+	}
+
+	osFs := afero.NewOsFs()
+
+	if replayFile != "" {
+		replayer, err = cassette.Open(osFs, replayFile, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Info("Replaying", slog.String("file", replayFile), slog.Int("episodes", replayer.Len()))
+	}
+
+	if recordFile != "" {
+		_ = osFs.Remove(recordFile) // start a fresh recording
+		recorder, err = cassette.Open(osFs, recordFile, log)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return recorder, replayer, nil
+}
+
+func reportHistogram(m map[int]int, log *logger.Logger) {
 	keys := slices.Collect(maps.Keys(m))
 	slices.Sort(keys)
-	logger.Warn("Scraping finished", slog.Int("response-codes", len(keys)))
+	log.Report("Scraping finished", slog.Int("response-codes", len(keys)))
 	for _, key := range keys {
-		logger.Warn(fmt.Sprintf("%3d: %d", key, m[key]))
+		log.Report(fmt.Sprintf("%3d: %d", key, m[key]))
 	}
 }
 
-func createLogger(args Arguments) {
+func reportExhausted(exhausted []work.Result, log *logger.Logger) {
+	if len(exhausted) == 0 {
+		return
+	}
+
+	log.Warn("Abandoned after too many attempts", slog.Int("items", len(exhausted)))
+	for _, result := range exhausted {
+		log.Warn(fmt.Sprintf("%3d: %s", result.StatusCode, result.Item.URL))
+	}
+}
+
+func createLogger(args Arguments) *logger.Logger {
 	opts := &slog.HandlerOptions{Level: slog.LevelWarn}
 
 	if args.Debug {
 		opts.Level = slog.LevelDebug
-		servefiles.Debugf = func(format string, v ...interface{}) { logger.Debug(fmt.Sprintf(format, v...)) }
 	} else if args.Verbose {
 		opts.Level = slog.LevelInfo
 	} else {
 		opts.Level = slog.LevelWarn
 	}
 
-	logger.Create(os.Stdout, opts)
+	var w io.Writer = os.Stdout
+	if args.Stdin || args.ListURLs != "" || args.CrawlLog == "-" || args.CheckConfig {
+		w = os.Stderr // stdout carries the results
+	} else if dash != nil {
+		w = dash // shown on the dashboard while it is running
+	}
+
+	log := logger.Create(w, opts)
+	log.FailOnWarn = args.FailOnWarn
+
+	if args.Debug {
+		servefiles.Debugf = func(format string, v ...interface{}) { log.Debug(fmt.Sprintf(format, v...)) }
+	}
+	return log
 }
 
 func readCookieFile(cookieFile string) ([]config.Cookie, error) {
@@ -307,6 +1625,34 @@ func readCookieFile(cookieFile string) ([]config.Cookie, error) {
 	return cookies, nil
 }
 
+func readExcludeFile(excludeFile string) ([]string, error) {
+	if excludeFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(excludeFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return filter.ReadGlobs(f)
+}
+
+func readSeedFile(seedFile string) ([]string, error) {
+	if seedFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(seedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return scraper.ReadSeeds(f)
+}
+
 func saveCookies(cookieFile string, cookies []config.Cookie) error {
 	if cookieFile == "" || len(cookies) == 0 {
 		return nil
@@ -324,6 +1670,58 @@ func saveCookies(cookieFile string, cookies []config.Cookie) error {
 	return nil
 }
 
+// openBlocklist reads the blocklist in file, if any, and keeps it up to date until the
+// returned function is called.
+func openBlocklist(ctx context.Context, file string, log *logger.Logger) (*blocklist.List, func(), error) {
+	if file == "" {
+		return nil, func() {}, nil
+	}
+
+	list, err := blocklist.Read(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("Read blocklist", slog.String("file", file), slog.Int("entries", list.Len()))
+	ctx, stop := context.WithCancel(ctx)
+	go list.Watch(ctx, blocklist.Interval, log)
+	return list, stop, nil
+}
+
+// openCrawlLog opens the file for the crawl log; "-" is stdout. It returns nil if
+// there is no file.
+func openCrawlLog(name string, log *logger.Logger) (*crawllog.Log, func(), error) {
+	switch name {
+	case "":
+		return nil, func() {}, nil
+	case "-":
+		return crawllog.New(os.Stdout, log), func() {}, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating crawl log: %w", err)
+	}
+	return crawllog.New(f, log), func() { _ = f.Close() }, nil
+}
+
+func saveStats(statsFile string, summary stats.Summary) error {
+	if statsFile == "" {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := summary.WriteJSON(buf); err != nil {
+		return fmt.Errorf("marshaling statistics: %w", err)
+	}
+
+	if err := os.WriteFile(statsFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("saving statistics: %w", err)
+	}
+
+	return nil
+}
+
 // formatVersion builds a version string based on binary release information.
 func formatVersion(version, commit, date string) string {
 	buf := strings.Builder{}
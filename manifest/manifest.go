@@ -0,0 +1,307 @@
+// Package manifest records the SHA-256 hash of every stored file. The hashes are
+// computed as the files are written, so a mirror can be verified, de-duplicated and
+// compared without re-reading the whole output tree. The manifest is written in the
+// format of sha256sum, so "sha256sum -c" can also check it. The metadata of each
+// stored page is written alongside it, as JSON lines, so that the mirror can also be
+// used as a structured dataset. So is the Vary key of each file that the server
+// negotiated, which shows the variant that was stored.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+)
+
+// FileName is the name of the manifest within the output directory.
+const FileName = "manifest.sha256"
+
+// PagesFileName is the name of the page metadata within the output directory.
+const PagesFileName = "manifest.pages.jsonl"
+
+// VaryFileName is the name of the Vary keys within the output directory. Each line
+// holds a file and its key, separated by a tab.
+const VaryFileName = "manifest.vary"
+
+// Manifest maps the path of each stored file, relative to the output directory and
+// with forward slashes, to its SHA-256 hash in hex. It also holds the metadata of the
+// stored pages and the Vary keys of the files that have them. It is safe for concurrent
+// use; a nil Manifest does nothing.
+type Manifest struct {
+	hashes map[string]string
+	pages  map[string]work.Metadata
+	vary   map[string]string
+	mu     sync.Mutex
+}
+
+// Page is the metadata of a stored page, as written in PagesFileName.
+type Page struct {
+	File string `json:"file"`
+	work.Metadata
+}
+
+// New returns an empty manifest.
+func New() *Manifest {
+	return &Manifest{hashes: make(map[string]string), pages: make(map[string]work.Metadata), vary: make(map[string]string)}
+}
+
+// Read reads the manifest in dir. If there is none yet, the manifest is empty.
+func Read(fs afero.Fs, dir string) (*Manifest, error) {
+	m := New()
+
+	data, err := afero.ReadFile(fs, filepath.Join(dir, FileName))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		hash, file, found := strings.Cut(scanner.Text(), "  ")
+		if found && len(hash) == hex.EncodedLen(sha256.Size) {
+			m.hashes[file] = hash
+		}
+	}
+
+	if err := m.readPages(fs, dir); err != nil {
+		return nil, err
+	}
+	return m, m.readVary(fs, dir)
+}
+
+func (m *Manifest) readPages(fs afero.Fs, dir string) error {
+	data, err := afero.ReadFile(fs, filepath.Join(dir, PagesFileName))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading page metadata: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var page Page
+		if err := json.Unmarshal(scanner.Bytes(), &page); err == nil && page.File != "" {
+			m.pages[page.File] = page.Metadata
+		}
+	}
+	return scanner.Err()
+}
+
+// Add records the hash of a stored file.
+func (m *Manifest) Add(file, hash string) {
+	if m == nil || hash == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hashes[file] = hash
+}
+
+func (m *Manifest) readVary(fs afero.Fs, dir string) error {
+	data, err := afero.ReadFile(fs, filepath.Join(dir, VaryFileName))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading vary keys: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if file, key, found := strings.Cut(scanner.Text(), "\t"); found && key != "" {
+			m.vary[file] = key
+		}
+	}
+	return nil
+}
+
+// AddPage records the metadata of a stored page.
+func (m *Manifest) AddPage(file string, metadata work.Metadata) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pages[file] = metadata
+}
+
+// AddVary records the Vary key of a stored file, e.g. "Accept: image/webp". A blank key
+// means that the file doesn't vary.
+func (m *Manifest) AddVary(file, key string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key == "" {
+		delete(m.vary, file)
+	} else {
+		m.vary[file] = key
+	}
+}
+
+// Vary gets the recorded Vary key of a file, or blank if it has none.
+func (m *Manifest) Vary(file string) string {
+	if m == nil {
+		return ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.vary[file]
+}
+
+// Remove forgets a file that has been deleted.
+func (m *Manifest) Remove(file string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.hashes, file)
+	delete(m.pages, file)
+	delete(m.vary, file)
+}
+
+// Hash gets the recorded hash of a file, or blank if it is not in the manifest.
+func (m *Manifest) Hash(file string) string {
+	if m == nil {
+		return ""
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hashes[file]
+}
+
+// Files lists the files in the manifest, sorted by path.
+func (m *Manifest) Files() []string {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.hashes))
+}
+
+// Pages lists the metadata of the stored pages, sorted by path.
+func (m *Manifest) Pages() []Page {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pages := make([]Page, 0, len(m.pages))
+	for _, file := range slices.Sorted(maps.Keys(m.pages)) {
+		pages = append(pages, Page{File: file, Metadata: m.pages[file]})
+	}
+	return pages
+}
+
+// Write writes the manifest, the page metadata and the Vary keys into dir, sorted by path.
+func (m *Manifest) Write(fs afero.Fs, dir string) error {
+	if m == nil {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	for _, file := range m.Files() {
+		fmt.Fprintf(buf, "%s  %s\n", m.Hash(file), file)
+	}
+
+	if _, err := ioutil.WriteFileAtomically(fs, filepath.Join(dir, FileName), buf); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	buf = &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	for _, page := range m.Pages() {
+		if err := enc.Encode(page); err != nil {
+			return fmt.Errorf("encoding page metadata: %w", err)
+		}
+	}
+
+	if _, err := ioutil.WriteFileAtomically(fs, filepath.Join(dir, PagesFileName), buf); err != nil {
+		return fmt.Errorf("writing page metadata: %w", err)
+	}
+
+	m.mu.Lock()
+	buf = &bytes.Buffer{}
+	for _, file := range slices.Sorted(maps.Keys(m.vary)) {
+		fmt.Fprintf(buf, "%s\t%s\n", file, m.vary[file])
+	}
+	m.mu.Unlock()
+
+	if _, err := ioutil.WriteFileAtomically(fs, filepath.Join(dir, VaryFileName), buf); err != nil {
+		return fmt.Errorf("writing vary keys: %w", err)
+	}
+	return nil
+}
+
+// Duplicates groups the files that have identical content, keyed by hash. Files with
+// unique content are omitted.
+func (m *Manifest) Duplicates() map[string][]string {
+	byHash := make(map[string][]string)
+	for _, file := range m.Files() {
+		hash := m.Hash(file)
+		byHash[hash] = append(byHash[hash], file)
+	}
+
+	maps.DeleteFunc(byHash, func(_ string, files []string) bool { return len(files) < 2 })
+	return byHash
+}
+
+// Verify re-hashes every file in the manifest, which is relative to dir. It returns
+// the files that are missing and those whose content has changed.
+func (m *Manifest) Verify(fs afero.Fs, dir string) (missing, changed []string, err error) {
+	for _, file := range m.Files() {
+		hash, err := hashFile(fs, filepath.Join(dir, filepath.FromSlash(file)))
+		switch {
+		case errors.Is(err, iofs.ErrNotExist):
+			missing = append(missing, file)
+		case err != nil:
+			return nil, nil, err
+		case hash != m.Hash(file):
+			changed = append(changed, file)
+		}
+	}
+	return missing, changed, nil
+}
+
+func hashFile(fs afero.Fs, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
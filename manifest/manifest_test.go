@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestWriteAndRead(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	m := New()
+	m.Add("example.org/index.html", sha("index"))
+	m.Add("example.org/a.html", sha("a"))
+	m.Add("example.org/gone.html", sha("gone"))
+	m.Add("example.org/blank.html", "")
+	m.Remove("example.org/gone.html")
+	require.NoError(t, m.Write(fs, "out"))
+
+	data, err := afero.ReadFile(fs, "out/"+FileName)
+	require.NoError(t, err)
+	assert.Equal(t, sha("a")+"  example.org/a.html\n"+sha("index")+"  example.org/index.html\n", string(data))
+
+	again, err := Read(fs, "out")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org/a.html", "example.org/index.html"}, again.Files())
+	assert.Equal(t, sha("index"), again.Hash("example.org/index.html"))
+
+	empty, err := Read(fs, "elsewhere")
+	require.NoError(t, err)
+	assert.Empty(t, empty.Files())
+}
+
+func TestPages(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	m := New()
+	m.Add("example.org/index.html", sha("index"))
+	m.AddPage("example.org/index.html", work.Metadata{Title: "Home & away", Language: "en"})
+	m.AddPage("example.org/gone.html", work.Metadata{Title: "Gone"})
+	m.Remove("example.org/gone.html")
+	require.NoError(t, m.Write(fs, "out"))
+
+	data, err := afero.ReadFile(fs, "out/"+PagesFileName)
+	require.NoError(t, err)
+	assert.Equal(t, `{"file":"example.org/index.html","title":"Home & away","language":"en"}`+"\n", string(data))
+
+	again, err := Read(fs, "out")
+	require.NoError(t, err)
+	assert.Equal(t, []Page{{File: "example.org/index.html", Metadata: work.Metadata{Title: "Home & away", Language: "en"}}}, again.Pages())
+}
+
+func TestVary(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	m := New()
+	m.AddVary("example.org/a.jpg", "Accept: image/webp; Accept-Encoding: gzip")
+	m.AddVary("example.org/b.jpg", "Accept: image/png")
+	m.AddVary("example.org/b.jpg", "")
+	m.AddVary("example.org/c.jpg", "*")
+	m.Remove("example.org/c.jpg")
+	require.NoError(t, m.Write(fs, "out"))
+
+	data, err := afero.ReadFile(fs, "out/"+VaryFileName)
+	require.NoError(t, err)
+	assert.Equal(t, "example.org/a.jpg\tAccept: image/webp; Accept-Encoding: gzip\n", string(data))
+
+	again, err := Read(fs, "out")
+	require.NoError(t, err)
+	assert.Equal(t, "Accept: image/webp; Accept-Encoding: gzip", again.Vary("example.org/a.jpg"))
+	assert.Empty(t, again.Vary("example.org/b.jpg"))
+}
+
+func TestVerifyAndDuplicates(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "out/example.org/index.html", []byte("index"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "out/example.org/copy.html", []byte("index"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "out/example.org/a.html", []byte("edited"), 0o644))
+
+	m := New()
+	m.Add("example.org/index.html", sha("index"))
+	m.Add("example.org/copy.html", sha("index"))
+	m.Add("example.org/a.html", sha("a"))
+	m.Add("example.org/b.html", sha("b"))
+
+	missing, changed, err := m.Verify(fs, "out")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org/b.html"}, missing)
+	assert.Equal(t, []string{"example.org/a.html"}, changed)
+
+	assert.Equal(t, map[string][]string{
+		sha("index"): {"example.org/copy.html", "example.org/index.html"},
+	}, m.Duplicates())
+}
+
+func TestNilManifest(t *testing.T) {
+	var m *Manifest
+	m.Add("a", sha("a"))
+	m.Remove("a")
+	assert.Empty(t, m.Files())
+	assert.NoError(t, m.Write(afero.NewMemMapFs(), "out"))
+}
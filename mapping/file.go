@@ -1,8 +1,12 @@
 package mapping
 
 import (
+	"fmt"
+	"net"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 const (
@@ -13,23 +17,69 @@ const (
 	PageDirIndex = "index" + HTMLExtension
 )
 
-// GetFilePath returns a file path for a URL to store the URL content in.
+// pageExtensions are the file extensions that usually indicate pages, rather than assets.
+var pageExtensions = []string{".html", ".htm", ".xhtml", ".shtml", ".php", ".asp", ".aspx", ".jsp", ".cgi"}
+
+// pageExtensionMap maps the extensions of page URLs, in lower case, to the extensions
+// of the files that they are stored in. It is set by SetPageExtensions.
+var pageExtensionMap map[string]string
+
+// SetPageExtensions sets how the extensions of page URLs are mapped to the extensions
+// of the files that the pages are stored in, e.g. ".php" to ".html", so that the
+// mirror can be browsed without a server that knows them. The links to the pages are
+// rewritten to match. Extensions are matched ignoring case. This applies to everything
+// that names the stored files, so it must be set before any scraping starts; nil
+// restores the default, in which every extension is kept.
+func SetPageExtensions(m map[string]string) error {
+	mapped := make(map[string]string, len(m))
+	for from, to := range m {
+		for _, ext := range []string{from, to} {
+			if len(ext) < 2 || filepath.Ext(ext) != ext || SafeName(ext) != ext {
+				return fmt.Errorf("%q is not a file extension such as .html", ext)
+			}
+		}
+		if !strings.EqualFold(from, to) {
+			mapped[strings.ToLower(from)] = to
+		}
+	}
+	pageExtensionMap = mapped
+	return nil
+}
+
+// IsPageURL guesses whether a URL refers to a page, as opposed to an asset such as
+// an image or a stylesheet. The decision is based only on the file extension, so it
+// can be made before downloading.
+func IsPageURL(url *url.URL) bool {
+	ext := strings.ToLower(filepath.Ext(url.Path))
+	_, mapped := pageExtensionMap[ext]
+	return ext == "" || mapped || slices.Contains(pageExtensions, ext)
+}
+
+// HasMappedExtension reports whether the file that the page at url is stored in has a
+// different extension to the URL, according to SetPageExtensions.
+func HasMappedExtension(url *url.URL) bool {
+	_, mapped := pageExtensionMap[strings.ToLower(filepath.Ext(url.Path))]
+	return mapped
+}
+
+// GetFilePath returns a file path for a URL to store the URL content in. The path
+// always stays within the directory it is relative to, whatever the URL contains.
 func GetFilePath(url *url.URL, isAPage bool) string {
 	if isAPage {
 		fileName := GetPageFilePath(url)
 		return "." + fileName
 	} else {
-		return "." + url.Path
+		return "." + safePath(url.Path)
 	}
 }
 
 // GetPageFilePath returns a filename for a URL that represents a page.
 func GetPageFilePath(url *url.URL) string {
-	fileName := url.Path
+	fileName := safePath(url.Path)
 
 	// root of domain will be index.html
 	switch {
-	case fileName == "" || fileName == "/":
+	case fileName == "/":
 		fileName = "/" + PageDirIndex
 		// directory index will be index.html in the directory
 
@@ -39,10 +89,82 @@ func GetPageFilePath(url *url.URL) string {
 	default:
 		ext := filepath.Ext(fileName)
 		// if file extension is missing add .html, otherwise keep the existing file extension
+		// unless it is mapped to another, which replaces it rather than being appended
 		if ext == "" {
 			fileName += HTMLExtension
+		} else if to, ok := pageExtensionMap[strings.ToLower(ext)]; ok {
+			fileName = strings.TrimSuffix(fileName, ext) + to
 		}
 	}
 
+	if url.RawQuery != "" {
+		// pages that differ only by their query are stored separately
+		ext := filepath.Ext(fileName)
+		fileName = strings.TrimSuffix(fileName, ext) + "_" + querySuffix(url.RawQuery) + ext
+	}
+
 	return fileName
 }
+
+// querySuffix makes a query string safe to use in a file name and as a relative URL.
+func querySuffix(query string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case strings.ContainsRune("-_.=&,", r):
+			return r
+		default:
+			return '_'
+		}
+	}, query)
+}
+
+// HostDir returns the name of the directory that the files of a host are stored in.
+// A port is included after an underscore, e.g. "example.com_8080", unless it is the
+// default port for HTTP or HTTPS, so that sites on several ports of one host can be
+// mirrored side by side. A hostile host name, such as "..", cannot refer to any other
+// directory.
+func HostDir(host string) string {
+	if name, port, err := net.SplitHostPort(host); err == nil {
+		host = name
+		if strings.Contains(name, ":") {
+			host = "[" + name + "]" // IPv6
+		}
+		if port != "" && port != "80" && port != "443" {
+			host += "_" + port
+		}
+	}
+
+	if host == "" {
+		return "_"
+	}
+	return SafeName(host)
+}
+
+// WithoutDefaultPort removes the port from a URL when it is the default for its scheme,
+// e.g. "https://example.com:443/" becomes "https://example.com/".
+func WithoutDefaultPort(u *url.URL) {
+	port := u.Port()
+	if u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443" ||
+		u.Scheme == "ftp" && port == "21" || u.Scheme == "ftps" && port == "990" ||
+		u.Scheme == "gemini" && port == "1965" || u.Scheme == "gopher" && port == "70" {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+}
+
+// safePath makes a URL path safe to use as a file path, by making each of its segments
+// a SafeName. The path is already decoded, so encoded traversal such as "%2e%2e"
+// arrives here as "..". The result always starts with "/".
+func safePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = SafeName(segment)
+	}
+
+	p = strings.Join(segments, "/")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
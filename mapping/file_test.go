@@ -1,14 +1,13 @@
 package mapping
 
 import (
-	"io"
-	"log/slog"
 	urlpkg "net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/cornelk/goscrape/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetFilePath(t *testing.T) {
@@ -26,10 +25,11 @@ func TestGetFilePath(t *testing.T) {
 		{downloadURL: "https://github.com/test/", expectedFilePath: "./test" + pathSeparator + "index.html"},
 		{downloadURL: "https://github.com/test.aspx", expectedFilePath: "./test.aspx"},
 		{downloadURL: "https://google.com/settings", expectedFilePath: "./settings.html"},
+		{downloadURL: "https://github.com/search?q=a+b&p=2", expectedFilePath: "./search_q=a_b&p=2.html"},
+		{downloadURL: "https://github.com/test/?x=%2F", expectedFilePath: "./test" + pathSeparator + "index_x=_2F.html"},
+		{downloadURL: "https://github.com/test.aspx?x=1", expectedFilePath: "./test_x=1.aspx"},
 	}
 
-	logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
-
 	for _, c := range cases {
 		url := must(c.downloadURL)
 
@@ -45,3 +45,154 @@ func must(s string) *urlpkg.URL {
 	}
 	return u
 }
+
+func TestGetFilePath_PageExtensions(t *testing.T) {
+	require.NoError(t, SetPageExtensions(map[string]string{".php": ".html", ".DO": ".htm", ".html": ".html"}))
+	t.Cleanup(func() { _ = SetPageExtensions(nil) })
+
+	cases := map[string]string{
+		"https://github.com/news.php":      "./news.html",
+		"https://github.com/News.PHP?id=3": "./News_id=3.html",
+		"https://github.com/login.do":      "./login.htm",
+		"https://github.com/about.html":    "./about.html",
+		"https://github.com/shop.aspx":     "./shop.aspx",
+		"https://github.com/test":          "./test.html",
+	}
+	for u, expected := range cases {
+		assert.Equal(t, expected, GetFilePath(must(u), true), u)
+	}
+
+	assert.True(t, IsPageURL(must("https://github.com/login.do")))
+	assert.True(t, HasMappedExtension(must("https://github.com/news.php")))
+	assert.False(t, HasMappedExtension(must("https://github.com/about.html")), "mapped to itself")
+	assert.Equal(t, "./img/logo.php", GetFilePath(must("https://github.com/img/logo.php"), false), "not a page")
+
+	for _, bad := range []string{"php", ".", ".a/b", "..php", ".php."} {
+		assert.Error(t, SetPageExtensions(map[string]string{bad: ".html"}), bad)
+		assert.Error(t, SetPageExtensions(map[string]string{".php": bad}), bad)
+	}
+}
+
+func TestIsPageURL(t *testing.T) {
+	cases := map[string]bool{
+		"https://github.com/":              true,
+		"https://github.com/test":          true,
+		"https://github.com/test/":         true,
+		"https://github.com/test.aspx":     true,
+		"https://github.com/a/b/Index.HTM": true,
+		"https://github.com/style.css":     false,
+		"https://github.com/img/photo.jpg": false,
+		"https://github.com/app.js?v=1":    false,
+	}
+
+	for u, expected := range cases {
+		assert.Equal(t, expected, IsPageURL(must(u)), u)
+	}
+}
+
+func TestGetFilePath_Hostile(t *testing.T) {
+	cases := []struct {
+		downloadURL string
+		isAPage     bool
+		expected    string
+	}{
+		{downloadURL: "https://github.com/../../etc/passwd", expected: "./%2E%2E/%2E%2E/etc/passwd"},
+		{downloadURL: "https://github.com/a/%2e%2e/%2e%2e/%2e%2e/etc/passwd", expected: "./a/%2E%2E/%2E%2E/%2E%2E/etc/passwd"},
+		{downloadURL: "https://github.com/a/%2E%2E%2F%2E%2E%2Fx.css", expected: "./a/%2E%2E/%2E%2E/x.css"},
+		{downloadURL: "https://github.com/..%5c..%5cwin.ini", expected: "./..%5C..%5Cwin.ini"},
+		{downloadURL: "https://github.com/./x.js", expected: "./%2E/x.js"},
+		{downloadURL: "https://github.com/a%00b.png", expected: "./a%00b.png"},
+		{downloadURL: "https://github.com//etc/passwd", expected: ".//etc/passwd"},
+		{downloadURL: "https://github.com/..", isAPage: true, expected: "./%2E%2E.html"},
+		{downloadURL: "https://github.com/../", isAPage: true, expected: "./%2E%2E/index.html"},
+		{downloadURL: "https://github.com/%2e%2e/x?a=1", isAPage: true, expected: "./%2E%2E/x_a=1.html"},
+	}
+
+	for _, c := range cases {
+		output := GetFilePath(must(c.downloadURL), c.isAPage)
+		assert.Equal(t, c.expected, output, c.downloadURL)
+		assert.True(t, filepath.IsLocal(output), c.downloadURL)
+	}
+}
+
+func TestHostDir(t *testing.T) {
+	cases := map[string]string{
+		"github.com":      "github.com",
+		"localhost:8080":  "localhost_8080",
+		"example.com:80":  "example.com",
+		"example.com:443": "example.com",
+		"[::1]":           "[::1]",
+		"..":              "%2E%2E",
+		".":               "%2E",
+		"":                "_",
+		`a\..\..`:         "a%5C..%5C.%2E",
+		"a/../../b":       "a%2F..%2F..%2Fb",
+		"[::1]:8080":      "[::1]_8080",
+		"bad\x00host.com": "bad%00host.com",
+	}
+
+	for host, expected := range cases {
+		assert.Equal(t, expected, HostDir(host), host)
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	cases := map[string]string{
+		"index.html":  "index.html",
+		"":            "",
+		"..":          "%2E%2E",
+		"a.":          "a%2E",
+		"a ":          "a%20",
+		"con":         "con_",
+		"NUL.txt":     "NUL_.txt",
+		"com1.tar.gz": "com1_.tar.gz",
+		"lpt9 .png":   "lpt9 _.png",
+		"console.log": "console.log",
+		"com10":       "com10",
+		"a\tb":        "a%09b",
+	}
+
+	for segment, expected := range cases {
+		assert.Equal(t, expected, SafeName(segment), segment)
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	for _, p := range []string{"example.org/index.html", `example.org\img\a.png`, "localhost:8080/a.css", "a/./b/../c"} {
+		name, err := ArchiveName(p)
+		assert.NoError(t, err, p)
+		assert.True(t, filepath.IsLocal(name), p)
+	}
+
+	name, _ := ArchiveName(`example.org\img\a.png`)
+	assert.Equal(t, "example.org/img/a.png", name)
+
+	name, _ = ArchiveName("en.wiki.org/wiki/Special:Random.html")
+	assert.Equal(t, "en.wiki.org/wiki/Special%3ARandom.html", name)
+
+	name, _ = ArchiveName(`example.org/a?b<c>d|e*f"g.html`)
+	assert.Equal(t, "example.org/a%3Fb%3Cc%3Ed%7Ce%2Af%22g.html", name)
+
+	for _, p := range []string{"", "/etc/passwd", `\windows\win.ini`, "C:/windows/win.ini", "c:win.ini", "../x", "a/../../x", `a\..\..\x`, "."} {
+		_, err := ArchiveName(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestWithoutDefaultPort(t *testing.T) {
+	cases := map[string]string{
+		"http://example.com:80/a":    "http://example.com/a",
+		"https://example.com:443/a":  "https://example.com/a",
+		"http://example.com:443/a":   "http://example.com:443/a",
+		"https://example.com:8443/a": "https://example.com:8443/a",
+		"http://[::1]:80/":           "http://[::1]/",
+		"http://example.com/":        "http://example.com/",
+		"ftp://example.com:21/a":     "ftp://example.com/a",
+	}
+
+	for input, expected := range cases {
+		u := must(input)
+		WithoutDefaultPort(u)
+		assert.Equal(t, expected, u.String(), input)
+	}
+}
@@ -0,0 +1,107 @@
+package mapping
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// windowsForbiddenChars are the characters that Windows forbids in file names, besides
+// control characters.
+const windowsForbiddenChars = `/\<>:"|?*`
+
+// reservedNames are the device names that Windows reserves in every directory,
+// whatever extension follows them.
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// SafeName makes one segment of a path safe to use as the name of a file or directory,
+// on any operating system and within archives. These rules are shared by everything
+// that names the stored files:
+//
+//   - "." and ".." become "%2E" and "%2E%2E", so a name cannot refer to another directory
+//   - separators, control characters and the other characters that the operating
+//     system forbids are percent-encoded, as is a trailing dot or space, which
+//     Windows would drop
+//   - a reserved Windows device name, such as "con" or "nul.txt", gets a "_" suffix
+//     before its extension, e.g. "con_" and "nul_.txt"
+func SafeName(segment string) string {
+	return safeName(segment, forbiddenChars)
+}
+
+// safeName is SafeName with the given forbidden characters.
+func safeName(segment, forbidden string) string {
+	switch segment {
+	case "":
+		return segment
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	}
+
+	unsafeRune := func(r rune) bool {
+		return r < 0x20 || r == 0x7f || strings.ContainsRune(forbidden, r)
+	}
+
+	if strings.ContainsFunc(segment, unsafeRune) {
+		b := &strings.Builder{}
+		for _, r := range segment {
+			if unsafeRune(r) {
+				fmt.Fprintf(b, "%%%02X", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+		segment = b.String()
+	}
+
+	if last := segment[len(segment)-1]; last == '.' || last == ' ' {
+		segment = fmt.Sprintf("%s%%%02X", segment[:len(segment)-1], last)
+	}
+
+	base, ext, _ := strings.Cut(segment, ".")
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(strings.TrimRight(base, " "), reserved) {
+			if ext != "" {
+				return base + "_." + ext
+			}
+			return base + "_"
+		}
+	}
+
+	return segment
+}
+
+// ArchiveName checks the path of a file relative to the root of an archive and
+// returns the name of its entry, which has forward slashes. It rejects any path
+// that would be extracted outside the directory the archive is extracted into
+// (known as "zip slip"), i.e. absolute paths, paths with a drive or volume name
+// and those with ".." segments. Each segment is also made a SafeName as it would be
+// on Windows, e.g. "a?b.html" becomes "a%3Fb.html", so that the archive can be
+// extracted on any operating system.
+func ArchiveName(p string) (string, error) {
+	name := strings.ReplaceAll(p, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || hasDrive(name) {
+		return "", fmt.Errorf("archive entry %q: not a relative path", p)
+	}
+
+	name = path.Clean(name)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("archive entry %q: outside the archive", p)
+	}
+
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = safeName(segment, windowsForbiddenChars)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// hasDrive checks whether a path starts with a Windows drive letter, e.g. "C:".
+func hasDrive(p string) bool {
+	return len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z')
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package mapping
+
+// forbiddenChars are the characters that cannot be used in file names, besides
+// control characters. The backslash is included so that the mirror can be copied
+// to Windows, where it is a separator.
+const forbiddenChars = `/\`
@@ -0,0 +1,5 @@
+package mapping
+
+// forbiddenChars are the characters that cannot be used in file names, besides
+// control characters.
+const forbiddenChars = windowsForbiddenChars
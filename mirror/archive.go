@@ -0,0 +1,130 @@
+package mirror
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// WriteZip writes the files in dir into a zip archive called name, which is written
+// under a temporary name and then renamed. The entries are named as in
+// mapping.ArchiveName, so extracting the archive cannot write outside the directory
+// it is extracted into. Symbolic links are stored as the files they refer to, provided
+// that these are within dir; others are skipped. Entries whose names differ only in
+// case are also skipped after the first, because they would overwrite each other
+// when extracted on Windows or macOS. It returns the number of entries and the paths
+// that were skipped as duplicates.
+func WriteZip(dir, name string) (entries int, duplicates []string, err error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	archive, err := filepath.Abs(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	temp := archive + ".tmp"
+
+	f, err := os.Create(temp)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer os.Remove(temp) // fails harmlessly after the rename
+
+	zw := zip.NewWriter(f)
+	seen := make(map[string]bool)
+
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path == archive || path == temp {
+			return err
+		}
+
+		info, err := os.Stat(path) // follows symbolic links
+		if err != nil || !info.Mode().IsRegular() || !within(root, path) {
+			return nil // dangling links, sockets, devices etc are skipped
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		entryName, err := mapping.ArchiveName(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(entryName)
+		if seen[key] {
+			duplicates = append(duplicates, entryName)
+			return nil
+		}
+		seen[key] = true
+
+		if err := addToZip(zw, path, entryName, info); err != nil {
+			return err
+		}
+		entries++
+		return nil
+	})
+
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("writing archive %s: %w", name, err)
+	}
+
+	return entries, duplicates, os.Rename(temp, archive)
+}
+
+// within checks that a file, after resolving any symbolic links, is within root.
+func within(root, path string) bool {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+func addToZip(zw *zip.Writer, path, entryName string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = entryName
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package mirror
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteZip(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "Logo.png"), "logo")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.png"), "other logo")
+	writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+	require.NoError(t, os.Symlink(filepath.Join("img", "Logo.png"), filepath.Join(dir, "example.org", "copy.png")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "example.org", "secret.txt")))
+
+	name := filepath.Join(dir, "site.zip") // within dir, so must not archive itself
+	entries, duplicates, err := WriteZip(dir, name)
+	require.NoError(t, err)
+	assert.Equal(t, 3, entries)
+	assert.Equal(t, []string{"example.org/img/logo.png"}, duplicates)
+
+	zr, err := zip.OpenReader(name)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		contents[f.Name] = string(data)
+	}
+
+	assert.Equal(t, map[string]string{
+		"example.org/copy.png":     "logo",
+		"example.org/img/Logo.png": "logo",
+		"example.org/index.html":   "home",
+	}, contents)
+
+	_, err = os.Stat(name + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
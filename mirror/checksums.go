@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/spf13/afero"
+)
+
+// ChecksumsFileName is the name of the files that list the SHA-256 hashes of the stored
+// files, in the format of sha256sum, so that they can be verified with standard tools,
+// e.g. "sha256sum -c SHA256SUMS".
+const ChecksumsFileName = "SHA256SUMS"
+
+// Where the checksums are written.
+const (
+	ChecksumsTop          = "top" // one file at the top of the output directory
+	ChecksumsPerDirectory = "dir" // one file in each directory, listing the files in it
+)
+
+// WriteChecksums hashes the files stored in dir and writes them into ChecksumsFileName,
+// either one file at the top of dir, or one in each directory that has files, according
+// to where. It returns the number of files hashed.
+func WriteChecksums(dir, where string) (int, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	byDir := make(map[string]*bytes.Buffer) // key is relative to dir, with forward slashes
+	for _, f := range files {
+		hash, err := hashOf(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return 0, err
+		}
+
+		parent, name := ".", f.Path
+		if where == ChecksumsPerDirectory {
+			parent, name = path.Split(f.Path)
+		}
+
+		buf, ok := byDir[parent]
+		if !ok {
+			buf = &bytes.Buffer{}
+			byDir[parent] = buf
+		}
+		fmt.Fprintf(buf, "%s  %s\n", hash, name) // two spaces, for binary and text alike
+	}
+
+	if where == ChecksumsTop && len(files) == 0 {
+		byDir["."] = &bytes.Buffer{}
+	}
+
+	for _, parent := range slices.Sorted(maps.Keys(byDir)) {
+		name := filepath.Join(dir, filepath.FromSlash(parent), ChecksumsFileName)
+		if _, err := ioutil.WriteFileAtomically(afero.NewOsFs(), name, byDir[parent]); err != nil {
+			return 0, fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+	return len(files), nil
+}
@@ -0,0 +1,45 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA-256 hashes of "home" and "logo".
+const (
+	homeHash = "4ea140588150773ce3aace786aeef7f4049ce100fa649c94fbbddb960f1da942"
+	logoHash = "3598ce6f965b2481fe26316c06b30950c46ac7f8e7229f104aa78f579997668d"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "example.org", "index.html.headers.json"), "{}")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.png"), "logo")
+	writeFile(t, filepath.Join(dir, "_text", "example.org", "index.txt"), "home")
+	writeFile(t, filepath.Join(dir, "manifest.sha256"), "")
+
+	files, err := WriteChecksums(dir, ChecksumsTop)
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+
+	data, err := os.ReadFile(filepath.Join(dir, ChecksumsFileName))
+	require.NoError(t, err)
+	assert.Equal(t, logoHash+"  example.org/img/logo.png\n"+homeHash+"  example.org/index.html\n", string(data))
+
+	files, err = WriteChecksums(dir, ChecksumsPerDirectory)
+	require.NoError(t, err)
+	assert.Equal(t, 2, files, "the checksums files are not themselves listed")
+
+	data, err = os.ReadFile(filepath.Join(dir, "example.org", ChecksumsFileName))
+	require.NoError(t, err)
+	assert.Equal(t, homeHash+"  index.html\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "example.org", "img", ChecksumsFileName))
+	require.NoError(t, err)
+	assert.Equal(t, logoHash+"  logo.png\n", string(data))
+}
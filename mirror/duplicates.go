@@ -0,0 +1,93 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// How duplicate files are linked.
+const (
+	LinkHard     = "hard"
+	LinkSymbolic = "symlink"
+)
+
+// LinkDuplicates replaces the files that have identical content with links to one copy
+// of them, which is the first in each group. The groups hold paths relative to dir,
+// with forward slashes, e.g. as found by manifest.Duplicates. Each link is made under a
+// temporary name and then renamed, so the files are never missing. Files that are
+// already the same file, or missing, are skipped. It returns the number of files linked and the
+// space saved.
+//
+// Hard links are safe because files are always replaced by renaming (see
+// ioutil.WriteFileAtomically), so writing one of them never alters the others.
+// Symbolic links are relative, so the mirror can be moved, but a symbolic link keeps
+// following its target if the target changes later.
+func LinkDuplicates(dir string, groups map[string][]string, how string) (linked int, saved int64, err error) {
+	for _, hash := range slices.Sorted(maps.Keys(groups)) {
+		files := slices.Sorted(slices.Values(groups[hash]))
+		original := filepath.Join(dir, filepath.FromSlash(files[0]))
+
+		originalInfo, err := os.Stat(original)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // the manifest is out of date
+		} else if err != nil {
+			return linked, saved, err
+		}
+
+		for _, file := range files[1:] {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+			info, err := os.Lstat(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return linked, saved, err
+			}
+
+			if os.SameFile(originalInfo, info) || info.Mode()&os.ModeSymlink != 0 {
+				continue // already linked
+			}
+
+			if err := link(original, path, how); err != nil {
+				return linked, saved, err
+			}
+			linked++
+			saved += info.Size()
+		}
+	}
+	return linked, saved, nil
+}
+
+func link(original, path, how string) error {
+	tmp := path + ".link"
+	_ = os.Remove(tmp)
+
+	switch how {
+	case LinkHard:
+		if err := os.Link(original, tmp); err != nil {
+			return fmt.Errorf("linking %s: %w", path, err)
+		}
+
+	case LinkSymbolic:
+		target, err := filepath.Rel(filepath.Dir(path), original)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return fmt.Errorf("linking %s: %w", path, err)
+		}
+
+	default:
+		return fmt.Errorf("unknown kind of link %q", how)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("linking %s: %w", path, err)
+	}
+	return nil
+}
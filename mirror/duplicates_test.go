@@ -0,0 +1,53 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkDuplicates(t *testing.T) {
+	for _, how := range []string{LinkHard, LinkSymbolic} {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "example.org", "logo.png"), "logo")
+		writeFile(t, filepath.Join(dir, "www.example.org", "img", "logo.png"), "logo")
+		writeFile(t, filepath.Join(dir, "www.example.org", "other.png"), "logo")
+
+		groups := map[string][]string{
+			"h1": {"www.example.org/img/logo.png", "example.org/logo.png", "www.example.org/other.png", "www.example.org/gone.png"},
+		}
+
+		linked, saved, err := LinkDuplicates(dir, groups, how)
+		require.NoError(t, err, how)
+		assert.Equal(t, 2, linked, how)
+		assert.Equal(t, int64(8), saved, how)
+
+		original, _ := os.Stat(filepath.Join(dir, "example.org", "logo.png"))
+		for _, file := range []string{"www.example.org/img/logo.png", "www.example.org/other.png"} {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+			assertContent(t, path, "logo")
+			info, _ := os.Stat(path)
+			assert.True(t, os.SameFile(original, info), file)
+		}
+
+		if how == LinkSymbolic {
+			target, err := os.Readlink(filepath.Join(dir, "www.example.org", "img", "logo.png"))
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join("..", "..", "example.org", "logo.png"), target)
+		}
+
+		// again, nothing changes
+		linked, _, err = LinkDuplicates(dir, groups, how)
+		require.NoError(t, err, how)
+		assert.Zero(t, linked, how)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
@@ -0,0 +1,235 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// What is done with the versions of fingerprinted assets.
+const (
+	FingerprintsReport  = "report"
+	FingerprintsCollect = "collect"
+)
+
+// referringExtensions are the extensions of the files whose content can refer to
+// fingerprinted assets.
+var referringExtensions = []string{".html", ".htm", ".css", ".js", ".mjs", ".json", ".map", ".svg", ".xml", ".webmanifest"}
+
+// AssetVersions are the versions of one fingerprinted asset, e.g. "app.a1b2c3.js" and
+// "app.d4e5f6.js", which are files in the same directory whose names differ only by
+// their fingerprints. Every re-crawl of a site whose assets have changed adds more of
+// them. The paths are relative to the output directory, with forward slashes.
+type AssetVersions struct {
+	Asset      string     // the name without a fingerprint, e.g. "example.org/js/app.js"
+	Files      []string   // the versions, sorted by path
+	Identical  [][]string // the groups of versions with identical content
+	Referenced []string   // the versions referred to by the pages, directly or indirectly
+}
+
+// assetName gets the name of the asset stored in file without its fingerprint, if it
+// has one. A fingerprint is one of the parts of the name separated by dots or hyphens,
+// e.g. "app.a1b2c3.js", "styles-3F7KQ2ZB.css" or "main.a1b2c3d4.chunk.js"; a source
+// map such as "app.a1b2c3.js.map" belongs to the asset "app.js.map".
+func assetName(file string) (string, bool) {
+	dir, name := path.Split(file)
+	ext := path.Ext(name)
+	if ext == "" || mapping.IsPageURL(&url.URL{Path: name}) {
+		return "", false
+	}
+
+	stem := strings.TrimSuffix(name, ext)
+	for i := len(stem) - 1; i > 0; i-- {
+		if stem[i] != '.' && stem[i] != '-' {
+			continue
+		}
+
+		end := strings.IndexAny(stem[i+1:], ".-")
+		if end < 0 {
+			end = len(stem)
+		} else {
+			end += i + 1
+		}
+
+		if isFingerprint(stem[i+1 : end]) {
+			return dir + stem[:i] + stem[end:] + ext, true
+		}
+	}
+	return "", false
+}
+
+// isFingerprint checks whether part of a name looks like a hash: hexadecimal, or at
+// least eight letters and digits, including both.
+func isFingerprint(s string) bool {
+	if len(s) < 6 || len(s) > 64 {
+		return false
+	}
+
+	var digits, letters, nonHex int
+	for _, r := range s {
+		switch {
+		case '0' <= r && r <= '9':
+			digits++
+		case 'a' <= r && r <= 'f', 'A' <= r && r <= 'F':
+			letters++
+		case 'g' <= r && r <= 'z', 'G' <= r && r <= 'Z', r == '_':
+			letters++
+			nonHex++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && letters > 0 && (nonHex == 0 || len(s) >= 8)
+}
+
+// FingerprintedAssets finds the fingerprinted assets stored in dir that have more than
+// one version. Which versions have identical content is found by hashing them. Which
+// versions are still referred to is found by searching for their names, starting with
+// the stored pages and stylesheets and continuing with the versions they refer to, so
+// that a script loaded only by an old script does not count.
+func FingerprintedAssets(dir string) ([]AssetVersions, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byAsset := make(map[string][]string)
+	for _, f := range files {
+		if asset, ok := assetName(f.Path); ok {
+			byAsset[asset] = append(byAsset[asset], f.Path)
+		}
+	}
+	maps.DeleteFunc(byAsset, func(_ string, versions []string) bool { return len(versions) < 2 })
+	if len(byAsset) == 0 {
+		return nil, nil
+	}
+
+	versions := make(map[string]bool)
+	for _, v := range byAsset {
+		for _, file := range v {
+			versions[file] = true
+		}
+	}
+
+	referenced, err := findReferenced(dir, files, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make([]AssetVersions, 0, len(byAsset))
+	for _, asset := range slices.Sorted(maps.Keys(byAsset)) {
+		av := AssetVersions{Asset: asset, Files: slices.Sorted(slices.Values(byAsset[asset]))}
+
+		byHash := make(map[string][]string)
+		for _, file := range av.Files {
+			hash, err := hashOf(filepath.Join(dir, filepath.FromSlash(file)))
+			if err != nil {
+				return nil, err
+			}
+			byHash[hash] = append(byHash[hash], file)
+
+			if referenced[file] {
+				av.Referenced = append(av.Referenced, file)
+			}
+		}
+
+		for _, hash := range slices.Sorted(maps.Keys(byHash)) {
+			if len(byHash[hash]) > 1 {
+				av.Identical = append(av.Identical, byHash[hash])
+			}
+		}
+		assets = append(assets, av)
+	}
+	return assets, nil
+}
+
+// findReferenced finds which versions are referred to by the other files, directly or
+// via other versions that are referred to.
+func findReferenced(dir string, files []storedFile, versions map[string]bool) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	var queue []string
+
+	search := func(file string) error {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return fmt.Errorf("searching %s: %w", file, err)
+		}
+
+		for v := range versions {
+			if !referenced[v] && v != file && bytes.Contains(data, []byte(path.Base(v))) {
+				referenced[v] = true
+				queue = append(queue, v)
+			}
+		}
+		return nil
+	}
+
+	for _, f := range files {
+		if !versions[f.Path] && slices.Contains(referringExtensions, strings.ToLower(path.Ext(f.Path))) {
+			if err := search(f.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if slices.Contains(referringExtensions, strings.ToLower(path.Ext(file))) {
+			if err := search(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func hashOf(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CollectSuperseded removes the versions of each asset that are not referred to when
+// some other version of it is, along with their sidecar files. When no version is
+// referred to, all are kept, because the references may be in files that were not
+// stored. It returns the files removed.
+func CollectSuperseded(dir string, assets []AssetVersions) ([]string, error) {
+	var removed []string
+	for _, av := range assets {
+		if len(av.Referenced) == 0 {
+			continue
+		}
+
+		for _, file := range av.Files {
+			if slices.Contains(av.Referenced, file) {
+				continue
+			}
+
+			if err := removeStored(dir, file); err != nil {
+				return removed, err
+			}
+			removed = append(removed, file)
+		}
+	}
+	return removed, nil
+}
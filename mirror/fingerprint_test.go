@@ -0,0 +1,75 @@
+package mirror
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetName(t *testing.T) {
+	cases := map[string]string{
+		"example.org/js/app.a1b2c3.js":          "example.org/js/app.js",
+		"example.org/css/styles-3F7KQ2ZB.css":   "example.org/css/styles.css",
+		"example.org/js/main.a1b2c3d4.chunk.js": "example.org/js/main.chunk.js",
+		"example.org/js/app.a1b2c3.js.map":      "example.org/js/app.js.map",
+		"example.org/js/jquery-3.6.0.min.js":    "",
+		"example.org/js/bootstrap.bundle.js":    "",
+		"example.org/img/photo-20240101.jpg":    "",
+		"example.org/a1b2c3.js":                 "",
+		"example.org/page.a1b2c3.html":          "",
+	}
+
+	for file, expected := range cases {
+		asset, ok := assetName(file)
+		assert.Equal(t, expected, asset, file)
+		assert.Equal(t, expected != "", ok, file)
+	}
+}
+
+func TestFingerprintedAssets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), `<script src="js/app.d4e5f6.js"></script><link href="css/site.1a2b3c.css">`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "app.a1b2c3.js"), `import "./chunk.00aa11.js"`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "app.a1b2c3.js.headers.json"), `{}`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "app.d4e5f6.js"), `import "./chunk.22bb33.js"`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "app.0f0f0f.js"), `import "./chunk.22bb33.js"`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "chunk.00aa11.js"), `old`)
+	writeFile(t, filepath.Join(dir, "example.org", "js", "chunk.22bb33.js"), `new`)
+	writeFile(t, filepath.Join(dir, "example.org", "css", "site.1a2b3c.css"), `a{}`)
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.a9b8c7.png"), `logo`)
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.c7b8a9.png"), `logo`)
+
+	assets, err := FingerprintedAssets(dir)
+	require.NoError(t, err)
+	require.Len(t, assets, 3)
+
+	assert.Equal(t, AssetVersions{
+		Asset:      "example.org/img/logo.png",
+		Files:      []string{"example.org/img/logo.a9b8c7.png", "example.org/img/logo.c7b8a9.png"},
+		Identical:  [][]string{{"example.org/img/logo.a9b8c7.png", "example.org/img/logo.c7b8a9.png"}},
+		Referenced: nil,
+	}, assets[0])
+
+	assert.Equal(t, AssetVersions{
+		Asset:      "example.org/js/app.js",
+		Files:      []string{"example.org/js/app.0f0f0f.js", "example.org/js/app.a1b2c3.js", "example.org/js/app.d4e5f6.js"},
+		Identical:  [][]string{{"example.org/js/app.0f0f0f.js", "example.org/js/app.d4e5f6.js"}},
+		Referenced: []string{"example.org/js/app.d4e5f6.js"},
+	}, assets[1])
+
+	assert.Equal(t, "example.org/js/chunk.js", assets[2].Asset)
+	assert.Equal(t, []string{"example.org/js/chunk.22bb33.js"}, assets[2].Referenced)
+
+	removed, err := CollectSuperseded(dir, assets)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org/js/app.0f0f0f.js", "example.org/js/app.a1b2c3.js", "example.org/js/chunk.00aa11.js"}, removed)
+
+	for _, file := range []string{"js/app.a1b2c3.js", "js/app.a1b2c3.js.headers.json", "js/chunk.00aa11.js"} {
+		assert.NoFileExists(t, filepath.Join(dir, "example.org", filepath.FromSlash(file)))
+	}
+	for _, file := range []string{"js/app.d4e5f6.js", "js/chunk.22bb33.js", "img/logo.a9b8c7.png", "img/logo.c7b8a9.png"} {
+		assert.FileExists(t, filepath.Join(dir, "example.org", filepath.FromSlash(file)))
+	}
+}
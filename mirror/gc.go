@@ -0,0 +1,142 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// Orphans finds the files stored in dir that are neither retained by keep, e.g.
+// because they are listed in the manifest, nor referred to by the pages and
+// stylesheets that are, directly or indirectly. So a file that only an orphan page
+// refers to is an orphan too. In a long-lived incremental mirror, these are typically
+// left over from pages and assets that the website no longer has. The paths are
+// relative to dir, with forward slashes.
+func Orphans(dir string, keep func(file string) bool) ([]string, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := hostDirs(files)
+	stored := make(map[string]bool, len(files))
+	reached := make(map[string]bool)
+	var queue []string
+
+	for _, f := range files {
+		stored[f.Path] = true
+		if keep(f.Path) {
+			reached[f.Path] = true
+			queue = append(queue, f.Path)
+		}
+	}
+
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+
+		refs, err := referencesIn(dir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			if target, ok := referencedFile(ref, hosts); ok && stored[target] && !reached[target] {
+				reached[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	var orphans []string
+	for _, f := range files {
+		if !reached[f.Path] {
+			orphans = append(orphans, f.Path)
+		}
+	}
+	return orphans, nil
+}
+
+// referencesIn finds the references in a stored page or stylesheet, resolved against
+// its path within dir.
+func referencesIn(dir, file string) ([]*url.URL, error) {
+	ext := strings.ToLower(path.Ext(file))
+	if ext != ".html" && ext != ".htm" && ext != ".css" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, fmt.Errorf("searching %s: %w", file, err)
+	}
+
+	u := &url.URL{Path: "/" + file}
+	if ext == ".css" {
+		_, refs := document.CheckCSSForUrls(u, "", data, nil)
+		return refs, nil
+	}
+	return document.ScanReferences(u, data), nil
+}
+
+// referencedFile gets the stored file that a reference found in a stored file refers
+// to. Relative references have already been resolved against the stored file.
+func referencedFile(ref *url.URL, hosts map[string]bool) (string, bool) {
+	switch {
+	case ref.Host != "" && (ref.Scheme == "http" || ref.Scheme == "https"):
+		return storedTarget(ref, hosts)
+
+	case ref.Host == "" && ref.Scheme == "" && ref.Path != "":
+		file := strings.TrimPrefix(path.Clean(ref.Path), "/")
+		if strings.HasSuffix(ref.Path, "/") {
+			file = path.Join(file, mapping.PageDirIndex)
+		}
+		return file, true
+
+	default:
+		return "", false
+	}
+}
+
+// hostDirs gets the set of host directories that hold the stored files.
+func hostDirs(files []storedFile) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, f := range files {
+		hosts[f.Path[:strings.IndexByte(f.Path, '/')]] = true
+	}
+	return hosts
+}
+
+// RemoveFiles removes stored files, given relative to dir, along with their sidecar
+// files. Files that are already missing are skipped.
+func RemoveFiles(dir string, files []string) error {
+	for _, file := range files {
+		if err := removeStored(dir, file); err != nil {
+			return fmt.Errorf("removing %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// removeStored removes a stored file, given relative to dir, along with its sidecar files.
+func removeStored(dir, file string) error {
+	name := filepath.Join(dir, filepath.FromSlash(file))
+	for _, sidecar := range []string{name + download.HeadersExtension, name + download.DiffExtension} {
+		if err := os.Remove(sidecar); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package mirror
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrphans(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), `<a href="docs/">Docs</a><link rel="stylesheet" href="css/site.css"><a href="https://www.example.org/about">About</a>`)
+	writeFile(t, filepath.Join(dir, "example.org", "docs", "index.html"), `<img src="../img/logo.png">`)
+	writeFile(t, filepath.Join(dir, "example.org", "css", "site.css"), `body { background: url("../img/bg.png") }`)
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.png"), "logo")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "bg.png"), "bg")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "old.png"), "old")
+	writeFile(t, filepath.Join(dir, "example.org", "img", "old.png.headers.json"), "{}")
+	writeFile(t, filepath.Join(dir, "example.org", "gone.html"), `<img src="img/gone.png">`)
+	writeFile(t, filepath.Join(dir, "example.org", "img", "gone.png"), "gone")
+	writeFile(t, filepath.Join(dir, "www.example.org", "about.html"), "about")
+	writeFile(t, filepath.Join(dir, "www.example.org", "kept.html"), "kept")
+
+	inManifest := []string{"example.org/index.html", "www.example.org/kept.html"}
+	orphans, err := Orphans(dir, func(file string) bool { return slices.Contains(inManifest, file) })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org/gone.html", "example.org/img/gone.png", "example.org/img/old.png"}, orphans)
+
+	require.NoError(t, RemoveFiles(dir, orphans))
+	assert.NoFileExists(t, filepath.Join(dir, "example.org", "gone.html"))
+	assert.NoFileExists(t, filepath.Join(dir, "example.org", "img", "old.png"))
+	assert.NoFileExists(t, filepath.Join(dir, "example.org", "img", "old.png.headers.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "example.org", "img", "gone.png"))
+	assert.FileExists(t, filepath.Join(dir, "example.org", "img", "bg.png"))
+
+	orphans, err = Orphans(dir, func(file string) bool { return slices.Contains(inManifest, file) })
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxListedChanges limits how many files are listed in each commit message.
+const maxListedChanges = 100
+
+// Changes summarises the files changed by a crawl.
+type Changes struct {
+	Added, Modified, Deleted []string
+}
+
+// Empty returns true if nothing changed.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// Summary gives a one-line description of the changes.
+func (c Changes) Summary() string {
+	return fmt.Sprintf("%d added, %d changed, %d deleted", len(c.Added), len(c.Modified), len(c.Deleted))
+}
+
+// GitCommit records the current state of dir as a commit in the git repository in
+// that directory, which is created if necessary. Every added, changed and deleted file
+// is included. Nothing is committed if there are no changes. The git command must be
+// installed.
+func GitCommit(ctx context.Context, dir string, when time.Time) (Changes, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		if _, err := git(ctx, dir, "init", "--quiet"); err != nil {
+			return Changes{}, err
+		}
+	}
+
+	if _, err := git(ctx, dir, "add", "--all", "."); err != nil {
+		return Changes{}, err
+	}
+
+	status, err := git(ctx, dir, "diff", "--cached", "--name-status", "--no-renames", "-z")
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes := parseNameStatus(status)
+	if changes.Empty() {
+		return changes, nil
+	}
+
+	message := fmt.Sprintf("Scraped at %s: %s\n\n%s", when.UTC().Format(time.RFC3339), changes.Summary(), changes.list())
+
+	args := []string{"commit", "--quiet", "--no-verify", "--file", "-"}
+	if _, err := git(ctx, dir, "config", "user.email"); err != nil {
+		// no identity has been configured, so provide one
+		args = append([]string{"-c", "user.name=goscrape", "-c", "user.email=goscrape@localhost"}, args...)
+	}
+
+	if _, err := gitWithInput(ctx, dir, message, args...); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
+
+// parseNameStatus parses the NUL-separated output of git diff --name-status -z.
+func parseNameStatus(output string) Changes {
+	var changes Changes
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, name := fields[i], fields[i+1]
+		switch {
+		case strings.HasPrefix(status, "A"):
+			changes.Added = append(changes.Added, name)
+		case strings.HasPrefix(status, "D"):
+			changes.Deleted = append(changes.Deleted, name)
+		default:
+			changes.Modified = append(changes.Modified, name)
+		}
+	}
+	return changes
+}
+
+func (c Changes) list() string {
+	buf := &strings.Builder{}
+	n := 0
+	for _, group := range []struct {
+		prefix string
+		names  []string
+	}{{"A", c.Added}, {"M", c.Modified}, {"D", c.Deleted}} {
+		for _, name := range group.names {
+			if n == maxListedChanges {
+				fmt.Fprintf(buf, "...and %d more\n", len(c.Added)+len(c.Modified)+len(c.Deleted)-n)
+				return buf.String()
+			}
+			fmt.Fprintf(buf, "%s %s\n", group.prefix, name)
+			n++
+		}
+	}
+	return buf.String()
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	return gitWithInput(ctx, dir, "", args...)
+}
+
+func gitWithInput(ctx context.Context, dir, input string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,56 @@
+package mirror
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	when := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "example.org"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.org", "index.html"), []byte("v1"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.org", "old.html"), []byte("old"), 0o644))
+
+	changes, err := GitCommit(ctx, dir, when)
+	require.NoError(t, err)
+	assert.Equal(t, "2 added, 0 changed, 0 deleted", changes.Summary())
+
+	// no changes gives no commit
+	changes, err = GitCommit(ctx, dir, when)
+	require.NoError(t, err)
+	assert.True(t, changes.Empty())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.org", "index.html"), []byte("v2"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.org", "new.html"), []byte("new"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "example.org", "old.html")))
+
+	changes, err = GitCommit(ctx, dir, when.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, Changes{
+		Added:    []string{"example.org/new.html"},
+		Modified: []string{"example.org/index.html"},
+		Deleted:  []string{"example.org/old.html"},
+	}, changes)
+
+	log, err := git(ctx, dir, "log", "--format=%s")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Scraped at 2024-03-01T11:00:00Z: 1 added, 1 changed, 1 deleted",
+		"Scraped at 2024-03-01T10:00:00Z: 2 added, 0 changed, 0 deleted",
+	}, strings.Split(strings.TrimSpace(log), "\n"))
+}
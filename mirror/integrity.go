@@ -0,0 +1,55 @@
+package mirror
+
+import (
+	"slices"
+)
+
+// DanglingReference is a local reference in a stored page or stylesheet that does not
+// lead to a stored file. The paths are relative to the output directory, with forward
+// slashes.
+type DanglingReference struct {
+	File   string // the page or stylesheet
+	Target string // the missing file
+}
+
+// DanglingReferences checks that every local reference in the pages and stylesheets
+// stored in dir leads to a stored file, which is the offline equivalent of checking
+// for broken links. Absolute references, e.g. to other websites, are not checked.
+// Links to pages that were beyond the crawl's limits are reported too, because they
+// were rewritten all the same. It returns the dangling references, sorted by file.
+func DanglingReferences(dir string) ([]DanglingReference, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(files))
+	for _, f := range files {
+		stored[f.Path] = true
+	}
+
+	var dangling []DanglingReference
+	for _, f := range files {
+		refs, err := referencesIn(dir, f.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var missing []string
+		for _, ref := range refs {
+			if ref.Scheme != "" || ref.Host != "" {
+				continue
+			}
+
+			if target, ok := referencedFile(ref, nil); ok && !stored[target] && !slices.Contains(missing, target) {
+				missing = append(missing, target)
+			}
+		}
+
+		slices.Sort(missing)
+		for _, target := range missing {
+			dangling = append(dangling, DanglingReference{File: f.Path, Target: target})
+		}
+	}
+	return dangling, nil
+}
@@ -0,0 +1,28 @@
+package mirror
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDanglingReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"),
+		`<a href="docs/index.html#intro">Docs</a><a href="#top">Top</a><a href="missing.html">Missing</a>`+
+			`<a href="missing.html">Again</a><a href="https://other.org/">Other</a><a href="mailto:me@example.org">Mail</a>`+
+			`<img src="img/logo.png?v=2"><link rel="stylesheet" href="css/site.css">`)
+	writeFile(t, filepath.Join(dir, "example.org", "docs", "index.html"), `<a href="../index.html">Home</a><img src="../img/gone.png">`)
+	writeFile(t, filepath.Join(dir, "example.org", "css", "site.css"), `body { background: url("../img/bg.png") }`)
+	writeFile(t, filepath.Join(dir, "example.org", "img", "logo.png"), "logo")
+
+	dangling, err := DanglingReferences(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []DanglingReference{
+		{File: "example.org/css/site.css", Target: "example.org/img/bg.png"},
+		{File: "example.org/docs/index.html", Target: "example.org/img/gone.png"},
+		{File: "example.org/index.html", Target: "example.org/missing.html"},
+	}, dangling)
+}
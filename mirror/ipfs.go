@@ -0,0 +1,146 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AddToIPFS adds the files in dir to the IPFS node whose HTTP API is at api, e.g.
+// "http://127.0.0.1:5001", and pins them. It returns the CID of the directory, which
+// is named after dir, and the number of files. The files are streamed to the node, so
+// the mirror is never held in memory.
+func AddToIPFS(ctx context.Context, client *http.Client, api, dir string) (string, int, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	files, err := publishedFiles(root)
+	if err != nil {
+		return "", 0, err
+	}
+
+	endpoint, err := url.JoinPath(api, "/api/v0/add")
+	if err != nil {
+		return "", 0, fmt.Errorf("ipfs api %q: %w", api, err)
+	}
+	endpoint += "?recursive=true&pin=true&cid-version=1"
+
+	name := filepath.Base(root)
+	body, w := io.Pipe()
+	defer body.Close() // stops the writer if the node gives up early
+	mw := multipart.NewWriter(w)
+	go func() {
+		w.CloseWithError(writeIPFSParts(mw, name, files))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("adding to ipfs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", 0, fmt.Errorf("adding to ipfs: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	// the node replies with a JSON object for each file and directory added
+	var cid string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var added struct {
+			Name    string
+			Hash    string
+			Message string // set when an error arises part way
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &added); err != nil {
+			return "", 0, fmt.Errorf("adding to ipfs: %w", err)
+		}
+		if added.Message != "" {
+			return "", 0, fmt.Errorf("adding to ipfs: %s", added.Message)
+		}
+		if added.Name == name {
+			cid = added.Hash
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, fmt.Errorf("adding to ipfs: %w", err)
+	}
+	if cid == "" {
+		return "", 0, fmt.Errorf("adding to ipfs: no CID was given for %s", name)
+	}
+	return cid, len(files), nil
+}
+
+// writeIPFSParts writes each directory and file as a part of the form, as the IPFS API
+// expects for adding a directory tree. The parts are named by their paths within the
+// tree, whose root is name.
+func writeIPFSParts(mw *multipart.Writer, name string, files []publishedFile) error {
+	dirs := map[string]bool{}
+	part := func(name, contentType string) (io.Writer, error) {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, url.QueryEscape(name)))
+		header.Set("Content-Type", contentType)
+		return mw.CreatePart(header)
+	}
+
+	var addDir func(dir string) error
+	addDir = func(dir string) error {
+		if dirs[dir] {
+			return nil
+		}
+		if parent := path.Dir(dir); parent != "." {
+			if err := addDir(parent); err != nil {
+				return err
+			}
+		}
+		dirs[dir] = true
+		_, err := part(dir, "application/x-directory")
+		return err
+	}
+
+	if err := addDir(name); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		p := path.Join(name, f.path)
+		if err := addDir(path.Dir(p)); err != nil {
+			return err
+		}
+
+		w, err := part(p, "application/octet-stream")
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(f.abs)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.path, err)
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,74 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddToIPFS(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "example.org")
+	writeFile(t, filepath.Join(dir, "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "img", "a logo.png"), "logo")
+
+	parts := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v0/add", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("pin"))
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+
+			name, err := url.QueryUnescape(part.FileName())
+			require.NoError(t, err)
+			content, err := io.ReadAll(part)
+			require.NoError(t, err)
+			parts[name] = part.Header.Get("Content-Type") + " " + string(content)
+			fmt.Fprintf(w, `{"Name":%q,"Hash":"cid-%d"}`+"\n", name, len(parts))
+		}
+	}))
+	defer server.Close()
+
+	cid, files, err := AddToIPFS(context.Background(), server.Client(), server.URL, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "cid-1", cid)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, map[string]string{
+		"example.org":                "application/x-directory ",
+		"example.org/img":            "application/x-directory ",
+		"example.org/img/a logo.png": "application/octet-stream logo",
+		"example.org/index.html":     "application/octet-stream home",
+	}, parts)
+}
+
+func TestAddToIPFSError(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "index.html"), "home")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		fmt.Fprintln(w, `{"Message":"pinning failed"}`)
+	}))
+	defer server.Close()
+
+	_, _, err := AddToIPFS(context.Background(), server.Client(), server.URL, dir)
+	require.ErrorContains(t, err, "pinning failed")
+}
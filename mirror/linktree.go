@@ -0,0 +1,85 @@
+// Package mirror manages the directories that hold the downloaded files, so that a
+// published mirror is only ever replaced by a complete crawl.
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LinkTree recreates the directory tree src as dst, in which every file is a hard link
+// to the corresponding file in src. Files are copied instead when they can't be linked,
+// e.g. because dst is on a different device. Unchanged files therefore cost no space.
+//
+// This is safe because files are always replaced by renaming (see ioutil.WriteFileAtomically),
+// so writing to dst never alters the files in src.
+func LinkTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case entry.IsDir():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode().Perm())
+
+		case entry.Type().IsRegular():
+			if err := os.Link(path, target); err != nil {
+				return copyFile(path, target)
+			}
+			return nil
+
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		default:
+			return nil // sockets, devices etc are ignored
+		}
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copying %s: %w", src, err)
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
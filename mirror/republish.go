@@ -0,0 +1,166 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/spf13/afero"
+)
+
+// Republish makes a copy of the mirror in src as dst, which must not yet exist, with
+// the links in its pages rewritten for hosting the copy elsewhere. The copy is made
+// using hard links, so only the rewritten pages take extra space.
+//
+// When base is nil, every link to a mirrored file becomes relative, including the
+// absolute links from one mirrored website to another. Otherwise, every link to a
+// mirrored file becomes absolute, for hosting the copy at base, e.g.
+// "https://archive.example.net/", at which the host directories are found. Links to
+// websites that were not mirrored are unchanged. It returns the number of pages
+// rewritten.
+func Republish(src, dst string, base *url.URL) (int, error) {
+	if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("republishing: %s already exists", dst)
+	}
+
+	if err := LinkTree(src, dst); err != nil {
+		return 0, fmt.Errorf("republishing: %w", err)
+	}
+
+	files, err := storedFiles(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	rp := republisher{hosts: hostDirs(files), base: base}
+	if base != nil {
+		root := *base
+		if !strings.HasSuffix(root.Path, "/") {
+			root.Path += "/"
+		}
+		rp.base = &root
+	}
+
+	n := 0
+	for _, f := range files {
+		if !isStoredPage(f.Path) {
+			continue
+		}
+
+		changed, err := rp.rewritePage(dst, f)
+		if err != nil {
+			return n, err
+		}
+		if changed {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type republisher struct {
+	hosts map[string]bool // the host directories
+	base  *url.URL        // nil for relative links
+}
+
+func (rp republisher) rewritePage(dir string, f storedFile) (bool, error) {
+	name := filepath.Join(dir, filepath.FromSlash(f.Path))
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return false, fmt.Errorf("republishing: %w", err)
+	}
+
+	u := &url.URL{Path: "/" + f.Path}
+	doc, err := document.ParseHTML(u, u, bytes.NewReader(data), nil)
+	if err != nil {
+		return false, fmt.Errorf("republishing %s: %w", f.Path, err)
+	}
+
+	if doc.RewriteLinks(func(ref string) string { return rp.link(f.Path, ref) }) == 0 {
+		return false, nil
+	}
+
+	rendered, err := doc.Render()
+	if err != nil {
+		return false, fmt.Errorf("republishing %s: %w", f.Path, err)
+	}
+
+	// this replaces the hard link, leaving the file in the source unaltered
+	if _, err = ioutil.WriteFileAtomically(afero.NewOsFs(), name, bytes.NewReader(rendered)); err != nil {
+		return false, fmt.Errorf("republishing %s: %w", f.Path, err)
+	}
+
+	// the modification time is the Last-Modified time of the page, where known
+	return true, os.Chtimes(name, f.Modified, f.Modified)
+}
+
+// link rewrites one reference in the page stored at page. Both page and the
+// target are paths relative to the output directory.
+func (rp republisher) link(page, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return ref
+	}
+
+	var target string
+	switch {
+	case u.Host != "" && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https"):
+		var mirrored bool
+		if target, mirrored = storedTarget(u, rp.hosts); !mirrored {
+			return ref
+		}
+		u.RawQuery = "" // the query of a page is part of its file name
+
+	case u.Scheme == "" && u.Host == "" && u.Path != "":
+		if rp.base == nil {
+			return ref // already relative
+		}
+		if strings.HasPrefix(u.Path, "/") {
+			target = path.Join(page[:strings.IndexByte(page, '/')], u.Path)
+		} else {
+			target = path.Join(path.Dir(page), u.Path)
+		}
+		if strings.HasSuffix(u.Path, "/") {
+			target += "/" + mapping.PageDirIndex
+		}
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return ref // outside the mirror
+		}
+
+	default:
+		return ref // e.g. a fragment, or a mailto: link
+	}
+
+	if rp.base != nil {
+		resolved := rp.base.ResolveReference(&url.URL{Path: target})
+		resolved.RawQuery = u.RawQuery
+		resolved.Fragment, resolved.RawFragment = u.Fragment, u.RawFragment
+		return resolved.String()
+	}
+
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(page)), filepath.FromSlash(target))
+	if err != nil {
+		return ref
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel), RawQuery: u.RawQuery, Fragment: u.Fragment, RawFragment: u.RawFragment}).String()
+}
+
+// storedTarget gets the file that an absolute URL is stored in, relative to the
+// output directory, provided its host is one of the host directories.
+func storedTarget(u *url.URL, hosts map[string]bool) (string, bool) {
+	mapping.WithoutDefaultPort(u)
+	host := mapping.HostDir(u.Host)
+	if !hosts[host] {
+		return "", false
+	}
+	return host + mapping.GetFilePath(u, mapping.IsPageURL(u))[1:], true
+}
@@ -0,0 +1,68 @@
+package mirror
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const republishPage = `<html><head><link rel="canonical" href="https://example.org/docs/page"></head><body>` +
+	`<a href="../index.html#top">Home</a>` +
+	`<a href="https://www.example.org/about?x=1">About</a>` +
+	`<a href="https://other.org/x">Other</a>` +
+	`<a href="mailto:me@example.org">Mail</a>` +
+	`<img srcset="../logo.png 1x, ../logo@2x.png 2x">` +
+	`</body></html>`
+
+func TestRepublishRelative(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFile(t, filepath.Join(src, "example.org", "docs", "page.html"), republishPage)
+	writeFile(t, filepath.Join(src, "www.example.org", "about_x=1.html"), "about")
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	pages, err := Republish(src, dst, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	data, err := os.ReadFile(filepath.Join(dst, "example.org", "docs", "page.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<link rel="canonical" href="page.html"/>`)
+	assert.Contains(t, string(data), `<a href="../index.html#top">Home</a>`)
+	assert.Contains(t, string(data), `<a href="../../www.example.org/about_x=1.html">About</a>`)
+	assert.Contains(t, string(data), `<a href="https://other.org/x">Other</a>`)
+	assert.Contains(t, string(data), `<a href="mailto:me@example.org">Mail</a>`)
+
+	original, err := os.ReadFile(filepath.Join(src, "example.org", "docs", "page.html"))
+	require.NoError(t, err)
+	assert.Equal(t, republishPage, string(original))
+
+	_, err = Republish(src, dst, nil)
+	assert.Error(t, err)
+}
+
+func TestRepublishAbsolute(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFile(t, filepath.Join(src, "example.org", "docs", "page.html"), republishPage)
+	writeFile(t, filepath.Join(src, "example.org", "logo.png"), "logo")
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	base, _ := url.Parse("https://archive.example.net/mirror")
+	pages, err := Republish(src, dst, base)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	data, err := os.ReadFile(filepath.Join(dst, "example.org", "docs", "page.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<link rel="canonical" href="https://archive.example.net/mirror/example.org/docs/page.html"/>`)
+	assert.Contains(t, string(data), `<a href="https://archive.example.net/mirror/example.org/index.html#top">Home</a>`)
+	assert.Contains(t, string(data), `<a href="https://www.example.org/about?x=1">About</a>`) // not mirrored
+	assert.Contains(t, string(data), `<img srcset="https://archive.example.net/mirror/example.org/logo.png 1x, https://archive.example.net/mirror/example.org/logo@2x.png 2x"/>`)
+
+	logo, err := os.ReadFile(filepath.Join(dst, "example.org", "logo.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "logo", string(logo))
+}
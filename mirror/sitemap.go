@@ -0,0 +1,203 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/spf13/afero"
+)
+
+const (
+	// SitemapFileName is the name of the sitemap within the output directory.
+	SitemapFileName = "sitemap.xml"
+
+	// ListingFileName is the name of the listing of the files within the output directory.
+	ListingFileName = "index.html"
+
+	// maxSitemapURLs is the most URLs that one sitemap may contain.
+	maxSitemapURLs = 50000
+)
+
+// storedFile is a file in the mirror; its path is relative to the output directory,
+// with forward slashes.
+type storedFile struct {
+	Path     string
+	Size     int64
+	Modified time.Time
+}
+
+// storedFiles lists the files that were stored in dir, in lexical order. These are in
+// the host directories; the other files and directories in dir, e.g. the manifest,
+// and the sidecar and checksums files are omitted.
+func storedFiles(dir string) ([]storedFile, error) {
+	var files []storedFile
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !strings.Contains(rel, "/") { // at the top
+			if entry.IsDir() && strings.ContainsAny(rel[:1], "._") {
+				return filepath.SkipDir // e.g. .git or the text corpus
+			}
+			return nil
+		}
+
+		if entry.IsDir() || strings.HasSuffix(rel, download.HeadersExtension) || strings.HasSuffix(rel, download.DiffExtension) ||
+			path.Base(rel) == ChecksumsFileName {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, storedFile{Path: rel, Size: info.Size(), Modified: info.ModTime().UTC()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func isStoredPage(file string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	return ext == ".html" || ext == ".htm"
+}
+
+//-------------------------------------------------------------------------------------------------
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// WriteSitemap writes a sitemap of the pages stored in dir into SitemapFileName, for
+// when the mirror is republished at base, e.g. "https://archive.example.org/". Each
+// page is located by its path within dir and is dated by the time its file was last
+// modified, which is the Last-Modified time given by the website, where known. When
+// there are too many pages for one sitemap, they are split into numbered sitemaps,
+// e.g. sitemap-1.xml, listed by a sitemap index. It returns the number of pages.
+func WriteSitemap(dir string, base *url.URL) (int, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	root := *base
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+	}
+
+	var urls []sitemapURL
+	for _, f := range files {
+		if isStoredPage(f.Path) {
+			loc := root.ResolveReference(&url.URL{Path: f.Path})
+			urls = append(urls, sitemapURL{Loc: loc.String(), LastMod: f.Modified.Format(time.DateOnly)})
+		}
+	}
+
+	if len(urls) <= maxSitemapURLs {
+		return len(urls), writeXML(filepath.Join(dir, SitemapFileName), urlSet{URLs: urls})
+	}
+
+	index := sitemapIndex{}
+	for i := 0; i*maxSitemapURLs < len(urls); i++ {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		part := urls[i*maxSitemapURLs : min((i+1)*maxSitemapURLs, len(urls))]
+		if err := writeXML(filepath.Join(dir, name), urlSet{URLs: part}); err != nil {
+			return 0, err
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: root.ResolveReference(&url.URL{Path: name}).String()})
+	}
+
+	return len(urls), writeXML(filepath.Join(dir, SitemapFileName), index)
+}
+
+func writeXML(name string, v any) error {
+	buf := bytes.NewBufferString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encoding %s: %w", name, err)
+	}
+	buf.WriteByte('\n')
+
+	if _, err := ioutil.WriteFileAtomically(afero.NewOsFs(), name, buf); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------------------------------------
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Mirrored files</title></head>
+<body>
+<h1>Mirrored files</h1>
+<table>
+<thead><tr><th>File</th><th>Size</th><th>Modified</th></tr></thead>
+<tbody>
+{{range .}}<tr><td><a href="{{.Href}}">{{.Path}}</a></td><td>{{.Size}}</td><td>{{.Modified.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</tbody>
+</table>
+</body></html>
+`))
+
+// WriteListing writes a listing of the files stored in dir into ListingFileName, with
+// relative links to them, so that the mirror can be browsed even if the crawl was
+// partial. It returns the number of files.
+func WriteListing(dir string) (int, error) {
+	files, err := storedFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	type entry struct {
+		storedFile
+		Href string
+	}
+
+	entries := make([]entry, len(files))
+	for i, f := range files {
+		entries[i] = entry{storedFile: f, Href: (&url.URL{Path: f.Path}).String()}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := listingTemplate.Execute(buf, entries); err != nil {
+		return 0, fmt.Errorf("rendering the listing: %w", err)
+	}
+
+	name := filepath.Join(dir, ListingFileName)
+	if _, err := ioutil.WriteFileAtomically(afero.NewOsFs(), name, buf); err != nil {
+		return 0, fmt.Errorf("writing %s: %w", name, err)
+	}
+	return len(files), nil
+}
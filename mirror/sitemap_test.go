@@ -0,0 +1,61 @@
+package mirror
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSitemap(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "example.org", "a b.html"), "a")
+	writeFile(t, filepath.Join(dir, "example.org", "a b.html.headers.json"), "{}")
+	writeFile(t, filepath.Join(dir, "example.org", "logo.png"), "logo")
+	writeFile(t, filepath.Join(dir, "_text", "example.org", "index.txt"), "home")
+	writeFile(t, filepath.Join(dir, "manifest.sha256"), "")
+
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "example.org", "index.html"), modified, modified))
+
+	base, _ := url.Parse("https://archive.example.net/mirror")
+	pages, err := WriteSitemap(dir, base)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pages)
+
+	data, err := os.ReadFile(filepath.Join(dir, SitemapFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, string(data), "<loc>https://archive.example.net/mirror/example.org/a%20b.html</loc>")
+	assert.Contains(t, string(data), "<loc>https://archive.example.net/mirror/example.org/index.html</loc>\n    <lastmod>2024-05-06</lastmod>")
+	assert.NotContains(t, string(data), "logo.png")
+	assert.NotContains(t, string(data), "_text")
+}
+
+func TestWriteListing(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "example.org", "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "example.org", "a:b.html"), "a")
+	writeFile(t, filepath.Join(dir, "example.org", "a:b.html.diff"), "-a\n+b\n")
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref")
+
+	files, err := WriteListing(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+
+	data, err := os.ReadFile(filepath.Join(dir, ListingFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<a href="example.org/a:b.html">example.org/a:b.html</a></td><td>1</td>`)
+	assert.Contains(t, string(data), `<a href="example.org/index.html">example.org/index.html</a></td><td>4</td>`)
+	assert.NotContains(t, string(data), "diff")
+	assert.NotContains(t, string(data), "HEAD")
+
+	files, err = WriteListing(dir) // the listing itself is not listed
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+}
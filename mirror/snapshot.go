@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// SnapshotLayout is the time layout used to name each snapshot directory.
+	SnapshotLayout = "2006-01-02T150405Z"
+
+	// LatestLink is the name of the symbolic link to the most recent complete snapshot.
+	LatestLink = "latest"
+
+	partialSuffix = ".partial"
+)
+
+// Snapshots lists the complete snapshot directories within root, oldest first.
+func Snapshots(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if _, err := time.Parse(SnapshotLayout, entry.Name()); err == nil && entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	slices.Sort(names) // the layout sorts chronologically
+	return names, nil
+}
+
+// PrepareSnapshot creates a new, partial snapshot directory within root, named after
+// the time now. It starts as a copy of the latest snapshot (if there is one), made using
+// hard links, so unchanged files are shared by all the snapshots that contain them.
+// Any partial snapshots left by earlier failed crawls are removed.
+func PrepareSnapshot(root string, now time.Time) (partial string, err error) {
+	if err = removePartialSnapshots(root); err != nil {
+		return "", err
+	}
+
+	snapshots, err := Snapshots(root)
+	if err != nil {
+		return "", err
+	}
+
+	partial = filepath.Join(root, now.UTC().Format(SnapshotLayout)+partialSuffix)
+
+	if len(snapshots) == 0 {
+		return partial, os.MkdirAll(partial, 0o755)
+	}
+
+	latest := filepath.Join(root, snapshots[len(snapshots)-1])
+	if err = LinkTree(latest, partial); err != nil {
+		_ = os.RemoveAll(partial)
+		return "", fmt.Errorf("preparing snapshot: %w", err)
+	}
+
+	return partial, nil
+}
+
+// PublishSnapshot completes a partial snapshot and points the 'latest' link at it.
+func PublishSnapshot(partial string) (snapshot string, err error) {
+	snapshot = strings.TrimSuffix(partial, partialSuffix)
+	if err = os.Rename(partial, snapshot); err != nil {
+		return "", fmt.Errorf("publishing snapshot: %w", err)
+	}
+
+	// replace the link atomically by renaming a new link over it
+	root := filepath.Dir(snapshot)
+	link := filepath.Join(root, LatestLink)
+	tmp := link + partialSuffix
+	_ = os.Remove(tmp)
+	if err = os.Symlink(filepath.Base(snapshot), tmp); err != nil {
+		return snapshot, fmt.Errorf("linking latest snapshot: %w", err)
+	}
+	if err = os.Rename(tmp, link); err != nil {
+		return snapshot, fmt.Errorf("linking latest snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func removePartialSnapshots(root string) error {
+	partials, err := filepath.Glob(filepath.Join(root, "*"+partialSuffix))
+	if err != nil {
+		return err
+	}
+	for _, p := range partials {
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("removing partial snapshot: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	root := t.TempDir()
+	t1 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+
+	// first snapshot
+	partial, err := PrepareSnapshot(root, t1)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "2024-03-01T100000Z.partial"), partial)
+	require.NoError(t, os.MkdirAll(filepath.Join(partial, "example.org"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(partial, "example.org", "index.html"), []byte("v1"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(partial, "example.org", "style.css"), []byte("css"), 0o644))
+
+	first, err := PublishSnapshot(partial)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "2024-03-01T100000Z"), first)
+
+	// a stale partial snapshot is removed
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "2024-03-01T110000Z.partial"), 0o755))
+
+	// second snapshot
+	partial, err = PrepareSnapshot(root, t2)
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(root, "2024-03-01T110000Z.partial"))
+	replaceFile(t, filepath.Join(partial, "example.org", "index.html"), "v2")
+
+	second, err := PublishSnapshot(partial)
+	require.NoError(t, err)
+
+	snapshots, err := Snapshots(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-03-01T100000Z", "2024-03-02T100000Z"}, snapshots)
+
+	// the old snapshot is unchanged and the unchanged file is shared
+	assertContent(t, filepath.Join(first, "example.org", "index.html"), "v1")
+	assertContent(t, filepath.Join(second, "example.org", "index.html"), "v2")
+	a, _ := os.Stat(filepath.Join(first, "example.org", "style.css"))
+	b, _ := os.Stat(filepath.Join(second, "example.org", "style.css"))
+	assert.True(t, os.SameFile(a, b))
+
+	// 'latest' points to the second snapshot
+	assertContent(t, filepath.Join(root, LatestLink, "example.org", "index.html"), "v2")
+}
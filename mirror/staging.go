@@ -0,0 +1,63 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StagingDir gets the name of the staging directory for a published directory.
+func StagingDir(published string) string {
+	return filepath.Clean(published) + ".staging"
+}
+
+// PrepareStaging creates a fresh staging directory that starts as a copy of the published
+// directory (if it exists), made using hard links. This gives the crawl all the existing
+// files so that conditional requests work as usual. Any stale staging directory left by
+// an earlier failed crawl is removed first.
+func PrepareStaging(published string) (staging string, err error) {
+	staging = StagingDir(published)
+	if err = os.RemoveAll(staging); err != nil {
+		return "", fmt.Errorf("removing stale staging directory: %w", err)
+	}
+
+	if _, err = os.Stat(published); errors.Is(err, fs.ErrNotExist) {
+		return staging, os.MkdirAll(staging, 0o755)
+	}
+
+	if err = LinkTree(published, staging); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("preparing staging directory: %w", err)
+	}
+
+	return staging, nil
+}
+
+// Publish replaces the published directory with the staging directory. This uses
+// two renames, so the published directory is absent only momentarily; if the second
+// rename fails, the previous directory is restored.
+func Publish(published, staging string) error {
+	published = filepath.Clean(published)
+	previous := published + ".previous"
+
+	if err := os.RemoveAll(previous); err != nil {
+		return fmt.Errorf("publishing: %w", err)
+	}
+
+	if err := os.Rename(published, previous); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("publishing: %w", err)
+	}
+
+	if err := os.Rename(staging, published); err != nil {
+		_ = os.Rename(previous, published)
+		return fmt.Errorf("publishing: %w", err)
+	}
+
+	if err := os.RemoveAll(previous); err != nil {
+		return fmt.Errorf("removing previous directory: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cornelk/goscrape/corpus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingAndPublish(t *testing.T) {
+	published := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(published, "example.org", "a"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(published, "example.org", "index.html"), []byte("v1"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(published, "example.org", "a", "b.css"), []byte("css"), 0o644))
+
+	staging, err := PrepareStaging(published)
+	require.NoError(t, err)
+	assert.Equal(t, published+".staging", staging)
+
+	// unchanged files are hard links
+	before, _ := os.Stat(filepath.Join(published, "example.org", "a", "b.css"))
+	after, _ := os.Stat(filepath.Join(staging, "example.org", "a", "b.css"))
+	assert.True(t, os.SameFile(before, after))
+
+	// changes in the staging directory are not visible until published
+	replaceFile(t, filepath.Join(staging, "example.org", "index.html"), "v2")
+	require.NoError(t, os.Remove(filepath.Join(staging, "example.org", "a", "b.css")))
+	assertContent(t, filepath.Join(published, "example.org", "index.html"), "v1")
+	assertContent(t, filepath.Join(published, "example.org", "a", "b.css"), "css")
+
+	require.NoError(t, Publish(published, staging))
+
+	assertContent(t, filepath.Join(published, "example.org", "index.html"), "v2")
+	assert.NoFileExists(t, filepath.Join(published, "example.org", "a", "b.css"))
+	assert.NoDirExists(t, staging)
+	assert.NoDirExists(t, published+".previous")
+}
+
+func TestStagingWithoutPublished(t *testing.T) {
+	published := filepath.Join(t.TempDir(), "site")
+
+	staging, err := PrepareStaging(published)
+	require.NoError(t, err)
+	assert.DirExists(t, staging)
+
+	require.NoError(t, Publish(published, staging))
+	assert.DirExists(t, published)
+}
+
+func TestStagingKeepsPublishedCorpus(t *testing.T) {
+	published := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(published, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(published, corpus.FileName), []byte("v1\n"), 0o644))
+
+	staging, err := PrepareStaging(published)
+	require.NoError(t, err)
+
+	texts, err := corpus.New(afero.NewOsFs(), staging, corpus.FormatJSONL)
+	require.NoError(t, err)
+	u, _ := url.Parse("https://example.org/")
+	require.NoError(t, texts.Add(u, "index.html", nil, []string{"v2"}))
+	require.NoError(t, texts.Close())
+
+	// the crawl failed, so the staging directory is not published
+	assertContent(t, filepath.Join(published, corpus.FileName), "v1\n")
+}
+
+// replaceFile writes a file in the same way as the scraper, i.e. by renaming.
+func replaceFile(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(name+".tmp", []byte(content), 0o644))
+	require.NoError(t, os.Rename(name+".tmp", name))
+}
+
+func assertContent(t *testing.T, name, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
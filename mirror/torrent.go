@@ -0,0 +1,232 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA-1 is required by the BitTorrent protocol
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Limits on the size of the pieces of a torrent, which is chosen so that there are
+// about targetPieces of them.
+const (
+	minPieceLength = 16 << 10
+	maxPieceLength = 16 << 20
+	targetPieces   = 1500
+)
+
+// Torrent describes the torrent written by WriteTorrent.
+type Torrent struct {
+	Trackers []string // the announce URLs, in order of preference; none for a trackerless torrent
+	WebSeeds []string // the URLs at which the published directory can also be downloaded
+	Comment  string
+}
+
+// publishedFile is a file to be published; its path is relative to the directory, with
+// forward slashes.
+type publishedFile struct {
+	path string
+	abs  string
+	size int64
+}
+
+// publishedFiles lists the regular files in root, in lexical order, for publishing it.
+// Symbolic links are followed, provided they lead to files within root. Dot files and
+// directories at the top, e.g. .git, are omitted, as are the excluded files.
+func publishedFiles(root string, exclude ...string) ([]publishedFile, error) {
+	var files []publishedFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !strings.Contains(rel, "/") && strings.HasPrefix(rel, ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() || slices.Contains(exclude, path) {
+			return nil
+		}
+
+		info, err := os.Stat(path) // follows symbolic links
+		if err != nil || !info.Mode().IsRegular() || !within(root, path) {
+			return nil // dangling links, sockets, devices etc are skipped
+		}
+
+		files = append(files, publishedFile{path: rel, abs: path, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// WriteTorrent writes a BitTorrent metainfo file called name for the files in dir, so
+// that the mirror can be distributed by peer-to-peer file sharing. The torrent is named
+// after dir, which becomes the directory that the files are downloaded into. It returns
+// the number of files and the info hash, which identifies the torrent, e.g. in magnet
+// links.
+func WriteTorrent(dir, name string, t Torrent) (int, string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, "", err
+	}
+
+	output, err := filepath.Abs(name)
+	if err != nil {
+		return 0, "", err
+	}
+
+	files, err := publishedFiles(root, output)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var total int64
+	list := make([]any, len(files))
+	for i, f := range files {
+		total += f.size
+		path := make([]any, 0, strings.Count(f.path, "/")+1)
+		for _, part := range strings.Split(f.path, "/") {
+			path = append(path, part)
+		}
+		list[i] = map[string]any{"length": f.size, "path": path}
+	}
+
+	pieceLength := pieceLengthFor(total)
+	pieces, err := hashPieces(files, pieceLength)
+	if err != nil {
+		return 0, "", err
+	}
+
+	info := map[string]any{
+		"name":         filepath.Base(root),
+		"piece length": pieceLength,
+		"pieces":       pieces,
+		"files":        list,
+	}
+
+	var infoBytes bytes.Buffer
+	bencode(&infoBytes, info)
+	infoHash := sha1.Sum(infoBytes.Bytes()) //nolint:gosec // as above
+
+	metainfo := map[string]any{
+		"info":          info,
+		"created by":    "goscrape",
+		"creation date": time.Now().Unix(),
+	}
+	if len(t.Trackers) > 0 {
+		metainfo["announce"] = t.Trackers[0]
+		tiers := make([]any, len(t.Trackers))
+		for i, tracker := range t.Trackers {
+			tiers[i] = []any{tracker}
+		}
+		metainfo["announce-list"] = tiers
+	}
+	if len(t.WebSeeds) > 0 {
+		seeds := make([]any, len(t.WebSeeds))
+		for i, seed := range t.WebSeeds {
+			seeds[i] = seed
+		}
+		metainfo["url-list"] = seeds
+	}
+	if t.Comment != "" {
+		metainfo["comment"] = t.Comment
+	}
+
+	var buf bytes.Buffer
+	bencode(&buf, metainfo)
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		return 0, "", fmt.Errorf("writing torrent: %w", err)
+	}
+	return len(files), fmt.Sprintf("%x", infoHash), nil
+}
+
+// pieceLengthFor chooses a power of two such that there are about targetPieces pieces.
+func pieceLengthFor(total int64) int64 {
+	length := int64(minPieceLength)
+	for length < maxPieceLength && total/length > targetPieces {
+		length *= 2
+	}
+	return length
+}
+
+// hashPieces gets the concatenated SHA-1 hashes of the pieces of the files, which are
+// treated as one stream of bytes.
+func hashPieces(files []publishedFile, pieceLength int64) (string, error) {
+	var pieces []byte
+	h := sha1.New() //nolint:gosec // as above
+	inPiece := int64(0)
+
+	for _, f := range files {
+		in, err := os.Open(f.abs)
+		if err != nil {
+			return "", err
+		}
+
+		for {
+			n, err := io.CopyN(h, in, pieceLength-inPiece)
+			inPiece += n
+			if inPiece == pieceLength {
+				pieces = h.Sum(pieces)
+				h.Reset()
+				inPiece = 0
+			}
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				in.Close()
+				return "", fmt.Errorf("reading %s: %w", f.path, err)
+			}
+		}
+		in.Close()
+	}
+
+	if inPiece > 0 {
+		pieces = h.Sum(pieces)
+	}
+	return string(pieces), nil
+}
+
+// bencode writes v in the encoding used by BitTorrent. It supports the types used by
+// WriteTorrent.
+func bencode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []any:
+		buf.WriteByte('l')
+		for _, item := range v {
+			bencode(buf, item)
+		}
+		buf.WriteByte('e')
+	case map[string]any:
+		buf.WriteByte('d')
+		for _, key := range slices.Sorted(maps.Keys(v)) { // the keys must be sorted
+			bencode(buf, key)
+			bencode(buf, v[key])
+		}
+		buf.WriteByte('e')
+	default:
+		panic(fmt.Sprintf("bencode: unsupported %T", v))
+	}
+}
@@ -0,0 +1,71 @@
+package mirror
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA-1 is required by the BitTorrent protocol
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTorrent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "example.org")
+	writeFile(t, filepath.Join(dir, "index.html"), "home")
+	writeFile(t, filepath.Join(dir, "img", "logo.png"), "logo")
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref")
+	name := filepath.Join(dir, "site.torrent")
+
+	files, infoHash, err := WriteTorrent(dir, name, Torrent{
+		Trackers: []string{"udp://tracker.example.net:6969", "https://tracker.example.com/announce"},
+		WebSeeds: []string{"https://archive.example.org/"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, files, "the torrent itself and .git are left out")
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	torrent := string(data)
+
+	pieces := sha1.Sum([]byte("logohome")) //nolint:gosec // as above
+	info := "d5:filesl" +
+		"d6:lengthi4e4:pathl3:img8:logo.pngee" +
+		"d6:lengthi4e4:pathl10:index.htmlee" +
+		"e4:name11:example.org12:piece lengthi16384e6:pieces20:" + string(pieces[:]) + "e"
+	assert.Contains(t, torrent, "4:info"+info)
+	assert.Equal(t, fmt.Sprintf("%x", sha1.Sum([]byte(info))), infoHash) //nolint:gosec // as above
+
+	assert.True(t, strings.HasPrefix(torrent, "d8:announce30:udp://tracker.example.net:6969"+
+		"13:announce-listll30:udp://tracker.example.net:6969el36:https://tracker.example.com/announceee"))
+	assert.True(t, strings.HasSuffix(torrent, "8:url-listl28:https://archive.example.org/ee"))
+}
+
+func TestHashPieces(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "abcde")
+	writeFile(t, filepath.Join(dir, "b"), "fgh")
+
+	files, err := publishedFiles(dir)
+	require.NoError(t, err)
+
+	pieces, err := hashPieces(files, 3)
+	require.NoError(t, err)
+
+	var expected bytes.Buffer
+	for _, piece := range []string{"abc", "def", "gh"} { // the pieces span the files
+		sum := sha1.Sum([]byte(piece)) //nolint:gosec // as above
+		expected.Write(sum[:])
+	}
+	assert.Equal(t, expected.String(), pieces)
+}
+
+func TestPieceLengthFor(t *testing.T) {
+	assert.Equal(t, int64(minPieceLength), pieceLengthFor(0))
+	assert.Equal(t, int64(minPieceLength), pieceLengthFor(targetPieces*minPieceLength))
+	assert.Equal(t, int64(2*minPieceLength), pieceLengthFor((targetPieces+1)*minPieceLength))
+	assert.Equal(t, int64(maxPieceLength), pieceLengthFor(1<<50))
+}
@@ -0,0 +1,111 @@
+// Package pagination expands URL patterns that describe a series of pages, such as
+// "/page/{1..200}", so that paginated listings can be captured fully even when their
+// deeper pages are not linked from the start page.
+package pagination
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxExpansion limits the number of strings that any one pattern can produce.
+const MaxExpansion = 100000
+
+// Expand expands all the brace expressions in a pattern. Each brace expression is
+// either a numeric range "{first..last}" or "{first..last..step}", or a list of
+// alternatives "{a,b,c}". A range is zero-padded when either bound has a leading zero,
+// e.g. "{01..12}", and it may count down. When a pattern has several brace expressions,
+// every combination is produced. A pattern without braces expands to itself.
+func Expand(pattern string) ([]string, error) {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		if strings.IndexByte(pattern, '}') >= 0 {
+			return nil, fmt.Errorf("%q: unmatched '}'", pattern)
+		}
+		return []string{pattern}, nil
+	}
+
+	size := strings.IndexByte(pattern[open:], '}')
+	if size < 0 {
+		return nil, fmt.Errorf("%q: unmatched '{'", pattern)
+	}
+
+	prefix, expression, rest := pattern[:open], pattern[open+1:open+size], pattern[open+size+1:]
+	if strings.IndexByte(prefix, '}') >= 0 || strings.IndexByte(expression, '{') >= 0 {
+		return nil, fmt.Errorf("%q: misplaced brace", pattern)
+	}
+
+	alternatives, err := expandExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", pattern, err)
+	}
+
+	suffixes, err := Expand(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(alternatives)*len(suffixes) > MaxExpansion {
+		return nil, fmt.Errorf("%q: more than %d expansions", pattern, MaxExpansion)
+	}
+
+	result := make([]string, 0, len(alternatives)*len(suffixes))
+	for _, a := range alternatives {
+		for _, s := range suffixes {
+			result = append(result, prefix+a+s)
+		}
+	}
+	return result, nil
+}
+
+func expandExpression(expression string) ([]string, error) {
+	if !strings.Contains(expression, "..") {
+		return strings.Split(expression, ","), nil
+	}
+
+	parts := strings.Split(expression, "..")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("{%s}: too many parts", expression)
+	}
+
+	first, err1 := strconv.Atoi(parts[0])
+	last, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("{%s}: range bounds must be integers", expression)
+	}
+
+	step := 1
+	if len(parts) == 3 {
+		s, err := strconv.Atoi(parts[2])
+		if err != nil || s == 0 {
+			return nil, fmt.Errorf("{%s}: step must be a non-zero integer", expression)
+		}
+		step = max(s, -s)
+	}
+
+	width := 0
+	if isZeroPadded(parts[0]) || isZeroPadded(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	n := max(last-first, first-last)/step + 1
+	if n > MaxExpansion {
+		return nil, fmt.Errorf("{%s}: more than %d expansions", expression, MaxExpansion)
+	}
+
+	if last < first {
+		step = -step
+	}
+
+	result := make([]string, 0, n)
+	for i, v := 0, first; i < n; i, v = i+1, v+step {
+		result = append(result, fmt.Sprintf("%0*d", width, v))
+	}
+	return result, nil
+}
+
+func isZeroPadded(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
@@ -0,0 +1,44 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	cases := map[string][]string{
+		"/about":                {"/about"},
+		"/page/{1..3}":          {"/page/1", "/page/2", "/page/3"},
+		"/page/{3..1}":          {"/page/3", "/page/2", "/page/1"},
+		"/p{08..10}.html":       {"/p08.html", "/p09.html", "/p10.html"},
+		"/p/{0..10..5}":         {"/p/0", "/p/5", "/p/10"},
+		"/{a,b}/{1..2}":         {"/a/1", "/a/2", "/b/1", "/b/2"},
+		"/list?letter={x,y,z}":  {"/list?letter=x", "/list?letter=y", "/list?letter=z"},
+		"/list?letter={x,,z}":   {"/list?letter=x", "/list?letter=", "/list?letter=z"},
+		"/list?from={10..1..4}": {"/list?from=10", "/list?from=6", "/list?from=2"},
+	}
+
+	for pattern, expected := range cases {
+		actual, err := Expand(pattern)
+		require.NoError(t, err, pattern)
+		assert.Equal(t, expected, actual, pattern)
+	}
+}
+
+func TestExpand_errors(t *testing.T) {
+	for _, pattern := range []string{
+		"/page/{1..3",
+		"/page/1..3}",
+		"/page/{{1..3}}",
+		"/page/{a..3}",
+		"/page/{1..3..0}",
+		"/page/{1..2..3..4}",
+		"/page/{1..1000000}",
+		"/page/{1..1000}/{1..1000}",
+	} {
+		_, err := Expand(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
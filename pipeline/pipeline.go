@@ -0,0 +1,115 @@
+// Package pipeline reads URLs continuously and writes a JSON result for each of them
+// as soon as it has been downloaded, rewritten and stored. This allows goscrape to be
+// used as the fetch and rewrite stage of a Unix pipeline or some other orchestration.
+// Links are not followed; the references of each page are reported instead, so that
+// the caller can decide which of them to send back.
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+)
+
+// Result describes the outcome for one URL.
+type Result struct {
+	URL         string   `json:"url"`
+	Status      int      `json:"status,omitempty"`
+	ContentType string   `json:"contentType,omitempty"`
+	File        string   `json:"file,omitempty"` // relative to the output directory; blank if no file was written
+	Size        int64    `json:"size,omitempty"`
+	Hash        string   `json:"sha256,omitempty"`
+	Redirects   []string `json:"redirects,omitempty"`
+	References  []string `json:"references,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// DownloaderFunc gets the downloader for the website of a URL.
+type DownloaderFunc func(u *url.URL) (*download.Download, error)
+
+// Run reads URLs from in, one per line, until it reaches the end or the context is
+// cancelled. Blank lines and lines starting with '#' are ignored. Each URL is
+// processed in turn and its result is written to out as one line of JSON. Failures
+// of individual URLs are reported in their results rather than stopping the run.
+func Run(ctx context.Context, in io.Reader, out io.Writer, downloader DownloaderFunc) error {
+	enc := json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		result := process(ctx, line, downloader)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func process(ctx context.Context, line string, downloader DownloaderFunc) Result {
+	u, err := url.Parse(line)
+	if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+		err = errors.New("not an absolute http or https URL")
+	}
+	if err != nil {
+		return Result{URL: line, Error: err.Error()}
+	}
+
+	u.Fragment = ""
+	d, err := downloader(u)
+	if err != nil {
+		return Result{URL: u.String(), Error: err.Error()}
+	}
+
+	_, result, err := d.ProcessURL(ctx, work.Item{URL: u})
+	if err != nil && !download.Unstored(err) {
+		d.Logger.Debug("Pipeline failed", slog.String("url", u.String()), slog.Any("error", err))
+		return Result{URL: u.String(), Error: err.Error()}
+	}
+
+	return makeResult(d.StartURL.Host, result)
+}
+
+func makeResult(host string, result *work.Result) Result {
+	r := Result{
+		URL:         result.URL.String(),
+		Status:      result.StatusCode,
+		ContentType: result.ContentType,
+		Size:        result.FileSize,
+		Hash:        result.Hash,
+		Redirects:   strs(result.Redirects),
+		References:  strs(append(result.Pagination, result.References...)),
+	}
+
+	if result.Hash != "" {
+		r.File = path.Join(mapping.HostDir(host), result.FilePath)
+	}
+
+	return r
+}
+
+func strs(refs work.Refs) []string {
+	var list []string
+	for _, ref := range refs {
+		list = append(list, ref.String())
+	}
+	return list
+}
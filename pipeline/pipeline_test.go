@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body><a href="/about">About</a><img src="logo.png"></body></html>`)
+	stub.GivenResponse(http.StatusNotFound, "https://example.org/missing", "text/html", ``)
+
+	downloaders := 0
+	downloader := func(u *url.URL) (*download.Download, error) {
+		downloaders++
+		return &download.Download{Client: stub, StartURL: u, Fs: afero.NewMemMapFs()}, nil
+	}
+
+	in := strings.NewReader(`# seeds
+https://example.org/#top
+
+https://example.org/missing
+/relative
+`)
+	out := &bytes.Buffer{}
+
+	err := Run(context.Background(), in, out, downloader)
+	require.NoError(t, err)
+	assert.Equal(t, 2, downloaders)
+
+	var results []Result
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var r Result
+		require.NoError(t, dec.Decode(&r))
+		results = append(results, r)
+	}
+
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "https://example.org/", results[0].URL)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.Equal(t, "text/html", results[0].ContentType)
+	assert.Equal(t, "example.org/index.html", results[0].File)
+	assert.NotEmpty(t, results[0].Hash)
+	assert.ElementsMatch(t, []string{"https://example.org/about", "https://example.org/logo.png"}, results[0].References)
+
+	assert.Equal(t, Result{URL: "https://example.org/missing", Status: http.StatusNotFound}, results[1])
+
+	assert.Equal(t, "/relative", results[2].URL)
+	assert.NotEmpty(t, results[2].Error)
+}
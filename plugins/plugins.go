@@ -0,0 +1,93 @@
+// Package plugins loads Go plugins that extend goscrape with logic that is specific to
+// a website, so that it can be shipped without recompiling goscrape. A plugin is built
+// using "go build -buildmode=plugin" against the same version of goscrape and of its
+// dependencies, and exports any of these functions:
+//
+//	func Filter(c filter.Candidate) bool                      // decides which URLs are fetched
+//	func Process(u *url.URL, page []byte) ([]byte, error)     // alters each page before it is stored
+//	func Middleware(next http.RoundTripper) http.RoundTripper // wraps the HTTP requests
+//
+// Go plugins are only supported on Linux, macOS and FreeBSD, by builds of goscrape that
+// use cgo. WebAssembly modules are not supported.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"plugin"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/filter"
+)
+
+// Plugins are the extensions provided by the loaded plugins, in the order the plugins
+// were given.
+type Plugins struct {
+	Filters        []func(filter.Candidate) bool
+	PostProcessors []download.PostProcessor
+	Middleware     []download.Middleware
+}
+
+// Load opens each plugin file and looks up the functions that it exports. A plugin
+// that exports none of them is an error.
+func Load(files []string) (Plugins, error) {
+	var plugins Plugins
+	for _, file := range files {
+		if err := plugins.load(file); err != nil {
+			return Plugins{}, fmt.Errorf("plugin %s: %w", file, err)
+		}
+	}
+	return plugins, nil
+}
+
+func (plugins *Plugins) load(file string) error {
+	p, err := plugin.Open(file)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	if sym, err := p.Lookup("Filter"); err == nil {
+		fn, ok := sym.(func(filter.Candidate) bool)
+		if !ok {
+			return fmt.Errorf("Filter is %T, not func(filter.Candidate) bool", sym)
+		}
+		plugins.Filters = append(plugins.Filters, fn)
+		found++
+	}
+
+	if sym, err := p.Lookup("Process"); err == nil {
+		fn, ok := sym.(func(*url.URL, []byte) ([]byte, error))
+		if !ok {
+			return fmt.Errorf("Process is %T, not func(*url.URL, []byte) ([]byte, error)", sym)
+		}
+		plugins.PostProcessors = append(plugins.PostProcessors, fn)
+		found++
+	}
+
+	if sym, err := p.Lookup("Middleware"); err == nil {
+		fn, ok := sym.(func(http.RoundTripper) http.RoundTripper)
+		if !ok {
+			return fmt.Errorf("Middleware is %T, not func(http.RoundTripper) http.RoundTripper", sym)
+		}
+		plugins.Middleware = append(plugins.Middleware, fn)
+		found++
+	}
+
+	if found == 0 {
+		return errors.New("exports none of Filter, Process or Middleware")
+	}
+	return nil
+}
+
+// Allows returns true if every filter allows the candidate URL.
+func (plugins Plugins) Allows(c filter.Candidate) bool {
+	for _, allows := range plugins.Filters {
+		if !allows(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cornelk/goscrape/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building a plugin is slow")
+	}
+
+	file := filepath.Join(t.TempDir(), "example.so")
+	args := []string{"build", "-buildmode=plugin", "-o", file}
+	if race {
+		args = append(args, "-race") // the plugin's packages must match those of the test binary
+	}
+	out, err := exec.Command("go", append(args, "./testdata/example")...).CombinedOutput()
+	if err != nil {
+		t.Skipf("plugins are not supported here: %v\n%s", err, out)
+	}
+
+	plugins, err := Load([]string{file})
+	require.NoError(t, err)
+	require.Len(t, plugins.Filters, 1)
+	require.Len(t, plugins.PostProcessors, 1)
+	require.Len(t, plugins.Middleware, 1)
+
+	u, _ := url.Parse("https://example.org/private/a")
+	assert.False(t, plugins.Allows(filter.Candidate{URL: u}))
+	u, _ = url.Parse("https://example.org/public/a")
+	assert.True(t, plugins.Allows(filter.Candidate{URL: u}))
+
+	page, err := plugins.PostProcessors[0](u, []byte("<p>a<!--advert--></p>"))
+	require.NoError(t, err)
+	assert.Equal(t, "<p>a</p>", string(page))
+
+	var header string
+	rt := plugins.Middleware[0](roundTripper(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Get("X-Plugin")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "example", header)
+}
+
+func TestLoadMissing(t *testing.T) {
+	_, err := Load([]string{filepath.Join(t.TempDir(), "missing.so")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.so")
+}
+
+func TestAllowsWithoutFilters(t *testing.T) {
+	u, _ := url.Parse("https://example.org/")
+	assert.True(t, Plugins{}.Allows(filter.Candidate{URL: u}))
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
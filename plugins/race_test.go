@@ -0,0 +1,7 @@
+//go:build race
+
+package plugins
+
+// race is true when the tests are built with the race detector, so that the
+// plugin must be too.
+const race = true
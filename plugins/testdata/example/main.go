@@ -0,0 +1,37 @@
+// This is an example plugin, which is built by the tests.
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/filter"
+)
+
+// Filter skips the URLs under /private/.
+func Filter(c filter.Candidate) bool {
+	return !strings.HasPrefix(c.URL.Path, "/private/")
+}
+
+// Process removes the comments that mark adverts.
+func Process(_ *url.URL, page []byte) ([]byte, error) {
+	return bytes.ReplaceAll(page, []byte("<!--advert-->"), nil), nil
+}
+
+// Middleware adds a header to every request.
+func Middleware(next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Plugin", "example")
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func main() {}
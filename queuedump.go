@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/cornelk/goscrape/manifest"
+	"github.com/cornelk/goscrape/scraper"
+	"github.com/spf13/afero"
+)
+
+// dumpQueueOnSignal writes a snapshot of the scraper's queue to queueFile whenever the
+// snapshot signal is received (SIGUSR1, where the platform has it). The returned
+// function stops listening and must be called when the scrape has finished.
+func dumpQueueOnSignal(sc *scraper.Scraper, queueFile string) (stop func()) {
+	if queueFile == "" || snapshotSignal == nil {
+		return func() {}
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, snapshotSignal)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if err := saveQueue(queueFile, sc.QueueSnapshot()); err != nil {
+					sc.Logger.Error("Saving queue", slog.Any("error", err))
+				} else {
+					sc.Logger.Info("Saved queue", slog.String("file", queueFile))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// saveAbortedState saves what is needed to resume a scrape that was aborted: the queue,
+// if there is a queueFile, and the manifest of the files stored so far. Errors are only
+// logged, because the scrape has already failed.
+func saveAbortedState(fs afero.Fs, dir, queueFile string, sc *scraper.Scraper, files *manifest.Manifest) {
+	if queueFile != "" {
+		if err := saveQueue(queueFile, sc.QueueSnapshot()); err != nil {
+			sc.Logger.Error("Saving queue", slog.Any("error", err))
+		} else {
+			sc.Logger.Info("Saved queue", slog.String("file", queueFile))
+		}
+	}
+
+	if err := files.Write(fs, dir); err != nil {
+		sc.Logger.Error("Saving manifest", slog.Any("error", err))
+	}
+}
+
+func saveQueue(queueFile string, snapshot scraper.QueueSnapshot) error {
+	buf := &bytes.Buffer{}
+	if err := snapshot.WriteJSON(buf); err != nil {
+		return fmt.Errorf("marshaling queue: %w", err)
+	}
+
+	if err := os.WriteFile(queueFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("saving queue: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/work"
+)
+
+// ErrErrorBudget is the cause of a scrape being aborted because too many of its
+// items failed, which usually means that the scraper has been banned or its login
+// session has expired.
+var ErrErrorBudget = errors.New("error budget exceeded")
+
+// errorRateWindow is the number of most recent results over which the error rate is
+// measured.
+const errorRateWindow = 100
+
+// errorBudget counts the failed items, i.e. those that got an error response other than
+// 404 or 410, which are normal on most websites. A nil errorBudget allows any number
+// of errors.
+type errorBudget struct {
+	maxErrors int
+	maxRate   float64
+
+	errors int
+	recent [errorRateWindow]bool // a ring buffer of whether each recent result failed
+	count  int                   // the number of results seen so far
+	failed int                   // the number of failures in recent
+}
+
+func newErrorBudget(cfg config.Config) *errorBudget {
+	if cfg.MaxErrors <= 0 && cfg.MaxErrorRate <= 0 {
+		return nil
+	}
+	return &errorBudget{maxErrors: cfg.MaxErrors, maxRate: cfg.MaxErrorRate}
+}
+
+// add counts a result. It returns an error wrapping ErrErrorBudget when the budget
+// has been exceeded.
+func (b *errorBudget) add(result work.Result) error {
+	if b == nil {
+		return nil
+	}
+
+	failed := (result.TimedOut || isFailure(result.StatusCode)) && result.ParkedUntil.IsZero() // maintenance is not a failure
+	if failed {
+		b.errors++
+	}
+
+	i := b.count % errorRateWindow
+	if b.recent[i] {
+		b.failed--
+	}
+	b.recent[i] = failed
+	if failed {
+		b.failed++
+	}
+	b.count++
+
+	if b.maxErrors > 0 && b.errors > b.maxErrors {
+		return fmt.Errorf("%w: %d items failed", ErrErrorBudget, b.errors)
+	}
+
+	if b.maxRate > 0 && b.count >= errorRateWindow {
+		if rate := float64(b.failed) / errorRateWindow; rate > b.maxRate {
+			return fmt.Errorf("%w: %d of the last %d items failed", ErrErrorBudget, b.failed, errorRateWindow)
+		}
+	}
+
+	return nil
+}
+
+func isFailure(status int) bool {
+	return status >= 400 && status != http.StatusNotFound && status != http.StatusGone
+}
@@ -0,0 +1,63 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorBudget(t *testing.T) {
+	assert.Nil(t, newErrorBudget(config.Config{}))
+	assert.NoError(t, newErrorBudget(config.Config{}).add(work.Result{StatusCode: http.StatusForbidden}))
+
+	b := newErrorBudget(config.Config{MaxErrors: 2})
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusForbidden}))
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusNotFound}))
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusOK}))
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusServiceUnavailable}))
+	assert.ErrorIs(t, b.add(work.Result{StatusCode: http.StatusUnauthorized}), ErrErrorBudget)
+
+	b = newErrorBudget(config.Config{MaxErrors: 1})
+	assert.NoError(t, b.add(work.Result{TimedOut: true}))
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusServiceUnavailable, ParkedUntil: utc.Now()}), "maintenance")
+	assert.ErrorIs(t, b.add(work.Result{TimedOut: true}), ErrErrorBudget)
+
+	b = newErrorBudget(config.Config{MaxErrorRate: 0.5})
+	for i := 0; i < 2*errorRateWindow; i++ {
+		status := http.StatusOK
+		if i%2 == 0 {
+			status = http.StatusTooManyRequests
+		}
+		require.NoError(t, b.add(work.Result{StatusCode: status}), i) // exactly half is within the budget
+	}
+	assert.NoError(t, b.add(work.Result{StatusCode: http.StatusForbidden})) // replaces an earlier failure
+	assert.ErrorIs(t, b.add(work.Result{StatusCode: http.StatusForbidden}), ErrErrorBudget)
+}
+
+func TestScraperErrorBudget(t *testing.T) {
+	var links strings.Builder
+	stub := &stubclient.Client{}
+	for i := range 10 {
+		fmt.Fprintf(&links, `<a href="/p%d">p</a>`, i)
+		stub.GivenResponse(http.StatusForbidden, fmt.Sprintf("https://example.org/p%d", i), "text/html", "banned")
+	}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", links.String())
+
+	sc, err := New(config.Config{MaxErrors: 3}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	err = sc.Start(context.Background())
+	assert.ErrorIs(t, err, ErrErrorBudget)
+	assert.NotEmpty(t, sc.QueueSnapshot().Pending)
+}
@@ -0,0 +1,272 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	urlpkg "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/crawllog"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/work"
+)
+
+// Capture runs a reverse proxy for the website of the start URL, serving it on the
+// listener until the context is done. The pages and assets that are browsed through
+// the proxy are stored in the same way as those that are scraped, but their links
+// are not followed. This allows a person to log in and click through a website that
+// cannot easily be crawled; whatever they see is captured.
+//
+// The proxy is plain HTTP. Links, redirects and cookies that refer to the website
+// are altered on their way to the browser so that browsing stays within the proxy.
+func (sc *Scraper) Capture(ctx context.Context, listener net.Listener) error {
+	d := sc.Downloader()
+	defer sc.closeWriter()
+
+	if sc.probeHTTPS {
+		if err := sc.upgradeToHTTPS(ctx, d); err != nil {
+			return err
+		}
+		d = sc.Downloader() // for the upgraded start URL
+	}
+
+	cp := &captureProxy{sc: sc, d: d, target: &urlpkg.URL{Scheme: sc.URL.Scheme, Host: sc.URL.Host}}
+	server := &http.Server{
+		Handler:           cp.reverseProxy(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	})
+	defer stop()
+
+	sc.Logger.Info("Capturing", slog.String("url", sc.URL.String()), slog.String("proxy", "http://"+listener.Addr().String()))
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// captureProxy forwards the requests of a browser to a website, capturing the responses.
+type captureProxy struct {
+	sc     *Scraper
+	d      *download.Download
+	target *urlpkg.URL // the scheme and host of the website
+	mu     sync.Mutex  // serializes the accounting of the results
+}
+
+// proxyOriginKey is the context key of the origin of the proxy, as the browser sees it.
+type proxyOriginKey struct{}
+
+func (cp *captureProxy) reverseProxy() *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite:        cp.rewrite,
+		Transport:      cp.transport(),
+		ModifyResponse: cp.modifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if !errors.Is(err, context.Canceled) {
+				cp.sc.Logger.Error("Proxy request failed", slog.String("url", req.URL.String()), slog.Any("error", err))
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// transport gets the transport of the scraper's client, which connects to the website
+// without the middleware, because the browser supplies its own headers and cookies.
+func (cp *captureProxy) transport() http.RoundTripper {
+	if client, ok := cp.sc.Client.(*http.Client); ok {
+		if client.Transport != nil {
+			return client.Transport
+		}
+		return http.DefaultTransport
+	}
+	return download.RoundTripperFunc(cp.sc.Client.Do)
+}
+
+// rewrite directs a request to the website. The headers that would reveal the proxy
+// are altered, and conditional requests are made unconditional so that every
+// response has a body that can be captured.
+func (cp *captureProxy) rewrite(pr *httputil.ProxyRequest) {
+	proxy := &urlpkg.URL{Scheme: "http", Host: pr.In.Host}
+	pr.SetURL(cp.target)
+	pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), proxyOriginKey{}, proxy))
+
+	for _, name := range []string{"Origin", "Referer"} {
+		if value := pr.Out.Header.Get(name); value != "" {
+			pr.Out.Header.Set(name, replaceOrigin(value, proxy, cp.target))
+		}
+	}
+
+	pr.Out.Header.Del("Accept-Encoding") // so that the transport decompresses the response
+	pr.Out.Header.Del("If-None-Match")
+	pr.Out.Header.Del("If-Modified-Since")
+}
+
+// modifyResponse captures the response, if it is wanted, then alters it for the browser.
+func (cp *captureProxy) modifyResponse(resp *http.Response) error {
+	proxy, _ := resp.Request.Context().Value(proxyOriginKey{}).(*urlpkg.URL)
+	if proxy == nil {
+		return nil
+	}
+
+	capture, rewrite := cp.capturable(resp), rewritable(resp)
+	if capture || rewrite {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if capture {
+			cp.capture(resp, body)
+		}
+
+		if rewrite {
+			body = []byte(toProxy(cp.target, proxy).Replace(string(body)))
+			resp.ContentLength = int64(len(body))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if location := resp.Header.Get("Location"); location != "" {
+		resp.Header.Set("Location", replaceOrigin(location, cp.target, proxy))
+	}
+
+	cookies := resp.Header.Values("Set-Cookie")
+	resp.Header.Del("Set-Cookie")
+	for _, line := range cookies {
+		resp.Header.Add("Set-Cookie", proxyCookie(line))
+	}
+
+	// these would stop the browser from using the proxy, or from loading the altered links
+	resp.Header.Del("Strict-Transport-Security")
+	resp.Header.Del("Content-Security-Policy")
+	return nil
+}
+
+// capturable returns true if the response is to be stored.
+func (cp *captureProxy) capturable(resp *http.Response) bool {
+	sc, u := cp.sc, resp.Request.URL
+	if resp.Request.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	if sc.blocked(u) {
+		sc.Logger.Debug("Skipping blocked URL", slog.String("url", u.String()))
+		return false
+	}
+
+	if sc.includes.Present() && !sc.includes.Matches(u, "Including URL", sc.Logger) {
+		return false
+	}
+
+	if sc.excludes.Present() && sc.excludes.Matches(u, "Skipping URL", sc.Logger) {
+		return false
+	}
+
+	allowed, decided := sc.types.AllowsURL(u)
+	return allowed || !decided
+}
+
+// capture stores a copy of the response and accounts for its result. Failures are
+// logged but otherwise ignored, so that browsing can continue.
+func (cp *captureProxy) capture(resp *http.Response, body []byte) {
+	sc := cp.sc
+
+	captured := *resp
+	captured.Header = resp.Header.Clone()
+	captured.Body = io.NopCloser(bytes.NewReader(body))
+
+	item := work.Item{URL: resp.Request.URL, Depth: 1}
+	if referrer, err := urlpkg.Parse(resp.Request.Header.Get("Referer")); err == nil && referrer.Host != "" {
+		item.Referrer = referrer
+	}
+
+	_, result, err := cp.d.Capture(resp.Request.Context(), item, &captured)
+	if err != nil && !download.Unstored(err) {
+		if !errors.Is(err, context.Canceled) {
+			sc.Logger.Error("Capture failed", slog.String("url", item.URL.String()), slog.Any("error", err))
+		}
+		return
+	}
+	if result == nil {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	result.LocalPath = storedPath(sc.URL.Host, *result)
+	sc.Stats.Add(*result)
+	sc.recordFile(sc.URL.Host, *result)
+	sc.CrawlLog.Add(crawllog.NewRecord(*result, result.LocalPath))
+	if sc.OnResult != nil {
+		sc.OnResult(*result)
+	}
+
+	if result.LocalPath != "" {
+		sc.Logger.Info("Captured", slog.String("url", item.URL.String()), slog.String("file", result.LocalPath))
+	}
+}
+
+// rewritable returns true for the responses whose links to the website are altered so
+// that they lead to the proxy instead.
+func rewritable(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/css", "text/javascript", "application/javascript":
+		return resp.Header.Get("Content-Encoding") == ""
+	}
+	return false
+}
+
+// toProxy replaces the absolute and scheme-relative links to the website with links
+// to the proxy. Links with either scheme are replaced, because websites often mix them.
+func toProxy(target, proxy *urlpkg.URL) *strings.Replacer {
+	return strings.NewReplacer(
+		"https://"+target.Host, proxy.String(),
+		"http://"+target.Host, proxy.String(),
+		"//"+target.Host, "//"+proxy.Host,
+	)
+}
+
+// replaceOrigin replaces the origin from with the origin to, if the URL starts with it.
+func replaceOrigin(rawURL string, from, to *urlpkg.URL) string {
+	if rest, found := strings.CutPrefix(rawURL, from.String()); found && (rest == "" || strings.ContainsAny(rest[:1], "/?#")) {
+		return to.String() + rest
+	}
+	return rawURL
+}
+
+// proxyCookie alters a cookie so that the browser sends it back to the proxy, which is
+// a different host and is not secure.
+func proxyCookie(line string) string {
+	cookie, err := http.ParseSetCookie(line)
+	if err != nil {
+		return line
+	}
+
+	cookie.Domain = ""
+	cookie.Secure = false
+	cookie.Partitioned = false
+	if cookie.SameSite == http.SameSiteNoneMode {
+		cookie.SameSite = http.SameSiteLaxMode // None requires Secure
+	}
+	return cookie.String()
+}
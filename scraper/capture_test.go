@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Set-Cookie", "session=s3cret; Path=/; Domain=example.org; Secure; HttpOnly; SameSite=None")
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+			http.Redirect(w, r, origin.URL+"/account", http.StatusFound)
+
+		case "/account":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "s3cret" {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, `<html><body><img src="`+origin.URL+`/logo.png"><a href="`+origin.URL+`/login">Again</a></body></html>`)
+
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, "logo")
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{}, mustParseURL(origin.URL), fs, testLogger())
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	proxy := "http://" + listener.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sc.Capture(ctx, listener) }()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := &http.Client{Jar: jar}
+
+	resp, err := browser.Get(proxy + "/login")
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, proxy+"/account", resp.Request.URL.String(), "the redirect leads to the proxy")
+	assert.Contains(t, string(page), `<img src="`+proxy+`/logo.png">`)
+
+	resp, err = browser.Get(proxy + "/logo.png")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	cancel()
+	require.NoError(t, <-done)
+
+	dir := mapping.HostDir(sc.URL.Host)
+	account, err := afero.ReadFile(fs, filepath.Join(dir, "account.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(account), `<img src="logo.png"/>`)
+
+	logo, err := afero.ReadFile(fs, filepath.Join(dir, "logo.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "logo", string(logo))
+
+	exists, err := afero.Exists(fs, filepath.Join(dir, "login.html"))
+	require.NoError(t, err)
+	assert.False(t, exists, "redirects are not stored")
+}
+
+func TestProxyCookie(t *testing.T) {
+	assert.Equal(t, "id=1; Path=/; HttpOnly; SameSite=Lax",
+		proxyCookie("id=1; Path=/; Domain=example.org; Secure; HttpOnly; SameSite=None"))
+	assert.Equal(t, "id=2; Max-Age=60; SameSite=Strict", proxyCookie("id=2; Max-Age=60; SameSite=Strict"))
+}
+
+func TestReplaceOrigin(t *testing.T) {
+	from, to := mustParseURL("https://example.org"), mustParseURL("http://localhost:8000")
+	assert.Equal(t, "http://localhost:8000/a?b=c", replaceOrigin("https://example.org/a?b=c", from, to))
+	assert.Equal(t, "http://localhost:8000", replaceOrigin("https://example.org", from, to))
+	assert.Equal(t, "https://example.org.evil/a", replaceOrigin("https://example.org.evil/a", from, to))
+	assert.Equal(t, "/relative", replaceOrigin("/relative", from, to))
+}
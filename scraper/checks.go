@@ -1,58 +1,176 @@
 package scraper
 
 import (
-	"github.com/cornelk/goscrape/work"
+	"log/slog"
 	"net/url"
+	"strings"
+
+	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
 )
 
-// shouldURLBeDownloaded checks whether a page should be downloaded.
+// Reasons for rejecting URLs, as reported in the crawl statistics.
+const (
+	ReasonURLTooLong         = "URL too long"
+	ReasonTooManyQueryParams = "too many query parameters"
+)
+
+// shouldURLBeDownloaded checks whether a page should be downloaded. The parent is
+// the page in which it was found, if any.
 // nolint: cyclop
-func (sc *Scraper) shouldURLBeDownloaded(item *url.URL, depth int) bool {
-	if item.Scheme != "http" && item.Scheme != "https" {
+func (sc *Scraper) shouldURLBeDownloaded(item, parent *url.URL, depth int) bool {
+	if !sc.fetchable(item) {
 		return false
 	}
 
-	p := item.String()
-	if item.Host == sc.URL.Host {
-		p = item.Path
+	if !sc.processed.AddIfAbsent(sc.processedKey(item)) { // was already downloaded or checked?
+		return false
 	}
-	if p == "" {
-		p = "/"
+
+	if item.Host != sc.URL.Host {
+		return false
 	}
 
-	if !sc.processed.AddIfAbsent(p) { // was already downloaded or checked?
+	if sc.config.Refetch && parent != nil && mapping.IsPageURL(item) {
+		return false // only the start URL is fetched again
+	}
+
+	if sc.config.Refresh != "" && mapping.IsPageURL(item) && !strings.HasPrefix(item.String(), sc.config.Refresh) {
+		sc.Logger.Debug("Skipping URL outside the refreshed prefix", slog.String("url", item.String()))
 		return false
 	}
 
-	if item.Host != sc.URL.Host {
+	if sc.blocked(item) {
+		sc.Logger.Debug("Skipping blocked URL", slog.String("url", item.String()))
 		return false
 	}
 
-	if depth > sc.config.MaxDepth {
+	if depth > sc.maxDepthFor(item) {
 		return false
 	}
 
-	if sc.includes.Present() && !sc.includes.Matches(item, "Including URL") {
+	if reason := sc.exceedsLimits(item); reason != "" {
+		sc.Logger.Warn("Rejecting URL", slog.String("url", item.String()), slog.String("reason", reason))
+		sc.Stats.AddRejected(item.String(), reason)
 		return false
 	}
 
-	if sc.excludes.Present() && sc.excludes.Matches(item, "Skipping URL") {
+	if sc.includes.Present() && !sc.includes.Matches(item, "Including URL", sc.Logger) {
+		return false
+	}
+
+	if sc.excludes.Present() && sc.excludes.Matches(item, "Skipping URL", sc.Logger) {
+		return false
+	}
+
+	if allowed, decided := sc.types.AllowsURL(item); decided && !allowed {
+		sc.Logger.Debug("Skipping URL by type", slog.String("url", item.String()))
+		return false
+	}
+
+	candidate := filter.Candidate{URL: item, Parent: parent, Depth: depth}
+	if !sc.rules.Fetch.Allows(candidate) {
+		sc.Logger.Debug("Skipping URL by rule", slog.String("url", item.String()), slog.String("rule", sc.rules.Fetch.String()))
+		return false
+	}
+
+	if !sc.plugins.Allows(candidate) {
+		sc.Logger.Debug("Skipping URL by plugin", slog.String("url", item.String()))
 		return false
 	}
 
 	return true
 }
 
+// fetchable reports whether the URL has a scheme that can be downloaded.
+func (sc *Scraper) fetchable(u *url.URL) bool {
+	switch u.Scheme {
+	case "http", "https", "ftp", "ftps":
+		return true
+	case "file":
+		return sc.URL.Scheme == "file" // only the local tree being scraped can be read
+	case "gemini", "gopher":
+		return sc.config.SmallWeb
+	}
+	return false
+}
+
+// processedKey gets the key of a URL in the set of processed URLs.
+func (sc *Scraper) processedKey(item *url.URL) string {
+	if item.Host != sc.URL.Host {
+		return item.String()
+	}
+
+	p := item.Path
+	if p == "" {
+		p = "/"
+	}
+	if item.RawQuery != "" && mapping.IsPageURL(item) {
+		p += "?" + item.RawQuery // pages that differ only by their query are distinct
+	}
+	return p
+}
+
+// maxDepthFor gets the depth limit for pages or for assets, as appropriate. With
+// PageOnly, no page other than the start page is within the limit.
+func (sc *Scraper) maxDepthFor(item *url.URL) int {
+	if mapping.IsPageURL(item) && sc.config.PageOnly {
+		return 0
+	} else if mapping.IsPageURL(item) {
+		return sc.config.MaxDepth
+	}
+	return sc.config.MaxAssetDepth
+}
+
+// exceedsLimits checks the URL length and number of query parameters, which guards
+// against the combinatorial explosion of URLs that faceted navigation can cause.
+// It returns the reason for rejecting the URL, or blank if it is acceptable.
+func (sc *Scraper) exceedsLimits(item *url.URL) string {
+	if sc.config.MaxURLLength > 0 && len(item.String()) > sc.config.MaxURLLength {
+		return ReasonURLTooLong
+	}
+
+	if sc.config.MaxQueryParams > 0 && countQueryParams(item.RawQuery) > sc.config.MaxQueryParams {
+		return ReasonTooManyQueryParams
+	}
+
+	return ""
+}
+
+func countQueryParams(query string) int {
+	n := 0
+	for _, param := range strings.Split(query, "&") {
+		if param != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// partitionResult separates the references that should be downloaded from those that
+// should not. Pagination links are checked first because they keep the item's depth.
 func (sc *Scraper) partitionResult(result *work.Result, depth int) {
-	included := make([]*url.URL, 0, len(result.References))
+	result.Pagination = sc.partition(result, result.Pagination, result.Item.Depth)
+	result.References = sc.partition(result, result.References, depth)
+}
 
-	for _, ref := range result.References {
-		if sc.shouldURLBeDownloaded(ref, depth) {
+func (sc *Scraper) partition(result *work.Result, refs work.Refs, depth int) work.Refs {
+	included := make([]*url.URL, 0, len(refs))
+
+	for _, ref := range refs {
+		sc.upgradeScheme(ref)
+		if sc.shouldURLBeDownloaded(ref, result.Item.URL, depth) {
 			included = append(included, ref)
 		} else {
 			result.Excluded = append(result.Excluded, ref)
 		}
 	}
 
-	result.References = included
+	return included
+}
+
+// blocked reports whether the blocklist forbids downloading u.
+func (sc *Scraper) blocked(u *url.URL) bool {
+	return sc.Blocklist.Blocks(u)
 }
@@ -1,19 +1,16 @@
 package scraper
 
 import (
-	"fmt"
 	"github.com/cornelk/goscrape/filter"
 	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/stats"
 	"github.com/cornelk/goscrape/stubclient"
-	"github.com/rickb777/servefiles/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
-	"sync"
 	"testing"
 )
 
@@ -25,21 +22,15 @@ func mustParseURL(s string) *url.URL {
 	return u
 }
 
-func setup() {
-	sync.OnceFunc(func() {
-		if testing.Verbose() {
-			opts := &slog.HandlerOptions{Level: slog.LevelWarn}
-			opts.Level = slog.LevelDebug
-			servefiles.Debugf = func(format string, v ...interface{}) { logger.Debug(fmt.Sprintf(format, v...)) }
-			logger.Logger = slog.New(slog.NewTextHandler(os.Stdout, opts))
-		} else {
-			logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
-		}
-	})
+// testLogger writes the debug log in verbose mode; otherwise it writes nothing.
+func testLogger() *logger.Logger {
+	if testing.Verbose() {
+		return logger.Create(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return logger.Discard()
 }
 
 func TestShouldURLBeDownloaded(t *testing.T) {
-	setup()
 	startURL := "https://example.org/#fragment"
 
 	stub := &stubclient.Client{}
@@ -65,14 +56,52 @@ func TestShouldURLBeDownloaded(t *testing.T) {
 		{item: mustParseURL("http://example.org/ok/toodeep"), depth: 11, expected: false},
 		{item: mustParseURL("http://example.org/oktoodeep"), depth: 12, expected: false},
 		{item: mustParseURL("http://example.org/other"), depth: 1, expected: false},
-		{item: mustParseURL("ftp://example.org/ok"), expected: false},
+		{item: mustParseURL("ftp://example.org/ok/file"), expected: true},
+		{item: mustParseURL("gopher://example.org/ok"), expected: false},
+		{item: mustParseURL("gemini://example.org/ok/capsule"), expected: false},
 		{item: mustParseURL("https://example.org/ok/done"), expected: false},
 		{item: mustParseURL("https://other.org/ok"), expected: false},
 		{item: mustParseURL("https://example.org/ok/bad"), expected: false},
 	}
 
 	for _, c := range cases {
-		result := scraper.shouldURLBeDownloaded(c.item, c.depth)
+		result := scraper.shouldURLBeDownloaded(c.item, nil, c.depth)
 		assert.Equal(t, c.expected, result, c.item.String())
 	}
 }
+
+func TestShouldURLBeDownloaded_smallWeb(t *testing.T) {
+	scraper := newTestScraper(t, "gemini://example.org/", &stubclient.Client{})
+	assert.False(t, scraper.shouldURLBeDownloaded(mustParseURL("gemini://example.org/log/"), nil, 1))
+
+	scraper.config.SmallWeb = true
+	assert.True(t, scraper.shouldURLBeDownloaded(mustParseURL("gemini://example.org/log/"), nil, 1))
+}
+
+func TestShouldURLBeDownloaded_limits(t *testing.T) {
+	scraper := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	scraper.config.MaxURLLength = 40
+	scraper.config.MaxQueryParams = 2
+	scraper.Stats = stats.New()
+
+	cases := []struct {
+		item     *url.URL
+		expected bool
+	}{
+		{item: mustParseURL("https://example.org/search?a=1&b=2"), expected: true},
+		{item: mustParseURL("https://example.org/search?a=1&b=2&c=3"), expected: false},
+		{item: mustParseURL("https://example.org/a/very/long/path/to/a/page"), expected: false},
+	}
+
+	for _, c := range cases {
+		result := scraper.shouldURLBeDownloaded(c.item, nil, 1)
+		assert.Equal(t, c.expected, result, c.item.String())
+	}
+
+	s := scraper.Stats.Summary(nil)
+	assert.Equal(t, map[string]int{ReasonURLTooLong: 1, ReasonTooManyQueryParams: 1}, s.Rejected)
+	assert.Equal(t, []stats.Rejection{
+		{URL: "https://example.org/search?a=1&b=2&c=3", Reason: ReasonTooManyQueryParams},
+		{URL: "https://example.org/a/very/long/path/to/a/page", Reason: ReasonURLTooLong},
+	}, s.RejectedURLs)
+}
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSkipped is the cause of a scrape being stopped by Skip.
+var ErrSkipped = errors.New("skipped by the operator")
+
+// control lets an operator steer a scrape while it runs, e.g. from a dashboard. Pausing
+// stops the workers from taking more items; the downloads in progress are completed.
+// The extra delay is imposed before every download, on top of any loop delay.
+type control struct {
+	mu      sync.Mutex
+	resumed chan struct{} // closed when not paused
+	delay   time.Duration
+	abort   context.CancelCauseFunc // stops the scrape in progress; nil if none
+	skipped bool
+}
+
+func newControl() *control {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &control{resumed: resumed}
+}
+
+// wait blocks while the scrape is paused, and then for the extra delay. It returns false
+// if the context is done first.
+func (c *control) wait(ctx context.Context) bool {
+	c.mu.Lock()
+	resumed, delay := c.resumed, c.delay
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resumed:
+	}
+
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (c *control) started(abort context.CancelCauseFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.abort = abort
+	if c.skipped {
+		abort(ErrSkipped)
+	}
+}
+
+// Pause stops the workers from starting more downloads until Resume is called.
+func (sc *Scraper) Pause() {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+
+	select {
+	case <-sc.control.resumed:
+		sc.control.resumed = make(chan struct{})
+	default: // already paused
+	}
+}
+
+// Resume lets the workers continue after Pause.
+func (sc *Scraper) Resume() {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+
+	select {
+	case <-sc.control.resumed: // not paused
+	default:
+		close(sc.control.resumed)
+	}
+}
+
+// Paused reports whether the scrape has been paused.
+func (sc *Scraper) Paused() bool {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+
+	select {
+	case <-sc.control.resumed:
+		return false
+	default:
+		return true
+	}
+}
+
+// SetExtraDelay sets a delay imposed before every download, on top of the loop delay,
+// so that an operator can slow a scrape down, or speed it up again, while it runs.
+func (sc *Scraper) SetExtraDelay(delay time.Duration) {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+	sc.control.delay = max(delay, 0)
+}
+
+// ExtraDelay gets the delay set by SetExtraDelay.
+func (sc *Scraper) ExtraDelay() time.Duration {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+	return sc.control.delay
+}
+
+// Skip stops the scrape, leaving the rest of its queue pending, so that Start returns
+// ErrSkipped. This lets an operator give up on a host and move on to the next.
+func (sc *Scraper) Skip() {
+	sc.control.mu.Lock()
+	defer sc.control.mu.Unlock()
+
+	sc.control.skipped = true
+	if sc.control.abort != nil {
+		sc.control.abort(ErrSkipped)
+	}
+	select {
+	case <-sc.control.resumed:
+	default:
+		close(sc.control.resumed) // the paused workers can stop
+	}
+}
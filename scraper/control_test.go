@@ -0,0 +1,50 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	assert.False(t, sc.Paused())
+	assert.True(t, sc.control.wait(context.Background()))
+
+	sc.Pause()
+	sc.Pause()
+	assert.True(t, sc.Paused())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, sc.control.wait(ctx))
+
+	waited := make(chan bool)
+	go func() { waited <- sc.control.wait(context.Background()) }()
+	sc.Resume()
+	sc.Resume()
+	assert.True(t, <-waited)
+	assert.False(t, sc.Paused())
+
+	sc.SetExtraDelay(-time.Second)
+	assert.Equal(t, time.Duration(0), sc.ExtraDelay())
+	sc.SetExtraDelay(5 * time.Millisecond)
+	assert.Equal(t, 5*time.Millisecond, sc.ExtraDelay())
+	assert.True(t, sc.control.wait(context.Background()))
+}
+
+func TestSkip(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a> <a href="/b">b</a>`)
+
+	sc := newTestScraper(t, "https://example.org/", stub) // the stub would panic if /a or /b were fetched
+	sc.Pause()
+	sc.Skip()
+
+	require.ErrorIs(t, sc.Start(context.Background()), ErrSkipped)
+}
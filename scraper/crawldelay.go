@@ -0,0 +1,50 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	urlpkg "net/url"
+
+	"github.com/cornelk/goscrape/document"
+	"github.com/cornelk/goscrape/download"
+)
+
+// readCrawlDelay fetches the robots.txt of the start host and adopts its Crawl-delay
+// as the floor of the loop delay, unless the loop delay is already longer. The delay
+// in effect is logged and recorded in the crawl statistics, so that compliance can be
+// confirmed. A missing robots.txt asks for no delay.
+func (sc *Scraper) readCrawlDelay(ctx context.Context, d *download.Download) error {
+	u := sc.URL.ResolveReference(&urlpkg.URL{Path: "/robots.txt"})
+
+	resp, body, err := d.Probe(ctx, u)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sc.Logger.Warn("Reading robots.txt failed", slog.String("url", u.String()), slog.Any("error", err))
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		sc.Logger.Debug("No robots.txt", slog.String("url", u.String()), slog.Int("status", resp.StatusCode))
+		return nil
+	}
+
+	sc.crawlDelay = document.ParseCrawlDelay(body)
+	if sc.crawlDelay == 0 {
+		return nil
+	}
+
+	effective := max(sc.config.LoopDelay, sc.crawlDelay) + d.Adaptive.Delay()
+	sc.Logger.Info("Crawl delay",
+		slog.String("host", sc.URL.Host),
+		slog.String("requested", sc.crawlDelay.String()),
+		slog.String("effective", effective.String()))
+	sc.Stats.SetCrawlDelay(sc.URL.Host, sc.crawlDelay, effective)
+
+	if sc.config.Concurrency > 1 {
+		sc.Logger.Warn("The crawl delay applies to each concurrent download separately", slog.Int("concurrency", sc.config.Concurrency))
+	}
+	return nil
+}
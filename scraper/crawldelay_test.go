@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/stats"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScraperCrawlDelay(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/robots.txt", "text/plain", "User-agent: *\nCrawl-delay: 0.02\n")
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `a`)
+
+	cfg := config.Config{MaxDepth: 10, CrawlDelay: true, LoopDelay: 10 * time.Millisecond}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Stats = stats.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, 20*time.Millisecond, sc.Downloader().LoopDelay.Snapshot().Delay)
+	assert.Equal(t, map[string]stats.CrawlDelay{"example.org": {Requested: 20 * time.Millisecond, Effective: 20 * time.Millisecond}},
+		sc.Stats.Summary(nil).CrawlDelays)
+}
+
+func TestScraperCrawlDelay_Absent(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusNotFound, "https://example.org/robots.txt", "text/plain", "")
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `a`)
+
+	cfg := config.Config{MaxDepth: 10, CrawlDelay: true, LoopDelay: 10 * time.Millisecond}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Stats = stats.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, 10*time.Millisecond, sc.Downloader().LoopDelay.Snapshot().Delay)
+	assert.Nil(t, sc.Stats.Summary(nil).CrawlDelays)
+}
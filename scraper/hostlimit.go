@@ -0,0 +1,54 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+)
+
+// hostSemaphores limits the number of concurrent requests to any single host,
+// independently of the overall concurrency. A nil *hostSemaphores imposes no limit.
+type hostSemaphores struct {
+	limit int
+	m     map[string]chan struct{}
+	mu    sync.Mutex
+}
+
+func newHostSemaphores(limit int) *hostSemaphores {
+	if limit < 1 {
+		return nil
+	}
+	return &hostSemaphores{limit: limit, m: make(map[string]chan struct{})}
+}
+
+func (h *hostSemaphores) semaphore(host string) chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sem, exists := h.m[host]
+	if !exists {
+		sem = make(chan struct{}, h.limit)
+		h.m[host] = sem
+	}
+	return sem
+}
+
+// acquire blocks until a slot is available for host, or the context is cancelled.
+func (h *hostSemaphores) acquire(ctx context.Context, host string) error {
+	if h == nil {
+		return nil
+	}
+
+	select {
+	case h.semaphore(host) <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot previously acquired for host.
+func (h *hostSemaphores) release(host string) {
+	if h != nil {
+		<-h.semaphore(host)
+	}
+}
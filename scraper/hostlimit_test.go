@@ -0,0 +1,56 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostSemaphores(t *testing.T) {
+	h := newHostSemaphores(2)
+
+	var active, peak atomic.Int32
+	wg := &sync.WaitGroup{}
+
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, h.acquire(context.Background(), "example.org"))
+			defer h.release("example.org")
+
+			n := active.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(2), peak.Load())
+
+	// other hosts are not affected
+	require.NoError(t, h.acquire(context.Background(), "a.example.org"))
+	require.NoError(t, h.acquire(context.Background(), "a.example.org"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, h.acquire(ctx, "a.example.org"), context.Canceled)
+}
+
+func TestNilHostSemaphores(t *testing.T) {
+	h := newHostSemaphores(0)
+	assert.Nil(t, h)
+	assert.NoError(t, h.acquire(context.Background(), "example.org"))
+	h.release("example.org")
+}
@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+)
+
+// Kinds of listed URL.
+const (
+	KindPage  = "page"
+	KindAsset = "asset"
+)
+
+// ListedURL is a URL found when listing URLs. Pages are fetched, so their status is
+// known, but assets are not.
+type ListedURL struct {
+	URL         string `json:"url"`
+	Referrer    string `json:"referrer,omitempty"`
+	Depth       int    `json:"depth"`
+	Kind        string `json:"kind"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Inventory lists the URLs of a website in the order they were found.
+type Inventory []ListedURL
+
+// Inventory gets the URLs found by a scrape with config.ListURLs set.
+func (sc *Scraper) Inventory() Inventory {
+	return sc.inventory
+}
+
+// WriteJSON writes the inventory as indented JSON.
+func (inv Inventory) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(inv)
+}
+
+// WriteCSV writes the inventory as CSV with a header row.
+func (inv Inventory) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"url", "referrer", "depth", "kind", "status", "contentType"})
+
+	for _, listed := range inv {
+		status := ""
+		if listed.Status != 0 {
+			status = strconv.Itoa(listed.Status)
+		}
+		cw.Write([]string{listed.URL, listed.Referrer, strconv.Itoa(listed.Depth), listed.Kind, status, listed.ContentType})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// listResult adds a page and the assets it refers to into the inventory when listing
+// URLs. The assets are removed from the page's references so that they are not fetched.
+func (sc *Scraper) listResult(result *work.Result, depth int) {
+	if !sc.config.ListURLs {
+		return
+	}
+
+	page := ListedURL{
+		URL:         result.URL.String(),
+		Depth:       result.Depth,
+		Kind:        KindPage,
+		Status:      result.StatusCode,
+		ContentType: result.ContentType,
+	}
+	if result.Referrer != nil {
+		page.Referrer = result.Referrer.String()
+	}
+	sc.inventory = append(sc.inventory, page)
+
+	pages := make(work.Refs, 0, len(result.References))
+	for _, ref := range result.References {
+		if mapping.IsPageURL(ref) {
+			pages = append(pages, ref)
+		} else {
+			sc.inventory = append(sc.inventory, ListedURL{URL: ref.String(), Referrer: page.URL, Depth: depth, Kind: KindAsset})
+		}
+	}
+	result.References = pages
+}
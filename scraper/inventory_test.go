@@ -0,0 +1,48 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScraperListURLs(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body><a href="/about">About</a><a href="/private/x">X</a><img src="/logo.png"></body></html>`)
+	stub.GivenResponse(http.StatusNotFound, "https://example.org/about", "text/html", ``)
+
+	cfg := config.Config{MaxDepth: 10, ListURLs: true, Excludes: []string{"/private"}}
+	fs := afero.NewMemMapFs()
+	sc, err := New(cfg, mustParseURL("https://example.org/"), fs, testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	err = sc.Start(context.Background())
+	require.NoError(t, err)
+
+	// the stub would panic if the asset were fetched
+	assert.Equal(t, Inventory{
+		{URL: "https://example.org/", Depth: 0, Kind: KindPage, Status: http.StatusOK, ContentType: "text/html"},
+		{URL: "https://example.org/logo.png", Referrer: "https://example.org/", Depth: 1, Kind: KindAsset},
+		{URL: "https://example.org/about", Referrer: "https://example.org/", Depth: 1, Kind: KindPage, Status: http.StatusNotFound},
+	}, sc.Inventory())
+
+	files, err := afero.ReadDir(fs, ".")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, sc.Inventory().WriteCSV(buf))
+	assert.Equal(t, `url,referrer,depth,kind,status,contentType
+https://example.org/,,0,page,200,text/html
+https://example.org/logo.png,https://example.org/,1,asset,,
+https://example.org/about,https://example.org/,1,page,404,
+`, buf.String())
+}
@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	urlpkg "net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/cornelk/goscrape/mapping"
+)
+
+// localHost is the host of the URLs of a local tree that has no origin.
+const localHost = "localhost"
+
+// localTree serves the URLs of a website from the files in a local directory, such
+// as the pages exported from a CMS, so that they can be processed in the same way as
+// those of a live website. The directory is the root of the website. The assets that
+// are missing from the tree are fetched from the origin, if any; missing pages are not.
+type localTree struct {
+	root   string
+	origin *urlpkg.URL // the URL of the root; file://localhost/ if there is no origin
+	files  http.RoundTripper
+	next   http.RoundTripper // for the other URLs
+}
+
+// newLocalTree gets the local tree for a file:// start URL, which names the root
+// directory or a page in it, and the start URL to use instead, which is within origin.
+// With no origin, the tree is processed as file://localhost/.
+func newLocalTree(start *urlpkg.URL, origin string) (*localTree, *urlpkg.URL, error) {
+	base := &urlpkg.URL{Scheme: "file", Host: localHost, Path: "/"}
+	if origin != "" {
+		var err error
+		if base, err = urlpkg.Parse(origin); err != nil {
+			return nil, nil, fmt.Errorf("origin: %w", err)
+		}
+		if base.Path != "" && base.Path != "/" {
+			return nil, nil, fmt.Errorf("origin %q: must be the URL of a website, without a path", origin)
+		}
+	}
+
+	root := filepath.FromSlash(start.Path)
+	page := "/"
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		root, page = filepath.Dir(root), "/"+filepath.Base(root)
+	}
+
+	lt := &localTree{
+		root:   root,
+		origin: base,
+		files:  http.NewFileTransport(http.Dir(root)),
+	}
+	return lt, base.ResolveReference(&urlpkg.URL{Path: page}), nil
+}
+
+// RoundTrip serves the file for the URL of the request, if it is within the origin.
+func (lt *localTree) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := req.URL
+	if u.Scheme != lt.origin.Scheme || u.Host != lt.origin.Host {
+		return lt.next.RoundTrip(req)
+	}
+
+	name := filepath.Join(lt.root, filepath.FromSlash(path.Clean("/"+u.Path)))
+	_, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) && lt.origin.Scheme != "file" && !mapping.IsPageURL(u) {
+		return lt.next.RoundTrip(req)
+	}
+
+	resp, err := lt.files.RoundTrip(req)
+	if resp != nil {
+		resp.Request = req
+	}
+	return resp, err
+}
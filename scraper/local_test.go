@@ -0,0 +1,104 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTree(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("logo"))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	writeLocal(t, filepath.Join(root, "index.html"), `<html><head><link href="/css/site.css" rel="stylesheet"></head>
+<body><img src="`+origin.URL+`/img/logo.png"><a href="blog/post.html">Post</a><a href="missing.html">Missing</a></body></html>`)
+	writeLocal(t, filepath.Join(root, "css", "site.css"), `body { color: black; }`)
+	writeLocal(t, filepath.Join(root, "blog", "post.html"), `<html><body><a href="../index.html">Home</a></body></html>`)
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{MaxDepth: 10, Origin: origin.URL}, mustParseURL("file://"+filepath.ToSlash(root)+"/"), fs, testLogger())
+	require.NoError(t, err)
+	assert.Equal(t, origin.URL+"/", sc.URL.String())
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	dir := mapping.HostDir(sc.URL.Host)
+	for _, file := range []string{"index.html", "css/site.css", "blog/post.html", "img/logo.png"} {
+		exists, err := afero.Exists(fs, filepath.Join(dir, file))
+		require.NoError(t, err)
+		assert.True(t, exists, file)
+	}
+
+	index, err := afero.ReadFile(fs, filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `<img src="img/logo.png"/>`)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, requested, "/img/logo.png")
+	assert.NotContains(t, requested, "/css/site.css", "local files are not fetched")
+	assert.NotContains(t, requested, "/missing.html", "missing pages are not fetched")
+}
+
+func TestLocalTreeWithoutOrigin(t *testing.T) {
+	root := t.TempDir()
+	writeLocal(t, filepath.Join(root, "start.html"), `<html><body><a href="/docs/other.html">Other</a></body></html>`)
+	writeLocal(t, filepath.Join(root, "docs", "other.html"), `<html><body>Other</body></html>`)
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{MaxDepth: 10}, mustParseURL("file://"+filepath.ToSlash(root)+"/start.html"), fs, testLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "file://localhost/start.html", sc.URL.String())
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	exists, err := afero.Exists(fs, filepath.Join("localhost", "docs", "other.html"))
+	require.NoError(t, err)
+	assert.True(t, exists, "root-relative links lead within the tree")
+
+	_, err = New(config.Config{}, mustParseURL("file://"+filepath.ToSlash(root)+"/absent/"), fs, testLogger())
+	assert.Error(t, err)
+}
+
+func writeLocal(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+}
+
+func TestFileLinksIgnoredOnWebsites(t *testing.T) {
+	var host string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`<a href="file://` + host + `/x">x</a><a href="/b.html">b</a>`))
+		}
+	}))
+	defer origin.Close()
+	host = mustParseURL(origin.URL).Host
+
+	sc, err := New(config.Config{}, mustParseURL(origin.URL), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Contains(t, sc.processed.Slice(), "/b.html")
+}
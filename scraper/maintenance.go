@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/utc"
+)
+
+// maintenance holds the times until which hosts are down for maintenance, as announced
+// by 503 responses with a distant Retry-After. Their items wait until then, rather
+// than using up their attempts in vain.
+type maintenance struct {
+	mu    sync.Mutex
+	until map[string]time.Time // keyed by host
+}
+
+// park records a maintenance window. It returns false if the host was already parked
+// for at least as long.
+func (m *maintenance) park(host string, until time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !until.After(m.until[host]) {
+		return false
+	}
+	if m.until == nil {
+		m.until = make(map[string]time.Time)
+	}
+	m.until[host] = until
+	return true
+}
+
+// wait blocks until the host's maintenance window, if any, has ended. It returns false
+// if the context is done first.
+func (m *maintenance) wait(ctx context.Context, host string) bool {
+	for {
+		m.mu.Lock()
+		until := m.until[host]
+		m.mu.Unlock()
+
+		remaining := until.Sub(utc.Now())
+		if remaining <= 0 {
+			return ctx.Err() == nil
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+			// the window may have been extended meanwhile
+		}
+	}
+}
+
+// park leaves a host alone until its maintenance window ends, or for MaxMaintenance
+// if that is sooner. The window is also recorded in the metadata store, so that a
+// later run, e.g. one that resumes this scrape, waits for it too.
+func (sc *Scraper) park(host string, until time.Time) {
+	now := utc.Now()
+	if longest := now.Add(sc.config.MaxMaintenance); until.After(longest) {
+		until = longest
+	}
+	if !until.After(now) || !sc.maintenance.park(host, until) {
+		return
+	}
+
+	sc.ETagsDB.Park(host, until)
+	sc.Logger.Warn("Down for maintenance", slog.String("host", host), slog.Time("until", until))
+}
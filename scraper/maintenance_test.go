@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	var requests atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, `<html><body>Back again</body></html>`)
+	}))
+	defer origin.Close()
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{MaxAttempts: 1, Maintenance: time.Millisecond}, mustParseURL(origin.URL), fs, testLogger())
+	require.NoError(t, err)
+
+	start := utc.Now()
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.GreaterOrEqual(t, utc.Now().Sub(start), 900*time.Millisecond, "waited for the maintenance window")
+	assert.EqualValues(t, 2, requests.Load(), "the maintenance did not use up the only attempt")
+
+	exists, err := afero.Exists(fs, filepath.Join(mapping.HostDir(sc.URL.Host), "index.html"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMaintenanceEnds(t *testing.T) {
+	var requests atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "31536000") // a year
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer origin.Close()
+
+	cfg := config.Config{MaxAttempts: 1, Maintenance: time.Millisecond, MaxMaintenance: 10 * time.Millisecond}
+	sc, err := New(cfg, mustParseURL(origin.URL), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	require.NoError(t, sc.Start(ctx))
+
+	require.NoError(t, ctx.Err(), "the window was cut short")
+	assert.EqualValues(t, 2, requests.Load(), "one window waited out, then the only attempt used up")
+}
+
+func TestMaintenanceWait(t *testing.T) {
+	var m maintenance
+	assert.True(t, m.wait(context.Background(), "example.org"), "not parked")
+
+	until := utc.Now().Add(20 * time.Millisecond)
+	assert.True(t, m.park("example.org", until))
+	assert.False(t, m.park("example.org", until.Add(-time.Millisecond)), "already parked for longer")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, m.wait(ctx, "example.org"), "cancelled")
+
+	assert.True(t, m.wait(context.Background(), "example.org"))
+	assert.False(t, utc.Now().Before(until))
+}
@@ -0,0 +1,46 @@
+package scraper
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+)
+
+// recordFile keeps the manifest up to date with the file that was stored, or deleted,
+// for a result, along with its Vary key and the metadata of a stored page. The files are within a
+// directory named after the host.
+func (sc *Scraper) recordFile(host string, result work.Result) {
+	if sc.Manifest == nil {
+		return
+	}
+
+	switch result.StatusCode {
+	case http.StatusOK:
+		if result.Hash != "" {
+			sc.Manifest.Add(manifestPath(host, result.FilePath), result.Hash)
+			if result.Metadata != nil {
+				sc.Manifest.AddPage(manifestPath(host, result.FilePath), *result.Metadata)
+			}
+			sc.Manifest.AddVary(manifestPath(host, result.FilePath), result.Vary)
+		}
+
+	case http.StatusForbidden, http.StatusGone, http.StatusUnavailableForLegalReasons:
+		sc.Manifest.Remove(manifestPath(host, mapping.GetFilePath(result.URL, true)))
+		sc.Manifest.Remove(manifestPath(host, mapping.GetFilePath(result.URL, false)))
+	}
+}
+
+// storedPath gets the path of the file stored for a result, relative to the output
+// directory, or blank if there is none.
+func storedPath(host string, result work.Result) string {
+	if result.FilePath == "" || (result.Hash == "" && result.StatusCode != http.StatusNotModified) {
+		return ""
+	}
+	return manifestPath(host, result.FilePath)
+}
+
+func manifestPath(host, file string) string {
+	return filepath.ToSlash(filepath.Join(mapping.HostDir(host), file))
+}
@@ -0,0 +1,29 @@
+package scraper
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// seedItems gets the work items for the pages listed by the pagination patterns and
+// for the seed URLs. These are all at depth 0 so that the depth limit doesn't prevent
+// them from being fetched, although they are subject to the usual filters.
+func (sc *Scraper) seedItems() []work.Item {
+	var items []work.Item
+	for _, page := range slices.Concat(sc.pages, sc.config.Seeds) {
+		u, err := sc.URL.Parse(page)
+		if err != nil {
+			sc.Logger.Warn("Invalid seed URL", slog.String("url", page), slog.Any("error", err))
+			continue
+		}
+
+		u.Fragment = ""
+		if sc.shouldURLBeDownloaded(u, sc.URL, 0) {
+			items = append(items, work.Item{URL: u, Referrer: sc.URL, Queued: utc.Now()})
+		}
+	}
+	return items
+}
@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"context"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/work"
+	"github.com/rickb777/process/v2"
+)
+
+// processors is a pool of workers that parse and rewrite the fetched responses, so
+// that this CPU-bound work doesn't stall the download workers. A nil *processors
+// means the download workers process their own responses.
+type processors struct {
+	queue chan *download.Fetched
+	pool  *process.ProcessGroup
+}
+
+// startProcessors starts the processing pool, if one is configured.
+func (sc *Scraper) startProcessors(ctx context.Context, d *download.Download, results chan<- work.Result) *processors {
+	if sc.config.ProcessConcurrency < 1 {
+		return nil
+	}
+
+	queueSize := sc.config.ProcessQueue
+	if queueSize < 1 {
+		queueSize = 2 * sc.config.ProcessConcurrency
+	}
+
+	p := &processors{
+		queue: make(chan *download.Fetched, queueSize),
+		pool:  process.NewGroup(),
+	}
+
+	p.pool.GoNE(sc.config.ProcessConcurrency, func(int) error {
+		for fetched := range p.queue {
+			if err := processResult(ctx, d, fetched, results); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return p
+}
+
+// accept passes a buffered response to the pool, blocking while the queue is full.
+// It returns false if the response should be processed by the caller instead.
+func (p *processors) accept(ctx context.Context, fetched *download.Fetched) bool {
+	if p == nil || !fetched.Buffered() {
+		return false
+	}
+
+	select {
+	case p.queue <- fetched:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close stops accepting work and waits for the pool to finish the queue.
+func (p *processors) close() {
+	if p != nil {
+		close(p.queue)
+		p.pool.Wait()
+	}
+}
+
+func (p *processors) err() error {
+	if p == nil {
+		return nil
+	}
+	return p.pool.Err()
+}
@@ -0,0 +1,141 @@
+package scraper
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/utc"
+)
+
+// progressWindow is the period over which the rates of discovery and completion are
+// measured; progressSamples is the number of samples taken during it.
+const (
+	progressWindow  = time.Minute
+	progressSamples = 12
+)
+
+// Progress describes how a scrape is getting on: how fast new URLs are being discovered
+// and how fast they are being completed, recently, and so how long the rest of the queue
+// is likely to take.
+type Progress struct {
+	Discovered     int           // the items queued so far, including retries
+	Completed      int           // the results received so far
+	Pending        int           // the items queued but not yet completed
+	DiscoveryRate  float64       // the items queued per second, recently
+	CompletionRate float64       // the results received per second, recently
+	ETA            time.Duration // the estimated time until the queue is empty; zero while it is growing or not yet known
+	Measured       time.Duration // the period over which the rates were measured, up to a little over a minute
+}
+
+// Growth gets the number of items by which the queue is growing per second, recently;
+// it is negative when the queue is shrinking.
+func (p Progress) Growth() float64 {
+	return p.DiscoveryRate - p.CompletionRate
+}
+
+// Growing reports whether the queue has been growing faster than it is being completed
+// for the last minute, which is a sign of a crawler trap, such as an endless calendar, or
+// of filters that are too broad. The queue usually grows at first, so a shorter period
+// does not count.
+func (p Progress) Growing() bool {
+	return p.Measured >= progressWindow && p.Growth() > 0
+}
+
+type progressSample struct {
+	at         time.Time
+	discovered int
+	completed  int
+}
+
+// progress counts the items queued and completed, sampling the counts so that the recent
+// rates can be measured.
+type progress struct {
+	mu         sync.Mutex
+	discovered int
+	completed  int
+	samples    []progressSample // the oldest first, spanning a little over progressWindow
+	warned     bool             // the queue has been reported as growing
+}
+
+func (p *progress) queued(now time.Time, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discovered += n
+	p.sample(now)
+}
+
+func (p *progress) done(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.completed++
+	p.sample(now)
+}
+
+func (p *progress) sample(now time.Time) {
+	if n := len(p.samples); n > 0 && now.Sub(p.samples[n-1].at) < progressWindow/progressSamples {
+		return
+	}
+	p.samples = append(p.samples, progressSample{at: now, discovered: p.discovered, completed: p.completed})
+
+	// keep one sample from at least progressWindow ago, for measuring the whole window
+	for len(p.samples) > 2 && now.Sub(p.samples[1].at) >= progressWindow {
+		p.samples = p.samples[1:]
+	}
+}
+
+func (p *progress) snapshot(now time.Time) Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.measure(now)
+}
+
+func (p *progress) measure(now time.Time) Progress {
+	pr := Progress{Discovered: p.discovered, Completed: p.completed, Pending: max(p.discovered-p.completed, 0)}
+	if len(p.samples) == 0 {
+		return pr
+	}
+
+	oldest := p.samples[0]
+	seconds := now.Sub(oldest.at).Seconds()
+	if seconds <= 0 {
+		return pr
+	}
+
+	pr.Measured = now.Sub(oldest.at)
+	pr.DiscoveryRate = float64(p.discovered-oldest.discovered) / seconds
+	pr.CompletionRate = float64(p.completed-oldest.completed) / seconds
+	if pr.Growth() < 0 {
+		pr.ETA = time.Duration(float64(pr.Pending) / -pr.Growth() * float64(time.Second)).Round(time.Second)
+	}
+	return pr
+}
+
+// startedGrowing reports when the queue has started growing faster than it is being
+// completed. It reports this once, and again only after the queue has stopped growing
+// in the meantime.
+func (p *progress) startedGrowing(now time.Time) (Progress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pr := p.measure(now)
+	if !pr.Growing() {
+		p.warned = false
+		return pr, false
+	}
+
+	warn := !p.warned
+	p.warned = true
+	return pr, warn
+}
+
+func perSecond(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 1, 64) + "/s"
+}
+
+// Progress gets the recent rates at which URLs are being discovered and completed, and
+// the estimated time until the scrape finishes. It can be called at any time while the
+// scrape is running.
+func (sc *Scraper) Progress() Progress {
+	return sc.progress.snapshot(utc.Now())
+}
@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTooSoon(t *testing.T) {
+	var p progress
+	start := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, Progress{}, p.snapshot(start))
+
+	p.queued(start, 10)
+	pr := p.snapshot(start)
+	assert.Equal(t, Progress{Discovered: 10, Pending: 10}, pr)
+	assert.False(t, pr.Growing())
+}
+
+func TestProgressETA(t *testing.T) {
+	var p progress
+	start := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+
+	p.queued(start, 200)
+	for i := range 60 {
+		at := start.Add(time.Duration(i+1) * time.Second)
+		p.queued(at, 1)
+		p.done(at)
+		p.done(at)
+	}
+
+	// completing 2/s and discovering 1/s leaves 140 items to go at 1/s
+	pr := p.snapshot(start.Add(60 * time.Second))
+	assert.Equal(t, 260, pr.Discovered)
+	assert.Equal(t, 120, pr.Completed)
+	assert.Equal(t, 140, pr.Pending)
+	assert.InDelta(t, 1.0, pr.DiscoveryRate, 0.01)
+	assert.InDelta(t, 2.0, pr.CompletionRate, 0.01)
+	assert.Equal(t, 140*time.Second, pr.ETA)
+	assert.Equal(t, time.Minute, pr.Measured)
+}
+
+func TestProgressGrowing(t *testing.T) {
+	var p progress
+	start := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+
+	warnings := 0
+	tick := func(at time.Time, discovered int) {
+		p.queued(at, discovered)
+		p.done(at)
+		if _, growing := p.startedGrowing(at); growing {
+			warnings++
+		}
+	}
+
+	for i := range 50 {
+		tick(start.Add(time.Duration(i)*time.Second), 3)
+	}
+	assert.Zero(t, warnings, "the queue usually grows at first")
+
+	for i := 50; i < 120; i++ {
+		tick(start.Add(time.Duration(i)*time.Second), 3)
+	}
+	assert.Equal(t, 1, warnings, "reported once")
+	assert.True(t, p.snapshot(start.Add(120*time.Second)).Growing())
+
+	for i := 120; i < 240; i++ {
+		tick(start.Add(time.Duration(i)*time.Second), 0)
+	}
+	for i := 240; i < 360; i++ {
+		tick(start.Add(time.Duration(i)*time.Second), 3)
+	}
+	assert.Equal(t, 2, warnings, "reported again after it stopped growing")
+}
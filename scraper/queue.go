@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// QueueSnapshot lists the work of a scrape that is in progress, so that an aborted or
+// misbehaving scrape can be inspected and selectively re-seeded.
+type QueueSnapshot struct {
+	Time     time.Time   `json:"time"`
+	StartURL string      `json:"startURL"`
+	Pending  []QueuedURL `json:"pending"` // queued or being downloaded
+	Seen     []string    `json:"seen"`    // paths on the start host, and other URLs, that have been checked
+}
+
+// QueuedURL is an item in the work queue.
+type QueuedURL struct {
+	URL      string    `json:"url"`
+	Referrer string    `json:"referrer,omitempty"`
+	Depth    int       `json:"depth"`
+	Attempt  int       `json:"attempt,omitempty"`
+	Queued   time.Time `json:"queued"`
+}
+
+// WriteJSON writes the snapshot as indented JSON.
+func (s QueueSnapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// QueueSnapshot gets the pending items and the URLs seen so far. It can be called at any
+// time while the scrape is running.
+func (sc *Scraper) QueueSnapshot() QueueSnapshot {
+	seen := sc.processed.Slice()
+	slices.Sort(seen)
+
+	return QueueSnapshot{
+		Time:     utc.Now(),
+		StartURL: sc.URL.String(),
+		Pending:  sc.pending.list(),
+		Seen:     seen,
+	}
+}
+
+// Pending gets the items that are queued or being downloaded. Unlike QueueSnapshot, it
+// is cheap enough to be called frequently, e.g. to show progress.
+func (sc *Scraper) Pending() []QueuedURL {
+	return sc.pending.list()
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// pendingItems tracks the items that have been queued but whose results have not yet
+// arrived, because the work queue itself cannot be inspected. The key is the URL.
+type pendingItems struct {
+	items map[string]work.Item
+	mu    sync.Mutex
+}
+
+func (p *pendingItems) add(item work.Item) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.items == nil {
+		p.items = make(map[string]work.Item)
+	}
+	p.items[item.URL.String()] = item
+}
+
+func (p *pendingItems) remove(result work.Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.items, result.Item.URL.String())
+	if len(result.Redirects) > 0 {
+		// the URL of the start page and its pagination may have been changed by redirection
+		delete(p.items, result.Redirects[0].String())
+	}
+}
+
+func (p *pendingItems) list() []QueuedURL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]QueuedURL, 0, len(p.items))
+	for _, key := range slices.Sorted(maps.Keys(p.items)) {
+		item := p.items[key]
+		q := QueuedURL{URL: key, Depth: item.Depth, Attempt: item.Attempt, Queued: item.Queued}
+		if item.Referrer != nil {
+			q.Referrer = item.Referrer.String()
+		}
+		list = append(list, q)
+	}
+
+	slices.SortStableFunc(list, func(a, b QueuedURL) int { return cmp.Compare(a.Depth, b.Depth) })
+	return list
+}
@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/cornelk/goscrape/work"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueSnapshot(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	queued := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	home := mustParseURL("https://example.org/")
+	sc.processed.Add("/")
+	sc.processed.Add("/a")
+	sc.processed.Add("/b")
+	sc.processed.Add("/old")
+
+	sc.pending.add(work.Item{URL: mustParseURL("https://example.org/b"), Referrer: home, Depth: 2, Queued: queued})
+	sc.pending.add(work.Item{URL: mustParseURL("https://example.org/a"), Referrer: home, Depth: 1, Attempt: 1, Queued: queued})
+	sc.pending.add(work.Item{URL: mustParseURL("https://example.org/old"), Referrer: home, Depth: 1, Queued: queued})
+	sc.pending.add(work.Item{URL: mustParseURL("https://example.org/c"), Referrer: home, Depth: 1, Queued: queued})
+
+	sc.pending.remove(work.Result{Item: work.Item{URL: mustParseURL("https://example.org/c")}})
+	sc.pending.remove(work.Result{
+		Item:      work.Item{URL: mustParseURL("https://example.org/new")},
+		Redirects: work.Refs{mustParseURL("https://example.org/old")},
+	})
+
+	snapshot := sc.QueueSnapshot()
+	assert.Equal(t, "https://example.org/", snapshot.StartURL)
+	assert.Equal(t, []string{"/", "/a", "/b", "/old"}, snapshot.Seen)
+	assert.Equal(t, []QueuedURL{
+		{URL: "https://example.org/a", Referrer: "https://example.org/", Depth: 1, Attempt: 1, Queued: queued},
+		{URL: "https://example.org/b", Referrer: "https://example.org/", Depth: 2, Queued: queued},
+	}, snapshot.Pending)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, snapshot.WriteJSON(buf))
+
+	var decoded QueueSnapshot
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, snapshot.Pending, decoded.Pending)
+	assert.Equal(t, snapshot.Seen, decoded.Seen)
+}
@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/utc"
+)
+
+// renewals serialises the renewals of expired credentials. When several workers are
+// rejected at once, only the first renews the credentials; the others share the outcome.
+type renewals struct {
+	mu      sync.Mutex
+	renewed time.Time // when the credentials were last renewed
+	err     error     // the outcome of the last renewal
+}
+
+// renew calls the reauthenticator, unless the credentials were renewed after the
+// rejected request was sent.
+func (r *renewals) renew(ctx context.Context, sent time.Time, reauthenticate download.Reauthenticator) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.renewed.After(sent) {
+		return r.err
+	}
+
+	r.err = reauthenticate(ctx, sent)
+	r.renewed = utc.Now()
+	return r.err
+}
+
+// reauthenticator gets the means of renewing expired credentials, which is Reauthenticate
+// or else logging in again. It is nil if there is neither.
+func (sc *Scraper) reauthenticator() download.Reauthenticator {
+	var reauthenticate download.Reauthenticator
+	switch {
+	case sc.Reauthenticate != nil:
+		reauthenticate = func(ctx context.Context, sent time.Time) error {
+			err := sc.Reauthenticate(ctx, sent)
+			if err == nil {
+				sc.Logger.Info("Renewed the credentials")
+			}
+			return err
+		}
+
+	case sc.session != nil && sc.session.login != nil:
+		reauthenticate = func(ctx context.Context, _ time.Time) error {
+			return sc.session.renew(ctx, sc.Downloader(), sc.URL) // logs in
+		}
+
+	default:
+		return nil
+	}
+
+	return func(ctx context.Context, sent time.Time) error {
+		return sc.renewals.renew(ctx, sent, reauthenticate)
+	}
+}
@@ -0,0 +1,103 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReauthenticateByLoggingIn(t *testing.T) {
+	var mu sync.Mutex
+	sid := 0
+	logins := 0
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/login" {
+			logins++
+			sid = logins
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: fmt.Sprint(sid), Path: "/"})
+			return
+		}
+
+		if r.URL.Path == "/a" && logins == 1 {
+			sid = 0 // the session expires
+		}
+
+		cookie, err := r.Cookie("sid")
+		if err != nil || cookie.Value != fmt.Sprint(sid) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		case "/a":
+			fmt.Fprint(w, `Secret A <a href="/b">b</a>`)
+		default:
+			fmt.Fprint(w, "Secret B")
+		}
+	}))
+	defer origin.Close()
+
+	cfg := config.Config{LoginURL: "/login", LoginValues: url.Values{"user": {"alice"}}}
+	sc, err := New(cfg, mustParseURL(origin.URL+"/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, 2, logins)
+	a, err := afero.ReadFile(sc.Fs, mapping.HostDir(sc.URL.Host)+"/a.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(a), "Secret A")
+	exists, _ := afero.Exists(sc.Fs, mapping.HostDir(sc.URL.Host)+"/b.html")
+	assert.True(t, exists)
+}
+
+func TestRenewals(t *testing.T) {
+	var r renewals
+	calls := 0
+	reauthenticate := func(ctx context.Context, sent time.Time) error {
+		calls++
+		return errors.New("refused")
+	}
+
+	sent := utc.Now().Add(-time.Second)
+	assert.Error(t, r.renew(context.Background(), sent, reauthenticate))
+	assert.Error(t, r.renew(context.Background(), sent, reauthenticate), "the outcome is shared")
+	assert.Equal(t, 1, calls)
+
+	assert.Error(t, r.renew(context.Background(), utc.Now().Add(time.Second), reauthenticate), "rejected after the renewal")
+	assert.Equal(t, 2, calls)
+}
+
+func TestReauthenticator(t *testing.T) {
+	sc, err := New(config.Config{}, mustParseURL("http://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	assert.Nil(t, sc.reauthenticator())
+
+	refreshed := 0
+	sc.Reauthenticate = func(ctx context.Context, sent time.Time) error {
+		refreshed++
+		return nil
+	}
+	require.NoError(t, sc.Downloader().Reauthenticate(context.Background(), utc.Now()))
+	assert.Equal(t, 1, refreshed)
+}
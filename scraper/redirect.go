@@ -0,0 +1,60 @@
+package scraper
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/logger"
+)
+
+// redirectPolicy limits the number of redirects that are followed and, if
+// configured, prevents redirects from leading to a different host. Redirects to
+// blocked URLs are not followed either.
+// Redirects that are not followed are returned as 3xx responses, which are then
+// logged and discarded. Redirects to hosts that may not be sent the credentials
+// have them removed.
+func redirectPolicy(cfg config.Config, startHost string, blocked func(*url.URL) bool, log *logger.Logger) func(req *http.Request, via []*http.Request) error {
+	maxRedirects := cfg.MaxRedirects
+	switch {
+	case maxRedirects == 0:
+		maxRedirects = config.DefaultMaxRedirects
+	case maxRedirects < 0:
+		maxRedirects = 0 // config.NoRedirects
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			if maxRedirects == 0 {
+				// redirects were turned off, so this is expected
+				log.Debug("Redirect not followed",
+					slog.String("url", via[0].URL.String()),
+					slog.String("location", req.URL.String()))
+			} else {
+				log.Warn("Too many redirects",
+					slog.String("url", via[0].URL.String()),
+					slog.Int("limit", maxRedirects))
+			}
+			return http.ErrUseLastResponse
+		}
+
+		if cfg.SameHostRedirects && req.URL.Host != via[0].URL.Host {
+			log.Info("Redirect to another host not followed",
+				slog.String("url", via[0].URL.String()),
+				slog.String("location", req.URL.String()))
+			return http.ErrUseLastResponse
+		}
+
+		if blocked != nil && blocked(req.URL) {
+			log.Info("Redirect to a blocked URL not followed",
+				slog.String("url", via[0].URL.String()),
+				slog.String("location", req.URL.String()))
+			return http.ErrUseLastResponse
+		}
+
+		download.StripCredentials(cfg, startHost, req)
+		return nil
+	}
+}
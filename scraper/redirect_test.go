@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, "http://other.invalid/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer origin.Close()
+
+	blockB := func(u *url.URL) bool { return u.Path == "/b" }
+
+	cases := []struct {
+		cfg     config.Config
+		blocked func(*url.URL) bool
+		path    string
+		status  int
+	}{
+		{cfg: config.Config{}, path: "/a", status: http.StatusOK},
+		{cfg: config.Config{MaxRedirects: config.NoRedirects}, path: "/a", status: http.StatusFound},
+		{cfg: config.Config{MaxRedirects: 1}, path: "/a", status: http.StatusFound},
+		{cfg: config.Config{MaxRedirects: 2}, path: "/a", status: http.StatusOK},
+		{cfg: config.Config{SameHostRedirects: true}, path: "/away", status: http.StatusFound},
+		{cfg: config.Config{}, blocked: blockB, path: "/a", status: http.StatusFound},
+	}
+
+	for _, c := range cases {
+		client := &http.Client{CheckRedirect: redirectPolicy(c.cfg, "example.org", c.blocked, nil)}
+		resp, err := client.Get(origin.URL + c.path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, c.status, resp.StatusCode, "%+v %s", c.cfg, c.path)
+	}
+}
+
+func TestRedirectPolicyWarnings(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer origin.Close()
+
+	cases := []struct {
+		maxRedirects int
+		exitCode     int
+	}{
+		{maxRedirects: config.NoRedirects, exitCode: logger.ExitOK}, // redirects turned off is not a problem
+		{maxRedirects: 1, exitCode: logger.ExitErrors},
+		{maxRedirects: 2, exitCode: logger.ExitOK},
+	}
+
+	for _, c := range cases {
+		log := testLogger()
+		log.FailOnWarn = true
+		client := &http.Client{CheckRedirect: redirectPolicy(config.Config{MaxRedirects: c.maxRedirects}, "example.org", nil, log)}
+		resp, err := client.Get(origin.URL + "/a")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, c.exitCode, log.ExitCode(), "%d", c.maxRedirects)
+	}
+}
+
+func TestRedirectPolicyStripsCredentials(t *testing.T) {
+	var seen http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header
+	}))
+	defer other.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	startHost := mustParseURL(origin.URL).Host
+	otherHost := mustParseURL(other.URL).Host
+
+	cases := []struct {
+		cfg      config.Config
+		expected string
+	}{
+		{cfg: config.Config{Header: http.Header{"X-Token": {"abc"}}}, expected: ""},
+		{cfg: config.Config{Header: http.Header{"X-Token": {"abc"}}, CredentialHosts: []string{otherHost}}, expected: "abc"},
+		{cfg: config.Config{Header: http.Header{"X-Token": {"abc"}}, AnyHostCredentials: true}, expected: "abc"},
+	}
+
+	for _, c := range cases {
+		client := &http.Client{CheckRedirect: redirectPolicy(c.cfg, startHost, nil, nil)}
+		req, _ := http.NewRequest(http.MethodGet, origin.URL+"/", nil)
+		req.Header.Set("X-Token", "abc")
+		req.Header.Set("Authorization", "Basic xyz")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, c.expected, seen.Get("X-Token"), "%+v", c.cfg)
+		assert.Equal(t, c.expected != "", seen.Get("Authorization") != "", "%+v", c.cfg)
+	}
+}
@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	urlpkg "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cornelk/goscrape/download"
+)
+
+// upgradeToHTTPS probes whether the start page is available via https://. If so, the
+// start URL is upgraded, adopting the URL that the probe was redirected to (unless
+// FixedStartURL is set). This happens before the start page is downloaded, so that
+// the files are mapped according to the canonical URL rather than the first hop of
+// the redirect chain. If the website also sends an HSTS policy, any http:// links to
+// it are upgraded as they are found.
+func (sc *Scraper) upgradeToHTTPS(ctx context.Context, d *download.Download) error {
+	secure := *sc.URL
+	secure.Scheme = "https"
+
+	resp, _, err := d.Probe(ctx, &secure)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sc.Logger.Info("HTTPS is not available", slog.String("url", secure.String()), slog.Any("error", err))
+		return nil
+	}
+
+	if resp.StatusCode >= 400 {
+		sc.Logger.Info("HTTPS is not available", slog.String("url", secure.String()), slog.Int("status", resp.StatusCode))
+		return nil
+	}
+
+	final := resp.Request.URL
+	if final.Scheme != "https" {
+		return nil // redirected back to http://
+	}
+
+	if sc.config.FixedStartURL {
+		sc.URL = &secure
+	} else {
+		canonical := *final
+		canonical.Fragment = ""
+		sc.URL = &canonical
+	}
+
+	sc.hsts = hasHSTS(resp.Header)
+	sc.Logger.Info("Using HTTPS", slog.String("url", sc.URL.String()), slog.Bool("hsts", sc.hsts))
+	return nil
+}
+
+// upgradeScheme changes http:// references to the start host into https:// ones when
+// the website has an HSTS policy. With SameScheme, references to the start host via
+// either scheme are changed to use the scheme of the start URL instead, because both
+// versions of a page are stored in the same file.
+func (sc *Scraper) upgradeScheme(ref *urlpkg.URL) {
+	if ref.Host != sc.URL.Host || (ref.Scheme != "http" && ref.Scheme != "https") {
+		return
+	}
+
+	switch {
+	case sc.config.SameScheme:
+		ref.Scheme = sc.URL.Scheme
+	case sc.hsts:
+		ref.Scheme = "https"
+	}
+}
+
+// hasHSTS reports whether the headers contain a Strict-Transport-Security policy that
+// has not expired, i.e. whose max-age is positive.
+func hasHSTS(hdr http.Header) bool {
+	for _, directive := range strings.Split(hdr.Get("Strict-Transport-Security"), ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			age, err := strconv.Atoi(strings.Trim(value, `"`))
+			return err == nil && age > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithoutScheme(t *testing.T) {
+	sc, err := New(config.Config{}, mustParseURL("example.org/docs/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.org/docs/", sc.URL.String())
+	assert.True(t, sc.probeHTTPS)
+
+	sc, err = New(config.Config{}, mustParseURL("http://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	assert.False(t, sc.probeHTTPS)
+
+	sc, err = New(config.Config{UpgradeHTTPS: true}, mustParseURL("http://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	assert.True(t, sc.probeHTTPS)
+}
+
+func TestScraperUpgradeHTTPS(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<a href="http://%s/a">a</a>`, r.Host)
+		}
+	}))
+	defer origin.Close()
+
+	insecure := strings.Replace(origin.URL, "https:", "http:", 1) + "/"
+	sc, err := New(config.Config{UpgradeHTTPS: true}, mustParseURL(insecure), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = origin.Client() // trusts the server's certificate
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, origin.URL+"/", sc.URL.String())
+	assert.True(t, sc.hsts)
+	for _, name := range []string{"index.html", "a.html"} {
+		exists, _ := afero.Exists(sc.Fs, mapping.HostDir(sc.URL.Host)+"/"+name)
+		assert.True(t, exists, name)
+	}
+}
+
+func TestUpgradeScheme(t *testing.T) {
+	cases := []struct {
+		start      string
+		sameScheme bool
+		hsts       bool
+		ref        string
+		expected   string
+	}{
+		{start: "https://example.org/", ref: "http://example.org/a", expected: "http://example.org/a"},
+		{start: "https://example.org/", hsts: true, ref: "http://example.org/a", expected: "https://example.org/a"},
+		{start: "https://example.org/", sameScheme: true, ref: "http://example.org/a", expected: "https://example.org/a"},
+		{start: "http://example.org/", sameScheme: true, ref: "https://example.org/a", expected: "http://example.org/a"},
+		{start: "https://example.org/", sameScheme: true, ref: "http://other.org/a", expected: "http://other.org/a"},
+		{start: "https://example.org/", sameScheme: true, ref: "ftp://example.org/a", expected: "ftp://example.org/a"},
+	}
+
+	for _, c := range cases {
+		sc := &Scraper{config: config.Config{SameScheme: c.sameScheme}, URL: mustParseURL(c.start), hsts: c.hsts}
+		ref := mustParseURL(c.ref)
+		sc.upgradeScheme(ref)
+		assert.Equal(t, c.expected, ref.String(), c.ref)
+	}
+}
+
+func TestHasHSTS(t *testing.T) {
+	cases := map[string]bool{
+		"":                                 false,
+		"max-age=31536000":                 true,
+		`max-age="600"; includeSubDomains`: true,
+		"includeSubDomains; Max-Age=60":    true,
+		"max-age=0":                        false,
+		"max-age=soon":                     false,
+	}
+
+	for value, expected := range cases {
+		hdr := http.Header{}
+		hdr.Set("Strict-Transport-Security", value)
+		assert.Equal(t, expected, hasHSTS(hdr), value)
+	}
+}
@@ -2,26 +2,37 @@ package scraper
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	urlpkg "net/url"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/cornelk/goscrape/blocklist"
 	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/corpus"
+	"github.com/cornelk/goscrape/crawllog"
 	"github.com/cornelk/goscrape/db"
+	"github.com/cornelk/goscrape/document"
 	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/download/ioutil"
 	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/cornelk/goscrape/download/wayback"
 	"github.com/cornelk/goscrape/filter"
+	"github.com/cornelk/goscrape/images"
 	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/manifest"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/pagination"
+	"github.com/cornelk/goscrape/plugins"
+	"github.com/cornelk/goscrape/stats"
 	"github.com/cornelk/goscrape/utc"
 	"github.com/cornelk/goscrape/work"
 	"github.com/rickb777/process/v2"
 	"github.com/spf13/afero"
-	"golang.org/x/net/proxy"
 )
 
 // Scraper contains all scraping data, starts the process and handles the concurrency.
@@ -31,25 +42,118 @@ type Scraper struct {
 	cookies *cookiejar.Jar
 	URL     *urlpkg.URL // contains the main URL to parse, will be modified in case of a redirect
 
-	auth   string
+	auth   *download.Authenticator
 	Client download.HttpClient
 	Fs     afero.Fs // filesystem
 
 	includes filter.Filter
 	excludes filter.Filter
+	types    filter.Types
+	rules    filter.Rules
+	plugins  plugins.Plugins
+	prune    *document.Selector
+	headers  []download.HeaderRule
+	accept   []download.AcceptRule
+
+	// probeHTTPS is set when the start URL should be upgraded to https:// if possible;
+	// hsts is set when the website requires https://
+	probeHTTPS bool
+	hsts       bool
+
+	// crawlDelay is the Crawl-delay of the website's robots.txt, with CrawlDelay
+	crawlDelay time.Duration
+
+	// logs in and keeps the login session alive; it is optional
+	session *session
+
+	// pages listed by the pagination patterns, relative to the start URL
+	pages []string
+
+	// limits the images re-encoded at once
+	recoder *images.Recoder
+
+	// flushes files to disk and writes them in the background
+	writer *ioutil.Writer
 
 	// key is the URL of page or asset
 	processed *work.Set[string]
 
+	// the pages that were permanently redirected, keyed by their original URLs
+	aliases *work.Aliases
+
+	// items that have been queued but whose results have not yet arrived
+	pending pendingItems
+
+	// the URLs found when listing URLs instead of storing files
+	inventory Inventory
+
+	// the rates at which items are queued and completed
+	progress progress
+
+	// lets an operator pause, slow down or skip the scrape
+	control *control
+
+	// the URLs added while the scrape runs
+	submissions submissions
+
+	// the hosts that are down for maintenance
+	maintenance maintenance
+
+	// the renewals of expired credentials
+	renewals renewals
+
+	// items that were abandoned after using all their attempts
+	exhausted   []work.Result
+	exhaustedMu sync.Mutex
+
 	// ETagsDB stores ETags (hashes of file state) for each URL
 	ETagsDB *db.DB
+
+	// Reauthenticate renews expired credentials, e.g. by refreshing a token, when a 401
+	// or 403 response is received. By default, the login form is posted again if there
+	// is one. It is optional
+	Reauthenticate download.Reauthenticator
+
+	// Middleware is appended to the built-in HTTP middleware chain
+	Middleware []download.Middleware
+
+	// Recorder is the outermost HTTP middleware, e.g. for recording every response
+	// into a cassette; it is optional
+	Recorder download.Middleware
+
+	// Histogram accumulates the response status codes
+	Histogram download.Histogram
+
+	// Stats accumulates the crawl statistics; it is optional
+	Stats *stats.Aggregator
+
+	// Manifest records the hash of every stored file; it is optional
+	Manifest *manifest.Manifest
+
+	// Corpus receives the plain text of every stored page; it is optional
+	Corpus *corpus.Corpus
+
+	// CrawlLog receives a record of every fetch; it is optional
+	CrawlLog *crawllog.Log
+
+	// Blocklist lists the hosts and URLs not to download from, and may change while the
+	// scrape is running; it is optional
+	Blocklist *blocklist.List
+
+	// OnResult receives every completed result, in the order they complete, so that an
+	// embedding application can index the mirror as it grows. It is called from a single
+	// goroutine, so it must not block for long; it is optional
+	OnResult func(work.Result)
+
+	// Logger receives the log of this scraper, separately from any other
+	Logger *logger.Logger
 }
 
 //-------------------------------------------------------------------------------------------------
 
-// New creates a new Scraper instance.
+// New creates a new Scraper instance that writes its log to log.
 // nolint: funlen
-func New(cfg config.Config, url *urlpkg.URL, fs afero.Fs) (*Scraper, error) {
+func New(cfg config.Config, url *urlpkg.URL, fs afero.Fs, log *logger.Logger) (*Scraper, error) {
 	var errs []error
 
 	url.Fragment = ""
@@ -64,43 +168,102 @@ func New(cfg config.Config, url *urlpkg.URL, fs afero.Fs) (*Scraper, error) {
 		errs = append(errs, err)
 	}
 
-	proxyURL, err := urlpkg.Parse(cfg.Proxy)
+	types, err := filter.NewTypes(cfg.IncludeTypes, cfg.ExcludeTypes)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rules, err := filter.NewRules(cfg.FetchIf, cfg.FollowIf, cfg.StoreIf)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	extensions, err := plugins.Load(cfg.Plugins)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := urlpkg.Parse(cfg.Proxy); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Wayback != "" {
+		if err := wayback.ValidateTimestamp(cfg.Wayback); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	session, err := newSession(cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	prune, err := document.ParseSelectors(cfg.Prune)
 	if err != nil {
 		errs = append(errs, err)
 	}
 
+	var pages []string
+	for _, pattern := range cfg.Pagination {
+		expanded, err := pagination.Expand(pattern)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		pages = append(pages, expanded...)
+	}
+
 	if errs != nil {
 		return nil, errors.Join(errs...)
 	}
 
+	var local *localTree
+	if url.Scheme == "file" {
+		if local, url, err = newLocalTree(url, cfg.Origin); err != nil {
+			return nil, err
+		}
+	}
+
+	probeHTTPS := cfg.UpgradeHTTPS && url.Scheme == "http" && local == nil
 	if url.Scheme == "" {
-		url.Scheme = "http" // if no URL scheme was given default to http
+		if url.Host == "" {
+			// e.g. example.org/path is parsed as a path without a host
+			if u, err := urlpkg.Parse("//" + url.String()); err == nil {
+				*url = *u
+			}
+		}
+		url.Scheme = "http" // if no URL scheme was given default to http, unless https works
+		probeHTTPS = true
 	}
+	mapping.WithoutDefaultPort(url)
 
 	cookies, err := createCookieJar(url, cfg.Cookies)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{
-		Jar:     cookies,
-		Timeout: cfg.Timeout,
+	headerRules, err := download.NewHeaderRules(cfg.HeaderRules, url.Host)
+	if err != nil {
+		return nil, err
 	}
 
-	if cfg.Proxy != "" {
-		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
-		if err != nil {
-			return nil, fmt.Errorf("creating proxy from URL: %w", err)
-		}
+	acceptRules, err := download.NewAcceptRules(cfg.AcceptRules)
+	if err != nil {
+		return nil, err
+	}
 
-		dialerCtx, ok := dialer.(proxy.ContextDialer)
-		if !ok {
-			return nil, errors.New("proxy dialer is not a context dialer")
-		}
+	transport, err := sharedTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-		client.Transport = &http.Transport{
-			DialContext: dialerCtx.DialContext,
-		}
+	client := &http.Client{
+		Transport: transport,
+		Jar:       cookies,
+		Timeout:   cfg.Timeout,
+	}
+	if local != nil {
+		local.next = transport
+		client.Transport = local
 	}
 
 	s := &Scraper{
@@ -113,13 +276,33 @@ func New(cfg config.Config, url *urlpkg.URL, fs afero.Fs) (*Scraper, error) {
 
 		includes: includes,
 		excludes: excludes,
+		types:    types,
+		rules:    rules,
+		plugins:  extensions,
+		prune:    prune,
+		headers:  headerRules,
+		accept:   acceptRules,
+		auth:     download.NewAuthenticator(cfg.Username, cfg.Password, cfg.HostCredentials),
+		session:  session,
+		pages:    pages,
+		recoder:  images.NewRecoder(cfg.ImageWorkers, cfg.ImageMemory, log),
+		writer:   newWriter(cfg, log),
+
+		probeHTTPS: probeHTTPS && cfg.Wayback == "",
 
 		processed: work.NewSet[string](),
+		control:   newControl(),
+		aliases:   work.NewAliases(),
+		Histogram: download.NewHistogram(),
+		Logger:    log,
 	}
 
-	if s.config.Username != "" {
-		s.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(s.config.Username+":"+s.config.Password))
+	client.CheckRedirect = redirectPolicy(cfg, url.Host, s.blocked, log)
+
+	if cfg.Wayback != "" {
+		s.Use(wayback.Middleware(cfg.Wayback))
 	}
+	s.Use(extensions.Middleware...)
 
 	return s, nil
 }
@@ -130,48 +313,109 @@ func (sc *Scraper) Downloader() *download.Download {
 	sc.config.SensibleDefaults()
 
 	return &download.Download{
-		Config:    sc.config,
-		Cookies:   sc.cookies,
-		ETagsDB:   sc.ETagsDB,
-		StartURL:  sc.URL,
-		Auth:      sc.auth,
-		Client:    sc.Client,
-		Fs:        afero.NewBasePathFs(sc.Fs, sc.URL.Host),
-		Lockdown:  throttle.New(0, 10*time.Second, 2*time.Second),
-		LoopDelay: throttle.New(sc.config.LoopDelay, time.Millisecond, time.Millisecond/2),
+		Config:         sc.config,
+		Cookies:        sc.cookies,
+		ETagsDB:        sc.ETagsDB,
+		StartURL:       sc.URL,
+		Authenticator:  sc.auth,
+		Reauthenticate: sc.reauthenticator(),
+		HeaderRules:    sc.headers,
+		AcceptRules:    sc.accept,
+		Aliases:        sc.aliases,
+		Client:         sc.Client,
+		Fs:             afero.NewBasePathFs(sc.Fs, mapping.HostDir(sc.URL.Host)),
+		Types:          sc.types,
+		Rules:          sc.rules,
+		Prune:          sc.prune,
+		Corpus:         sc.Corpus,
+		Recoder:        sc.recoder,
+		Writer:         sc.writer,
+		Lockdown:       throttle.New(0, 10*time.Second, 2*time.Second),
+		LoopDelay:      throttle.New(max(sc.config.LoopDelay, sc.crawlDelay), time.Millisecond, time.Millisecond/2),
+		Adaptive:       throttle.NewAdaptive(sc.config.MinDelay, sc.config.MaxDelay),
+		Histogram:      sc.Histogram,
+
+		Recorder:       sc.Recorder,
+		Middleware:     sc.Middleware,
+		PostProcessors: sc.plugins.PostProcessors,
+		Logger:         sc.Logger,
 	}
 }
 
+// Use appends middleware to the HTTP request/response chain.
+func (sc *Scraper) Use(mw ...download.Middleware) {
+	sc.Middleware = append(sc.Middleware, mw...)
+}
+
 //-------------------------------------------------------------------------------------------------
 
-// Start starts the scraping.
+// Start starts the scraping. Before it returns, all the files have been written.
 func (sc *Scraper) Start(ctx context.Context) error {
 	d := sc.Downloader()
+	defer sc.closeWriter()
+
+	sc.park(sc.URL.Host, sc.ETagsDB.ParkedUntil(sc.URL.Host)) // as found by an earlier run
+	if !sc.maintenance.wait(ctx, sc.URL.Host) {
+		return ctx.Err()
+	}
+
+	if sc.probeHTTPS {
+		if err := sc.upgradeToHTTPS(ctx, d); err != nil {
+			return err
+		}
+		d = sc.Downloader() // for the upgraded start URL
+	}
+
+	if sc.config.CrawlDelay {
+		if err := sc.readCrawlDelay(ctx, d); err != nil {
+			return err
+		}
+		d = sc.Downloader() // with the crawl delay
+	}
+
+	if err := sc.session.start(ctx, d, sc.URL); err != nil {
+		return err
+	}
+
+	if err := d.StoreExternalStub(ctx); err != nil {
+		return err
+	}
 
 	firstItem := work.Item{URL: sc.URL}
 
-	if !sc.shouldURLBeDownloaded(firstItem.URL, 0) {
+	if !sc.shouldURLBeDownloaded(firstItem.URL, nil, 0) {
 		return errors.New("start page is excluded from downloading")
 	}
 
 	redirect, firstResult, err := d.ProcessURL(ctx, firstItem)
-	if err != nil {
+	if fatal(err) {
 		return err
 	}
 
-	if redirect != nil {
+	if redirect != nil && !sc.config.FixedStartURL {
 		sc.URL = redirect // sc.URL is not altered subsequently
 	}
 
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	sc.control.started(abort)
+	budget := newErrorBudget(sc.config)
+
 	// WorkQueue has unlimited buffering and so prevents deadlock
 	workQueueIn, workQueueOut := process.WorkQueue[work.Item](32)
 	results := make(chan work.Result, sc.config.Concurrency)
 
 	pool := process.NewGroup()
+	hostLimit := newHostSemaphores(sc.config.HostConcurrency)
+	processors := sc.startProcessors(ctx, d, results)
 
 	// Pool of processes to concurrently handle URL downloading.
 	pool.GoNE(sc.config.Concurrency, func(pid int) error {
 		for {
+			if !sc.control.wait(ctx) {
+				return nil // cancelled
+			}
+
 			if pid == 0 || d.Lockdown.IsNormal() {
 				select {
 				case <-ctx.Done():
@@ -181,17 +425,44 @@ func (sc *Scraper) Start(ctx context.Context) error {
 					if !open {
 						return nil // normal 'clean' termination
 					} else {
-						_, result, err := d.ProcessURL(ctx, item)
-						if err != nil {
+						if sc.blocked(item.URL) {
+							// the blocklist has changed since the item was queued
+							sc.Logger.Info("Blocked", slog.String("url", item.URL.String()))
+							if err := sendResult(ctx, &work.Result{Item: item}, results); err != nil {
+								return err
+							}
+							continue
+						}
+
+						if !sc.maintenance.wait(ctx, item.URL.Host) {
+							return nil // cancelled
+						}
+
+						if err := hostLimit.acquire(ctx, item.URL.Host); err != nil {
+							return nil // cancelled
+						}
+						fetched, err := d.Fetch(ctx, item)
+						hostLimit.release(item.URL.Host)
+						switch {
+						case errors.Is(err, download.ErrTimedOut):
+							if err := sendResult(ctx, timedOut(item, err, d.Logger), results); err != nil {
+								return err
+							}
+
+						case err != nil:
 							if !errors.Is(err, context.Canceled) {
-								logger.Error("Failed", slog.String("item", item.String()), slog.Any("error", err))
+								sc.Logger.Error("Failed", slog.String("item", item.String()), slog.Any("error", err))
 							}
 							return err
-						}
 
-						logResult(result)
+						case processors.accept(ctx, fetched):
+							// the processors will send the result
 
-						results <- *result
+						default:
+							if err := processResult(ctx, d, fetched, results); err != nil {
+								return err
+							}
+						}
 					}
 				}
 			} else {
@@ -205,17 +476,96 @@ func (sc *Scraper) Start(ctx context.Context) error {
 	// work done/remaining work to do. When it terminates, it closes the workQueueIn channel,
 	// causing all the pool goroutines to terminate.
 	go func() {
+		enqueue := func(item work.Item) {
+			sc.pending.add(item)
+			sc.progress.queued(utc.Now(), 1)
+			workQueueIn <- item
+		}
+
+		var retries []work.Item // with RetryAtEnd, the items to attempt in the next final pass
+
 		todo := 1 // first page references
-		for result := range results {
+		sc.progress.queued(utc.Now(), 1)
+		for _, item := range sc.seedItems() {
+			enqueue(item)
+			todo++
+		}
+		submitted := sc.submissions.open()
+		for {
+			var result work.Result
+			select {
+			case item := <-submitted:
+				enqueue(item)
+				todo++
+				continue
+			case result = <-results:
+			}
+
 			todo--
+			sc.pending.remove(result)
+			sc.progress.done(utc.Now())
+			if pr, growing := sc.progress.startedGrowing(utc.Now()); growing {
+				sc.Logger.Warn("The queue is growing faster than it is being completed; this may be a crawler trap or too broad a filter",
+					slog.String("url", sc.URL.String()), slog.Int("pending", pr.Pending),
+					slog.String("discovered", perSecond(pr.DiscoveryRate)), slog.String("completed", perSecond(pr.CompletionRate)))
+			}
+			result.LocalPath = storedPath(d.StartURL.Host, result)
+			sc.Stats.Add(result)
+			sc.recordFile(d.StartURL.Host, result)
+			sc.CrawlLog.Add(crawllog.NewRecord(result, result.LocalPath))
+			if sc.OnResult != nil {
+				sc.OnResult(result)
+			}
+			if err := budget.add(result); err != nil && ctx.Err() == nil {
+				sc.Logger.Error("Aborting", slog.String("url", sc.URL.String()), slog.Any("error", err))
+				abort(err) // the workers stop, leaving the rest of the queue pending
+			}
+			if len(result.Redirects) > 0 && sc.aliases.Lookup(result.Redirects[0]) != nil {
+				sc.processed.Add(sc.processedKey(result.Item.URL)) // the canonical page need not be fetched again
+			}
+			for _, again := range sc.session.keepAlive(ctx, d, sc.URL, result.Item) {
+				again.Queued = utc.Now()
+				enqueue(again)
+				todo++
+			}
+			parked := !result.ParkedUntil.IsZero()
+			if parked {
+				sc.park(result.Item.URL.Host, result.ParkedUntil)
+				parked = result.Item.Parked < sc.config.MaxAttempts // after that, waiting uses up attempts so the crawl still ends
+			}
+			requeued := result.Requeue && (parked || sc.withinRetryBudget(result))
+			if requeued && sc.config.RetryAtEnd && !parked {
+				again := result.Item.Requeue()
+				sc.pending.add(again)
+				retries = append(retries, again)
+			} else if requeued {
+				again := result.Item.Requeue()
+				if parked {
+					again.Attempt = result.Item.Attempt // waiting out maintenance does not use up an attempt
+					again.Parked++
+				}
+				again.Queued = utc.Now()
+				enqueue(again)
+				todo++
+			}
 			newDepth := result.Item.Depth + 1
 			sc.partitionResult(&result, newDepth)
-			logger.Debug("Partitioned", slog.Any("item", result.Item), slog.Any("include", result.References), slog.Any("exclude", result.Excluded))
+			if !requeued {
+				sc.listResult(&result, newDepth)
+			}
+			sc.Logger.Debug("Partitioned", slog.Any("item", result.Item), slog.Any("include", result.References), slog.Any("pagination", result.Pagination), slog.Any("exclude", result.Excluded))
+			for _, ref := range result.Pagination {
+				enqueue(work.Item{URL: ref, Referrer: result.Item.URL, Depth: result.Item.Depth, Queued: utc.Now()})
+			}
 			for _, ref := range result.References {
-				workQueueIn <- work.Item{URL: ref, Referrer: result.Item.URL, Depth: newDepth}
+				enqueue(work.Item{URL: ref, Referrer: result.Item.URL, Depth: newDepth, Queued: utc.Now()})
+			}
+			todo += len(result.Pagination) + len(result.References)
+			if todo == 0 && len(retries) > 0 {
+				todo = sc.retryPass(d, retries, enqueue)
+				retries = nil
 			}
-			todo += len(result.References)
-			if todo == 0 {
+			if todo == 0 && sc.submissions.tryClose() {
 				break
 			}
 		}
@@ -227,12 +577,105 @@ func (sc *Scraper) Start(ctx context.Context) error {
 
 	// all the pool processes are busy until this unblocks.
 	pool.Wait()
-	return pool.Err()
+	sc.submissions.close()
+	processors.close()
+
+	sc.Stats.AddThrottle("lockdown", d.Lockdown.Snapshot())
+	sc.Stats.AddThrottle("loopdelay", d.LoopDelay.Snapshot())
+	sc.Stats.AddThrottle("adaptive", d.Adaptive.Snapshot())
+
+	if cause := context.Cause(ctx); errors.Is(cause, ErrErrorBudget) || errors.Is(cause, ErrSkipped) {
+		return cause
+	}
+	return errors.Join(pool.Err(), processors.err())
+}
+
+// processResult processes a fetched response and sends its result.
+func processResult(ctx context.Context, d *download.Download, fetched *download.Fetched, results chan<- work.Result) error {
+	_, result, err := d.Process(ctx, fetched)
+	if errors.Is(err, download.ErrTimedOut) {
+		return sendResult(ctx, timedOut(fetched.Item, err, d.Logger), results)
+	} else if fatal(err) {
+		if !errors.Is(err, context.Canceled) {
+			d.Logger.Error("Failed", slog.String("item", fetched.Item.String()), slog.Any("error", err))
+		}
+		return err
+	}
+
+	logResult(result, d.Logger)
+	return sendResult(ctx, result, results)
+}
+
+// fatal reports whether an error from processing an item stops the scrape. This is
+// any error that comes without a result, and also download.ErrStorage, because
+// whatever prevented the file from being written, such as a full disk, would most
+// likely lose every later file too.
+func fatal(err error) bool {
+	var storageErr download.ErrStorage
+	return err != nil && (!download.Unstored(err) || errors.As(err, &storageErr))
+}
+
+// timedOut reports an item that took longer than the processing timeout. This is not
+// fatal; the crawl carries on without it.
+func timedOut(item work.Item, err error, log *logger.Logger) *work.Result {
+	log.Warn("Timed out", slog.String("item", item.String()), slog.Any("error", err))
+	return &work.Result{Item: item, TimedOut: true}
+}
+
+func sendResult(ctx context.Context, result *work.Result, results chan<- work.Result) error {
+	select {
+	case results <- *result:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 //-------------------------------------------------------------------------------------------------
 
-func logResult(result *work.Result) {
+// withinRetryBudget returns true if the result's item may be attempted again. Otherwise,
+// the result is retained in the list of exhausted items.
+func (sc *Scraper) withinRetryBudget(result work.Result) bool {
+	if result.Item.Attempt+1 < sc.config.MaxAttempts {
+		return true
+	}
+
+	sc.Logger.Warn("Abandoned after too many attempts",
+		slog.String("url", result.Item.URL.String()),
+		slog.Int("attempts", result.Item.Attempt+1),
+		slog.Int("code", result.StatusCode))
+
+	sc.exhaustedMu.Lock()
+	defer sc.exhaustedMu.Unlock()
+	sc.exhausted = append(sc.exhausted, result)
+	return false
+}
+
+// retryPass enqueues the items that were set aside for a final pass, once everything
+// else has been done. The lockdown throttle is reset so that the pass starts with a
+// fresh backoff rather than the one left over from the main crawl. It returns the
+// number of items enqueued.
+func (sc *Scraper) retryPass(d *download.Download, retries []work.Item, enqueue func(work.Item)) int {
+	sc.Logger.Info("Retrying", slog.Int("items", len(retries)))
+	d.Lockdown.Reset()
+
+	for _, item := range retries {
+		item.Queued = utc.Now()
+		enqueue(item)
+	}
+	return len(retries)
+}
+
+// Exhausted lists the items that were abandoned after using all their attempts.
+func (sc *Scraper) Exhausted() []work.Result {
+	sc.exhaustedMu.Lock()
+	defer sc.exhaustedMu.Unlock()
+	return slices.Clone(sc.exhausted)
+}
+
+//-------------------------------------------------------------------------------------------------
+
+func logResult(result *work.Result, log *logger.Logger) {
 	// using a func result so that it can be applied transparently to the major method call sites, above
 	var args = []any{
 		slog.String("url", result.Item.URL.String()),
@@ -249,7 +692,10 @@ func logResult(result *work.Result) {
 	if result.Gzip {
 		args = append(args, slog.String("enc", "gzip"))
 	}
-	logger.Log(chooseLevel(result.StatusCode), statusText(result.StatusCode), args...)
+	if len(result.Redirects) > 0 {
+		args = append(args, slog.String("via", result.Redirects.String()))
+	}
+	log.Log(chooseLevel(result.StatusCode), statusText(result.StatusCode), args...)
 }
 
 func timeTaken(before time.Time) string {
@@ -1,24 +1,36 @@
 package scraper
 
 import (
+	"bytes"
 	"context"
 	"net/http"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/cornelk/goscrape/blocklist"
 	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/manifest"
+	"github.com/cornelk/goscrape/stats"
 	"github.com/cornelk/goscrape/stubclient"
+	"github.com/cornelk/goscrape/work"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func newTestScraper(t *testing.T, startURL string, stub *stubclient.Client) *Scraper {
-	setup()
 	t.Helper()
 
 	cfg := config.Config{MaxDepth: 10}
-	sc, err := New(cfg, mustParseURL(startURL), afero.NewMemMapFs())
+	sc, err := New(cfg, mustParseURL(startURL), afero.NewMemMapFs(), testLogger())
 	require.NoError(t, err)
 	require.NotNil(t, sc)
 
@@ -111,3 +123,445 @@ func TestScraperAttributes(t *testing.T) {
 	slices.Sort(actualProcessed)
 	assert.Equal(t, expectedProcessed, actualProcessed)
 }
+
+func TestWithinRetryBudget(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	sc.config.MaxAttempts = 3
+
+	item := work.Item{URL: mustParseURL("https://example.org/busy.css"), Depth: 2}
+
+	assert.True(t, sc.withinRetryBudget(work.Result{Item: item, StatusCode: http.StatusTooManyRequests}))
+	item = item.Requeue()
+	assert.True(t, sc.withinRetryBudget(work.Result{Item: item, StatusCode: http.StatusTooManyRequests}))
+	item = item.Requeue()
+	assert.False(t, sc.withinRetryBudget(work.Result{Item: item, StatusCode: http.StatusServiceUnavailable}))
+
+	exhausted := sc.Exhausted()
+	require.Len(t, exhausted, 1)
+	assert.Equal(t, http.StatusServiceUnavailable, exhausted[0].StatusCode)
+	assert.Equal(t, 2, exhausted[0].Item.Attempt)
+	assert.Equal(t, 2, exhausted[0].Item.Depth)
+}
+
+func TestRetryPass(t *testing.T) {
+	sc := newTestScraper(t, "https://example.org/", &stubclient.Client{})
+	d := sc.Downloader()
+	d.Lockdown.SlowDown()
+
+	retries := []work.Item{
+		work.Item{URL: mustParseURL("https://example.org/a"), Depth: 1}.Requeue(),
+		work.Item{URL: mustParseURL("https://example.org/b.css"), Depth: 2}.Requeue(),
+	}
+
+	var enqueued []work.Item
+	n := sc.retryPass(d, retries, func(item work.Item) { enqueued = append(enqueued, item) })
+
+	assert.Equal(t, 2, n)
+	assert.True(t, d.Lockdown.IsNormal())
+	require.Len(t, enqueued, 2)
+	for i, item := range enqueued {
+		assert.Equal(t, retries[i].URL, item.URL)
+		assert.Equal(t, 1, item.Attempt)
+		assert.False(t, item.Queued.IsZero())
+	}
+}
+
+func TestScraperPagination(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page/1", "text/html", `<html><body><a href="/about">About</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page/2", "text/html", `<html><body><a href="/page/3">Next</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page/3", "text/html", `<html><body></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/about", "text/html", `<html><body></body></html>`)
+
+	cfg := config.Config{MaxDepth: 1, Pagination: []string{"/page/{1..3}"}}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	err = sc.Start(context.Background())
+	require.NoError(t, err)
+
+	actualProcessed := sc.processed.Slice()
+	slices.Sort(actualProcessed)
+	assert.Equal(t, []string{"/", "/about", "/page/1", "/page/2", "/page/3"}, actualProcessed)
+}
+
+func TestScraperSeeds(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/deep/page", "text/html", `<html><body><a href="/about">About</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/about", "text/html", `<html><body></body></html>`)
+
+	cfg := config.Config{
+		MaxDepth: 1,
+		Seeds:    []string{"https://example.org/deep/page", "/private/x", "https://elsewhere.org/"},
+		Excludes: []string{"/private"},
+	}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	err = sc.Start(context.Background())
+	require.NoError(t, err)
+
+	// the excluded seed and the seed on another host are not fetched
+	actualProcessed := sc.processed.Slice()
+	slices.Sort(actualProcessed)
+	assert.Equal(t, []string{"/", "/about", "/deep/page", "/private/x", "https://elsewhere.org/"}, actualProcessed)
+}
+
+func TestScrapersLogSeparately(t *testing.T) {
+	scrape := func(startURL, link string) (*logger.Logger, *bytes.Buffer) {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(http.StatusOK, startURL, "text/html", `<html><body><a href="`+link+`">Page</a></body></html>`)
+		stub.GivenResponse(http.StatusOK, startURL+"page", "text/html", `<html><body></body></html>`)
+
+		buf := &bytes.Buffer{}
+		log := logger.Create(buf, nil)
+		log.FailOnWarn = true
+
+		sc, err := New(config.Config{MaxDepth: 1, MaxQueryParams: 1}, mustParseURL(startURL), afero.NewMemMapFs(), log)
+		require.NoError(t, err)
+		sc.Client = stub
+		require.NoError(t, sc.Start(context.Background()))
+		return log, buf
+	}
+
+	var wg sync.WaitGroup
+	var logA, logB *logger.Logger
+	var bufA, bufB *bytes.Buffer
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		logA, bufA = scrape("https://example.org/", "/page?a=1&b=2") // rejected, with a warning
+	}()
+	go func() {
+		defer wg.Done()
+		logB, bufB = scrape("https://example.com/", "/page")
+	}()
+	wg.Wait()
+
+	assert.Contains(t, bufA.String(), "Rejecting URL")
+	assert.NotContains(t, bufA.String(), "example.com")
+	assert.NotContains(t, bufB.String(), "example.org")
+
+	// only the scrape that had the warning counts it
+	assert.Equal(t, logger.ExitErrors, logA.ExitCode())
+	assert.Equal(t, logger.ExitOK, logB.ExitCode())
+}
+
+func TestNewWithBadPagination(t *testing.T) {
+	_, err := New(config.Config{Pagination: []string{"/page/{1..x}"}}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.Error(t, err)
+}
+
+func TestNewWithBadWayback(t *testing.T) {
+	_, err := New(config.Config{Wayback: "2019-06"}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.Error(t, err)
+}
+
+func TestScraperFollowNext(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<html><body><a href="/list/1">List</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/list/1", "text/html", `<html><body><a rel="next" href="/list/2">Next</a><a href="/item/1">Item</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/list/2", "text/html", `<html><head><link rel="next" href="/list/3"></head><body><a href="/item/2">Item</a></body></html>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/list/3", "text/html", `<html><body></body></html>`)
+
+	cfg := config.Config{MaxDepth: 1, FollowNext: true}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	err = sc.Start(context.Background())
+	require.NoError(t, err)
+
+	// the whole list is fetched at depth 1, but the items are beyond the depth limit
+	for file, expected := range map[string]bool{
+		"example.org/list/1.html": true,
+		"example.org/list/2.html": true,
+		"example.org/list/3.html": true,
+		"example.org/item/1.html": false,
+		"example.org/item/2.html": false,
+	} {
+		exists, _ := afero.Exists(sc.Fs, file)
+		assert.Equal(t, expected, exists, file)
+	}
+}
+
+func TestScraperProcessors(t *testing.T) {
+	indexPage := `<html><head><link href="/style.css" rel="stylesheet"></head>
+<body><a href="/page1">1</a> <a href="/page2">2</a> <a href="/file.pdf">PDF</a></body></html>`
+	page := `<html><body><a href="/">Home</a> <img src="/logo.png"></body></html>`
+
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", indexPage)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page1", "text/html", page)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page2", "text/html", page)
+	stub.GivenResponse(http.StatusOK, "https://example.org/style.css", "text/css", `body { background: url(/logo.png) }`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+	stub.GivenResponse(http.StatusOK, "https://example.org/file.pdf", "application/pdf", "pdf")
+
+	sc, err := New(config.Config{MaxDepth: 10, Concurrency: 3, ProcessConcurrency: 2, ProcessQueue: 1}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Stats = stats.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	for _, name := range []string{"index.html", "page1.html", "page2.html", "style.css", "logo.png", "file.pdf"} {
+		exists, _ := afero.Exists(sc.Fs, "example.org/"+name)
+		assert.True(t, exists, name)
+	}
+
+	s := sc.Stats.Summary(nil)
+	assert.Equal(t, 3, s.Pages)
+	assert.Equal(t, 3, s.Assets)
+}
+
+func TestScraperWriteBehind(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a> <a href="/b">b</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `<img src="/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/b", "text/html", `b`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+
+	cfg := config.Config{Concurrency: 2, Fsync: config.FsyncPeriodic, WriteBehind: 1}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	// all the files have been written when Start returns
+	for _, name := range []string{"index.html", "a.html", "b.html", "logo.png"} {
+		exists, _ := afero.Exists(sc.Fs, "example.org/"+name)
+		assert.True(t, exists, name)
+	}
+}
+
+func TestScraperManifest(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a> <img src="/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `a`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+
+	sc := newTestScraper(t, "https://example.org/", stub)
+	sc.Manifest = manifest.New()
+	sc.Manifest.Add("example.org/old.html", "0")
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, []string{"example.org/a.html", "example.org/index.html", "example.org/logo.png", "example.org/old.html"}, sc.Manifest.Files())
+	missing, changed, err := sc.Manifest.Verify(sc.Fs, ".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.org/old.html"}, missing)
+	assert.Empty(t, changed)
+}
+
+func TestScraperRules(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a> <a href="/b?sort=1">b</a> <a href="/doc.pdf">doc</a> <img src="/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `a`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/b?sort=1", "text/html", `<a href="/c">c</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+
+	cfg := config.Config{
+		MaxDepth: 10,
+		FetchIf:  `!path.endsWith(".pdf")`,
+		FollowIf: `!query.contains("sort=")`,
+		StoreIf:  `type != "image/png"`,
+	}
+	sc, err := New(cfg, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Manifest = manifest.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	processed := sc.processed.Slice()
+	slices.Sort(processed)
+	assert.Equal(t, []string{"/", "/a", "/b?sort=1", "/doc.pdf", "/logo.png"}, processed)
+	assert.Equal(t, []string{"example.org/a.html", "example.org/b_sort=1.html", "example.org/index.html"}, sc.Manifest.Files())
+}
+
+func TestScraperRefresh(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/docs/", "text/html", `<a href="/docs/a">a</a> <a href="/blog/">blog</a> <a href="/">home</a> <img src="/img/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/docs/a", "text/html", `<a href="/about">about</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/img/logo.png", "image/png", "png")
+
+	cfg := config.Config{MaxDepth: 10, Refresh: "https://example.org/docs/"}
+	sc, err := New(cfg, mustParseURL("https://example.org/docs/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Manifest = manifest.New()
+	sc.Manifest.Add("example.org/index.html", "h1")
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, []string{"example.org/docs/a.html", "example.org/docs/index.html", "example.org/img/logo.png", "example.org/index.html"}, sc.Manifest.Files())
+}
+
+func TestScraperRefetch(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/docs/", "text/html", `<a href="/docs/a">a</a> <img src="/img/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/img/logo.png", "image/png", "png")
+
+	cfg := config.Config{MaxDepth: 10, Refetch: true}
+	sc, err := New(cfg, mustParseURL("https://example.org/docs/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Manifest = manifest.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, []string{"example.org/docs/index.html", "example.org/img/logo.png"}, sc.Manifest.Files())
+}
+
+func TestScraperBlocklist(t *testing.T) {
+	stub := &stubclient.Client{} // it would panic if /calendar/ or /a were fetched
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/calendar/2024">cal</a> <a href="/a">a</a> <img src="/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(file, []byte("example.org/calendar/\n"), 0o644))
+	blocked, err := blocklist.Read(file)
+	require.NoError(t, err)
+
+	sc := newTestScraper(t, "https://example.org/", stub)
+	sc.Blocklist = blocked
+	sc.config.Concurrency = 1
+	sc.Pause() // so that the blocklist changes while /a is queued
+	go func() {
+		for !slices.ContainsFunc(sc.Pending(), func(q QueuedURL) bool { return q.URL == "https://example.org/a" }) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.NoError(t, os.WriteFile(file, []byte("example.org/calendar/\nexample.org/a\n"), 0o644))
+		assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+		_, err := blocked.Reload()
+		assert.NoError(t, err)
+		sc.Resume()
+	}()
+
+	require.NoError(t, sc.Start(context.Background()))
+	assert.Equal(t, 2, blocked.Len())
+}
+
+func TestNewWithBadRules(t *testing.T) {
+	_, err := New(config.Config{FollowIf: "depth <"}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.Error(t, err)
+}
+
+func TestScraperOnResult(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/a">a</a> <img src="/logo.png">`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/a", "text/html", `a`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/logo.png", "image/png", "png")
+
+	sc := newTestScraper(t, "https://example.org/", stub)
+	sc.Manifest = manifest.New()
+	results := make(map[string]work.Result)
+	sc.OnResult = func(result work.Result) {
+		results[result.LocalPath] = result
+	}
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	require.Len(t, results, 3)
+	for file, result := range results {
+		assert.Equal(t, sc.Manifest.Hash(file), result.Hash, file)
+		assert.False(t, result.StartTime.IsZero(), file)
+	}
+
+	logo := results["example.org/logo.png"]
+	assert.Equal(t, "image/png", logo.ContentType)
+	assert.Equal(t, int64(3), logo.FileSize)
+	assert.Equal(t, "text/html", results["example.org/a.html"].ContentType)
+}
+
+func TestScraperExternalStub(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="https://other.org/">other</a>`)
+
+	sc, err := New(config.Config{ExternalLinks: config.ExternalLinksStub}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+	sc.Client = stub
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	exists, _ := afero.Exists(sc.Fs, "example.org/_external.html")
+	assert.True(t, exists)
+	index, err := afero.ReadFile(sc.Fs, "example.org/index.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `href="_external.html#https:%2F%2Fother.org%2F"`)
+}
+
+func TestScraperSafeNames(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="/con.txt">a</a><a href="trail.">b</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/con.txt", "text/plain", "con")
+	stub.GivenResponse(http.StatusOK, "https://example.org/trail.", "text/plain", "trail")
+
+	sc := newTestScraper(t, "https://example.org/", stub)
+	require.NoError(t, sc.Start(context.Background()))
+
+	for _, name := range []string{"con_.txt", "trail%2E"} {
+		exists, _ := afero.Exists(sc.Fs, "example.org/"+name)
+		assert.True(t, exists, name)
+	}
+	index, err := afero.ReadFile(sc.Fs, "example.org/index.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `href="con_.txt"`)
+	assert.Contains(t, string(index), `href="trail%252E"`)
+}
+
+// fullFs fails to create the files whose names contain full, as though the disk
+// were full.
+type fullFs struct {
+	afero.Fs
+	full string
+}
+
+func (fs fullFs) Create(name string) (afero.File, error) {
+	if strings.Contains(name, fs.full) {
+		return nil, syscall.ENOSPC
+	}
+	return fs.Fs.Create(name)
+}
+
+func TestScraperStopsOnStorageError(t *testing.T) {
+	for _, full := range []string{"index", "page2"} {
+		stub := &stubclient.Client{}
+		stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="page2">a</a>`)
+		stub.GivenResponse(http.StatusOK, "https://example.org/page2", "text/html", `<a href="page3">a</a>`)
+		stub.GivenResponse(http.StatusOK, "https://example.org/page3", "text/html", `page 3`)
+
+		sc := newTestScraper(t, "https://example.org/", stub)
+		sc.Fs = fullFs{Fs: afero.NewMemMapFs(), full: full}
+
+		err := sc.Start(context.Background())
+		var storageErr download.ErrStorage
+		require.ErrorAs(t, err, &storageErr, full)
+		assert.ErrorIs(t, err, syscall.ENOSPC, full)
+		assert.NotContains(t, sc.processed.Slice(), "/page3", full)
+	}
+}
+
+func TestScraperCleanExitWithFailOnWarn(t *testing.T) {
+	stub := &stubclient.Client{}
+	stub.GivenResponse(http.StatusOK, "https://example.org/", "text/html", `<a href="page2">a</a>`)
+	stub.GivenResponse(http.StatusOK, "https://example.org/page2", "text/html", `page 2`)
+
+	log := testLogger()
+	log.FailOnWarn = true
+	sc, err := New(config.Config{}, mustParseURL("https://example.org/"), afero.NewMemMapFs(), log)
+	require.NoError(t, err)
+	sc.Client = stub
+	sc.Stats = stats.New()
+
+	require.NoError(t, sc.Start(context.Background()))
+	sc.Stats.Summary(map[int]int{http.StatusOK: 2}).Log(log)
+
+	assert.Equal(t, logger.ExitOK, log.ExitCode())
+}
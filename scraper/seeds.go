@@ -0,0 +1,21 @@
+package scraper
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReadSeeds reads a list of seed URLs, one per line. Blank lines and comment lines,
+// which start with '#', are ignored.
+func ReadSeeds(r io.Reader) ([]string, error) {
+	var seeds []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			seeds = append(seeds, line)
+		}
+	}
+	return seeds, scanner.Err()
+}
@@ -0,0 +1,22 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSeeds(t *testing.T) {
+	input := `# exported from analytics
+https://example.org/a
+
+  /b  
+#/c
+https://example.org/d#section
+`
+	seeds, err := ReadSeeds(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.org/a", "/b", "https://example.org/d#section"}, seeds)
+}
@@ -0,0 +1,169 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	urlpkg "net/url"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// session keeps a login session alive. The login form is posted before scraping.
+// Afterwards, the session check is made periodically; when it fails, the login is
+// repeated and the items processed since the last successful check are attempted
+// again, because they probably received the login page instead of their content.
+// A nil session does nothing.
+type session struct {
+	login    *urlpkg.URL // relative to the start URL
+	values   urlpkg.Values
+	check    *urlpkg.URL // relative to the start URL
+	status   int
+	contains []byte
+	interval time.Duration
+
+	next  time.Time   // when the next check is due
+	since []work.Item // the items processed since the last successful check
+}
+
+func newSession(cfg config.Config) (*session, error) {
+	if cfg.LoginURL == "" && cfg.SessionURL == "" {
+		return nil, nil
+	}
+
+	s := &session{
+		values:   cfg.LoginValues,
+		status:   cfg.SessionStatus,
+		contains: []byte(cfg.SessionContains),
+		interval: cfg.SessionInterval,
+	}
+
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	if s.interval <= 0 {
+		s.interval = config.DefaultSessionInterval
+	}
+
+	var err error
+	if cfg.LoginURL != "" {
+		if s.login, err = urlpkg.Parse(cfg.LoginURL); err != nil {
+			return nil, fmt.Errorf("login URL: %w", err)
+		}
+	}
+
+	if cfg.SessionURL != "" {
+		if s.check, err = urlpkg.Parse(cfg.SessionURL); err != nil {
+			return nil, fmt.Errorf("session URL: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// start logs in, if required, and then checks that the session is valid.
+func (s *session) start(ctx context.Context, d *download.Download, base *urlpkg.URL) error {
+	if s == nil {
+		return nil
+	}
+
+	if s.login != nil {
+		if err := s.logIn(ctx, d, base); err != nil {
+			return err
+		}
+	}
+
+	if s.check != nil && !s.isValid(ctx, d, base) {
+		return fmt.Errorf("login session is not valid according to %s", base.ResolveReference(s.check))
+	}
+
+	s.next = utc.Now().Add(s.interval)
+	return nil
+}
+
+// keepAlive records each processed item and checks the session when this is due. It
+// returns the items that must be attempted again because the session had expired.
+func (s *session) keepAlive(ctx context.Context, d *download.Download, base *urlpkg.URL, item work.Item) []work.Item {
+	if s == nil || s.check == nil {
+		return nil
+	}
+
+	s.since = append(s.since, item)
+	if utc.Now().Before(s.next) {
+		return nil
+	}
+
+	s.next = utc.Now().Add(s.interval)
+	if s.isValid(ctx, d, base) {
+		s.since = s.since[:0]
+		return nil
+	}
+
+	affected := s.since
+	s.since = nil
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	d.Logger.Warn("Login session has expired", slog.Int("affected", len(affected)))
+	if s.login == nil {
+		return nil
+	}
+
+	if err := s.renew(ctx, d, base); err != nil {
+		d.Logger.Error("Logging in again did not restore the session", slog.Any("error", err))
+		return nil
+	}
+
+	again := make([]work.Item, len(affected))
+	for i, it := range affected {
+		again[i] = it.Requeue()
+	}
+	return again
+}
+
+// renew logs in again and checks that this restored the session, if there is a check.
+func (s *session) renew(ctx context.Context, d *download.Download, base *urlpkg.URL) error {
+	if err := s.logIn(ctx, d, base); err != nil {
+		return err
+	}
+
+	if s.check != nil && !s.isValid(ctx, d, base) {
+		return fmt.Errorf("login session is not valid according to %s", base.ResolveReference(s.check))
+	}
+	return nil
+}
+
+func (s *session) logIn(ctx context.Context, d *download.Download, base *urlpkg.URL) error {
+	u := base.ResolveReference(s.login)
+	resp, _, err := d.PostForm(ctx, u, s.values)
+	if err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("logging in: %s returned %d %s", u, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	d.Logger.Info("Logged in", slog.String("url", u.String()))
+	return nil
+}
+
+func (s *session) isValid(ctx context.Context, d *download.Download, base *urlpkg.URL) bool {
+	u := base.ResolveReference(s.check)
+	resp, body, err := d.Probe(ctx, u)
+	if err != nil {
+		d.Logger.Warn("Session check failed", slog.String("url", u.String()), slog.Any("error", err))
+		return false
+	}
+
+	return resp.StatusCode == s.status && bytes.Contains(body, s.contains)
+}
@@ -0,0 +1,98 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScraperSession(t *testing.T) {
+	var mu sync.Mutex
+	sessions := map[string]bool{}
+	logins := 0
+	expired := false
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/login" {
+			if r.PostFormValue("user") != "alice" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			logins++
+			sid := fmt.Sprint(logins)
+			sessions[sid] = true
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: sid, Path: "/"})
+			return
+		}
+
+		if r.URL.Path == "/a" && !expired {
+			expired = true
+			clear(sessions)
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		cookie, err := r.Cookie("sid")
+		if err != nil || !sessions[cookie.Value] {
+			fmt.Fprint(w, "Please log in")
+			return
+		}
+
+		switch r.URL.Path {
+		case "/check":
+			fmt.Fprint(w, "Welcome")
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		case "/a":
+			fmt.Fprint(w, `Secret A <a href="/b">b</a>`)
+		default:
+			fmt.Fprint(w, "Secret B")
+		}
+	}))
+	defer origin.Close()
+
+	cfg := config.Config{
+		LoginURL:        "/login",
+		LoginValues:     url.Values{"user": {"alice"}},
+		SessionURL:      "/check",
+		SessionContains: "Welcome",
+		SessionInterval: time.Nanosecond,
+	}
+	sc, err := New(cfg, mustParseURL(origin.URL+"/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, sc.Start(context.Background()))
+
+	assert.Equal(t, 2, logins)
+	a, err := afero.ReadFile(sc.Fs, mapping.HostDir(sc.URL.Host)+"/a.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(a), "Secret A")
+	exists, _ := afero.Exists(sc.Fs, mapping.HostDir(sc.URL.Host)+"/b.html")
+	assert.True(t, exists)
+}
+
+func TestScraperSessionLoginFails(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer origin.Close()
+
+	cfg := config.Config{LoginURL: "/login", LoginValues: url.Values{"user": {"mallory"}}}
+	sc, err := New(cfg, mustParseURL(origin.URL+"/"), afero.NewMemMapFs(), testLogger())
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, sc.Start(context.Background()), "403")
+}
@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"log/slog"
+	urlpkg "net/url"
+	"sync"
+
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// submissionQueue is the capacity of the queue of submitted URLs. It only needs to
+// cover the time taken to handle a result.
+const submissionQueue = 64
+
+// submissions are the URLs added to a scrape while it runs, e.g. from a bookmarklet.
+type submissions struct {
+	mu    sync.Mutex
+	items chan work.Item // nil unless the scrape is running
+}
+
+// open starts accepting submissions.
+func (s *submissions) open() <-chan work.Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(chan work.Item, submissionQueue)
+	return s.items
+}
+
+// tryClose stops accepting submissions, unless some have arrived that are yet to be
+// received, in which case it returns false.
+func (s *submissions) tryClose() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) > 0 {
+		return false
+	}
+	s.items = nil
+	return true
+}
+
+// close stops accepting submissions, whether or not the scrape completed.
+func (s *submissions) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = nil
+}
+
+// Submit adds a URL to the scrape while it runs. Like a seed URL, it is at depth 0, so
+// its links are followed as far as the depth limit allows, subject to the usual
+// filters. It returns false if the URL was not added, because the scrape is not
+// running, the URL is not within the website or it has already been processed.
+func (sc *Scraper) Submit(u *urlpkg.URL) bool {
+	sc.submissions.mu.Lock()
+	defer sc.submissions.mu.Unlock()
+
+	if sc.submissions.items == nil || len(sc.submissions.items) == cap(sc.submissions.items) {
+		return false // not running, or too many submissions at once
+	}
+
+	u = sc.URL.ResolveReference(u)
+	u.Fragment = ""
+	if !sc.shouldURLBeDownloaded(u, nil, 0) {
+		return false
+	}
+
+	sc.submissions.items <- work.Item{URL: u, Queued: utc.Now()} // there is room, because only Submit sends
+	sc.Logger.Info("Submitted", slog.String("url", u.String()))
+	return true
+}
@@ -0,0 +1,77 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/work"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmit(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, `<html><body><a href="/linked.html">Linked</a></body></html>`)
+	}))
+	defer origin.Close()
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{MaxDepth: 10}, mustParseURL(origin.URL), fs, testLogger())
+	require.NoError(t, err)
+
+	assert.False(t, sc.Submit(mustParseURL(origin.URL+"/early.html")), "not running yet")
+
+	var submitted []bool
+	sc.OnResult = func(result work.Result) {
+		if len(submitted) == 0 {
+			submitted = append(submitted,
+				sc.Submit(mustParseURL(origin.URL+"/extra.html#top")),
+				sc.Submit(mustParseURL(origin.URL+"/extra.html")),
+				sc.Submit(mustParseURL("http://elsewhere.example/page.html")))
+		}
+	}
+
+	require.NoError(t, sc.Start(context.Background()))
+	assert.Equal(t, []bool{true, false, false}, submitted, "the second is a duplicate and the third is on another host")
+	assert.False(t, sc.Submit(mustParseURL(origin.URL+"/late.html")), "no longer running")
+
+	dir := mapping.HostDir(sc.URL.Host)
+	for _, file := range []string{"index.html", "linked.html", "extra.html"} {
+		exists, err := afero.Exists(fs, filepath.Join(dir, file))
+		require.NoError(t, err)
+		assert.True(t, exists, file)
+	}
+}
+
+func TestPageOnly(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logo.png" {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, "logo")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, `<html><body><img src="/logo.png"><a href="/other.html">Other</a></body></html>`)
+	}))
+	defer origin.Close()
+
+	fs := afero.NewMemMapFs()
+	sc, err := New(config.Config{PageOnly: true}, mustParseURL(origin.URL+"/page.html"), fs, testLogger())
+	require.NoError(t, err)
+	require.NoError(t, sc.Start(context.Background()))
+
+	dir := mapping.HostDir(sc.URL.Host)
+	for file, expected := range map[string]bool{"page.html": true, "logo.png": true, "other.html": false} {
+		exists, err := afero.Exists(fs, filepath.Join(dir, file))
+		require.NoError(t, err)
+		assert.Equal(t, expected, exists, file)
+	}
+}
@@ -0,0 +1,170 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/download/ftp"
+	"github.com/cornelk/goscrape/download/gemini"
+	"github.com/cornelk/goscrape/download/gopher"
+	"golang.org/x/net/proxy"
+)
+
+// transportSettings are the settings that distinguish one transport from another.
+type transportSettings struct {
+	proxy               string
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	tlsSessionCache     int
+	certPins            string // the pins, for comparison
+	connectTo           string // the rules, for comparison
+	smallWeb            bool
+}
+
+var (
+	transports   = map[transportSettings]*http.Transport{}
+	transportsMu sync.Mutex
+)
+
+// sharedTransport gets the HTTP transport for the configuration. Scrapers with the
+// same settings share one transport, and therefore its pool of idle connections and
+// its TLS session cache. A transport with a custom dialer is never shared.
+func sharedTransport(cfg config.Config) (*http.Transport, error) {
+	settings := transportSettings{
+		proxy:               cfg.Proxy,
+		maxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		idleConnTimeout:     cfg.IdleConnTimeout,
+		tlsSessionCache:     cfg.TLSSessionCache,
+		certPins:            fmt.Sprint(cfg.CertPins),
+		connectTo:           fmt.Sprint(cfg.ConnectTo),
+		smallWeb:            cfg.SmallWeb,
+	}
+
+	if settings.maxIdleConnsPerHost < 1 {
+		// enough for every worker to keep its connection to a single host
+		settings.maxIdleConnsPerHost = max(cfg.Concurrency, http.DefaultMaxIdleConnsPerHost)
+	}
+
+	if settings.tlsSessionCache == 0 {
+		settings.tlsSessionCache = config.DefaultTLSSessionCache
+	}
+
+	if cfg.Dial != nil {
+		return newTransport(settings, cfg)
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if t, exists := transports[settings]; exists {
+		return t, nil
+	}
+
+	t, err := newTransport(settings, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transports[settings] = t
+	return t, nil
+}
+
+func newTransport(settings transportSettings, cfg config.Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	t.MaxIdleConnsPerHost = settings.maxIdleConnsPerHost
+	t.MaxIdleConns = max(t.MaxIdleConns, settings.maxIdleConnsPerHost)
+
+	if settings.idleConnTimeout > 0 {
+		t.IdleConnTimeout = settings.idleConnTimeout
+	}
+
+	if settings.tlsSessionCache > 0 {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(settings.tlsSessionCache)
+	}
+
+	if len(cfg.CertPins) > 0 {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.VerifyConnection = download.VerifyPins(cfg.CertPins)
+	}
+
+	if cfg.Dial != nil {
+		t.DialContext = cfg.Dial
+	}
+
+	if settings.proxy != "" {
+		proxyURL, err := urlpkg.Parse(settings.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL: %w", err)
+		}
+
+		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("creating proxy from URL: %w", err)
+		}
+
+		dialerCtx, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("proxy dialer is not a context dialer")
+		}
+
+		t.Proxy = nil // the dialer connects via the proxy
+		t.DialContext = dialerCtx.DialContext
+	}
+
+	if len(cfg.ConnectTo) > 0 {
+		t.DialContext = connectTo(cfg.ConnectTo, t.DialContext)
+	}
+
+	// ftp:// and ftps:// URLs are fetched using the same dialer and TLS settings
+	ftpTransport := &ftp.Transport{Dial: t.DialContext, TLSConfig: t.TLSClientConfig}
+	t.RegisterProtocol("ftp", ftpTransport)
+	t.RegisterProtocol("ftps", ftpTransport)
+
+	if settings.smallWeb {
+		geminiTransport := &gemini.Transport{Dial: t.DialContext}
+		if len(cfg.CertPins) > 0 {
+			geminiTransport.VerifyConnection = download.VerifyPins(cfg.CertPins)
+		}
+		t.RegisterProtocol("gemini", geminiTransport)
+		t.RegisterProtocol("gopher", &gopher.Transport{Dial: t.DialContext})
+	}
+
+	return t, nil
+}
+
+// connectTo wraps a dialer so that the connections for the hosts of the rules go to
+// their addresses instead. The first matching rule applies. Unix domain sockets are
+// connected to directly, even if dial uses a proxy.
+func connectTo(rules []config.ConnectRule, dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(address)
+		for _, rule := range rules {
+			if !strings.EqualFold(rule.Host, address) && !strings.EqualFold(rule.Host, host) {
+				continue
+			}
+
+			if path, isUnix := strings.CutPrefix(rule.Address, "unix:"); isUnix {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			}
+			return dial(ctx, network, rule.Address)
+		}
+		return dial(ctx, network, address)
+	}
+}
@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedTransport(t *testing.T) {
+	cfg := config.Config{Concurrency: 8, IdleConnTimeout: 45 * time.Second}
+
+	t1, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	t2, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	assert.Same(t, t1, t2)
+
+	assert.Equal(t, 8, t1.MaxIdleConnsPerHost)
+	assert.Equal(t, 45*time.Second, t1.IdleConnTimeout)
+	require.NotNil(t, t1.TLSClientConfig)
+	assert.NotNil(t, t1.TLSClientConfig.ClientSessionCache)
+
+	cfg.MaxIdleConnsPerHost = 3
+	cfg.TLSSessionCache = -1
+	t3, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t3)
+	assert.Equal(t, 3, t3.MaxIdleConnsPerHost)
+	assert.True(t, t3.TLSClientConfig == nil || t3.TLSClientConfig.ClientSessionCache == nil)
+}
+
+func TestConnectTo(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	})
+
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	unixServer := httptest.NewUnstartedServer(handler)
+	unixServer.Listener = listener
+	unixServer.Start()
+	defer unixServer.Close()
+
+	tcpServer := httptest.NewServer(handler)
+	defer tcpServer.Close()
+
+	cfg := config.Config{ConnectTo: []config.ConnectRule{
+		{Host: "app.example", Address: "unix:" + socket},
+		{Host: "api.example:8080", Address: tcpServer.Listener.Addr().String()},
+	}}
+	transport, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	for _, u := range []string{"http://app.example/", "http://api.example:8080/"} {
+		resp, err := client.Get(u)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimSuffix(strings.TrimPrefix(u, "http://"), "/"), string(body), "the Host header is unchanged")
+	}
+
+	cfg.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, tcpServer.Listener.Addr().String())
+	}
+	t1, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	t2, err := sharedTransport(cfg)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t2, "transports with custom dialers are not shared")
+
+	resp, err := (&http.Client{Transport: t1}).Get("http://other.example/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,40 @@
+package scraper
+
+import (
+	"log/slog"
+
+	"github.com/cornelk/goscrape/config"
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/logger"
+)
+
+// newWriter creates the file writer according to the fsync policy and write-behind
+// queue. It is nil if neither is configured, in which case files are simply written
+// synchronously.
+func newWriter(cfg config.Config, log *logger.Logger) *ioutil.Writer {
+	switch cfg.Fsync {
+	case config.FsyncFile:
+		return ioutil.NewWriter(true, 0, cfg.WriteBehind, log)
+
+	case config.FsyncPeriodic:
+		interval := cfg.FsyncInterval
+		if interval <= 0 {
+			interval = config.DefaultFsyncInterval
+		}
+		return ioutil.NewWriter(false, interval, cfg.WriteBehind, log)
+
+	default:
+		if cfg.WriteBehind < 1 {
+			return nil
+		}
+		return ioutil.NewWriter(false, 0, cfg.WriteBehind, log)
+	}
+}
+
+// closeWriter waits for any files being written in the background, then flushes
+// them according to the fsync policy.
+func (sc *Scraper) closeWriter() {
+	if err := sc.writer.Close(); err != nil {
+		sc.Logger.Error("Flushing files failed", slog.Any("error", err))
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/cornelk/goscrape/download"
 	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/mapping"
 	"github.com/cornelk/goscrape/scraper"
 	"github.com/cornelk/goscrape/work"
 	"github.com/gorilla/handlers"
@@ -18,9 +20,14 @@ import (
 )
 
 // set more mime types in the browser, this fixes .asp files not being
-// downloaded but handled as html.
+// downloaded but handled as html. The same goes for the other extensions
+// of dynamic pages, which are kept unless -pageext maps them.
 var mimeTypes = map[string]string{
-	".asp": "text/html; charset=utf-8",
+	".asp":  "text/html; charset=utf-8",
+	".aspx": "text/html; charset=utf-8",
+	".cgi":  "text/html; charset=utf-8",
+	".jsp":  "text/html; charset=utf-8",
+	".php":  "text/html; charset=utf-8",
 }
 
 type onDemand struct {
@@ -33,7 +40,7 @@ func (h *onDemand) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	d := h.sc.Downloader()
 	_, result, err := d.ProcessURL(r.Context(), work.Item{URL: url, Depth: 1})
 
-	if err != nil {
+	if err != nil && !download.Unstored(err) {
 		http.Error(w, "Bad gateway: "+err.Error(), http.StatusBadGateway)
 	} else if result.StatusCode == http.StatusNotFound {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
@@ -46,8 +53,8 @@ func (h *onDemand) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 //-------------------------------------------------------------------------------------------------
 
-func ServeDirectory(ctx context.Context, sc *scraper.Scraper, path string, port int16) error {
-	server, errChan, err := LaunchWebserver(sc, path, port)
+func ServeDirectory(ctx context.Context, sc *scraper.Scraper, path string, port int16, log *logger.Logger) error {
+	server, errChan, err := LaunchWebserver(sc, path, port, log)
 	if err != nil {
 		return err
 	}
@@ -55,13 +62,13 @@ func ServeDirectory(ctx context.Context, sc *scraper.Scraper, path string, port
 	return AwaitWebserver(ctx, server, errChan)
 }
 
-func LaunchWebserver(sc *scraper.Scraper, path string, port int16) (*http.Server, chan error, error) {
-	logger.Info("Serving directory",
+func LaunchWebserver(sc *scraper.Scraper, path string, port int16, log *logger.Logger) (*http.Server, chan error, error) {
+	log.Info("Serving directory",
 		slog.String("path", path),
 		slog.String("address", fmt.Sprintf("http://%s:%d", hostname(), port)))
 
 	handler := selectAssetServer(sc, path)
-	handler = sloghttp.NewWithConfig(logger.Logger, logger.HttpLogConfig())(handler)
+	handler = sloghttp.NewWithConfig(log.Slog(), logger.HttpLogConfig())(handler)
 	handler = handlers.RecoveryHandler()(handler)
 	server := newWebserver(port, handler)
 
@@ -109,7 +116,7 @@ func selectAssetServer(sc *scraper.Scraper, path string) http.Handler {
 }
 
 func assetHandlerWith404Handler(sc *scraper.Scraper) http.Handler {
-	fs := afero.NewBasePathFs(sc.Fs, sc.URL.Host)
+	fs := afero.NewBasePathFs(sc.Fs, mapping.HostDir(sc.URL.Host))
 	fileServer := servefiles.NewAssetHandlerFS(fs)
 	secondary := servefiles.NewAssetHandlerFS(fs) // secondary has default 404 handler
 	fileServer.NotFound = &onDemand{sc: sc, fileServer: secondary}
@@ -2,21 +2,17 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"github.com/cornelk/goscrape/config"
 	"github.com/cornelk/goscrape/logger"
 	"github.com/cornelk/goscrape/scraper"
 	"github.com/cornelk/goscrape/stubclient"
-	"github.com/rickb777/servefiles/v3"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
-	"sync"
 	"testing"
 	"time"
 )
@@ -29,25 +25,19 @@ func mustParseURL(s string) *url.URL {
 	return u
 }
 
-func setup() {
-	sync.OnceFunc(func() {
-		if testing.Verbose() {
-			opts := &slog.HandlerOptions{Level: slog.LevelWarn}
-			opts.Level = slog.LevelDebug
-			servefiles.Debugf = func(format string, v ...interface{}) { logger.Debug(fmt.Sprintf(format, v...)) }
-			logger.Logger = slog.New(slog.NewTextHandler(os.Stdout, opts))
-		} else {
-			logger.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
-		}
-	})
+// testLogger writes the debug log in verbose mode; otherwise it writes nothing.
+func testLogger() *logger.Logger {
+	if testing.Verbose() {
+		return logger.Create(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	return logger.Discard()
 }
 
 func newTestScraper(t *testing.T, startURL string, stub *stubclient.Client) *scraper.Scraper {
-	setup()
 	t.Helper()
 
 	cfg := config.Config{MaxDepth: 10}
-	sc, err := scraper.New(cfg, mustParseURL(startURL), afero.NewMemMapFs())
+	sc, err := scraper.New(cfg, mustParseURL(startURL), afero.NewMemMapFs(), testLogger())
 	require.NoError(t, err)
 	require.NotNil(t, sc)
 
@@ -63,7 +53,7 @@ func TestServeDirectory(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 
-	err := ServeDirectory(ctx, sc, "", 14141)
+	err := ServeDirectory(ctx, sc, "", 14141, sc.Logger)
 	require.NoError(t, err)
 }
 
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// snapshotSignal is nil because there is no suitable signal on this platform.
+var snapshotSignal os.Signal
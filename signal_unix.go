@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// snapshotSignal requests a snapshot of the queue, e.g. using "kill -USR1 <pid>".
+var snapshotSignal os.Signal = syscall.SIGUSR1
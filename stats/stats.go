@@ -0,0 +1,301 @@
+// Package stats aggregates the results of a crawl into a summary, which can be
+// logged and/or written as JSON.
+package stats
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/cornelk/goscrape/logger"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// numberOfSlowest is the number of slowest URLs reported.
+const numberOfSlowest = 10
+
+// maxRejected is the number of rejected URLs listed; all of them are counted.
+const maxRejected = 100
+
+type timing struct {
+	url      string
+	duration time.Duration
+}
+
+// Aggregator accumulates the results of one or more crawls. It is safe for concurrent use.
+type Aggregator struct {
+	started   time.Time
+	pages     int
+	assets    int
+	unchanged int
+	timedOut  []string
+	bytes     map[string]int64 // key is content type
+	timings   []timing
+	throttles map[string]throttle.Snapshot
+	rejected  []Rejection
+	reasons   map[string]int        // key is reason for rejection
+	delays    map[string]CrawlDelay // key is host
+	mu        sync.Mutex
+}
+
+// New returns a new Aggregator; the crawl duration is measured from now.
+func New() *Aggregator {
+	return &Aggregator{
+		started:   utc.Now(),
+		bytes:     make(map[string]int64),
+		throttles: make(map[string]throttle.Snapshot),
+		reasons:   make(map[string]int),
+		delays:    make(map[string]CrawlDelay),
+	}
+}
+
+// Add accumulates one result.
+func (a *Aggregator) Add(result work.Result) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case result.StatusCode == http.StatusOK && isPage(result.ContentType):
+		a.pages++
+	case result.StatusCode == http.StatusOK:
+		a.assets++
+	case result.StatusCode == http.StatusNotModified || result.StatusCode == http.StatusTeapot:
+		a.unchanged++
+	case result.TimedOut:
+		a.timedOut = append(a.timedOut, result.Item.URL.String())
+	}
+
+	if result.FileSize > 0 {
+		a.bytes[cmp.Or(result.ContentType, "unknown")] += result.FileSize
+	}
+
+	if result.Duration > 0 && result.StatusCode != http.StatusTeapot {
+		a.timings = append(a.timings, timing{url: result.Item.URL.String(), duration: result.Duration})
+	}
+}
+
+// AddThrottle accumulates the slow-down events of a named throttle.
+func (a *Aggregator) AddThrottle(name string, snapshot throttle.Snapshot) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	existing := a.throttles[name]
+	existing.SlowDowns += snapshot.SlowDowns
+	existing.Delay = max(existing.Delay, snapshot.Delay)
+	a.throttles[name] = existing
+}
+
+// AddRejected accumulates a URL that was not enqueued, with the reason why.
+func (a *Aggregator) AddRejected(url, reason string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.reasons[reason]++
+	if len(a.rejected) < maxRejected {
+		a.rejected = append(a.rejected, Rejection{URL: url, Reason: reason})
+	}
+}
+
+// SetCrawlDelay records the Crawl-delay that a host asked for in its robots.txt and
+// the delay between requests that is in effect as a result.
+func (a *Aggregator) SetCrawlDelay(host string, requested, effective time.Duration) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.delays[host] = CrawlDelay{Requested: requested, Effective: effective}
+}
+
+func isPage(contentType string) bool {
+	return contentType == "text/html" || contentType == "application/xhtml+xml"
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Timing gives the time taken to process a URL.
+type Timing struct {
+	URL      string        `json:"url"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Rejection gives a URL that was not enqueued, with the reason why.
+type Rejection struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// CrawlDelay gives the Crawl-delay that a host asked for and the delay between
+// requests that was in effect.
+type CrawlDelay struct {
+	Requested time.Duration `json:"requested"`
+	Effective time.Duration `json:"effective"`
+}
+
+// Summary is the overall statistics of a crawl.
+type Summary struct {
+	Duration      time.Duration                `json:"duration"`
+	Pages         int                          `json:"pages"`
+	Assets        int                          `json:"assets"`
+	Unchanged     int                          `json:"unchanged"`
+	TimedOut      []string                     `json:"timedOut,omitempty"`
+	Bytes         map[string]int64             `json:"bytes"`
+	StatusCodes   map[int]int                  `json:"statusCodes"`
+	Requests      int                          `json:"requests"`
+	MeanLatency   time.Duration                `json:"meanLatency"`
+	P50Latency    time.Duration                `json:"p50Latency"`
+	P90Latency    time.Duration                `json:"p90Latency"`
+	P99Latency    time.Duration                `json:"p99Latency"`
+	Slowest       []Timing                     `json:"slowest,omitempty"`
+	ThrottleStats map[string]throttle.Snapshot `json:"throttles,omitempty"`
+	Rejected      map[string]int               `json:"rejected,omitempty"`
+	RejectedURLs  []Rejection                  `json:"rejectedURLs,omitempty"`
+	CrawlDelays   map[string]CrawlDelay        `json:"crawlDelays,omitempty"`
+}
+
+// Summary gets the statistics so far. The histogram of status codes is supplied
+// by the caller.
+func (a *Aggregator) Summary(statusCodes map[int]int) Summary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := Summary{
+		Duration:      utc.Now().Sub(a.started).Round(time.Millisecond),
+		Pages:         a.pages,
+		Assets:        a.assets,
+		Unchanged:     a.unchanged,
+		TimedOut:      slices.Clone(a.timedOut),
+		Bytes:         maps.Clone(a.bytes),
+		StatusCodes:   statusCodes,
+		Requests:      len(a.timings),
+		ThrottleStats: maps.Clone(a.throttles),
+		RejectedURLs:  slices.Clone(a.rejected),
+	}
+
+	if len(a.reasons) > 0 {
+		s.Rejected = maps.Clone(a.reasons)
+	}
+
+	if len(a.delays) > 0 {
+		s.CrawlDelays = maps.Clone(a.delays)
+	}
+
+	if len(a.timings) == 0 {
+		return s
+	}
+
+	sorted := slices.Clone(a.timings)
+	slices.SortStableFunc(sorted, func(x, y timing) int { return cmp.Compare(y.duration, x.duration) })
+
+	var total time.Duration
+	for _, t := range sorted {
+		total += t.duration
+	}
+
+	s.MeanLatency = total / time.Duration(len(sorted))
+	s.P50Latency = percentile(sorted, 50)
+	s.P90Latency = percentile(sorted, 90)
+	s.P99Latency = percentile(sorted, 99)
+
+	for _, t := range sorted[:min(numberOfSlowest, len(sorted))] {
+		s.Slowest = append(s.Slowest, Timing{URL: t.url, Duration: t.duration})
+	}
+
+	return s
+}
+
+// percentile uses the nearest-rank method on timings sorted in descending order.
+func percentile(descending []timing, p int) time.Duration {
+	n := len(descending)
+	rank := (p*n + 99) / 100 // ceiling
+	return descending[n-rank].duration
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// Log writes the summary to the logger as a report, so that it is normally visible;
+// only the throttling, timeouts and rejections count as warnings.
+func (s Summary) Log(log *logger.Logger) {
+	log.Report("Summary",
+		slog.String("duration", s.Duration.String()),
+		slog.Int("pages", s.Pages),
+		slog.Int("assets", s.Assets),
+		slog.Int("unchanged", s.Unchanged),
+		slog.Int("requests", s.Requests))
+
+	if s.Requests > 0 {
+		log.Report("Latency",
+			slog.String("mean", s.MeanLatency.Round(time.Millisecond).String()),
+			slog.String("p50", s.P50Latency.Round(time.Millisecond).String()),
+			slog.String("p90", s.P90Latency.Round(time.Millisecond).String()),
+			slog.String("p99", s.P99Latency.Round(time.Millisecond).String()))
+	}
+
+	for _, ct := range slices.Sorted(maps.Keys(s.Bytes)) {
+		log.Report(fmt.Sprintf("%12d bytes %s", s.Bytes[ct], ct))
+	}
+
+	for _, t := range s.Slowest {
+		log.Info(fmt.Sprintf("%10s %s", t.Duration.Round(time.Millisecond), t.URL))
+	}
+
+	for _, host := range slices.Sorted(maps.Keys(s.CrawlDelays)) {
+		cd := s.CrawlDelays[host]
+		log.Report("Crawl delay",
+			slog.String("host", host),
+			slog.String("requested", cd.Requested.String()),
+			slog.String("effective", cd.Effective.String()))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.ThrottleStats)) {
+		if ts := s.ThrottleStats[name]; ts.SlowDowns > 0 {
+			log.Warn("Throttled", slog.String("throttle", name), slog.Int64("events", ts.SlowDowns))
+		}
+	}
+
+	if len(s.TimedOut) > 0 {
+		log.Warn("Timed out", slog.Int("urls", len(s.TimedOut)))
+	}
+
+	for _, u := range s.TimedOut {
+		log.Info("timed out " + u)
+	}
+
+	for _, reason := range slices.Sorted(maps.Keys(s.Rejected)) {
+		log.Warn("Rejected", slog.String("reason", reason), slog.Int("urls", s.Rejected[reason]))
+	}
+
+	for _, r := range s.RejectedURLs {
+		log.Info(fmt.Sprintf("rejected %s (%s)", r.URL, r.Reason))
+	}
+}
+
+// WriteJSON writes the summary as indented JSON.
+func (s Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
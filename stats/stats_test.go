@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cornelk/goscrape/download/throttle"
+	"github.com/cornelk/goscrape/work"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	a := New()
+
+	for i := 1; i <= 100; i++ {
+		u, _ := url.Parse(fmt.Sprintf("http://example.org/img%d.png", i))
+		a.Add(work.Result{Item: work.Item{URL: u}, StatusCode: http.StatusOK, ContentType: "image/png",
+			FileSize: 10, Duration: time.Duration(i) * time.Millisecond})
+	}
+
+	u, _ := url.Parse("http://example.org/")
+	a.Add(work.Result{Item: work.Item{URL: u}, StatusCode: http.StatusOK, ContentType: "text/html",
+		FileSize: 1000, Duration: time.Second})
+	a.Add(work.Result{Item: work.Item{URL: u}, StatusCode: http.StatusNotModified, Duration: time.Millisecond})
+	a.Add(work.Result{Item: work.Item{URL: u}, StatusCode: http.StatusTeapot})
+
+	a.AddThrottle("lockdown", throttle.Snapshot{SlowDowns: 2})
+	a.AddThrottle("lockdown", throttle.Snapshot{SlowDowns: 3})
+
+	s := a.Summary(map[int]int{200: 101, 304: 1})
+
+	assert.Equal(t, 1, s.Pages)
+	assert.Equal(t, 100, s.Assets)
+	assert.Equal(t, 2, s.Unchanged)
+	assert.Equal(t, map[string]int64{"image/png": 1000, "text/html": 1000}, s.Bytes)
+	assert.Equal(t, 102, s.Requests)
+	assert.Equal(t, 50*time.Millisecond, s.P50Latency)
+	assert.Equal(t, 91*time.Millisecond, s.P90Latency)
+	assert.Equal(t, 100*time.Millisecond, s.P99Latency)
+	require.Len(t, s.Slowest, 10)
+	assert.Equal(t, "http://example.org/", s.Slowest[0].URL)
+	assert.Equal(t, "http://example.org/img100.png", s.Slowest[1].URL)
+	assert.Equal(t, int64(5), s.ThrottleStats["lockdown"].SlowDowns)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.WriteJSON(buf))
+
+	var decoded Summary
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, s, decoded)
+}
+
+func TestRejected(t *testing.T) {
+	a := New()
+
+	for i := 1; i <= maxRejected+5; i++ {
+		a.AddRejected(fmt.Sprintf("http://example.org/?p=%d", i), "URL too long")
+	}
+	a.AddRejected("http://example.org/?a=1&b=2", "too many query parameters")
+
+	s := a.Summary(nil)
+
+	assert.Equal(t, map[string]int{"URL too long": maxRejected + 5, "too many query parameters": 1}, s.Rejected)
+	require.Len(t, s.RejectedURLs, maxRejected)
+	assert.Equal(t, Rejection{URL: "http://example.org/?p=1", Reason: "URL too long"}, s.RejectedURLs[0])
+
+	var nilAggregator *Aggregator
+	nilAggregator.AddRejected("http://example.org/", "ignored")
+}
+
+func TestCrawlDelays(t *testing.T) {
+	a := New()
+	assert.Nil(t, a.Summary(nil).CrawlDelays)
+
+	a.SetCrawlDelay("example.org", 2*time.Second, 3*time.Second)
+	s := a.Summary(nil)
+	assert.Equal(t, map[string]CrawlDelay{"example.org": {Requested: 2 * time.Second, Effective: 3 * time.Second}}, s.CrawlDelays)
+
+	var nilAggregator *Aggregator
+	nilAggregator.SetCrawlDelay("example.org", time.Second, time.Second)
+}
@@ -0,0 +1,181 @@
+// Package textdiff compares sequences of lines, giving the differences in the
+// unified format used by diff -u.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCells limits the memory used when comparing; larger changes are reported as
+// the removal of all the differing old lines and the addition of all the new ones.
+const maxCells = 1 << 22
+
+type opKind byte
+
+const (
+	same   opKind = ' '
+	remove opKind = '-'
+	insert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified gives the differences between a and b in unified format, with the given
+// number of lines of context around each change. It is blank if there are no differences.
+func Unified(oldName, newName string, a, b []string, context int) string {
+	ops := compare(a, b)
+
+	buf := &strings.Builder{}
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == same {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk until there is a long enough run of unchanged lines
+		from := max(start-context, 0)
+		end := start
+		for i, run := start, 0; i < len(ops); i++ {
+			if ops[i].kind == same {
+				run++
+				if run > 2*context {
+					break
+				}
+			} else {
+				run = 0
+				end = i + 1
+			}
+		}
+		to := min(end+context, len(ops))
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		writeHunk(buf, ops, from, to)
+		start = to
+	}
+	return buf.String()
+}
+
+func writeHunk(buf *strings.Builder, ops []op, from, to int) {
+	// line numbers are 1-based and count the lines before the hunk
+	aLine, bLine := 1, 1
+	for _, o := range ops[:from] {
+		if o.kind != insert {
+			aLine++
+		}
+		if o.kind != remove {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, o := range ops[from:to] {
+		if o.kind != insert {
+			aCount++
+		}
+		if o.kind != remove {
+			bCount++
+		}
+	}
+
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, o := range ops[from:to] {
+		buf.WriteByte(byte(o.kind))
+		buf.WriteString(o.line)
+		buf.WriteByte('\n')
+	}
+}
+
+// compare finds a shortest edit script from a to b, using the longest common
+// subsequence of the lines that differ.
+func compare(a, b []string) []op {
+	// common prefix and suffix are unchanged
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{same, line})
+	}
+
+	ops = append(ops, compareMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{same, line})
+	}
+	return ops
+}
+
+func compareMiddle(a, b []string) []op {
+	var ops []op
+	n, m := len(a), len(b)
+
+	if (n+1)*(m+1) > maxCells {
+		for _, line := range a {
+			ops = append(ops, op{remove, line})
+		}
+		for _, line := range b {
+			ops = append(ops, op{insert, line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{same, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{remove, a[i]})
+			i++
+		default:
+			ops = append(ops, op{insert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{remove, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{insert, b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,44 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l", " ")
+	b := strings.Split("a b X d e f g h i j k l m", " ")
+
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+ b
+-c
++X
+ d
+ e
+@@ -11,2 +11,3 @@
+ k
+ l
++m
+`
+	assert.Equal(t, expected, Unified("old", "new", a, b, 2))
+}
+
+func TestUnifiedNoChange(t *testing.T) {
+	a := []string{"a", "b"}
+	assert.Equal(t, "", Unified("old", "new", a, a, 3))
+}
+
+func TestUnifiedAllNew(t *testing.T) {
+	expected := `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`
+	assert.Equal(t, expected, Unified("old", "new", nil, []string{"a", "b"}, 3))
+}
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/rickb777/acceptable/headername"
+)
+
+// Webhook posts each change as JSON to the endpoint.
+func Webhook(client *http.Client, endpoint string) Notifier {
+	return func(ctx context.Context, change Change) error {
+		body, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set(headername.ContentType, "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s: %s", endpoint, resp.Status)
+		}
+		return nil
+	}
+}
+
+// Command runs a command for each change. The command line is split into words at
+// spaces; it is not interpreted by a shell. The change is described by the environment
+// variables GOSCRAPE_URL, GOSCRAPE_FILE, GOSCRAPE_OLD_HASH, GOSCRAPE_NEW_HASH and
+// GOSCRAPE_CHANGE.
+func Command(command string) Notifier {
+	args := strings.Fields(command)
+	return func(ctx context.Context, change Change) error {
+		if len(args) == 0 {
+			return nil
+		}
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = append(os.Environ(),
+			"GOSCRAPE_URL="+change.URL,
+			"GOSCRAPE_FILE="+change.File,
+			"GOSCRAPE_OLD_HASH="+change.OldHash,
+			"GOSCRAPE_NEW_HASH="+change.NewHash,
+			"GOSCRAPE_CHANGE="+strconv.FormatFloat(change.Amount, 'f', 3, 64),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
@@ -0,0 +1,45 @@
+package watch
+
+import (
+	"strings"
+
+	"github.com/cornelk/goscrape/document"
+)
+
+// words splits content into words. For HTML, only the text is used, i.e. not the
+// markup nor any scripts or styles.
+func words(data []byte, contentType string) []string {
+	if contentType != "text/html" && contentType != "application/xhtml+xml" {
+		return strings.Fields(string(data))
+	}
+
+	var result []string
+	for _, line := range document.TextLines(data) {
+		result = append(result, strings.Fields(line)...)
+	}
+	return result
+}
+
+// textChange estimates the proportion of the words that differ between a and b,
+// ignoring the order of the words. It is 0 for identical texts and 1 for texts that
+// have no words in common.
+func textChange(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, w := range a {
+		counts[w]++
+	}
+
+	common := 0
+	for _, w := range b {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+
+	return 1 - float64(2*common)/float64(len(a)+len(b))
+}
@@ -0,0 +1,153 @@
+// Package watch repeatedly checks a set of URLs and gives notifications when their
+// content changes. It uses the usual downloader, so each check is a conditional
+// request and changed content is stored as usual.
+package watch
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/download/ioutil"
+	"github.com/cornelk/goscrape/mapping"
+	"github.com/cornelk/goscrape/utc"
+	"github.com/cornelk/goscrape/work"
+)
+
+// Target is a URL to be watched, along with the downloader for its website.
+type Target struct {
+	URL      *url.URL
+	Download *download.Download
+}
+
+// Change describes a change of content that has been detected.
+type Change struct {
+	URL     string    `json:"url"`
+	File    string    `json:"file"`
+	Time    time.Time `json:"time"`
+	OldHash string    `json:"oldHash"`
+	NewHash string    `json:"newHash"`
+	Amount  float64   `json:"amount"` // the proportion of the text that changed, from 0 to 1
+}
+
+// Notifier is told about each change.
+type Notifier func(ctx context.Context, change Change) error
+
+// Watcher checks its targets repeatedly.
+type Watcher struct {
+	Targets   []Target
+	Interval  time.Duration // the time between successive checks of all the targets
+	Threshold float64       // the proportion of text that must change to give a notification; 0 for any change
+	Notify    []Notifier
+
+	state map[string]content
+}
+
+// content is the state of one target when it was last checked.
+type content struct {
+	hash string
+	text []string
+}
+
+// Run checks all the targets at each interval until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every target once.
+func (w *Watcher) CheckAll(ctx context.Context) {
+	if w.state == nil {
+		w.state = make(map[string]content)
+	}
+
+	for _, target := range w.Targets {
+		if ctx.Err() != nil {
+			return
+		}
+		w.check(ctx, target)
+	}
+}
+
+func (w *Watcher) check(ctx context.Context, target Target) {
+	d := target.Download
+	key := target.URL.String()
+
+	_, result, err := d.ProcessURL(ctx, work.Item{URL: target.URL})
+	if err != nil || result == nil {
+		return // already logged
+	}
+
+	previous, seen := w.state[key]
+	hash := result.Hash
+	if hash == "" {
+		hash = d.ETagsDB.Lookup(target.URL).Hash // not rewritten, so unchanged
+	}
+
+	if seen && hash == previous.hash {
+		d.Logger.Debug("Unchanged", slog.String("url", key), slog.Int("code", result.StatusCode))
+		return
+	}
+
+	filePath := storedFile(target.URL, result.ContentType)
+	current := content{hash: hash, text: readText(d, filePath, result.ContentType)}
+
+	if !seen || hash == "" {
+		w.state[key] = current // the first check only establishes the baseline
+		return
+	}
+
+	amount := textChange(previous.text, current.text)
+	if amount < w.Threshold {
+		// the text is retained so that small changes can accumulate
+		w.state[key] = content{hash: hash, text: previous.text}
+		d.Logger.Info("Changed below threshold", slog.String("url", key), slog.Float64("amount", amount))
+		return
+	}
+
+	w.state[key] = current
+
+	change := Change{
+		URL:     key,
+		File:    filePath,
+		Time:    utc.Now(),
+		OldHash: previous.hash,
+		NewHash: hash,
+		Amount:  amount,
+	}
+
+	d.Logger.Info("Changed", slog.String("url", key), slog.Float64("amount", amount))
+	for _, notify := range w.Notify {
+		if err := notify(ctx, change); err != nil {
+			d.Logger.Error("Notification failed", slog.String("url", key), slog.Any("error", err))
+		}
+	}
+}
+
+// storedFile gets the name of the file in which the content of a URL is stored,
+// relative to the website's directory.
+func storedFile(u *url.URL, contentType string) string {
+	isAPage := contentType == "text/html" || contentType == "application/xhtml+xml" ||
+		(contentType == "" && mapping.IsPageURL(u))
+	return mapping.GetFilePath(u, isAPage)
+}
+
+func readText(d *download.Download, filePath, contentType string) []string {
+	data, err := ioutil.ReadFile(d.Fs, filePath)
+	if err != nil {
+		return nil
+	}
+	return words(data, contentType)
+}
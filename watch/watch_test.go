@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cornelk/goscrape/download"
+	"github.com/cornelk/goscrape/stubclient"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	const page = "https://example.org/news/"
+	u, _ := url.Parse(page)
+
+	stub := &stubclient.Client{}
+	d := &download.Download{
+		Client:   stub,
+		StartURL: u,
+		Fs:       afero.NewMemMapFs(),
+	}
+
+	var changes []Change
+	w := &Watcher{
+		Targets:   []Target{{URL: u, Download: d}},
+		Threshold: 0.2,
+		Notify: []Notifier{func(ctx context.Context, change Change) error {
+			changes = append(changes, change)
+			return nil
+		}},
+	}
+
+	check := func(body string) {
+		stub.GivenResponse(http.StatusOK, page, "text/html", body)
+		w.CheckAll(context.Background())
+	}
+
+	check(`<html><body><p>one two three four five six seven eight nine ten</p></body></html>`)
+	assert.Empty(t, changes, "baseline")
+
+	check(`<html><body><p>one two three four five six seven eight nine ten</p></body></html>`)
+	assert.Empty(t, changes, "unchanged")
+
+	check(`<html><body><p class="x">one two three four five six seven eight nine TEN</p><script>var x</script></body></html>`)
+	assert.Empty(t, changes, "below the threshold")
+
+	check(`<html><body><p>one two three four five six seven ELEVEN TWELVE THIRTEEN</p></body></html>`)
+	require.Len(t, changes, 1)
+	assert.Equal(t, page, changes[0].URL)
+	assert.Equal(t, "./news/index.html", changes[0].File)
+	assert.InDelta(t, 0.3, changes[0].Amount, 0.01)
+	assert.NotEqual(t, changes[0].OldHash, changes[0].NewHash)
+}
+
+func TestTextChange(t *testing.T) {
+	assert.Equal(t, 0.0, textChange(nil, nil))
+	assert.Equal(t, 1.0, textChange([]string{"a"}, nil))
+	assert.Equal(t, 0.0, textChange([]string{"a", "b"}, []string{"b", "a"}))
+	assert.Equal(t, 0.5, textChange([]string{"a", "b"}, []string{"a", "c"}))
+}
+
+func TestWords(t *testing.T) {
+	html := []byte(`<html><head><style>p {}</style></head><body><p>Hello <b>world</b></p><script>x()</script></body></html>`)
+	assert.Equal(t, []string{"Hello", "world"}, words(html, "text/html"))
+	assert.Equal(t, []string{"<p>Hello", "world</p>"}, words([]byte("<p>Hello world</p>"), "text/plain"))
+}
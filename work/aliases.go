@@ -0,0 +1,68 @@
+package work
+
+import (
+	"net/url"
+	"sync"
+)
+
+// Aliases maps the URLs that were permanently redirected to the URLs they lead to.
+// It is safe for concurrent use; a nil Aliases is empty.
+type Aliases struct {
+	m  map[string]*url.URL
+	mu sync.RWMutex
+}
+
+// NewAliases returns an empty set of aliases.
+func NewAliases() *Aliases {
+	return &Aliases{m: make(map[string]*url.URL)}
+}
+
+// Add records that from is an alias of to. Their fragments are ignored.
+func (a *Aliases) Add(from, to *url.URL) {
+	if a == nil {
+		return
+	}
+
+	target := *to
+	target.Fragment = ""
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m[aliasKey(from)] = &target
+}
+
+// Lookup gets the URL that u is an alias of, keeping u's fragment. It returns nil
+// if u is not an alias.
+func (a *Aliases) Lookup(u *url.URL) *url.URL {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.RLock()
+	target, exists := a.m[aliasKey(u)]
+	a.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	canonical := *target
+	canonical.Fragment = u.Fragment
+	return &canonical
+}
+
+// Len gets the number of aliases.
+func (a *Aliases) Len() int {
+	if a == nil {
+		return 0
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.m)
+}
+
+func aliasKey(u *url.URL) string {
+	k := *u
+	k.Fragment = ""
+	return k.String()
+}
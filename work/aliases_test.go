@@ -0,0 +1,25 @@
+package work
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	a := NewAliases()
+	from, _ := url.Parse("https://example.org/old#x")
+	to, _ := url.Parse("https://example.org/new/#y")
+	a.Add(from, to)
+
+	other, _ := url.Parse("https://example.org/old#top")
+	assert.Equal(t, "https://example.org/new/#top", a.Lookup(other).String())
+	assert.Nil(t, a.Lookup(to))
+	assert.Equal(t, 1, a.Len())
+
+	var none *Aliases
+	none.Add(from, to)
+	assert.Nil(t, none.Lookup(from))
+	assert.Equal(t, 0, none.Len())
+}
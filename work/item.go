@@ -10,28 +10,65 @@ import (
 // Item is comparable
 type Item struct {
 	URL       *url.URL
+	Queued    time.Time // when the item was put into the work queue
 	StartTime time.Time
 	Referrer  *url.URL
 	Depth     int
+	Attempt   int    // the number of earlier attempts that were requeued
+	Parked    int    // the number of maintenance windows that the item has waited out
 	FilePath  string // returned when the item is processed
 }
 
 func (it Item) String() string {
+	if it.Attempt > 0 {
+		return fmt.Sprintf("%s (depth:%d attempt:%d)", it.URL.String(), it.Depth, it.Attempt+1)
+	}
 	return fmt.Sprintf("%s (depth:%d)", it.URL.String(), it.Depth)
 }
 
+// Requeue gets a copy of the item ready to be attempted again. Its depth is unchanged.
+func (it Item) Requeue() Item {
+	it.Attempt++
+	it.Queued = time.Time{}
+	it.StartTime = time.Time{}
+	it.FilePath = ""
+	return it
+}
+
 type Refs []*url.URL
 
 type Result struct {
 	Item
 	StatusCode    int
 	References    Refs
+	Pagination    Refs // pages that have the same depth as this item, e.g. next/previous pages and alternates
 	Excluded      Refs
+	ContentType   string        // the media type of a 200 response, without parameters
+	Duration      time.Duration // the time taken to process the item
+	Requeue       bool          // the item should be attempted again later
+	ParkedUntil   time.Time     // the end of the host's maintenance window, as announced by a 503 response; zero if none
+	TimedOut      bool          // the item took longer than the processing timeout, so nothing was stored
+	Redirects     Refs          // every hop followed before the final URL, if any
 	ContentLength int64
-	FileSize      int64
+	FileSize      int64     // the number of bytes written
+	Hash          string    // SHA-256 of the stored file, in hex; blank if no file was written
+	LocalPath     string    // the stored file, relative to the output directory with forward slashes; blank if none
+	Metadata      *Metadata // what the page says about itself; nil if it is not a page
+	Vary          string    // the request headers named by the Vary header, with their values; blank if none
 	Gzip          bool
 }
 
+// Metadata describes a page, as declared in its head. The dates are as given by the
+// page, which normally uses RFC 3339 format.
+type Metadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+	Published   string `json:"published,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+}
+
 func (refs Refs) String() string {
 	buf := &strings.Builder{}
 	spacer := ""